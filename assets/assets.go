@@ -0,0 +1,198 @@
+package assets
+
+import (
+	"backend-elearning/database"
+	"backend-elearning/models"
+	"backend-elearning/storage"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Uploads are stored once per content hash under assets/<first two hex
+// digits>/<hash><ext>, and every row that points at the file (a module PDF,
+// a block attachment) holds one reference on it.
+
+// URL is the value kept in Module.PDFUrl and similar columns.
+func URL(a *models.Asset) string {
+	return storage.URLFromKey(a.StorageKey)
+}
+
+// Store saves r and takes one reference on it. When identical content is
+// already stored, only the reference count of the existing asset goes up.
+func Store(ctx context.Context, r io.Reader, ext, contentType string) (*models.Asset, error) {
+	// Spool to a temp file first: the hash, and therefore the key, is only
+	// known once everything has been read.
+	tmp, err := os.CreateTemp("", "asset-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if err != nil {
+		return nil, err
+	}
+	hash := hex.EncodeToString(h.Sum(nil))
+
+	if asset, err := acquireHash(hash); err == nil {
+		return asset, nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	asset := models.Asset{
+		Hash:        hash,
+		StorageKey:  "assets/" + hash[:2] + "/" + hash + strings.ToLower(ext),
+		Size:        size,
+		ContentType: contentType,
+		RefCount:    1,
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if err := storage.Files.Put(ctx, asset.StorageKey, tmp, size, contentType); err != nil {
+		return nil, err
+	}
+
+	if err := database.DB.Create(&asset).Error; err != nil {
+		// Someone stored the same content concurrently; use theirs. The file
+		// we wrote has the same key and content, so it is not removed.
+		if existing, acqErr := acquireHash(hash); acqErr == nil {
+			return existing, nil
+		}
+		return nil, err
+	}
+	return &asset, nil
+}
+
+func acquireHash(hash string) (*models.Asset, error) {
+	var asset models.Asset
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("hash = ?", hash).First(&asset).Error; err != nil {
+			return err
+		}
+		asset.RefCount++
+		return tx.Model(&asset).Update("ref_count", asset.RefCount).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+// Acquire takes another reference on the file behind fileURL, e.g. when a
+// module is copied, and returns the URL the new reference should use.
+// Files uploaded before assets existed are adopted: an asset row is created
+// for them, counting the reference they already had. If identical content is
+// already stored as an asset, that asset is referenced instead.
+func Acquire(ctx context.Context, fileURL string) (string, error) {
+	key := storage.KeyFromURL(fileURL)
+	result := fileURL
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var asset models.Asset
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("storage_key = ?", key).First(&asset).Error
+		if err == nil {
+			return tx.Model(&asset).Update("ref_count", asset.RefCount+1).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		adopted, err := describe(ctx, key)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("hash = ?", adopted.Hash).First(&asset).Error
+		if err == nil {
+			result = URL(&asset)
+			return tx.Model(&asset).Update("ref_count", asset.RefCount+1).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		adopted.RefCount = 2
+		return tx.Create(adopted).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return result, nil
+}
+
+// Release drops one reference on the file behind fileURL and deletes the
+// file once nothing references it. Files uploaded before assets existed
+// belong to exactly one row and are deleted right away. Watermarked copies
+// of a deleted file go with it.
+func Release(ctx context.Context, fileURL string) error {
+	if fileURL == "" {
+		return nil
+	}
+	key := storage.KeyFromURL(fileURL)
+
+	deleted := false
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var asset models.Asset
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("storage_key = ?", key).First(&asset).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			deleted = true
+			return storage.Files.Delete(ctx, key)
+		}
+		if err != nil {
+			return err
+		}
+
+		if asset.RefCount > 1 {
+			return tx.Model(&asset).Update("ref_count", asset.RefCount-1).Error
+		}
+
+		// Delete the file while the row is still locked, so a concurrent
+		// Store of the same content waits and then writes it afresh.
+		if err := tx.Delete(&asset).Error; err != nil {
+			return err
+		}
+		deleted = true
+		return storage.Files.Delete(ctx, key)
+	})
+	if err != nil || !deleted {
+		return err
+	}
+	return purgeWatermarks(ctx, fileURL)
+}
+
+// describe hashes a stored file that has no asset row yet.
+func describe(ctx context.Context, key string) (*models.Asset, error) {
+	info, err := storage.Files.Stat(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := storage.Files.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, rc); err != nil {
+		return nil, err
+	}
+	return &models.Asset{
+		Hash:        hex.EncodeToString(h.Sum(nil)),
+		StorageKey:  key,
+		Size:        info.Size,
+		ContentType: info.ContentType,
+	}, nil
+}
@@ -0,0 +1,169 @@
+package assets
+
+import (
+	"backend-elearning/database"
+	"backend-elearning/models"
+	"backend-elearning/pdf"
+	"backend-elearning/storage"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// PDFRenderer is poppler's pdftoppm, used to render the first page of a
+// module PDF as its thumbnail. Without it modules still get their page
+// count and title, just no thumbnail.
+var PDFRenderer = "pdftoppm"
+
+// ThumbnailWidth is the width of module thumbnails in pixels.
+const ThumbnailWidth = 320
+
+const renderTimeout = 30 * time.Second
+
+var pdfInfoQueue = make(chan uint, 256)
+
+// QueuePDFInfo schedules ExtractPDFInfo for a module whose PDF changed. The
+// module should already be marked "pending"; if the process stops before
+// the job runs, StartPDFInfoWorker picks it up again.
+func QueuePDFInfo(moduleID uint) {
+	select {
+	case pdfInfoQueue <- moduleID:
+	default:
+		go func() { pdfInfoQueue <- moduleID }()
+	}
+}
+
+// StartPDFInfoWorker runs queued jobs one at a time, after queueing every
+// module that has a PDF but no extracted info yet.
+func StartPDFInfoWorker() {
+	go func() {
+		var ids []uint
+		database.DB.Model(&models.Module{}).
+			Where("pdf_url <> '' AND pdf_info_status IN ?", []string{"", "pending"}).
+			Pluck("id", &ids)
+		for _, id := range ids {
+			QueuePDFInfo(id)
+		}
+
+		for id := range pdfInfoQueue {
+			if err := ExtractPDFInfo(context.Background(), id); err != nil {
+				log.Printf("⚠️ Extracting PDF info for module %d failed: %v", id, err)
+			}
+		}
+	}()
+}
+
+// ExtractPDFInfo reads the page count, title and a first-page thumbnail of
+// the module's PDF and stores them on the module. A PDF that cannot be
+// parsed marks the module "failed".
+func ExtractPDFInfo(ctx context.Context, moduleID uint) error {
+	var module models.Module
+	if err := database.DB.First(&module, moduleID).Error; err != nil {
+		return err
+	}
+	if module.PDFUrl == "" {
+		return nil
+	}
+	source := module.PDFUrl
+
+	data, err := readFile(ctx, source)
+	if err != nil {
+		return err
+	}
+
+	doc, err := pdf.Open(data)
+	var pages []pdf.Page
+	if err == nil {
+		pages, err = doc.Pages()
+	}
+	if err != nil {
+		database.DB.Model(&models.Module{}).Where("id = ? AND pdf_url = ?", moduleID, source).
+			Update("pdf_info_status", "failed")
+		return err
+	}
+	title := doc.Title()
+	if len(title) > 255 {
+		title = title[:255]
+	}
+
+	thumbnail := ""
+	png, err := renderThumbnail(ctx, data)
+	if err != nil {
+		log.Printf("⚠️ No thumbnail for module %d: %v", moduleID, err)
+	} else if png != nil {
+		asset, err := Store(ctx, bytes.NewReader(png), ".png", "image/png")
+		if err != nil {
+			return err
+		}
+		thumbnail = URL(asset)
+	}
+
+	// Only apply the result if the PDF was not replaced in the meantime.
+	res := database.DB.Model(&models.Module{}).Where("id = ? AND pdf_url = ?", moduleID, source).
+		Updates(map[string]interface{}{
+			"page_count":      len(pages),
+			"pdf_title":       title,
+			"thumbnail_url":   thumbnail,
+			"pdf_info_status": "ready",
+		})
+	if res.Error != nil || res.RowsAffected == 0 {
+		_ = Release(ctx, thumbnail)
+		return res.Error
+	}
+	if module.ThumbnailUrl != "" {
+		_ = Release(ctx, module.ThumbnailUrl)
+	}
+
+	// Revisions recorded at upload time did not have these yet
+	return database.DB.Model(&models.ModuleRevision{}).
+		Where("module_id = ? AND pdf_url = ? AND page_count = 0", moduleID, source).
+		Updates(map[string]interface{}{"page_count": len(pages), "pdf_title": title}).Error
+}
+
+func readFile(ctx context.Context, fileURL string) ([]byte, error) {
+	rc, err := storage.Files.Get(ctx, storage.KeyFromURL(fileURL))
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(io.LimitReader(rc, MaxUploadSize+1))
+}
+
+// renderThumbnail returns the first page of data as a PNG, or nil when
+// PDFRenderer is not installed.
+func renderThumbnail(ctx context.Context, data []byte) ([]byte, error) {
+	bin, err := exec.LookPath(PDFRenderer)
+	if errors.Is(err, exec.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "thumbnail-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	in := filepath.Join(dir, "in.pdf")
+	if err := os.WriteFile(in, data, 0o600); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, renderTimeout)
+	defer cancel()
+	out := filepath.Join(dir, "page")
+	cmd := exec.CommandContext(ctx, bin, "-f", "1", "-l", "1", "-singlefile", "-png",
+		"-scale-to-x", fmt.Sprint(ThumbnailWidth), "-scale-to-y", "-1", in, out)
+	if msg, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%s: %v: %s", PDFRenderer, err, bytes.TrimSpace(msg))
+	}
+	return os.ReadFile(out + ".png")
+}
@@ -0,0 +1,229 @@
+package assets
+
+import (
+	"backend-elearning/database"
+	"backend-elearning/models"
+	"backend-elearning/storage"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// reference is a column holding stored-file URLs. Reconcile counts a file
+// as used only if one of these columns mentions it; new columns that point
+// at uploads must be added here.
+type reference struct {
+	kind   string
+	model  interface{}
+	column string
+	clear  map[string]interface{} // what a dangling reference is reset to
+}
+
+var references = []reference{
+	{"module", &models.Module{}, "pdf_url", map[string]interface{}{"pdf_url": "", "pdf_name": ""}},
+	{"module_thumbnail", &models.Module{}, "thumbnail_url", map[string]interface{}{"thumbnail_url": ""}},
+	{"content_block", &models.ContentBlock{}, "file_url", map[string]interface{}{"file_url": ""}},
+	{"module_revision", &models.ModuleRevision{}, "pdf_url", map[string]interface{}{"pdf_url": ""}},
+	{"watermark", &models.WatermarkedFile{}, "file_url", map[string]interface{}{"file_url": ""}},
+	{"assignment_submission", &models.AssignmentSubmission{}, "file_url", map[string]interface{}{"file_url": ""}},
+}
+
+// FileRef is one row pointing at a stored file.
+type FileRef struct {
+	Kind string `json:"kind"`
+	ID   uint   `json:"id"`
+	URL  string `json:"url"`
+}
+
+type OrphanFile struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+	Skipped      string    `json:"skipped,omitempty"` // why cleanup left it alone
+}
+
+type RefCountFix struct {
+	Key    string `json:"key"`
+	Stored int    `json:"stored"`
+	Actual int    `json:"actual"`
+}
+
+type ReconcileReport struct {
+	DryRun       bool          `json:"dry_run"`
+	ScannedFiles int           `json:"scanned_files"`
+	OrphanFiles  []OrphanFile  `json:"orphan_files"`
+	OrphanBytes  int64         `json:"orphan_bytes"`
+	MissingFiles []FileRef     `json:"missing_files"`
+	RefCounts    []RefCountFix `json:"ref_count_fixes"`
+	Errors       []string      `json:"errors"`
+}
+
+// Reconcile compares stored files with the rows that reference them. It
+// reports files nothing references, rows whose file is gone and asset
+// reference counts that drifted. Unless dryRun is set it also deletes the
+// orphans, clears the dangling references and corrects the counts.
+//
+// Files younger than grace are never deleted: an upload stores the file
+// before the row that references it is written.
+func Reconcile(ctx context.Context, dryRun bool, grace time.Duration) (*ReconcileReport, error) {
+	report := &ReconcileReport{
+		DryRun:       dryRun,
+		OrphanFiles:  []OrphanFile{},
+		MissingFiles: []FileRef{},
+		RefCounts:    []RefCountFix{},
+		Errors:       []string{},
+	}
+
+	files, err := storage.Files.List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	report.ScannedFiles = len(files)
+	stored := map[string]bool{}
+	for _, f := range files {
+		stored[f.Key] = true
+	}
+
+	refs, err := collectReferences(database.DB)
+	if err != nil {
+		return nil, err
+	}
+	used := map[string]int{}
+	for _, r := range refs {
+		key := storage.KeyFromURL(r.URL)
+		used[key]++
+		if !stored[key] {
+			report.MissingFiles = append(report.MissingFiles, r)
+		}
+	}
+
+	now := time.Now()
+	for _, f := range files {
+		// Chunks of resumable uploads are purged by PurgeExpiredUploads.
+		if used[f.Key] > 0 || strings.HasPrefix(f.Key, partialPrefix) {
+			continue
+		}
+		orphan := OrphanFile{Key: f.Key, Size: f.Size, LastModified: f.LastModified}
+		report.OrphanBytes += f.Size
+		if !dryRun {
+			if now.Sub(f.LastModified) < grace {
+				orphan.Skipped = "modified recently"
+			} else if removed, err := removeOrphan(ctx, f.Key); err != nil {
+				orphan.Skipped = err.Error()
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", f.Key, err))
+			} else if !removed {
+				orphan.Skipped = "referenced again"
+			}
+		}
+		report.OrphanFiles = append(report.OrphanFiles, orphan)
+	}
+
+	var rows []models.Asset
+	if err := database.DB.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, a := range rows {
+		actual := used[a.StorageKey]
+		if actual == 0 || actual == a.RefCount {
+			continue // unused assets are handled as orphans above
+		}
+		report.RefCounts = append(report.RefCounts, RefCountFix{Key: a.StorageKey, Stored: a.RefCount, Actual: actual})
+		if !dryRun {
+			if err := database.DB.Model(&a).Update("ref_count", actual).Error; err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", a.StorageKey, err))
+			}
+		}
+	}
+
+	if !dryRun {
+		for _, r := range report.MissingFiles {
+			if err := clearReference(r); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s %d: %v", r.Kind, r.ID, err))
+			}
+		}
+	}
+
+	return report, nil
+}
+
+func collectReferences(db *gorm.DB) ([]FileRef, error) {
+	var out []FileRef
+	for _, ref := range references {
+		var rows []struct {
+			ID  uint
+			URL string
+		}
+		err := db.Model(ref.model).Select("id, " + ref.column + " AS url").Where(ref.column + " <> ''").Scan(&rows).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rows {
+			out = append(out, FileRef{Kind: ref.kind, ID: r.ID, URL: r.URL})
+		}
+	}
+	return out, nil
+}
+
+// removeOrphan deletes an unreferenced file and its asset row. References
+// are counted again under the row lock, so an upload of the same content
+// that raced with the scan keeps its file.
+func removeOrphan(ctx context.Context, key string) (bool, error) {
+	removed := false
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var asset models.Asset
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("storage_key = ?", key).First(&asset).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		url := storage.URLFromKey(key)
+		for _, ref := range references {
+			var n int64
+			if err := tx.Model(ref.model).Where(ref.column+" = ?", url).Count(&n).Error; err != nil {
+				return err
+			}
+			if n > 0 {
+				return nil
+			}
+		}
+
+		if asset.ID != 0 {
+			if err := tx.Delete(&asset).Error; err != nil {
+				return err
+			}
+		}
+		if err := storage.Files.Delete(ctx, key); err != nil {
+			return err
+		}
+		removed = true
+		return nil
+	})
+	return removed, err
+}
+
+// clearReference resets a row whose file is gone, so it shows as having no
+// file instead of failing on download.
+func clearReference(r FileRef) error {
+	for _, ref := range references {
+		if ref.kind != r.Kind {
+			continue
+		}
+		return database.DB.Transaction(func(tx *gorm.DB) error {
+			res := tx.Model(ref.model).Where("id = ? AND "+ref.column+" = ?", r.ID, r.URL).Updates(ref.clear)
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				return nil
+			}
+			// The asset row, if any, can no longer be served either.
+			return tx.Where("storage_key = ?", storage.KeyFromURL(r.URL)).Delete(&models.Asset{}).Error
+		})
+	}
+	return nil
+}
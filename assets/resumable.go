@@ -0,0 +1,252 @@
+package assets
+
+import (
+	"backend-elearning/database"
+	"backend-elearning/models"
+	"backend-elearning/storage"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UploadSessionTTL is how long a resumable upload may sit without progress
+// before it expires. Every chunk extends it.
+const UploadSessionTTL = 24 * time.Hour
+
+// partialPrefix is where chunks of unfinished uploads are kept in storage.
+const partialPrefix = "partial/"
+
+var (
+	ErrSessionNotFound   = errors.New("upload not found")
+	ErrSessionExpired    = errors.New("upload has expired")
+	ErrOffsetMismatch    = errors.New("upload offset does not match")
+	ErrSessionIncomplete = errors.New("upload is not complete")
+)
+
+// CreateSession starts a resumable upload of length bytes for userID.
+func CreateSession(userID uint, filename string, length int64) (*models.UploadSession, error) {
+	if length <= 0 {
+		return nil, reject("upload length must be positive")
+	}
+	if length > MaxUploadSize {
+		return nil, &RejectedError{Reason: fmt.Sprintf("file is larger than %d MB", MaxUploadSize>>20), TooLarge: true}
+	}
+	if filename == "" {
+		return nil, reject("filename metadata is required")
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	session := models.UploadSession{
+		ID:        hex.EncodeToString(id),
+		UserID:    userID,
+		Filename:  SanitizeFilename(filename),
+		Length:    length,
+		ExpiresAt: time.Now().Add(UploadSessionTTL),
+	}
+	if err := database.DB.Create(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// FindSession loads userID's upload id, failing with ErrSessionNotFound or
+// ErrSessionExpired.
+func FindSession(id string, userID uint) (*models.UploadSession, error) {
+	var session models.UploadSession
+	err := database.DB.Where("id = ? AND user_id = ?", id, userID).First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return nil, ErrSessionExpired
+	}
+	return &session, nil
+}
+
+// WriteChunk appends data at offset, which must equal the bytes received so
+// far. The chunk is stored as its own object, so an interrupted request
+// leaves the session as it was and the client simply resends.
+func WriteChunk(ctx context.Context, id string, userID uint, offset int64, data []byte) (*models.UploadSession, error) {
+	var session models.UploadSession
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ? AND user_id = ?", id, userID).First(&session).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSessionNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if time.Now().After(session.ExpiresAt) {
+			return ErrSessionExpired
+		}
+		if offset != session.Offset {
+			return ErrOffsetMismatch
+		}
+		if offset+int64(len(data)) > session.Length {
+			return reject("chunk goes past the declared upload length")
+		}
+
+		if len(data) > 0 {
+			key := fmt.Sprintf("%s%s/%016d", partialPrefix, session.ID, offset)
+			if err := storage.Files.Put(ctx, key, bytes.NewReader(data), int64(len(data)), "application/octet-stream"); err != nil {
+				return err
+			}
+		}
+
+		session.Offset += int64(len(data))
+		session.ExpiresAt = time.Now().Add(UploadSessionTTL)
+		return tx.Model(&session).Updates(map[string]interface{}{
+			"offset":     session.Offset,
+			"expires_at": session.ExpiresAt,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// StoreSession validates a finished resumable upload exactly like
+// StoreUpload and stores it, then discards the session.
+func StoreSession(ctx context.Context, id string, userID uint, allowed ...string) (*models.Asset, string, error) {
+	session, err := FindSession(id, userID)
+	if err != nil {
+		return nil, "", err
+	}
+	if session.Offset != session.Length {
+		return nil, "", ErrSessionIncomplete
+	}
+	name, ext, err := checkName(session.Filename, allowed)
+	if err != nil {
+		return nil, "", err
+	}
+
+	tmp, err := os.CreateTemp("", "upload-*")
+	if err != nil {
+		return nil, "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := assemble(ctx, session.ID, tmp)
+	if err != nil {
+		return nil, "", err
+	}
+	if size != session.Length {
+		return nil, "", fmt.Errorf("upload %s: stored chunks add up to %d of %d bytes", session.ID, size, session.Length)
+	}
+
+	asset, err := storeChecked(ctx, tmp, size, ext)
+	if err != nil {
+		return nil, "", err
+	}
+
+	_ = DeleteSession(ctx, session.ID)
+	return asset, name, nil
+}
+
+// assemble concatenates the chunks of upload id into w in offset order.
+func assemble(ctx context.Context, id string, w io.Writer) (int64, error) {
+	chunks, err := storage.Files.List(ctx, partialPrefix+id+"/")
+	if err != nil {
+		return 0, err
+	}
+	// Keys end in the zero-padded offset, so they sort in upload order.
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].Key < chunks[j].Key })
+
+	var total int64
+	for _, chunk := range chunks {
+		rc, err := storage.Files.Get(ctx, chunk.Key)
+		if err != nil {
+			return 0, err
+		}
+		n, err := io.Copy(w, rc)
+		rc.Close()
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// DeleteSession removes an upload and its chunks.
+func DeleteSession(ctx context.Context, id string) error {
+	chunks, err := storage.Files.List(ctx, partialPrefix+id+"/")
+	if err != nil {
+		return err
+	}
+	for _, chunk := range chunks {
+		if err := storage.Files.Delete(ctx, chunk.Key); err != nil {
+			return err
+		}
+	}
+	return database.DB.Where("id = ?", id).Delete(&models.UploadSession{}).Error
+}
+
+// PurgeExpiredUploads deletes expired sessions and chunks whose session no
+// longer exists (e.g. after a crash between the two deletes).
+func PurgeExpiredUploads(ctx context.Context) (int, error) {
+	var expired []models.UploadSession
+	if err := database.DB.Where("expires_at < ?", time.Now()).Find(&expired).Error; err != nil {
+		return 0, err
+	}
+	for _, s := range expired {
+		if err := DeleteSession(ctx, s.ID); err != nil {
+			return 0, err
+		}
+	}
+
+	chunks, err := storage.Files.List(ctx, partialPrefix)
+	if err != nil {
+		return len(expired), err
+	}
+	live := map[string]bool{}
+	for _, chunk := range chunks {
+		id := strings.SplitN(strings.TrimPrefix(chunk.Key, partialPrefix), "/", 2)[0]
+		if _, ok := live[id]; !ok {
+			var n int64
+			database.DB.Model(&models.UploadSession{}).Where("id = ?", id).Count(&n)
+			live[id] = n > 0
+		}
+		if !live[id] && time.Since(chunk.LastModified) > UploadSessionTTL {
+			if err := storage.Files.Delete(ctx, chunk.Key); err != nil {
+				return len(expired), err
+			}
+		}
+	}
+	return len(expired), nil
+}
+
+// StartUploadJanitor purges expired uploads every interval until the
+// process exits.
+func StartUploadJanitor(interval time.Duration) {
+	go func() {
+		for {
+			if n, err := PurgeExpiredUploads(context.Background()); err != nil {
+				log.Println("⚠️ Purging expired uploads failed:", err)
+			} else if n > 0 {
+				log.Printf("🧹 Purged %d expired uploads", n)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
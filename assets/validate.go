@@ -0,0 +1,255 @@
+package assets
+
+import (
+	"backend-elearning/models"
+	"backend-elearning/pdf"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxUploadSize is the largest file accepted by StoreUpload. main sets it
+// from MAX_UPLOAD_MB.
+var MaxUploadSize int64 = 50 << 20
+
+// RejectedError is returned for uploads that fail validation. The message is
+// safe to show to the user.
+type RejectedError struct {
+	Reason   string
+	TooLarge bool
+}
+
+func (e *RejectedError) Error() string {
+	return e.Reason
+}
+
+func reject(format string, args ...interface{}) error {
+	return &RejectedError{Reason: fmt.Sprintf(format, args...)}
+}
+
+// contentTypes is what stored files are served as. The header sent by the
+// client is never used.
+var contentTypes = map[string]string{
+	".pdf":  "application/pdf",
+	".doc":  "application/msword",
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".ppt":  "application/vnd.ms-powerpoint",
+	".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".xls":  "application/vnd.ms-excel",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".csv":  "text/csv; charset=utf-8",
+	".txt":  "text/plain; charset=utf-8",
+	".zip":  "application/zip",
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".mp3":  "audio/mpeg",
+	".mp4":  "video/mp4",
+}
+
+// ContentType returns the type a file with extension ext is stored as.
+func ContentType(ext string) string {
+	if ct, ok := contentTypes[strings.ToLower(ext)]; ok {
+		return ct
+	}
+	return "application/octet-stream"
+}
+
+var (
+	oleMagic = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+	zipMagic = []byte("PK\x03\x04")
+	pngMagic = []byte("\x89PNG\r\n\x1a\n")
+)
+
+// matchesSignature checks the first bytes of a file against the format its
+// extension claims.
+func matchesSignature(head []byte, ext string) bool {
+	switch ext {
+	case ".pdf":
+		// Readers accept the header anywhere in the first 1024 bytes.
+		return bytes.Contains(head, []byte("%PDF-"))
+	case ".doc", ".xls", ".ppt":
+		return bytes.HasPrefix(head, oleMagic)
+	case ".docx", ".xlsx", ".pptx":
+		return bytes.HasPrefix(head, zipMagic)
+	case ".zip":
+		return bytes.HasPrefix(head, zipMagic) || bytes.HasPrefix(head, []byte("PK\x05\x06"))
+	case ".png":
+		return bytes.HasPrefix(head, pngMagic)
+	case ".jpg", ".jpeg":
+		return bytes.HasPrefix(head, []byte{0xFF, 0xD8, 0xFF})
+	case ".mp3":
+		return bytes.HasPrefix(head, []byte("ID3")) ||
+			(len(head) > 1 && head[0] == 0xFF && head[1]&0xE0 == 0xE0)
+	case ".mp4":
+		return len(head) >= 8 && string(head[4:8]) == "ftyp"
+	case ".txt", ".csv":
+		return true // checked in full by Check
+	}
+	return false
+}
+
+// Check validates the content of a file with extension ext: the signature
+// must match the extension, text must be UTF-8, and PDFs must parse and be
+// neither encrypted nor scripted.
+func Check(r io.ReaderAt, size int64, ext string) error {
+	ext = strings.ToLower(ext)
+	if size > MaxUploadSize {
+		return &RejectedError{Reason: fmt.Sprintf("file is larger than %d MB", MaxUploadSize>>20), TooLarge: true}
+	}
+	if size == 0 {
+		return reject("file is empty")
+	}
+
+	head := make([]byte, 1024)
+	n, err := r.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if !matchesSignature(head[:n], ext) {
+		return reject("file content does not match its %s extension", ext)
+	}
+
+	switch ext {
+	case ".pdf":
+		data, err := io.ReadAll(io.NewSectionReader(r, 0, size))
+		if err != nil {
+			return err
+		}
+		return CheckPDF(data)
+	case ".txt", ".csv":
+		data, err := io.ReadAll(io.NewSectionReader(r, 0, size))
+		if err != nil {
+			return err
+		}
+		if !utf8.Valid(data) || bytes.IndexByte(data, 0) >= 0 {
+			return reject("%s files must be UTF-8 text", ext)
+		}
+	}
+	return nil
+}
+
+// CheckPDF rejects PDFs that cannot be parsed or have no pages, are
+// encrypted or contain JavaScript.
+func CheckPDF(data []byte) error {
+	doc, err := pdf.Open(data)
+	if err != nil {
+		return reject("PDF could not be read: %v", err)
+	}
+	if pages, err := doc.Pages(); err != nil || len(pages) == 0 {
+		return reject("PDF is damaged or has no pages")
+	}
+	if doc.Encrypted() {
+		return reject("encrypted or password-protected PDFs are not allowed")
+	}
+	if doc.HasJavaScript() {
+		return reject("PDFs containing JavaScript are not allowed")
+	}
+	return nil
+}
+
+// StoreUpload validates an uploaded form file and stores it under a
+// generated name (see Store). allowed lists the accepted extensions. The
+// sanitized original file name is returned for use in downloads.
+func StoreUpload(ctx context.Context, file *multipart.FileHeader, allowed ...string) (*models.Asset, string, error) {
+	name, ext, err := checkName(file.Filename, allowed)
+	if err != nil {
+		return nil, "", err
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+
+	asset, err := storeChecked(ctx, f, file.Size, ext)
+	if err != nil {
+		return nil, "", err
+	}
+	return asset, name, nil
+}
+
+// checkName sanitizes filename and checks its extension against allowed.
+func checkName(filename string, allowed []string) (string, string, error) {
+	name := SanitizeFilename(filename)
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, a := range allowed {
+		if ext == a {
+			return name, ext, nil
+		}
+	}
+	if ext == "" {
+		return "", "", reject("file has no extension; allowed: %s", strings.Join(allowed, ", "))
+	}
+	return "", "", reject("file type %s is not allowed", ext)
+}
+
+type seekReaderAt interface {
+	io.ReadSeeker
+	io.ReaderAt
+}
+
+func storeChecked(ctx context.Context, f seekReaderAt, size int64, ext string) (*models.Asset, error) {
+	if err := Check(f, size, ext); err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return Store(ctx, f, ext, ContentType(ext))
+}
+
+// maxFilenameLen is in bytes; most filesystems and browsers cope with 255.
+const maxFilenameLen = 200
+
+// SanitizeFilename turns a client-supplied name into one that is safe to
+// show and to put in a Content-Disposition header: no directories, control
+// characters, quotes or reserved characters, and a bounded length. Spaces
+// are kept, since this is only the download name, never a storage path.
+func SanitizeFilename(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	name = filepath.Base(name)
+	name = strings.ToValidUTF8(name, "")
+
+	var b strings.Builder
+	space := false
+	for _, r := range name {
+		switch {
+		case unicode.IsControl(r) || strings.ContainsRune(`"'/:*?<>|`+"`", r):
+			continue
+		case unicode.IsSpace(r):
+			space = true
+			continue
+		}
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteRune(r)
+	}
+	name = strings.TrimLeft(b.String(), ". ")
+
+	ext := filepath.Ext(name)
+	if len(ext) > 10 {
+		ext = ""
+	}
+	base := strings.TrimSuffix(name, ext)
+	ext = strings.ToLower(ext)
+	if len(base)+len(ext) > maxFilenameLen {
+		base = base[:maxFilenameLen-len(ext)]
+		for !utf8.ValidString(base) {
+			base = base[:len(base)-1]
+		}
+	}
+	if strings.TrimSpace(base) == "" {
+		base = "file"
+	}
+	return strings.TrimSpace(base) + ext
+}
@@ -0,0 +1,114 @@
+package assets
+
+import (
+	"backend-elearning/database"
+	"backend-elearning/models"
+	"backend-elearning/pdf"
+	"backend-elearning/storage"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// watermarkPrefix is where stamped copies of module PDFs are kept, one
+// folder per user.
+const watermarkPrefix = "watermarks/"
+
+// Watermarked returns the URL of a copy of the PDF at sourceURL stamped with
+// the user's name and email and the time of the download. Copies are made on
+// the first download and reused until the source changes or the user's
+// name or email does, so the time shown is that of the first download.
+func Watermarked(ctx context.Context, user models.User, sourceURL string) (string, error) {
+	label := fmt.Sprintf("%s <%s>", user.FullName, user.Email)
+
+	var cached models.WatermarkedFile
+	err := database.DB.Where("user_id = ? AND source_url = ?", user.ID, sourceURL).First(&cached).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", err
+	}
+	if err == nil && cached.FileUrl != "" && cached.Label == label {
+		if _, err := storage.Files.Stat(ctx, storage.KeyFromURL(cached.FileUrl)); err == nil {
+			return cached.FileUrl, nil
+		}
+	}
+
+	data, err := stampPDF(ctx, sourceURL, user, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	// The key only depends on the user and the source, so a concurrent
+	// download writes the same file and a restamp replaces the old copy.
+	sum := sha256.Sum256([]byte(sourceURL))
+	key := fmt.Sprintf("%s%d/%s.pdf", watermarkPrefix, user.ID, hex.EncodeToString(sum[:16]))
+	if err := storage.Files.Put(ctx, key, bytes.NewReader(data), int64(len(data)), "application/pdf"); err != nil {
+		return "", err
+	}
+
+	row := models.WatermarkedFile{
+		UserID:    user.ID,
+		SourceUrl: sourceURL,
+		FileUrl:   storage.URLFromKey(key),
+		Label:     label,
+	}
+	err = database.DB.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"file_url", "label"}),
+	}).Create(&row).Error
+	if err != nil {
+		return "", err
+	}
+	return row.FileUrl, nil
+}
+
+func stampPDF(ctx context.Context, sourceURL string, user models.User, at time.Time) ([]byte, error) {
+	data, err := readFile(ctx, sourceURL)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := pdf.Open(data)
+	if err != nil {
+		return nil, err
+	}
+	err = doc.ApplyStamp(pdf.Stamp{
+		Diagonal: []string{user.FullName, user.Email},
+		Footer: fmt.Sprintf("Downloaded by %s (%s) on %s UTC",
+			user.FullName, user.Email, at.UTC().Format("2006-01-02 15:04")),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	if err := doc.Write(&out); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// purgeWatermarks deletes the stamped copies made from sourceURL, once the
+// source itself is gone.
+func purgeWatermarks(ctx context.Context, sourceURL string) error {
+	var copies []models.WatermarkedFile
+	if err := database.DB.Where("source_url = ?", sourceURL).Find(&copies).Error; err != nil {
+		return err
+	}
+	for _, w := range copies {
+		if w.FileUrl != "" {
+			if err := storage.Files.Delete(ctx, storage.KeyFromURL(w.FileUrl)); err != nil {
+				return err
+			}
+		}
+		if err := database.DB.Delete(&w).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
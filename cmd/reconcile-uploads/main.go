@@ -0,0 +1,42 @@
+// Command reconcile-uploads compares stored uploads with the database rows
+// that reference them. By default it only reports; run it with -dry-run=false
+// to delete orphaned files and clear references to missing ones.
+package main
+
+import (
+	"backend-elearning/assets"
+	"backend-elearning/config"
+	"backend-elearning/database"
+	"backend-elearning/storage"
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"time"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", true, "only report, change nothing")
+	grace := flag.Duration("grace", time.Hour, "never delete files modified more recently than this")
+	flag.Parse()
+
+	cfg := config.LoadConfig()
+	database.ConnectDB(cfg)
+	storage.Init(cfg)
+
+	report, err := assets.Reconcile(context.Background(), *dryRun, *grace)
+	if err != nil {
+		log.Fatal("❌ Reconcile failed: ", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(report)
+
+	log.Printf("%d files scanned, %d orphaned (%d bytes), %d missing, %d ref counts off",
+		report.ScannedFiles, len(report.OrphanFiles), report.OrphanBytes, len(report.MissingFiles), len(report.RefCounts))
+	if len(report.Errors) > 0 {
+		os.Exit(1)
+	}
+}
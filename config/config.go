@@ -3,6 +3,7 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
 
 	"github.com/joho/godotenv"
 )
@@ -15,6 +16,19 @@ type Config struct {
 	DBPort       string
 	DBName       string
 	PasetoSecret string
+
+	// File storage: "local" (UploadDir) or "s3" (any S3-compatible store)
+	StorageDriver   string
+	UploadDir       string
+	S3Endpoint      string
+	S3Region        string
+	S3Bucket        string
+	S3AccessKey     string
+	S3SecretKey     string
+	S3PathStyle     bool
+	StorageRedirect bool // GetModulePDF redirects to a signed URL when the backend supports it
+	MaxUploadMB     int
+	PDFRenderer     string // pdftoppm binary for module thumbnails
 }
 
 func LoadConfig() *Config {
@@ -34,6 +48,18 @@ func LoadConfig() *Config {
 		DBName: getEnv("DB_NAME", "elearning_db"),
 
 		PasetoSecret: getEnv("PASETO_SECRET_KEY", ""),
+
+		StorageDriver:   getEnv("STORAGE_DRIVER", "local"),
+		UploadDir:       getEnv("UPLOAD_DIR", "uploads"),
+		S3Endpoint:      getEnv("S3_ENDPOINT", ""),
+		S3Region:        getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:        getEnv("S3_BUCKET", ""),
+		S3AccessKey:     getEnv("S3_ACCESS_KEY", ""),
+		S3SecretKey:     getEnv("S3_SECRET_KEY", ""),
+		S3PathStyle:     getEnv("S3_PATH_STYLE", "true") == "true",
+		StorageRedirect: getEnv("STORAGE_REDIRECT", "false") == "true",
+		MaxUploadMB:     getEnvInt("MAX_UPLOAD_MB", 50),
+		PDFRenderer:     getEnv("PDF_RENDERER", "pdftoppm"),
 	}
 }
 
@@ -43,3 +69,10 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+func getEnvInt(key string, fallback int) int {
+	if n, err := strconv.Atoi(getEnv(key, "")); err == nil && n > 0 {
+		return n
+	}
+	return fallback
+}
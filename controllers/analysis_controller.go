@@ -0,0 +1,456 @@
+package controllers
+
+import (
+	"backend-elearning/database"
+	"backend-elearning/models"
+	"backend-elearning/questions"
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Item analysis compares how students did on each question with how they
+// did on the rest of the quiz. The upper and lower groups are the best and
+// worst 27% of attempts by score, the usual split.
+const (
+	groupShare       = 0.27
+	minAnalysisCount = 10  // below this the numbers are flagged as unreliable
+	easyDifficulty   = 0.9 // mean credit above which a question is too easy
+	hardDifficulty   = 0.2 // and below which it is too hard
+	lowDiscriminator = 0.2 // point-biserial below which a question tells little
+	maxResponseKinds = 10  // distinct free responses listed per question
+)
+
+// itemOption is how often one option of a choice question was picked.
+type itemOption struct {
+	Option  string  `json:"option"`
+	Correct bool    `json:"correct"`
+	Count   int     `json:"count"`
+	Share   float64 `json:"share"` // of the attempts that showed the question
+	Upper   int     `json:"upper"` // picks in the upper group
+	Lower   int     `json:"lower"` // picks in the lower group
+}
+
+// itemResponse is a free response and how often it was given.
+type itemResponse struct {
+	Response string  `json:"response"`
+	Count    int     `json:"count"`
+	Credit   float64 `json:"credit"`
+}
+
+// itemStats is the analysis of one question.
+type itemStats struct {
+	QuizID   uint    `json:"quiz_id"`
+	Type     string  `json:"type"`
+	Question string  `json:"question"`
+	Points   float64 `json:"points"`
+	// Retired questions were edited or deleted since; they are listed for
+	// the attempts that still used them.
+	Retired  bool `json:"retired"`
+	FromBank bool `json:"from_bank"`
+	Shown    int  `json:"shown"`
+	Answered int  `json:"answered"`
+	// Difficulty is the mean credit, 0..1: the higher, the easier.
+	Difficulty      *float64 `json:"difficulty"`
+	UpperDifficulty *float64 `json:"upper_difficulty"`
+	LowerDifficulty *float64 `json:"lower_difficulty"`
+	// Discrimination is the upper minus the lower difficulty; PointBiserial
+	// correlates the credit with the score on the other questions.
+	Discrimination *float64       `json:"discrimination"`
+	PointBiserial  *float64       `json:"point_biserial"`
+	Options        []itemOption   `json:"options,omitempty"`
+	Responses      []itemResponse `json:"responses,omitempty"`
+	Flags          []string       `json:"flags"`
+}
+
+// itemObservation is one question in one attempt.
+type itemObservation struct {
+	attempt  int // index into the analysed attempts
+	credit   float64
+	rest     float64 // score (%) on the other questions of the attempt
+	hasRest  bool
+	answered bool
+	response string
+}
+
+// GetItemAnalysis -> GET /instructor/courses/:course_id/modules/:module_id/item-analysis (requires instructor)
+// Statistics per question over the graded attempts: difficulty, upper and
+// lower group difficulty, discrimination, point-biserial, how often each
+// option was picked and flags for questions that need a look, e.g.
+// "negative_discrimination" when the strongest students do worse.
+// ?attempts=first only counts each student's first graded attempt.
+func GetItemAnalysis(c *fiber.Ctx) error {
+	module, err := loadOwnedModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	var attempts []models.QuizResult
+	if err := database.DB.Preload("Answers").
+		Where("module_id = ? AND status = ?", module.ID, "graded").
+		Order("created_at ASC, id ASC").
+		Find(&attempts).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if c.Query("attempts") == "first" {
+		seen := make(map[uint]bool)
+		first := attempts[:0]
+		for _, a := range attempts {
+			if !seen[a.UserID] {
+				seen[a.UserID] = true
+				first = append(first, a)
+			}
+		}
+		attempts = first
+	}
+
+	// Soal modul saat ini, lalu soal lain yang muncul di percobaan
+	var current []models.Quiz
+	database.DB.Where("module_id = ?", module.ID).Order("position ASC, id ASC").Find(&current)
+	order := make([]uint, 0, len(current))
+	listed := make(map[uint]bool)
+	for _, q := range current {
+		order = append(order, q.ID)
+		listed[q.ID] = true
+	}
+	shown := make([][]uint, len(attempts))
+	var extra []uint
+	for i, a := range attempts {
+		shown[i] = attemptQuestionIDs(a)
+		if len(shown[i]) == 0 {
+			for _, ans := range a.Answers {
+				shown[i] = append(shown[i], ans.QuizID)
+			}
+		}
+		for _, id := range shown[i] {
+			if !listed[id] {
+				listed[id] = true
+				extra = append(extra, id)
+			}
+		}
+	}
+	sort.Slice(extra, func(i, j int) bool { return extra[i] < extra[j] })
+	order = append(order, extra...)
+
+	var quizzes []models.Quiz
+	if len(order) > 0 {
+		database.DB.Unscoped().Where("id IN ?", order).Find(&quizzes)
+	}
+	quizByID := make(map[uint]models.Quiz, len(quizzes))
+	for _, q := range quizzes {
+		if q.Points <= 0 {
+			q.Points = 1
+		}
+		quizByID[q.ID] = q
+	}
+
+	// Kelompok atas dan bawah menurut skor
+	scores := make([]float64, len(attempts))
+	for i, a := range attempts {
+		scores[i] = a.Score
+	}
+	upper, lower, groupSize := scoreGroups(scores)
+
+	observed := make(map[uint][]itemObservation)
+	scoreSum := 0.0
+	for i, a := range attempts {
+		scoreSum += a.Score
+		answers := make(map[uint]models.QuizAnswer, len(a.Answers))
+		for _, ans := range a.Answers {
+			answers[ans.QuizID] = ans
+		}
+		for _, id := range shown[i] {
+			q, ok := quizByID[id]
+			if !ok {
+				continue
+			}
+			o := itemObservation{attempt: i}
+			if ans, ok := answers[id]; ok {
+				o.credit = ans.Credit
+				o.response = ans.Response
+				o.answered = ans.Response != "" && ans.Response != "null"
+				if restMax := a.MaxPoints - q.Points; restMax > 0 {
+					o.rest = (a.Points - ans.Earned) / restMax * 100
+					o.hasRest = true
+				}
+			} else if restMax := a.MaxPoints - q.Points; restMax > 0 {
+				o.rest = a.Points / restMax * 100
+				o.hasRest = true
+			}
+			observed[id] = append(observed[id], o)
+		}
+	}
+
+	items := make([]itemStats, 0, len(order))
+	for _, id := range order {
+		q, ok := quizByID[id]
+		if !ok {
+			continue
+		}
+		items = append(items, analyseItem(q, observed[id], upper, lower))
+	}
+
+	out := fiber.Map{
+		"module_id":  module.ID,
+		"attempts":   len(attempts),
+		"mean_score": nil,
+		"group_size": groupSize,
+		"items":      items,
+	}
+	if len(attempts) > 0 {
+		out["mean_score"] = round2(scoreSum / float64(len(attempts)))
+	}
+	return c.JSON(out)
+}
+
+// scoreGroups picks the upper and lower groups, by index into scores. Ties
+// keep the attempt order, so the earlier attempt goes to the upper group.
+func scoreGroups(scores []float64) (upper, lower map[int]bool, size int) {
+	ranked := make([]int, len(scores))
+	for i := range ranked {
+		ranked[i] = i
+	}
+	sort.SliceStable(ranked, func(i, j int) bool { return scores[ranked[i]] > scores[ranked[j]] })
+	size = int(math.Ceil(float64(len(scores)) * groupShare))
+	if size > len(scores)/2 {
+		size = len(scores) / 2 // kelompok tidak boleh tumpang tindih
+	}
+	upper, lower = make(map[int]bool), make(map[int]bool)
+	for k := 0; k < size; k++ {
+		upper[ranked[k]] = true
+		lower[ranked[len(ranked)-1-k]] = true
+	}
+	return upper, lower, size
+}
+
+func analyseItem(q models.Quiz, obs []itemObservation, upper, lower map[int]bool) itemStats {
+	st := itemStats{
+		QuizID:   q.ID,
+		Type:     q.Type,
+		Question: q.Question,
+		Points:   q.Points,
+		Retired:  q.DeletedAt.Valid,
+		FromBank: q.BankID != nil,
+		Shown:    len(obs),
+		Flags:    []string{},
+	}
+	if st.Type == "" {
+		st.Type = questions.SingleChoice
+	}
+
+	var credits, rests []float64
+	var sum, upperSum, lowerSum float64
+	var upperN, lowerN int
+	for _, o := range obs {
+		sum += o.credit
+		if o.answered {
+			st.Answered++
+		}
+		if o.hasRest {
+			credits = append(credits, o.credit)
+			rests = append(rests, o.rest)
+		}
+		if upper[o.attempt] {
+			upperSum += o.credit
+			upperN++
+		}
+		if lower[o.attempt] {
+			lowerSum += o.credit
+			lowerN++
+		}
+	}
+	if len(obs) > 0 {
+		st.Difficulty = ratio(sum, len(obs))
+	}
+	if upperN > 0 && lowerN > 0 {
+		st.UpperDifficulty = ratio(upperSum, upperN)
+		st.LowerDifficulty = ratio(lowerSum, lowerN)
+		d := round3(*st.UpperDifficulty - *st.LowerDifficulty)
+		st.Discrimination = &d
+	}
+	if r, ok := pearson(credits, rests); ok {
+		r = round3(r)
+		st.PointBiserial = &r
+	}
+
+	switch st.Type {
+	case questions.SingleChoice, questions.MultipleSelect, questions.TrueFalse:
+		st.Options = optionCounts(q, st.Type, obs, upper, lower)
+	case questions.Numeric, questions.ShortText:
+		st.Responses = responseCounts(obs)
+	}
+
+	if len(obs) < minAnalysisCount {
+		st.Flags = append(st.Flags, "few_attempts")
+	}
+	if st.Difficulty != nil && *st.Difficulty > easyDifficulty {
+		st.Flags = append(st.Flags, "too_easy")
+	}
+	if st.Difficulty != nil && *st.Difficulty < hardDifficulty {
+		st.Flags = append(st.Flags, "too_hard")
+	}
+	switch {
+	case st.PointBiserial != nil && *st.PointBiserial < 0,
+		st.Discrimination != nil && *st.Discrimination < 0:
+		st.Flags = append(st.Flags, "negative_discrimination")
+	case st.PointBiserial != nil && *st.PointBiserial < lowDiscriminator:
+		st.Flags = append(st.Flags, "low_discrimination")
+	}
+	for _, o := range st.Options {
+		if !o.Correct && o.Upper > o.Lower {
+			st.Flags = append(st.Flags, "distractor_attracts_upper_group")
+			break
+		}
+	}
+	return st
+}
+
+// optionCounts counts the picks of each option of a choice question.
+func optionCounts(q models.Quiz, typ string, obs []itemObservation, upper, lower map[int]bool) []itemOption {
+	var options, correct []string
+	_ = json.Unmarshal([]byte(q.Options), &options)
+	switch typ {
+	case questions.SingleChoice, questions.TrueFalse:
+		correct = []string{q.Answer}
+	case questions.MultipleSelect:
+		_ = json.Unmarshal([]byte(q.Answer), &correct)
+	}
+
+	counts := make([]itemOption, len(options))
+	index := make(map[string]int, len(options))
+	for i, o := range options {
+		counts[i] = itemOption{Option: o}
+		index[o] = i
+		for _, c := range correct {
+			if c == o {
+				counts[i].Correct = true
+			}
+		}
+	}
+	for _, o := range obs {
+		for _, picked := range pickedOptions(typ, o.response) {
+			i, ok := index[picked]
+			if !ok {
+				continue
+			}
+			counts[i].Count++
+			if upper[o.attempt] {
+				counts[i].Upper++
+			}
+			if lower[o.attempt] {
+				counts[i].Lower++
+			}
+		}
+	}
+	for i := range counts {
+		if len(obs) > 0 {
+			counts[i].Share = *ratio(float64(counts[i].Count), len(obs))
+		}
+	}
+	return counts
+}
+
+// pickedOptions reads the options chosen in a stored response.
+func pickedOptions(typ, response string) []string {
+	raw := []byte(response)
+	switch typ {
+	case questions.MultipleSelect:
+		var picked []string
+		_ = json.Unmarshal(raw, &picked)
+		seen := make(map[string]bool)
+		out := picked[:0]
+		for _, p := range picked {
+			if !seen[p] {
+				seen[p] = true
+				out = append(out, p)
+			}
+		}
+		return out
+	case questions.TrueFalse:
+		var b bool
+		if json.Unmarshal(raw, &b) == nil {
+			return []string{strconv.FormatBool(b)}
+		}
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			return []string{strings.ToLower(strings.TrimSpace(s))}
+		}
+	default:
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			return []string{s}
+		}
+	}
+	return nil
+}
+
+// responseCounts lists the most common free responses.
+func responseCounts(obs []itemObservation) []itemResponse {
+	byText := make(map[string]*itemResponse)
+	var list []*itemResponse
+	for _, o := range obs {
+		if !o.answered {
+			continue
+		}
+		text := o.response
+		var s string
+		if json.Unmarshal([]byte(o.response), &s) == nil {
+			text = strings.ToLower(strings.Join(strings.Fields(s), " "))
+		}
+		r, ok := byText[text]
+		if !ok {
+			r = &itemResponse{Response: text, Credit: o.credit}
+			byText[text] = r
+			list = append(list, r)
+		}
+		r.Count++
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Count > list[j].Count })
+	if len(list) > maxResponseKinds {
+		list = list[:maxResponseKinds]
+	}
+	out := make([]itemResponse, len(list))
+	for i, r := range list {
+		out[i] = *r
+	}
+	return out
+}
+
+// pearson is the correlation of x and y; with x a right/wrong credit it is
+// the point-biserial. It is undefined when either does not vary.
+func pearson(x, y []float64) (float64, bool) {
+	n := float64(len(x))
+	if len(x) < 2 || len(x) != len(y) {
+		return 0, false
+	}
+	var mx, my float64
+	for i := range x {
+		mx += x[i]
+		my += y[i]
+	}
+	mx, my = mx/n, my/n
+	var sxy, sxx, syy float64
+	for i := range x {
+		dx, dy := x[i]-mx, y[i]-my
+		sxy += dx * dy
+		sxx += dx * dx
+		syy += dy * dy
+	}
+	if sxx == 0 || syy == 0 {
+		return 0, false
+	}
+	return sxy / math.Sqrt(sxx*syy), true
+}
+
+func ratio(sum float64, n int) *float64 {
+	r := round3(sum / float64(n))
+	return &r
+}
+
+func round3(f float64) float64 {
+	return math.Round(f*1000) / 1000
+}
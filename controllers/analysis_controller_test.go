@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"backend-elearning/models"
+	"math"
+	"reflect"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestScoreGroups(t *testing.T) {
+	tests := []struct {
+		name         string
+		scores       []float64
+		upper, lower []int
+	}{
+		{"none", nil, nil, nil},
+		{"one attempt", []float64{80}, nil, nil},
+		{"two attempts", []float64{40, 90}, []int{1}, []int{0}},
+		{"three attempts", []float64{50, 70, 60}, []int{1}, []int{0}},
+		// ceil(10 * 0.27) = 3 on each side
+		{"ten attempts", []float64{10, 100, 20, 90, 30, 80, 40, 70, 50, 60}, []int{1, 3, 5}, []int{0, 2, 4}},
+		// ceil(4 * 0.27) = 2 and the groups fill exactly half each
+		{"four attempts", []float64{70, 20, 90, 50}, []int{0, 2}, []int{1, 3}},
+		// ties keep the attempt order
+		{"ties", []float64{50, 50, 50, 50}, []int{0, 1}, []int{2, 3}},
+	}
+	for _, tt := range tests {
+		upper, lower, size := scoreGroups(tt.scores)
+		if size != len(tt.upper) || !reflect.DeepEqual(upper, indexSet(tt.upper)) || !reflect.DeepEqual(lower, indexSet(tt.lower)) {
+			t.Errorf("%s: scoreGroups = %v %v %d, want %v %v", tt.name, upper, lower, size, tt.upper, tt.lower)
+		}
+	}
+}
+
+func indexSet(indexes []int) map[int]bool {
+	set := make(map[int]bool)
+	for _, i := range indexes {
+		set[i] = true
+	}
+	return set
+}
+
+func TestPearson(t *testing.T) {
+	tests := []struct {
+		name   string
+		x, y   []float64
+		want   float64
+		wantOK bool
+	}{
+		{"perfect", []float64{0, 1, 2}, []float64{10, 20, 30}, 1, true},
+		{"inverse", []float64{0, 1, 2}, []float64{30, 20, 10}, -1, true},
+		// 40 / sqrt(1 * 2000)
+		{"point-biserial", []float64{1, 1, 0, 0}, []float64{80, 60, 40, 20}, 0.894427, true},
+		{"credit does not vary", []float64{1, 1, 1}, []float64{10, 50, 90}, 0, false},
+		{"rest does not vary", []float64{0, 1, 0}, []float64{60, 60, 60}, 0, false},
+		{"single value", []float64{1}, []float64{50}, 0, false},
+		{"no values", nil, nil, 0, false},
+		{"length mismatch", []float64{0, 1}, []float64{10, 20, 30}, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := pearson(tt.x, tt.y)
+		if ok != tt.wantOK || math.Abs(got-tt.want) > 1e-6 {
+			t.Errorf("%s: pearson = %v, %v; want %v, %v", tt.name, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestAnalyseItem(t *testing.T) {
+	quiz := models.Quiz{Type: "single_choice", Question: "Q", Points: 1, Options: `["A","B","C"]`, Answer: "A"}
+	// Attempts 0 and 1 are the upper group, 2 and 3 the lower one.
+	upper, lower := indexSet([]int{0, 1}), indexSet([]int{2, 3})
+	obs := func(credits []float64, responses ...string) []itemObservation {
+		rests := []float64{80, 60, 40, 20}
+		out := make([]itemObservation, len(credits))
+		for i, c := range credits {
+			out[i] = itemObservation{attempt: i, credit: c, rest: rests[i], hasRest: true}
+			if i < len(responses) {
+				out[i].response = responses[i]
+				out[i].answered = true
+			}
+		}
+		return out
+	}
+	f := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		name                          string
+		quiz                          models.Quiz
+		obs                           []itemObservation
+		difficulty, upperD, lowerD    *float64
+		discrimination, pointBiserial *float64
+		flags                         []string
+	}{
+		{
+			name:       "discriminating",
+			quiz:       quiz,
+			obs:        obs([]float64{1, 1, 0, 0}, `"A"`, `"A"`, `"B"`, `"C"`),
+			difficulty: f(0.5), upperD: f(1), lowerD: f(0), discrimination: f(1), pointBiserial: f(0.894),
+			flags: []string{"few_attempts"},
+		},
+		{
+			name:       "negative",
+			quiz:       quiz,
+			obs:        obs([]float64{0, 0, 1, 1}, `"B"`, `"B"`, `"A"`, `"A"`),
+			difficulty: f(0.5), upperD: f(0), lowerD: f(1), discrimination: f(-1), pointBiserial: f(-0.894),
+			flags: []string{"few_attempts", "negative_discrimination", "distractor_attracts_upper_group"},
+		},
+		{
+			// Everyone right: no variance, so no point-biserial.
+			name:       "zero variance easy",
+			quiz:       quiz,
+			obs:        obs([]float64{1, 1, 1, 1}),
+			difficulty: f(1), upperD: f(1), lowerD: f(1), discrimination: f(0),
+			flags: []string{"few_attempts", "too_easy"},
+		},
+		{
+			name:       "zero variance hard",
+			quiz:       quiz,
+			obs:        obs([]float64{0, 0, 0, 0}),
+			difficulty: f(0), upperD: f(0), lowerD: f(0), discrimination: f(0),
+			flags: []string{"few_attempts", "too_hard"},
+		},
+		{
+			name:       "partial credit",
+			quiz:       models.Quiz{Type: "essay", Points: 10},
+			obs:        obs([]float64{0.9, 0.6, 0.5, 0.2}),
+			difficulty: f(0.55), upperD: f(0.75), lowerD: f(0.35), discrimination: f(0.4), pointBiserial: f(0.984),
+			flags: []string{"few_attempts"},
+		},
+		{
+			name:  "never shown",
+			quiz:  quiz,
+			flags: []string{"few_attempts"},
+		},
+	}
+	for _, tt := range tests {
+		st := analyseItem(tt.quiz, tt.obs, upper, lower)
+		check := func(field string, got, want *float64) {
+			if (got == nil) != (want == nil) || got != nil && *got != *want {
+				t.Errorf("%s: %s = %v, want %v", tt.name, field, fmtPtr(got), fmtPtr(want))
+			}
+		}
+		check("difficulty", st.Difficulty, tt.difficulty)
+		check("upper difficulty", st.UpperDifficulty, tt.upperD)
+		check("lower difficulty", st.LowerDifficulty, tt.lowerD)
+		check("discrimination", st.Discrimination, tt.discrimination)
+		check("point-biserial", st.PointBiserial, tt.pointBiserial)
+		if !reflect.DeepEqual(st.Flags, tt.flags) {
+			t.Errorf("%s: flags = %v, want %v", tt.name, st.Flags, tt.flags)
+		}
+	}
+}
+
+func fmtPtr(f *float64) any {
+	if f == nil {
+		return nil
+	}
+	return *f
+}
+
+func TestAnalyseItemOptions(t *testing.T) {
+	quiz := models.Quiz{Model: gorm.Model{ID: 7}, Type: "multiple_select", Points: 2, Options: `["A","B","C"]`, Answer: `["A","C"]`}
+	obs := []itemObservation{
+		{attempt: 0, credit: 1, answered: true, response: `["A","C","A"]`, hasRest: true, rest: 90},
+		{attempt: 1, credit: 0.5, answered: true, response: `["A","B"]`, hasRest: true, rest: 50},
+		{attempt: 2, credit: 0, response: "null"},
+	}
+	st := analyseItem(quiz, obs, indexSet([]int{0}), indexSet([]int{2}))
+
+	want := []itemOption{
+		{Option: "A", Correct: true, Count: 2, Share: 0.667, Upper: 1},
+		{Option: "B", Count: 1, Share: 0.333},
+		{Option: "C", Correct: true, Count: 1, Share: 0.333, Upper: 1},
+	}
+	if !reflect.DeepEqual(st.Options, want) {
+		t.Errorf("options = %+v, want %+v", st.Options, want)
+	}
+	if st.QuizID != 7 || st.Shown != 3 || st.Answered != 2 || *st.Difficulty != 0.5 {
+		t.Errorf("stats = %+v", st)
+	}
+	// Only two observations have a rest score.
+	if st.PointBiserial == nil || *st.PointBiserial != 1 {
+		t.Errorf("point-biserial = %v, want 1", fmtPtr(st.PointBiserial))
+	}
+}
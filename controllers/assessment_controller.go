@@ -0,0 +1,246 @@
+package controllers
+
+import (
+	"backend-elearning/database"
+	"backend-elearning/models"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// assessmentInput is an assessment as sent by the instructor.
+type assessmentInput struct {
+	Title     string     `json:"title"`
+	Category  string     `json:"category"`   // "exam" if left out
+	MaxPoints float64    `json:"max_points"` // 100 if left out
+	ModuleID  *uint      `json:"module_id"`  // score from this module's quiz
+	DueAt     *time.Time `json:"due_at"`
+}
+
+func (in *assessmentInput) validate(courseID uint) error {
+	in.Title = strings.TrimSpace(in.Title)
+	in.Category = strings.TrimSpace(in.Category)
+	if in.Title == "" {
+		return fiber.NewError(400, "title is required")
+	}
+	if in.Category == "" {
+		in.Category = "exam"
+	}
+	if len(in.Category) > 64 {
+		return fiber.NewError(400, "category is too long")
+	}
+	if in.MaxPoints == 0 {
+		in.MaxPoints = 100
+	}
+	if !(in.MaxPoints > 0) || math.IsInf(in.MaxPoints, 0) {
+		return fiber.NewError(400, "max_points must be more than 0")
+	}
+	if in.ModuleID != nil {
+		var n int64
+		database.DB.Model(&models.Module{}).Where("id = ? AND course_id = ?", *in.ModuleID, courseID).Count(&n)
+		if n == 0 {
+			return fiber.NewError(400, "module_id is not a module of this course")
+		}
+	}
+	return nil
+}
+
+// loadOwnedAssessment loads the :assessment_id assessment of the
+// :course_id course and checks that the calling instructor owns the course.
+func loadOwnedAssessment(c *fiber.Ctx) (*models.Assessment, error) {
+	course, err := loadOwnedCourse(c, c.Params("course_id"))
+	if err != nil {
+		return nil, err
+	}
+	var a models.Assessment
+	if err := database.DB.Where("id = ? AND course_id = ?", c.Params("assessment_id"), course.ID).First(&a).Error; err != nil {
+		return nil, fiber.NewError(404, "assessment not found for this course")
+	}
+	return &a, nil
+}
+
+// ListAssessments -> GET /instructor/courses/:course_id/assessments (requires instructor)
+func ListAssessments(c *fiber.Ctx) error {
+	course, err := loadOwnedCourse(c, c.Params("course_id"))
+	if err != nil {
+		return sendError(c, err)
+	}
+	var assessments []models.Assessment
+	if err := database.DB.Where("course_id = ?", course.ID).Order("position ASC, id ASC").Find(&assessments).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(assessments)
+}
+
+// CreateAssessment -> POST /instructor/courses/:course_id/assessments (requires instructor)
+// Body: {"title", "category", "max_points", "module_id", "due_at"}. With a
+// module_id the score is the student's standing on that module's quiz,
+// which then no longer counts as a quiz of its own in the gradebook.
+func CreateAssessment(c *fiber.Ctx) error {
+	course, err := loadOwnedCourse(c, c.Params("course_id"))
+	if err != nil {
+		return sendError(c, err)
+	}
+	var in assessmentInput
+	if err := c.BodyParser(&in); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := in.validate(course.ID); err != nil {
+		return sendError(c, err)
+	}
+
+	var last struct{ Max int }
+	database.DB.Model(&models.Assessment{}).Select("COALESCE(MAX(position), 0) AS max").Where("course_id = ?", course.ID).Scan(&last)
+
+	a := models.Assessment{
+		CourseID:  course.ID,
+		Title:     in.Title,
+		Category:  in.Category,
+		MaxPoints: in.MaxPoints,
+		ModuleID:  in.ModuleID,
+		DueAt:     in.DueAt,
+		Position:  last.Max + 1,
+	}
+	if err := database.DB.Create(&a).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(201).JSON(fiber.Map{
+		"message": "assessment created successfully",
+		"data":    a,
+	})
+}
+
+// UpdateAssessment -> PUT /instructor/courses/:course_id/assessments/:assessment_id (requires instructor)
+// Body as for CreateAssessment; every field is replaced. Scores already
+// entered are kept, including those above a lowered max_points.
+func UpdateAssessment(c *fiber.Ctx) error {
+	a, err := loadOwnedAssessment(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+	var in assessmentInput
+	if err := c.BodyParser(&in); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := in.validate(a.CourseID); err != nil {
+		return sendError(c, err)
+	}
+
+	err = database.DB.Model(a).Updates(map[string]interface{}{
+		"title":      in.Title,
+		"category":   in.Category,
+		"max_points": in.MaxPoints,
+		"module_id":  in.ModuleID,
+		"due_at":     in.DueAt,
+	}).Error
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	database.DB.First(a, a.ID)
+	return c.JSON(fiber.Map{
+		"message": "assessment updated successfully",
+		"data":    a,
+	})
+}
+
+// DeleteAssessment -> DELETE /instructor/courses/:course_id/assessments/:assessment_id (requires instructor)
+func DeleteAssessment(c *fiber.Ctx) error {
+	a, err := loadOwnedAssessment(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("assessment_id = ?", a.ID).Delete(&models.AssessmentScore{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(a).Error
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{
+		"message": "assessment deleted successfully",
+	})
+}
+
+// assessmentScoreInput is one student's score. A null points removes it.
+type assessmentScoreInput struct {
+	UserID   uint     `json:"user_id"`
+	Points   *float64 `json:"points"`
+	Feedback string   `json:"feedback"`
+}
+
+// SetAssessmentScores -> PUT /instructor/courses/:course_id/assessments/:assessment_id/scores (requires instructor)
+// Body: [{"user_id", "points", "feedback"}] for enrolled students; points
+// run from 0 to the assessment's max_points. Students are notified. Fails
+// with 409 for assessments scored from a module's quiz.
+func SetAssessmentScores(c *fiber.Ctx) error {
+	a, err := loadOwnedAssessment(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+	if a.ModuleID != nil {
+		return c.Status(409).JSON(fiber.Map{"error": "this assessment is scored from its module's quiz"})
+	}
+	graderID, _ := currentUserID(c)
+
+	var payload []assessmentScoreInput
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if len(payload) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "no scores provided"})
+	}
+	for i, s := range payload {
+		if p := s.Points; p != nil && (*p < 0 || *p > a.MaxPoints || math.IsNaN(*p)) {
+			return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("score %d: points must be between 0 and %g", i+1, a.MaxPoints)})
+		}
+		var n int64
+		database.DB.Model(&models.Enrollment{}).Where("user_id = ? AND course_id = ?", s.UserID, a.CourseID).Count(&n)
+		if n == 0 {
+			return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("score %d: user %d is not enrolled in this course", i+1, s.UserID)})
+		}
+	}
+
+	now := time.Now()
+	var scores []models.AssessmentScore
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		for _, s := range payload {
+			if s.Points == nil {
+				if err := tx.Unscoped().Where("assessment_id = ? AND user_id = ?", a.ID, s.UserID).Delete(&models.AssessmentScore{}).Error; err != nil {
+					return err
+				}
+				continue
+			}
+
+			score := models.AssessmentScore{AssessmentID: a.ID, UserID: s.UserID}
+			tx.Where("assessment_id = ? AND user_id = ?", a.ID, s.UserID).First(&score)
+			score.Points = round2(*s.Points)
+			score.Feedback = s.Feedback
+			score.GraderID = &graderID
+			score.GradedAt = &now
+			if err := tx.Save(&score).Error; err != nil {
+				return err
+			}
+			scores = append(scores, score)
+
+			msg := fmt.Sprintf("%s was graded: %g/%g", a.Title, score.Points, a.MaxPoints)
+			if err := notifyUser(tx, s.UserID, "assessment_graded", msg, fiber.Map{"course_id": a.CourseID, "assessment_id": a.ID}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "scores saved successfully",
+		"data":    scores,
+	})
+}
@@ -0,0 +1,703 @@
+package controllers
+
+import (
+	"backend-elearning/assets"
+	"backend-elearning/database"
+	"backend-elearning/models"
+	"backend-elearning/questions"
+	"backend-elearning/utils"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// latePolicies are what happens to submissions after the due date: they
+// are refused, accepted and marked late, or accepted with a penalty.
+var latePolicies = map[string]bool{"reject": true, "accept": true, "penalty": true}
+
+// maxPeerReviewers caps how many classmates review each submission.
+const maxPeerReviewers = 10
+
+// assignmentInput is an assignment as sent by the instructor.
+type assignmentInput struct {
+	Title        string     `json:"title"`
+	Instructions string     `json:"instructions"`
+	DueAt        *time.Time `json:"due_at"`
+	LatePolicy   string     `json:"late_policy"`  // "reject" if left out
+	LatePenalty  float64    `json:"late_penalty"` // % per started day, for "penalty"
+	LateCutoff   *time.Time `json:"late_cutoff"`
+	AllowedTypes []string   `json:"allowed_types"` // e.g. [".pdf", ".docx"]
+	AllowText    *bool      `json:"allow_text"`    // true if left out
+	MaxPoints    float64    `json:"max_points"`    // 100 if left out
+
+	PeerReviewers   int              `json:"peer_reviewers"` // 0 turns peer review off
+	PeerRubric      questions.Rubric `json:"peer_rubric"`
+	PeerReviewDueAt *time.Time       `json:"peer_review_due_at"`
+}
+
+func (in *assignmentInput) validate() error {
+	in.Title = strings.TrimSpace(in.Title)
+	if in.Title == "" {
+		return fiber.NewError(400, "title is required")
+	}
+
+	if in.LatePolicy == "" {
+		in.LatePolicy = "reject"
+	}
+	if !latePolicies[in.LatePolicy] {
+		return fiber.NewError(400, "late_policy must be reject, accept or penalty")
+	}
+	if in.LatePolicy == "penalty" {
+		if !(in.LatePenalty > 0) || in.LatePenalty > 100 {
+			return fiber.NewError(400, "late_penalty must be more than 0 and at most 100")
+		}
+	} else {
+		in.LatePenalty = 0
+	}
+	if in.LateCutoff != nil {
+		if in.LatePolicy == "reject" {
+			return fiber.NewError(400, "late_cutoff needs a late_policy that accepts late submissions")
+		}
+		if in.DueAt == nil || !in.LateCutoff.After(*in.DueAt) {
+			return fiber.NewError(400, "late_cutoff must be after due_at")
+		}
+	}
+
+	// Hanya tipe yang bisa diperiksa isinya oleh assets
+	types := make([]string, 0, len(in.AllowedTypes))
+	seen := make(map[string]bool)
+	for _, t := range in.AllowedTypes {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t != "" && !strings.HasPrefix(t, ".") {
+			t = "." + t
+		}
+		known := false
+		for _, a := range allowedAttachmentTypes {
+			known = known || a == t
+		}
+		if !known {
+			return fiber.NewError(400, fmt.Sprintf("file type %q is not supported; use %s", t, strings.Join(allowedAttachmentTypes, ", ")))
+		}
+		if !seen[t] {
+			seen[t] = true
+			types = append(types, t)
+		}
+	}
+	in.AllowedTypes = types
+	if in.AllowText == nil {
+		allow := true
+		in.AllowText = &allow
+	}
+	if !*in.AllowText && len(in.AllowedTypes) == 0 {
+		return fiber.NewError(400, "an assignment must take text, files or both")
+	}
+
+	if in.MaxPoints == 0 {
+		in.MaxPoints = 100
+	}
+	if !(in.MaxPoints > 0) || math.IsInf(in.MaxPoints, 0) {
+		return fiber.NewError(400, "max_points must be more than 0")
+	}
+
+	// Review dibagikan setelah tenggat, jadi perlu due_at
+	if in.PeerReviewers < 0 || in.PeerReviewers > maxPeerReviewers {
+		return fiber.NewError(400, fmt.Sprintf("peer_reviewers must be between 0 and %d", maxPeerReviewers))
+	}
+	if in.PeerReviewers == 0 {
+		in.PeerRubric, in.PeerReviewDueAt = nil, nil
+		return nil
+	}
+	if in.DueAt == nil {
+		return fiber.NewError(400, "peer review needs a due_at")
+	}
+	if len(in.PeerRubric) == 0 {
+		return fiber.NewError(400, "peer review needs a peer_rubric")
+	}
+	for i := range in.PeerRubric {
+		cr := &in.PeerRubric[i]
+		cr.Criterion = strings.TrimSpace(cr.Criterion)
+		if cr.Criterion == "" {
+			return fiber.NewError(400, fmt.Sprintf("peer_rubric criterion %d has no description", i+1))
+		}
+		if !(cr.Points > 0) || math.IsInf(cr.Points, 0) {
+			return fiber.NewError(400, fmt.Sprintf("peer_rubric criterion %d must be worth more than 0 points", i+1))
+		}
+	}
+	closes := *in.DueAt
+	if in.LateCutoff != nil {
+		closes = *in.LateCutoff
+	}
+	if in.PeerReviewDueAt != nil && !in.PeerReviewDueAt.After(closes) {
+		return fiber.NewError(400, "peer_review_due_at must be after submissions close")
+	}
+	return nil
+}
+
+func (in assignmentInput) apply(a *models.Assignment) {
+	a.Title = in.Title
+	a.Instructions = in.Instructions
+	a.DueAt = in.DueAt
+	a.LatePolicy = in.LatePolicy
+	a.LatePenalty = in.LatePenalty
+	a.LateCutoff = in.LateCutoff
+	a.AllowedTypes = strings.Join(in.AllowedTypes, ",")
+	a.AllowText = *in.AllowText
+	a.MaxPoints = in.MaxPoints
+	a.PeerReviewers = in.PeerReviewers
+	a.PeerRubric = ""
+	if len(in.PeerRubric) > 0 {
+		b, _ := json.Marshal(in.PeerRubric)
+		a.PeerRubric = string(b)
+	}
+	a.PeerReviewDueAt = in.PeerReviewDueAt
+}
+
+// allowedTypes returns the file extensions the assignment takes.
+func allowedTypes(a models.Assignment) []string {
+	if a.AllowedTypes == "" {
+		return []string{}
+	}
+	return strings.Split(a.AllowedTypes, ",")
+}
+
+// lateness returns how many started days after the due date at is, or an
+// error when the assignment takes no submission at that time.
+func lateness(a models.Assignment, at time.Time) (int, error) {
+	if a.DueAt == nil || !at.After(*a.DueAt) {
+		return 0, nil
+	}
+	if a.LatePolicy == "reject" {
+		return 0, fiber.NewError(403, "the due date has passed")
+	}
+	if a.LateCutoff != nil && at.After(*a.LateCutoff) {
+		return 0, fiber.NewError(403, "late submissions are closed")
+	}
+	return int(math.Ceil(at.Sub(*a.DueAt).Hours() / 24)), nil
+}
+
+// latePenalty is the share of the points (in %) a submission loses.
+func latePenalty(a models.Assignment, daysLate int) float64 {
+	if a.LatePolicy != "penalty" || daysLate == 0 {
+		return 0
+	}
+	return math.Min(100, round2(a.LatePenalty*float64(daysLate)))
+}
+
+// assignmentResponse renders an assignment with its instructions as
+// sanitized HTML and whether it still takes submissions, which it does not
+// once peer reviews are handed out.
+func assignmentResponse(a models.Assignment, now time.Time) fiber.Map {
+	_, closed := lateness(a, now)
+	return fiber.Map{
+		"id":            a.ID,
+		"module_id":     a.ModuleID,
+		"title":         a.Title,
+		"instructions":  a.Instructions,
+		"html":          utils.RenderMarkdown(a.Instructions),
+		"due_at":        a.DueAt,
+		"late_policy":   a.LatePolicy,
+		"late_penalty":  a.LatePenalty,
+		"late_cutoff":   a.LateCutoff,
+		"allowed_types": allowedTypes(a),
+		"allow_text":    a.AllowText,
+		"max_points":    a.MaxPoints,
+		"position":      a.Position,
+		"open":          closed == nil && a.PeerAssignedAt == nil,
+
+		"peer_reviewers":     a.PeerReviewers,
+		"peer_rubric":        peerRubric(a),
+		"peer_review_due_at": a.PeerReviewDueAt,
+		"peer_assigned_at":   a.PeerAssignedAt,
+	}
+}
+
+// submissionResponse renders a submission with the download route of its
+// file under prefix ("instructor" or "me").
+func submissionResponse(s models.AssignmentSubmission, module *models.Module, prefix string) fiber.Map {
+	out := fiber.Map{
+		"id":           s.ID,
+		"attempt":      s.Attempt,
+		"user_id":      s.UserID,
+		"text":         s.Text,
+		"submitted_at": s.SubmittedAt,
+		"days_late":    s.DaysLate,
+		"late":         s.DaysLate > 0,
+		"points":       s.Points,
+		"penalty":      s.Penalty,
+		"score":        s.Score,
+		"peer_score":   s.PeerScore,
+		"feedback":     s.Feedback,
+		"graded_at":    s.GradedAt,
+	}
+	if s.FileUrl != "" {
+		out["file_name"] = s.FileName
+		out["download_url"] = fmt.Sprintf("/api/%s/courses/%d/modules/%d/assignments/%d/submissions/%d/file", prefix, module.CourseID, module.ID, s.AssignmentID, s.ID)
+	}
+	return out
+}
+
+// loadAssignment loads the :assignment_id assignment of module.
+func loadAssignment(c *fiber.Ctx, module *models.Module) (*models.Assignment, error) {
+	var a models.Assignment
+	if err := database.DB.Where("id = ? AND module_id = ?", c.Params("assignment_id"), module.ID).First(&a).Error; err != nil {
+		return nil, fiber.NewError(404, "assignment not found for this module")
+	}
+	return &a, nil
+}
+
+// releaseAssignments deletes the assignments of a module with their
+// submissions, dropping the references held on the submitted files.
+func releaseAssignments(ctx context.Context, moduleID uint) {
+	var ids []uint
+	database.DB.Model(&models.Assignment{}).Where("module_id = ?", moduleID).Pluck("id", &ids)
+	if len(ids) == 0 {
+		return
+	}
+	var subs []models.AssignmentSubmission
+	database.DB.Where("assignment_id IN ?", ids).Find(&subs)
+	database.DB.Unscoped().Where("assignment_id IN ?", ids).Delete(&models.PeerReview{})
+	database.DB.Unscoped().Where("assignment_id IN ?", ids).Delete(&models.AssignmentSubmission{})
+	database.DB.Where("id IN ?", ids).Delete(&models.Assignment{})
+	for _, s := range subs {
+		_ = assets.Release(ctx, s.FileUrl)
+	}
+}
+
+// ListAssignments -> GET /instructor/courses/:course_id/modules/:module_id/assignments (requires instructor)
+func ListAssignments(c *fiber.Ctx) error {
+	module, err := loadOwnedModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+	var list []models.Assignment
+	if err := database.DB.Where("module_id = ?", module.ID).Order("position ASC, id ASC").Find(&list).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	now := time.Now()
+	out := make([]fiber.Map, 0, len(list))
+	for _, a := range list {
+		out = append(out, assignmentResponse(a, now))
+	}
+	return c.JSON(out)
+}
+
+// CreateAssignment -> POST /instructor/courses/:course_id/modules/:module_id/assignments (requires instructor)
+// Body: {"title", "instructions", "due_at", "late_policy", "late_penalty",
+// "late_cutoff", "allowed_types", "allow_text", "max_points"}. Late policy
+// "reject" refuses submissions after due_at, "accept" marks them late and
+// "penalty" takes late_penalty % of the points per started day late; with
+// late_cutoff no late submissions are taken after it.
+func CreateAssignment(c *fiber.Ctx) error {
+	module, err := loadOwnedModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+	var in assignmentInput
+	if err := c.BodyParser(&in); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := in.validate(); err != nil {
+		return sendError(c, err)
+	}
+
+	var last struct{ Max int }
+	database.DB.Model(&models.Assignment{}).Select("COALESCE(MAX(position), 0) AS max").Where("module_id = ?", module.ID).Scan(&last)
+
+	a := models.Assignment{ModuleID: module.ID, Position: last.Max + 1}
+	in.apply(&a)
+	if err := database.DB.Create(&a).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(201).JSON(fiber.Map{
+		"message": "assignment created successfully",
+		"data":    assignmentResponse(a, time.Now()),
+	})
+}
+
+// UpdateAssignment -> PUT /instructor/courses/:course_id/modules/:module_id/assignments/:assignment_id (requires instructor)
+// Body as for CreateAssignment; every field is replaced. Submissions and
+// grades already given are kept as they are. Once peer reviews are handed
+// out, peer_reviewers and peer_rubric can no longer change.
+func UpdateAssignment(c *fiber.Ctx) error {
+	module, err := loadOwnedModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+	a, err := loadAssignment(c, module)
+	if err != nil {
+		return sendError(c, err)
+	}
+	var in assignmentInput
+	if err := c.BodyParser(&in); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := in.validate(); err != nil {
+		return sendError(c, err)
+	}
+	if a.PeerAssignedAt != nil {
+		next := *a
+		in.apply(&next)
+		if next.PeerReviewers != a.PeerReviewers || next.PeerRubric != a.PeerRubric {
+			return c.Status(409).JSON(fiber.Map{"error": "peer reviews are already handed out"})
+		}
+	}
+
+	in.apply(a)
+	if err := database.DB.Save(a).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{
+		"message": "assignment updated successfully",
+		"data":    assignmentResponse(*a, time.Now()),
+	})
+}
+
+// DeleteAssignment -> DELETE /instructor/courses/:course_id/modules/:module_id/assignments/:assignment_id (requires instructor)
+// The submissions, their files and peer reviews go too.
+func DeleteAssignment(c *fiber.Ctx) error {
+	module, err := loadOwnedModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+	a, err := loadAssignment(c, module)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	var subs []models.AssignmentSubmission
+	database.DB.Where("assignment_id = ?", a.ID).Find(&subs)
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("assignment_id = ?", a.ID).Delete(&models.PeerReview{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("assignment_id = ?", a.ID).Delete(&models.AssignmentSubmission{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(a).Error
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	for _, s := range subs {
+		_ = assets.Release(c.UserContext(), s.FileUrl)
+	}
+	return c.JSON(fiber.Map{
+		"message": "assignment deleted successfully",
+	})
+}
+
+// ListSubmissions -> GET /instructor/courses/:course_id/modules/:module_id/assignments/:assignment_id/submissions (requires instructor)
+// Every enrolled student with their latest submission and status
+// (missing, submitted or graded). ?user_id= lists all of one student's
+// submissions instead, newest first.
+func ListSubmissions(c *fiber.Ctx) error {
+	module, err := loadOwnedModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+	a, err := loadAssignment(c, module)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	if uid := c.QueryInt("user_id"); uid > 0 {
+		var subs []models.AssignmentSubmission
+		if err := database.DB.Where("assignment_id = ? AND user_id = ?", a.ID, uid).Order("attempt DESC").Find(&subs).Error; err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		out := make([]fiber.Map, 0, len(subs))
+		for _, s := range subs {
+			out = append(out, submissionResponse(s, module, "instructor"))
+		}
+		return c.JSON(out)
+	}
+
+	var enrollments []models.Enrollment
+	if err := database.DB.Preload("User").Where("course_id = ?", module.CourseID).Find(&enrollments).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	var subs []models.AssignmentSubmission
+	if err := database.DB.Where("assignment_id = ?", a.ID).Order("attempt DESC").Find(&subs).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	latest := make(map[uint]models.AssignmentSubmission)
+	for _, s := range subs {
+		if _, ok := latest[s.UserID]; !ok {
+			latest[s.UserID] = s
+		}
+	}
+
+	counts := map[string]int{"missing": 0, "submitted": 0, "graded": 0}
+	students := make([]fiber.Map, 0, len(enrollments))
+	for _, e := range enrollments {
+		row := fiber.Map{
+			"user_id":   e.UserID,
+			"full_name": e.User.FullName,
+			"email":     e.User.Email,
+			"status":    "missing",
+		}
+		if s, ok := latest[e.UserID]; ok {
+			row["submission"] = submissionResponse(s, module, "instructor")
+			row["status"] = "submitted"
+			if s.Score != nil {
+				row["status"] = "graded"
+			}
+		}
+		counts[row["status"].(string)]++
+		students = append(students, row)
+	}
+
+	return c.JSON(fiber.Map{
+		"assignment": assignmentResponse(*a, time.Now()),
+		"counts":     counts,
+		"students":   students,
+	})
+}
+
+// submissionGradeInput is a grade for a submission. A null points removes
+// the grade, going back to the peer score if there is one; penalty
+// overrides the late penalty, e.g. 0 to waive it.
+type submissionGradeInput struct {
+	Points   *float64 `json:"points"`
+	Penalty  *float64 `json:"penalty"`
+	Feedback string   `json:"feedback"`
+}
+
+// GradeSubmission -> PUT /instructor/courses/:course_id/modules/:module_id/assignments/:assignment_id/submissions/:submission_id/grade (requires instructor)
+// Body: {"points", "feedback", "penalty"}. Points run from 0 to the
+// assignment's max_points; the score is what remains after the late
+// penalty. A grade given here overrides the peer score. The student is
+// notified.
+func GradeSubmission(c *fiber.Ctx) error {
+	module, err := loadOwnedModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+	a, err := loadAssignment(c, module)
+	if err != nil {
+		return sendError(c, err)
+	}
+	var sub models.AssignmentSubmission
+	if err := database.DB.Where("id = ? AND assignment_id = ?", c.Params("submission_id"), a.ID).First(&sub).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "submission not found for this assignment"})
+	}
+	graderID, _ := currentUserID(c)
+
+	var in submissionGradeInput
+	if err := c.BodyParser(&in); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if p := in.Points; p != nil && (*p < 0 || *p > a.MaxPoints || math.IsNaN(*p)) {
+		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("points must be between 0 and %g", a.MaxPoints)})
+	}
+	if p := in.Penalty; p != nil && (*p < 0 || *p > 100 || math.IsNaN(*p)) {
+		return c.Status(400).JSON(fiber.Map{"error": "penalty must be between 0 and 100"})
+	}
+
+	if in.Points == nil {
+		sub.Points, sub.Score, sub.GraderID, sub.GradedAt = nil, nil, nil, nil
+		sub.Penalty = latePenalty(*a, sub.DaysLate)
+		sub.Feedback = in.Feedback
+		applyPeerScore(&sub)
+	} else {
+		points := round2(*in.Points)
+		sub.Penalty = latePenalty(*a, sub.DaysLate)
+		if in.Penalty != nil {
+			sub.Penalty = round2(*in.Penalty)
+		}
+		score := round2(points * (1 - sub.Penalty/100))
+		now := time.Now()
+		sub.Points, sub.Score = &points, &score
+		sub.Feedback = in.Feedback
+		sub.GraderID, sub.GradedAt = &graderID, &now
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&sub).Error; err != nil {
+			return err
+		}
+		if sub.Score == nil {
+			return nil
+		}
+		msg := fmt.Sprintf("%s was graded: %g/%g", a.Title, *sub.Score, a.MaxPoints)
+		return notifyUser(tx, sub.UserID, "assignment_graded", msg, fiber.Map{"course_id": module.CourseID, "module_id": module.ID, "assignment_id": a.ID, "submission_id": sub.ID})
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "submission graded successfully",
+		"data":    submissionResponse(sub, module, "instructor"),
+	})
+}
+
+// ListMyAssignments -> GET /me/courses/:course_id/modules/:module_id/assignments
+// The module's assignments with the student's latest submission of each.
+func ListMyAssignments(c *fiber.Ctx) error {
+	module, err := loadEnrolledModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+	userID, _ := currentUserID(c)
+
+	var list []models.Assignment
+	if err := database.DB.Where("module_id = ?", module.ID).Order("position ASC, id ASC").Find(&list).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	now := time.Now()
+	out := make([]fiber.Map, 0, len(list))
+	for _, a := range list {
+		row := assignmentResponse(a, now)
+		row["submission"] = nil
+		var sub models.AssignmentSubmission
+		if database.DB.Where("assignment_id = ? AND user_id = ?", a.ID, userID).Order("attempt DESC").First(&sub).Error == nil {
+			row["submission"] = submissionResponse(sub, module, "me")
+		}
+		out = append(out, row)
+	}
+	return c.JSON(out)
+}
+
+// ListMySubmissions -> GET /me/courses/:course_id/modules/:module_id/assignments/:assignment_id/submissions
+// All of the student's submissions, newest first.
+func ListMySubmissions(c *fiber.Ctx) error {
+	module, err := loadEnrolledModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+	a, err := loadAssignment(c, module)
+	if err != nil {
+		return sendError(c, err)
+	}
+	userID, _ := currentUserID(c)
+
+	var subs []models.AssignmentSubmission
+	if err := database.DB.Where("assignment_id = ? AND user_id = ?", a.ID, userID).Order("attempt DESC").Find(&subs).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	out := make([]fiber.Map, 0, len(subs))
+	for _, s := range subs {
+		out = append(out, submissionResponse(s, module, "me"))
+	}
+	return c.JSON(out)
+}
+
+// SubmitAssignment -> POST /me/courses/:course_id/modules/:module_id/assignments/:assignment_id/submissions
+// Form-data: text and/or a file (or the upload_id of a finished resumable
+// upload) of one of the assignment's allowed types. Each call is a new
+// submission; the latest one is graded. Late submissions follow the
+// assignment's late policy.
+func SubmitAssignment(c *fiber.Ctx) error {
+	module, err := loadEnrolledModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+	a, err := loadAssignment(c, module)
+	if err != nil {
+		return sendError(c, err)
+	}
+	userID, _ := currentUserID(c)
+
+	now := time.Now()
+	daysLate, err := lateness(*a, now)
+	if err != nil {
+		return sendError(c, err)
+	}
+	if a.PeerAssignedAt != nil {
+		return c.Status(403).JSON(fiber.Map{"error": "peer review has started; submissions are closed"})
+	}
+
+	text := strings.TrimSpace(c.FormValue("text"))
+	withFile := hasUpload(c, "file")
+	if text != "" && !a.AllowText {
+		return c.Status(400).JSON(fiber.Map{"error": "this assignment takes files only"})
+	}
+	if withFile && a.AllowedTypes == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "this assignment takes text only"})
+	}
+	if text == "" && !withFile {
+		return c.Status(400).JSON(fiber.Map{"error": "text or file is required"})
+	}
+
+	sub := models.AssignmentSubmission{
+		AssignmentID: a.ID,
+		UserID:       userID,
+		Text:         text,
+		SubmittedAt:  now,
+		DaysLate:     daysLate,
+		Penalty:      latePenalty(*a, daysLate),
+	}
+	if withFile {
+		asset, name, err := storeUpload(c, "file", allowedTypes(*a)...)
+		if err != nil {
+			return sendError(c, err)
+		}
+		sub.FileUrl = assets.URL(asset)
+		sub.FileName = name
+	}
+
+	var course models.Course
+	database.DB.First(&course, module.CourseID)
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var last struct{ Max int }
+		tx.Model(&models.AssignmentSubmission{}).Select("COALESCE(MAX(attempt), 0) AS max").Where("assignment_id = ? AND user_id = ?", a.ID, userID).Scan(&last)
+		sub.Attempt = last.Max + 1
+		if err := tx.Create(&sub).Error; err != nil {
+			return err
+		}
+		msg := fmt.Sprintf("New submission for %s", a.Title)
+		return notifyUser(tx, course.InstructorID, "assignment_submitted", msg, fiber.Map{"course_id": module.CourseID, "module_id": module.ID, "assignment_id": a.ID, "submission_id": sub.ID})
+	})
+	if err != nil {
+		_ = assets.Release(c.UserContext(), sub.FileUrl)
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"message": "assignment submitted successfully",
+		"data":    submissionResponse(sub, module, "me"),
+	})
+}
+
+// GetSubmissionFile -> GET /me/courses/:course_id/modules/:module_id/assignments/:assignment_id/submissions/:submission_id/file
+// Also mounted for instructors. Students only get their own submissions,
+// instructors those in their own courses.
+func GetSubmissionFile(c *fiber.Ctx) error {
+	var module *models.Module
+	var err error
+	staff := c.Locals("role") == "instructor"
+	if staff {
+		module, err = loadOwnedModule(c)
+	} else {
+		module, err = loadEnrolledModule(c)
+	}
+	if err != nil {
+		return sendError(c, err)
+	}
+	a, err := loadAssignment(c, module)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	query := database.DB.Where("id = ? AND assignment_id = ?", c.Params("submission_id"), a.ID)
+	if !staff {
+		userID, _ := currentUserID(c)
+		query = query.Where("user_id = ?", userID)
+	}
+	var sub models.AssignmentSubmission
+	if err := query.First(&sub).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "submission not found"})
+	}
+	if sub.FileUrl == "" {
+		return c.Status(404).JSON(fiber.Map{"error": "no file attached to this submission"})
+	}
+
+	return sendStoredFile(c, sub.FileUrl, sub.FileName, "attachment")
+}
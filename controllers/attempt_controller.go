@@ -0,0 +1,674 @@
+package controllers
+
+import (
+	"backend-elearning/database"
+	"backend-elearning/models"
+	"backend-elearning/questions"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// attemptGrace is how long after its time limit an attempt still accepts
+// answers, to allow for slow connections.
+const attemptGrace = 30 * time.Second
+
+// scoringPolicies are the ways a module can count a student's attempts.
+var scoringPolicies = map[string]bool{"highest": true, "latest": true, "average": true}
+
+// reviewPolicies are the moments students may review correct answers.
+var reviewPolicies = map[string]bool{"never": true, "after_attempt": true, "after_pass": true, "after_deadline": true}
+
+// attemptAnswer is one response sent by a student.
+type attemptAnswer struct {
+	QuizID uint            `json:"quiz_id"`
+	Answer json.RawMessage `json:"answer"` // format depends on the question type
+}
+
+// attemptSummary is what grading an attempt found.
+type attemptSummary struct {
+	Correct int
+	Pending int
+}
+
+func attemptQuestionIDs(result models.QuizResult) []uint {
+	var ids []uint
+	_ = json.Unmarshal([]byte(result.QuestionIDs), &ids)
+	return ids
+}
+
+func attemptExpired(result models.QuizResult, at time.Time) bool {
+	return result.ExpiresAt != nil && at.After(result.ExpiresAt.Add(attemptGrace))
+}
+
+// attemptEnd is when an attempt submitted at now ended: when its time ran
+// out, if that was earlier.
+func attemptEnd(result models.QuizResult, now time.Time) time.Time {
+	if result.ExpiresAt != nil && result.ExpiresAt.Before(now) {
+		return *result.ExpiresAt
+	}
+	return now
+}
+
+// nextAttemptAt is when the module's cooldown after the attempt last ends.
+func nextAttemptAt(module models.Module, last models.QuizResult) time.Time {
+	ended := last.CreatedAt
+	if last.SubmittedAt != nil {
+		ended = *last.SubmittedAt
+	}
+	return ended.Add(time.Duration(module.QuizCooldown) * time.Minute)
+}
+
+// openAttempt starts an attempt at the module's quiz on the questions
+// quizIDs, shown with the options in layout (see drawAttempt), enforcing
+// the module's attempt limit and cooldown. An earlier attempt whose time
+// ran out is submitted first; call expireAttempts before the transaction so
+// that submission stays when the cooldown refuses the new attempt. Call it
+// in a transaction.
+func openAttempt(tx *gorm.DB, module models.Module, userID uint, quizIDs []uint, layout string) (models.QuizResult, error) {
+	// The enrollment row serialises attempts of the same student
+	var enrollment models.Enrollment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ? AND course_id = ?", userID, module.CourseID).First(&enrollment).Error; err != nil {
+		return models.QuizResult{}, fiber.NewError(403, "not enrolled in this course")
+	}
+
+	var attempts []models.QuizResult
+	if err := tx.Where("user_id = ? AND module_id = ?", userID, module.ID).Order("created_at DESC, id DESC").Find(&attempts).Error; err != nil {
+		return models.QuizResult{}, err
+	}
+	now := time.Now()
+	if module.QuizDeadline != nil && now.After(*module.QuizDeadline) {
+		return models.QuizResult{}, fiber.NewError(403, "the deadline for this quiz has passed")
+	}
+	for i := range attempts {
+		if attempts[i].Status != "in_progress" {
+			continue
+		}
+		if !attemptExpired(attempts[i], now) {
+			return models.QuizResult{}, fiber.NewError(409, fmt.Sprintf("attempt %d is still in progress", attempts[i].ID))
+		}
+		if _, err := submitAttempt(tx, &attempts[i]); err != nil {
+			return models.QuizResult{}, err
+		}
+	}
+
+	if module.QuizMaxAttempts > 0 && len(attempts) >= module.QuizMaxAttempts {
+		return models.QuizResult{}, fiber.NewError(403, fmt.Sprintf("no attempts left; this quiz allows %d", module.QuizMaxAttempts))
+	}
+	if module.QuizCooldown > 0 && len(attempts) > 0 {
+		if next := nextAttemptAt(module, attempts[0]); now.Before(next) {
+			return models.QuizResult{}, fiber.NewError(429, fmt.Sprintf("next attempt possible at %s", next.Format(time.RFC3339)))
+		}
+	}
+
+	ids, _ := json.Marshal(quizIDs)
+	result := models.QuizResult{
+		UserID:         userID,
+		ModuleID:       module.ID,
+		ModuleRevision: latestModuleRevision(module.ID),
+		Status:         "in_progress",
+		Questions:      len(quizIDs),
+		QuestionIDs:    string(ids),
+		Layout:         layout,
+		StartedAt:      &now,
+	}
+	if module.QuizTimeLimit > 0 {
+		expires := now.Add(time.Duration(module.QuizTimeLimit) * time.Minute)
+		result.ExpiresAt = &expires
+	}
+	// Attempts end at the deadline at the latest
+	if d := module.QuizDeadline; d != nil && (result.ExpiresAt == nil || d.Before(*result.ExpiresAt)) {
+		expires := *d
+		result.ExpiresAt = &expires
+	}
+	return result, tx.Create(&result).Error
+}
+
+// saveAttemptAnswers stores responses on an in-progress attempt, replacing
+// earlier responses to the same questions.
+func saveAttemptAnswers(tx *gorm.DB, result *models.QuizResult, answers []attemptAnswer) error {
+	allowed := make(map[uint]bool)
+	for _, id := range attemptQuestionIDs(*result) {
+		allowed[id] = true
+	}
+
+	var saved []models.QuizAnswer
+	if err := tx.Where("quiz_result_id = ?", result.ID).Find(&saved).Error; err != nil {
+		return err
+	}
+	byQuiz := make(map[uint]models.QuizAnswer, len(saved))
+	for _, a := range saved {
+		byQuiz[a.QuizID] = a
+	}
+
+	for _, a := range answers {
+		if !allowed[a.QuizID] {
+			return fiber.NewError(400, fmt.Sprintf("quiz %d is not part of this attempt", a.QuizID))
+		}
+		if existing, ok := byQuiz[a.QuizID]; ok {
+			if err := tx.Model(&existing).Update("response", string(a.Answer)).Error; err != nil {
+				return err
+			}
+			continue
+		}
+		answer := models.QuizAnswer{
+			QuizResultID: result.ID,
+			QuizID:       a.QuizID,
+			Response:     string(a.Answer),
+			Status:       "saved",
+		}
+		if err := tx.Create(&answer).Error; err != nil {
+			return err
+		}
+		byQuiz[a.QuizID] = answer
+	}
+	return nil
+}
+
+// submitAttempt grades the saved answers of an attempt and closes it.
+// Unanswered questions earn nothing; essays wait for manual grading, and
+// until then the attempt is "pending" without a score.
+func submitAttempt(tx *gorm.DB, result *models.QuizResult) (attemptSummary, error) {
+	var sum attemptSummary
+
+	// Edited questions are soft-deleted but still graded as shown
+	var quizzes []models.Quiz
+	if ids := attemptQuestionIDs(*result); len(ids) > 0 {
+		if err := tx.Unscoped().Where("id IN ?", ids).Find(&quizzes).Error; err != nil {
+			return sum, err
+		}
+	}
+	quizByID := make(map[uint]models.Quiz, len(quizzes))
+	for _, q := range quizzes {
+		quizByID[q.ID] = q
+	}
+
+	var saved []models.QuizAnswer
+	if err := tx.Where("quiz_result_id = ?", result.ID).Find(&saved).Error; err != nil {
+		return sum, err
+	}
+	for i := range saved {
+		a := &saved[i]
+		quiz, ok := quizByID[a.QuizID]
+		if !ok {
+			continue
+		}
+		if questions.IsManual(quiz.Type) {
+			a.Status = "pending"
+			a.Credit = 0
+			sum.Pending++
+		} else {
+			a.Status = "graded"
+			a.Credit = questions.Grade(quiz.Type, quiz.Options, quiz.Answer, json.RawMessage(a.Response))
+			if a.Credit == 1 {
+				sum.Correct++
+			}
+		}
+		if err := tx.Model(a).Updates(map[string]interface{}{"status": a.Status, "credit": a.Credit}).Error; err != nil {
+			return sum, err
+		}
+	}
+
+	// An expired attempt ended when its time ran out, not when it was noticed
+	now := attemptEnd(*result, time.Now())
+	result.SubmittedAt = &now
+	result.Status = "graded"
+	if sum.Pending > 0 {
+		// Skor final dihitung setelah semua essay dinilai
+		result.Status = "pending"
+	} else if err := scoreAttempt(tx, result); err != nil {
+		return sum, err
+	}
+	err := tx.Model(result).Updates(map[string]interface{}{
+		"status":       result.Status,
+		"score":        result.Score,
+		"passed":       result.Passed,
+		"points":       result.Points,
+		"max_points":   result.MaxPoints,
+		"submitted_at": now,
+	}).Error
+	return sum, err
+}
+
+// expireAttempts submits the user's in-progress attempts whose time ran out.
+func expireAttempts(userID uint) {
+	var ids []uint
+	database.DB.Model(&models.QuizResult{}).
+		Where("user_id = ? AND status = ? AND expires_at < ?", userID, "in_progress", time.Now().Add(-attemptGrace)).
+		Pluck("id", &ids)
+	for _, id := range ids {
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			var result models.QuizResult
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&result, id).Error; err != nil {
+				return err
+			}
+			if result.Status != "in_progress" {
+				return nil
+			}
+			_, err := submitAttempt(tx, &result)
+			return err
+		})
+		if err != nil {
+			log.Printf("⚠️ Submitting expired attempt %d failed: %v", id, err)
+		}
+	}
+}
+
+// moduleStanding is where a student stands on a module's quiz under the
+// module's scoring policy.
+type moduleStanding struct {
+	Status   string // Not Attempted, In Progress, Pending Review, Passed or Failed
+	Score    float64
+	Passed   bool
+	Attempts int
+	Counted  *models.QuizResult // the attempt the score comes from; the latest one for "average"
+}
+
+// standingOf applies the module's scoring policy to attempts, newest first.
+// Passing is judged against the module's current threshold.
+func standingOf(module models.Module, attempts []models.QuizResult) moduleStanding {
+	st := moduleStanding{Status: "Not Attempted", Attempts: len(attempts)}
+
+	var graded []models.QuizResult
+	latestPending := false
+	for _, a := range attempts {
+		switch a.Status {
+		case "in_progress":
+			if st.Status == "Not Attempted" {
+				st.Status = "In Progress"
+			}
+		case "pending":
+			if len(graded) == 0 {
+				latestPending = true
+			}
+			st.Status = "Pending Review"
+		default:
+			graded = append(graded, a)
+		}
+	}
+	if len(graded) == 0 {
+		return st
+	}
+
+	switch module.QuizScoring {
+	case "highest":
+		best := graded[0]
+		for _, a := range graded[1:] {
+			if a.Score > best.Score {
+				best = a
+			}
+		}
+		st.Counted = &best
+		st.Score = best.Score
+	case "average":
+		total := 0.0
+		for _, a := range graded {
+			total += a.Score
+		}
+		st.Counted = &graded[0]
+		st.Score = round2(total / float64(len(graded)))
+	default:
+		if latestPending {
+			return st
+		}
+		st.Counted = &graded[0]
+		st.Score = graded[0].Score
+	}
+	st.Passed = st.Score >= module.QuizPassThreshold
+
+	st.Status = "Failed"
+	if st.Passed {
+		st.Status = "Passed"
+	}
+	return st
+}
+
+// loadOwnAttempt locks the :attempt_id attempt of the calling student on
+// module.
+func loadOwnAttempt(tx *gorm.DB, c *fiber.Ctx, module *models.Module) (models.QuizResult, error) {
+	userID, _ := currentUserID(c)
+	var result models.QuizResult
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND module_id = ? AND user_id = ?", c.Params("attempt_id"), module.ID, userID).
+		First(&result).Error
+	if err != nil {
+		return result, fiber.NewError(404, "attempt not found")
+	}
+	return result, nil
+}
+
+// studentQuestion is q as students may see it before answering: without
+// the correct answer or its explanation, which only the review shows.
+func studentQuestion(q models.Quiz) models.Quiz {
+	q.Answer = ""
+	q.Explanation = ""
+	return q
+}
+
+// attemptQuestions returns the questions of an attempt as shown: in order,
+// with shuffled options and without their answers.
+func attemptQuestions(result models.QuizResult) []models.Quiz {
+	ids := attemptQuestionIDs(result)
+	if len(ids) == 0 {
+		return []models.Quiz{}
+	}
+	var layout map[uint]json.RawMessage
+	_ = json.Unmarshal([]byte(result.Layout), &layout)
+
+	var quizzes []models.Quiz
+	database.DB.Unscoped().Where("id IN ?", ids).Find(&quizzes)
+	byID := make(map[uint]models.Quiz, len(quizzes))
+	for _, q := range quizzes {
+		q = studentQuestion(q)
+		if options, ok := layout[q.ID]; ok {
+			q.Options = string(options)
+		}
+		byID[q.ID] = q
+	}
+	out := make([]models.Quiz, 0, len(ids))
+	for _, id := range ids {
+		if q, ok := byID[id]; ok {
+			out = append(out, q)
+		}
+	}
+	return out
+}
+
+// StartQuizAttempt -> POST /me/courses/:course_id/modules/:module_id/attempts
+// Starts an attempt at the module's quiz and returns its questions, drawn
+// from question banks if the module has quiz rules. Fails
+// with 409 while another attempt is in progress, 403 when no attempts are
+// left and 429 during the cooldown.
+func StartQuizAttempt(c *fiber.Ctx) error {
+	module, err := loadEnrolledModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+	userID, _ := currentUserID(c)
+
+	quizIDs, layout, err := drawAttempt(module)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if len(quizIDs) == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "no quizzes found for this module"})
+	}
+	expireAttempts(userID)
+
+	var result models.QuizResult
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		result, err = openAttempt(tx, *module, userID, quizIDs, layout)
+		return err
+	})
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"message":   "attempt started",
+		"attempt":   result,
+		"questions": attemptQuestions(result),
+	})
+}
+
+// SaveQuizAttemptAnswers -> PUT /me/courses/:course_id/modules/:module_id/attempts/:attempt_id/answers
+// Body: [{"quiz_id", "answer"}]. Answers can be changed until the attempt
+// is submitted or its time runs out.
+func SaveQuizAttemptAnswers(c *fiber.Ctx) error {
+	module, err := loadEnrolledModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	var payload []attemptAnswer
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var expired bool
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		result, err := loadOwnAttempt(tx, c, module)
+		if err != nil {
+			return err
+		}
+		if result.Status != "in_progress" {
+			return fiber.NewError(409, "attempt already submitted")
+		}
+		if attemptExpired(result, time.Now()) {
+			expired = true
+			_, err := submitAttempt(tx, &result)
+			return err
+		}
+		return saveAttemptAnswers(tx, &result, payload)
+	})
+	if err != nil {
+		return sendError(c, err)
+	}
+	if expired {
+		return c.Status(409).JSON(fiber.Map{"error": "time is up; the attempt was submitted with the answers saved before"})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "answers saved",
+	})
+}
+
+// SubmitQuizAttempt -> POST /me/courses/:course_id/modules/:module_id/attempts/:attempt_id/submit
+// Body (optional): final answers as for SaveQuizAttemptAnswers. After the
+// time limit only the answers saved in time are graded.
+func SubmitQuizAttempt(c *fiber.Ctx) error {
+	module, err := loadEnrolledModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	var payload []attemptAnswer
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&payload); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	var result models.QuizResult
+	var sum attemptSummary
+	var expired bool
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if result, err = loadOwnAttempt(tx, c, module); err != nil {
+			return err
+		}
+		if result.Status != "in_progress" {
+			return fiber.NewError(409, "attempt already submitted")
+		}
+		expired = attemptExpired(result, time.Now())
+		if !expired {
+			if err := saveAttemptAnswers(tx, &result, payload); err != nil {
+				return err
+			}
+		}
+		sum, err = submitAttempt(tx, &result)
+		return err
+	})
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message":        "quiz submitted successfully",
+		"result_id":      result.ID,
+		"status":         result.Status,
+		"score":          result.Score,
+		"passed":         result.Passed,
+		"total_quiz":     result.Questions,
+		"correct":        sum.Correct,
+		"points":         result.Points,
+		"max_points":     result.MaxPoints,
+		"pending_review": sum.Pending,
+		"late":           expired,
+	})
+}
+
+// ListQuizAttempts -> GET /me/courses/:course_id/modules/:module_id/attempts
+// The student's attempts, newest first, with how many are left and which
+// one counts.
+func ListQuizAttempts(c *fiber.Ctx) error {
+	module, err := loadEnrolledModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+	userID, _ := currentUserID(c)
+	expireAttempts(userID)
+
+	var attempts []models.QuizResult
+	if err := database.DB.Where("user_id = ? AND module_id = ?", userID, module.ID).Order("created_at DESC, id DESC").Find(&attempts).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	st := standingOf(*module, attempts)
+
+	out := fiber.Map{
+		"attempts":       attempts,
+		"scoring_policy": module.QuizScoring,
+		"time_limit":     module.QuizTimeLimit,
+		"pass_threshold": module.QuizPassThreshold,
+		"max_attempts":   module.QuizMaxAttempts,
+		"status":         st.Status,
+		"score":          st.Score,
+		"passed":         st.Passed,
+		"attempts_left":  nil,
+	}
+	if module.QuizMaxAttempts > 0 {
+		left := module.QuizMaxAttempts - len(attempts)
+		if left < 0 {
+			left = 0
+		}
+		out["attempts_left"] = left
+	}
+	if st.Counted != nil {
+		out["counted_attempt_id"] = st.Counted.ID
+	}
+	return c.JSON(out)
+}
+
+// reviewAllowed reports whether the module's review policy lets the
+// student see the correct answers of a submitted attempt.
+func reviewAllowed(module models.Module, result models.QuizResult) bool {
+	if result.Status == "in_progress" {
+		return false
+	}
+	switch module.QuizReviewPolicy {
+	case "after_attempt":
+		return true
+	case "after_pass":
+		var attempts []models.QuizResult
+		database.DB.Where("user_id = ? AND module_id = ?", result.UserID, module.ID).Order("created_at DESC, id DESC").Find(&attempts)
+		return standingOf(module, attempts).Passed
+	case "after_deadline":
+		return module.QuizDeadline != nil && time.Now().After(*module.QuizDeadline)
+	}
+	return false
+}
+
+// ReviewQuizAttempt -> GET /me/courses/:course_id/modules/:module_id/attempts/:attempt_id/review
+// A submitted attempt question by question: the options as shown, the
+// student's response, the correct answer, the credit earned and the
+// explanation. The module's review policy decides when it is available;
+// before that it fails with 403.
+func ReviewQuizAttempt(c *fiber.Ctx) error {
+	module, err := loadEnrolledModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+	userID, _ := currentUserID(c)
+	expireAttempts(userID)
+
+	var result models.QuizResult
+	if err := database.DB.Preload("Answers").Where("id = ? AND module_id = ? AND user_id = ?", c.Params("attempt_id"), module.ID, userID).First(&result).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "attempt not found"})
+	}
+	if result.Status == "in_progress" {
+		return c.Status(409).JSON(fiber.Map{"error": "attempt not submitted yet"})
+	}
+	if !reviewAllowed(*module, result) {
+		return c.Status(403).JSON(fiber.Map{"error": "review is not available yet", "review_policy": module.QuizReviewPolicy})
+	}
+
+	answerByQuiz := make(map[uint]models.QuizAnswer, len(result.Answers))
+	for _, a := range result.Answers {
+		answerByQuiz[a.QuizID] = a
+	}
+	ids := attemptQuestionIDs(result)
+	if len(ids) == 0 {
+		// Attempts from before the order was stored
+		for _, a := range result.Answers {
+			ids = append(ids, a.QuizID)
+		}
+	}
+	var layout map[uint]json.RawMessage
+	_ = json.Unmarshal([]byte(result.Layout), &layout)
+
+	var quizzes []models.Quiz
+	if len(ids) > 0 {
+		database.DB.Unscoped().Where("id IN ?", ids).Find(&quizzes)
+	}
+	quizByID := make(map[uint]models.Quiz, len(quizzes))
+	for _, q := range quizzes {
+		quizByID[q.ID] = q
+	}
+
+	items := []fiber.Map{}
+	for _, id := range ids {
+		q, ok := quizByID[id]
+		if !ok {
+			continue
+		}
+		options := rawJSON(q.Options)
+		if shown, ok := layout[id]; ok {
+			options = shown
+		}
+		item := fiber.Map{
+			"quiz_id":        q.ID,
+			"type":           q.Type,
+			"question":       q.Question,
+			"options":        options,
+			"response":       json.RawMessage("null"),
+			"correct_answer": questions.AnswerJSON(q.Type, q.Answer),
+			"status":         "unanswered",
+			"credit":         0,
+			"earned":         0,
+			"points":         q.Points,
+			"explanation":    q.Explanation,
+		}
+		rubric, manual := manualRubric(q)
+		if manual {
+			item["rubric"] = rubric
+		}
+		if a, ok := answerByQuiz[id]; ok {
+			item["response"] = rawJSON(a.Response)
+			item["status"] = a.Status
+			item["credit"] = a.Credit
+			item["earned"] = a.Earned
+			if manual {
+				item["rubric_scores"] = rawJSON(a.RubricScores)
+				item["feedback"] = a.Feedback
+			}
+		}
+		items = append(items, item)
+	}
+
+	return c.JSON(fiber.Map{
+		"id":         result.ID,
+		"module_id":  result.ModuleID,
+		"status":     result.Status,
+		"score":      result.Score,
+		"passed":     result.Passed,
+		"points":     result.Points,
+		"max_points": result.MaxPoints,
+		"questions":  items,
+	})
+}
@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"backend-elearning/models"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAttemptEnd(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time { v := now.Add(d); return &v }
+	tests := []struct {
+		name    string
+		expires *time.Time
+		want    time.Time
+	}{
+		{"no time limit", nil, now},
+		{"in time", at(time.Minute), now},
+		{"within the grace period", at(-10 * time.Second), *at(-10 * time.Second)},
+		{"expired long ago", at(-2 * time.Hour), *at(-2 * time.Hour)},
+	}
+	for _, tt := range tests {
+		if got := attemptEnd(models.QuizResult{ExpiresAt: tt.expires}, now); !got.Equal(tt.want) {
+			t.Errorf("%s: attemptEnd = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestCooldownAfterExpiredAttempt follows a student starting a new attempt
+// while the previous one ran out of time unsubmitted: the expiry submit
+// must not restart the cooldown.
+func TestCooldownAfterExpiredAttempt(t *testing.T) {
+	module := models.Module{QuizCooldown: 60}
+	now := time.Now()
+	tests := []struct {
+		name       string
+		expiredAgo time.Duration
+		allowed    bool
+	}{
+		{"cooldown over since the time ran out", 2 * time.Hour, true},
+		{"cooldown still running", 30 * time.Minute, false},
+	}
+	for _, tt := range tests {
+		expires := now.Add(-tt.expiredAgo)
+		last := models.QuizResult{Status: "in_progress", ExpiresAt: &expires}
+		last.CreatedAt = expires.Add(-10 * time.Minute)
+		if !attemptExpired(last, now) {
+			t.Fatalf("%s: attempt not expired", tt.name)
+		}
+
+		// What submitAttempt stamps when the new attempt finds it
+		ended := attemptEnd(last, now)
+		last.SubmittedAt = &ended
+
+		next := nextAttemptAt(module, last)
+		if allowed := !now.Before(next); allowed != tt.allowed {
+			t.Errorf("%s: next attempt at %v (now %v), allowed = %v, want %v", tt.name, next, now, allowed, tt.allowed)
+		}
+		if want := expires.Add(time.Hour); !next.Equal(want) {
+			t.Errorf("%s: cooldown ends %v, want an hour after expiry %v", tt.name, next, want)
+		}
+	}
+}
+
+func TestNextAttemptAt(t *testing.T) {
+	created := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	submitted := created.Add(20 * time.Minute)
+	last := models.QuizResult{}
+	last.CreatedAt = created
+	if got := nextAttemptAt(models.Module{QuizCooldown: 15}, last); !got.Equal(created.Add(15 * time.Minute)) {
+		t.Errorf("unsubmitted: nextAttemptAt = %v", got)
+	}
+	last.SubmittedAt = &submitted
+	if got := nextAttemptAt(models.Module{QuizCooldown: 15}, last); !got.Equal(submitted.Add(15 * time.Minute)) {
+		t.Errorf("submitted: nextAttemptAt = %v", got)
+	}
+}
+
+func TestStudentQuestion(t *testing.T) {
+	q := models.Quiz{
+		Type:        "single_choice",
+		Question:    "Ibu kota Indonesia?",
+		Options:     `["Bandung","Jakarta"]`,
+		Answer:      "Jakarta",
+		Explanation: "Jakarta sejak 1961.",
+		Points:      2,
+	}
+	got := studentQuestion(q)
+	data, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload map[string]any
+	_ = json.Unmarshal(data, &payload)
+	for _, field := range []string{"answer", "explanation"} {
+		if payload[field] != "" {
+			t.Errorf("student payload carries %s %q", field, payload[field])
+		}
+	}
+	if strings.Contains(string(data), q.Explanation) {
+		t.Errorf("student payload %s carries the explanation", data)
+	}
+	if got.Question != q.Question || got.Options != q.Options || got.Points != q.Points {
+		t.Errorf("studentQuestion dropped what students need: %+v", got)
+	}
+	if q.Answer == "" || q.Explanation == "" {
+		t.Error("studentQuestion changed its argument")
+	}
+}
@@ -0,0 +1,459 @@
+package controllers
+
+import (
+	"backend-elearning/database"
+	"backend-elearning/models"
+	"backend-elearning/questions"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var difficulties = map[string]bool{"": true, "easy": true, "medium": true, "hard": true}
+
+// bankQuestionInput is a bank question: a quiz question plus its tags.
+type bankQuestionInput struct {
+	quizInput
+	Topic      string `json:"topic"`
+	Difficulty string `json:"difficulty"`
+}
+
+func (q *bankQuestionInput) validate(n int) error {
+	if !difficulties[q.Difficulty] {
+		return fiber.NewError(400, fmt.Sprintf("quiz %d: difficulty must be easy, medium or hard", n))
+	}
+	if len(q.Topic) > 100 {
+		return fiber.NewError(400, fmt.Sprintf("quiz %d: topic is too long", n))
+	}
+	return q.quizInput.validate(n)
+}
+
+// loadOwnedBank loads the :bank_id bank and checks that the calling
+// instructor owns it.
+func loadOwnedBank(c *fiber.Ctx) (*models.QuestionBank, error) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return nil, fiber.NewError(401, err.Error())
+	}
+	var bank models.QuestionBank
+	if err := database.DB.First(&bank, c.Params("bank_id")).Error; err != nil {
+		return nil, fiber.NewError(404, "question bank not found")
+	}
+	if bank.InstructorID != userID {
+		return nil, fiber.NewError(403, "not your question bank")
+	}
+	return &bank, nil
+}
+
+// ListQuestionBanks -> GET /instructor/banks (requires instructor)
+func ListQuestionBanks(c *fiber.Ctx) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var banks []models.QuestionBank
+	if err := database.DB.Where("instructor_id = ?", userID).Order("title ASC").Find(&banks).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	out := []fiber.Map{}
+	for _, b := range banks {
+		var count int64
+		database.DB.Model(&models.Quiz{}).Where("bank_id = ?", b.ID).Count(&count)
+		var topics []string
+		database.DB.Model(&models.Quiz{}).Where("bank_id = ? AND topic <> ''", b.ID).Distinct().Order("topic").Pluck("topic", &topics)
+		out = append(out, fiber.Map{
+			"id":          b.ID,
+			"title":       b.Title,
+			"description": b.Description,
+			"questions":   count,
+			"topics":      topics,
+		})
+	}
+	return c.JSON(out)
+}
+
+// CreateQuestionBank -> POST /instructor/banks (requires instructor)
+// Body: {"title", "description"}.
+func CreateQuestionBank(c *fiber.Ctx) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var payload struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+	}
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if payload.Title == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "title is required"})
+	}
+
+	bank := models.QuestionBank{
+		InstructorID: userID,
+		Title:        payload.Title,
+		Description:  payload.Description,
+	}
+	if err := database.DB.Create(&bank).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"message": "question bank created successfully",
+		"bank":    bank,
+	})
+}
+
+// GetQuestionBank -> GET /instructor/banks/:bank_id (requires instructor)
+// The bank with its questions; ?topic= and ?difficulty= filter them.
+func GetQuestionBank(c *fiber.Ctx) error {
+	bank, err := loadOwnedBank(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	query := database.DB.Where("bank_id = ?", bank.ID)
+	if topic := c.Query("topic"); topic != "" {
+		query = query.Where("topic = ?", topic)
+	}
+	if difficulty := c.Query("difficulty"); difficulty != "" {
+		query = query.Where("difficulty = ?", difficulty)
+	}
+	if err := query.Order("id ASC").Find(&bank.Questions).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(bank)
+}
+
+// UpdateQuestionBank -> PUT /instructor/banks/:bank_id (requires instructor)
+// Body: {"title", "description"}; fields left out stay unchanged.
+func UpdateQuestionBank(c *fiber.Ctx) error {
+	bank, err := loadOwnedBank(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	var payload struct {
+		Title       *string `json:"title"`
+		Description *string `json:"description"`
+	}
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if payload.Title != nil {
+		if *payload.Title == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "title is required"})
+		}
+		bank.Title = *payload.Title
+	}
+	if payload.Description != nil {
+		bank.Description = *payload.Description
+	}
+	if err := database.DB.Save(bank).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "question bank updated successfully",
+		"bank":    bank,
+	})
+}
+
+// DeleteQuestionBank -> DELETE /instructor/banks/:bank_id (requires instructor)
+// Refused while a module still draws from the bank. The questions are
+// soft-deleted, so past attempts keep them.
+func DeleteQuestionBank(c *fiber.Ctx) error {
+	bank, err := loadOwnedBank(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	var used int64
+	database.DB.Model(&models.QuizRule{}).Where("bank_id = ?", bank.ID).Count(&used)
+	if used > 0 {
+		return c.Status(409).JSON(fiber.Map{"error": fmt.Sprintf("%d quiz rules still draw from this bank", used)})
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("bank_id = ?", bank.ID).Delete(&models.Quiz{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(bank).Error
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "question bank deleted successfully",
+	})
+}
+
+// AddBankQuestions -> POST /instructor/banks/:bank_id/questions (requires instructor)
+// Body: an array of questions as for CreateQuiz, each with optional
+// "topic" and "difficulty" (easy, medium or hard).
+func AddBankQuestions(c *fiber.Ctx) error {
+	bank, err := loadOwnedBank(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	var payload []bankQuestionInput
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if len(payload) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "no questions provided"})
+	}
+
+	var quizzes []models.Quiz
+	for i := range payload {
+		q := &payload[i]
+		if err := q.validate(i + 1); err != nil {
+			return sendError(c, err)
+		}
+		quiz := q.apply(models.Quiz{BankID: &bank.ID})
+		quiz.Topic = q.Topic
+		quiz.Difficulty = q.Difficulty
+		quizzes = append(quizzes, quiz)
+	}
+	if err := database.DB.Create(&quizzes).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"message": "questions added successfully",
+		"data":    quizzes,
+	})
+}
+
+// UpdateBankQuestion -> PUT /instructor/banks/:bank_id/questions/:quiz_id (requires instructor)
+// As UpdateQuiz: a question that attempts already answered is replaced by
+// a new version. Topic and difficulty are updated in place.
+func UpdateBankQuestion(c *fiber.Ctx) error {
+	bank, err := loadOwnedBank(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	var payload bankQuestionInput
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := payload.validate(1); err != nil {
+		return sendError(c, err)
+	}
+
+	var quiz models.Quiz
+	var answered int64
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ? AND bank_id = ?", c.Params("quiz_id"), bank.ID).First(&quiz).Error; err != nil {
+			return fiber.NewError(404, "question not found in this bank")
+		}
+		var err error
+		if quiz, answered, err = editQuiz(tx, quiz, payload.quizInput); err != nil {
+			return err
+		}
+		quiz.Topic, quiz.Difficulty = payload.Topic, payload.Difficulty
+		return tx.Model(&quiz).Updates(map[string]interface{}{"topic": quiz.Topic, "difficulty": quiz.Difficulty}).Error
+	})
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	out := fiber.Map{
+		"message": "question updated successfully",
+		"quiz":    quiz,
+	}
+	if answered > 0 {
+		out["warning"] = versionWarning(answered)
+	}
+	return c.JSON(out)
+}
+
+// DeleteBankQuestion -> DELETE /instructor/banks/:bank_id/questions/:quiz_id (requires instructor)
+func DeleteBankQuestion(c *fiber.Ctx) error {
+	bank, err := loadOwnedBank(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	res := database.DB.Where("id = ? AND bank_id = ?", c.Params("quiz_id"), bank.ID).Delete(&models.Quiz{})
+	if res.Error != nil {
+		return c.Status(500).JSON(fiber.Map{"error": res.Error.Error()})
+	}
+	if res.RowsAffected == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "question not found in this bank"})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "question deleted successfully",
+	})
+}
+
+// ruleInput is one draw rule as sent by the instructor.
+type ruleInput struct {
+	BankID     uint   `json:"bank_id"`
+	Count      int    `json:"count"`
+	Topic      string `json:"topic"`
+	Difficulty string `json:"difficulty"`
+}
+
+// ruleQuery selects the bank questions a rule draws from.
+func ruleQuery(db *gorm.DB, bankID uint, topic, difficulty string) *gorm.DB {
+	query := db.Model(&models.Quiz{}).Where("bank_id = ?", bankID)
+	if topic != "" {
+		query = query.Where("topic = ?", topic)
+	}
+	if difficulty != "" {
+		query = query.Where("difficulty = ?", difficulty)
+	}
+	return query
+}
+
+// GetQuizRules -> GET /instructor/courses/:course_id/modules/:module_id/quiz-rules (requires instructor)
+func GetQuizRules(c *fiber.Ctx) error {
+	module, err := loadOwnedModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	var rules []models.QuizRule
+	if err := database.DB.Where("module_id = ?", module.ID).Order("position ASC, id ASC").Find(&rules).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(rules)
+}
+
+// ReplaceQuizRules -> PUT /instructor/courses/:course_id/modules/:module_id/quiz-rules (requires instructor)
+// Body: [{"bank_id", "count", "topic", "difficulty"}], e.g. 5 questions
+// from bank A and 3 from bank B. Each attempt shows the module's own
+// questions followed by a fresh random draw per rule. An empty array
+// removes the rules.
+func ReplaceQuizRules(c *fiber.Ctx) error {
+	module, err := loadOwnedModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+	userID, _ := currentUserID(c)
+
+	var payload []ruleInput
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var warnings []string
+	for i, r := range payload {
+		if r.Count < 1 {
+			return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("rule %d: count must be at least 1", i+1)})
+		}
+		if !difficulties[r.Difficulty] {
+			return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("rule %d: difficulty must be easy, medium or hard", i+1)})
+		}
+		var bank models.QuestionBank
+		if err := database.DB.First(&bank, r.BankID).Error; err != nil || bank.InstructorID != userID {
+			return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("rule %d: question bank %d not found", i+1, r.BankID)})
+		}
+		var available int64
+		ruleQuery(database.DB, r.BankID, r.Topic, r.Difficulty).Count(&available)
+		if available < int64(r.Count) {
+			warnings = append(warnings, fmt.Sprintf("rule %d: only %d matching questions in %q; attempts will get fewer than %d", i+1, available, bank.Title, r.Count))
+		}
+	}
+
+	var rules []models.QuizRule
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("module_id = ?", module.ID).Delete(&models.QuizRule{}).Error; err != nil {
+			return err
+		}
+		for i, r := range payload {
+			rules = append(rules, models.QuizRule{
+				ModuleID:   module.ID,
+				BankID:     r.BankID,
+				Count:      r.Count,
+				Topic:      r.Topic,
+				Difficulty: r.Difficulty,
+				Position:   i + 1,
+			})
+		}
+		if len(rules) == 0 {
+			return nil
+		}
+		return tx.Create(&rules).Error
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	out := fiber.Map{
+		"message": "quiz rules saved successfully",
+		"rules":   rules,
+	}
+	if len(warnings) > 0 {
+		out["warnings"] = warnings
+	}
+	return c.JSON(out)
+}
+
+// hasQuizRules reports whether the module's quiz draws from banks.
+func hasQuizRules(moduleID uint) bool {
+	var n int64
+	database.DB.Model(&models.QuizRule{}).Where("module_id = ?", moduleID).Count(&n)
+	return n > 0
+}
+
+// drawAttempt picks the questions of a new attempt: the module's own
+// questions in order, then a random draw for each rule. It returns their
+// ids and the layout, the shuffled options of each question.
+func drawAttempt(module *models.Module) ([]uint, string, error) {
+	var chosen []models.Quiz
+	if err := database.DB.Where("module_id = ?", module.ID).Order("position ASC, id ASC").Find(&chosen).Error; err != nil {
+		return nil, "", err
+	}
+	taken := make(map[uint]bool, len(chosen))
+	for _, q := range chosen {
+		taken[q.ID] = true
+	}
+
+	var rules []models.QuizRule
+	if err := database.DB.Where("module_id = ?", module.ID).Order("position ASC, id ASC").Find(&rules).Error; err != nil {
+		return nil, "", err
+	}
+	for _, r := range rules {
+		var pool []models.Quiz
+		if err := ruleQuery(database.DB, r.BankID, r.Topic, r.Difficulty).Find(&pool).Error; err != nil {
+			return nil, "", err
+		}
+		rand.Shuffle(len(pool), func(i, j int) { pool[i], pool[j] = pool[j], pool[i] })
+		n := 0
+		for _, q := range pool {
+			if n == r.Count {
+				break
+			}
+			if !taken[q.ID] {
+				taken[q.ID] = true
+				chosen = append(chosen, q)
+				n++
+			}
+		}
+	}
+
+	ids := make([]uint, len(chosen))
+	layout := make(map[uint]json.RawMessage)
+	for i, q := range chosen {
+		ids[i] = q.ID
+		if shuffled := questions.ShuffleOptions(q.Type, q.Options); shuffled != q.Options {
+			layout[q.ID] = json.RawMessage(shuffled)
+		}
+	}
+	b, _ := json.Marshal(layout)
+	return ids, string(b), nil
+}
@@ -0,0 +1,268 @@
+package controllers
+
+import (
+	"backend-elearning/assets"
+	"backend-elearning/database"
+	"backend-elearning/models"
+	"backend-elearning/utils"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// allowedAttachmentTypes lists the file extensions accepted for attachment blocks.
+var allowedAttachmentTypes = []string{
+	".pdf", ".doc", ".docx", ".ppt", ".pptx", ".xls", ".xlsx", ".csv",
+	".txt", ".zip", ".png", ".jpg", ".jpeg", ".mp3", ".mp4",
+}
+
+type blockPayload struct {
+	Type     string `json:"type" form:"type"`
+	Title    string `json:"title" form:"title"`
+	Body     string `json:"body" form:"body"`
+	URL      string `json:"url" form:"url"`
+	Position int    `json:"position" form:"position"`
+}
+
+// ListContentBlocks -> GET /instructor/courses/:course_id/modules/:module_id/blocks
+func ListContentBlocks(c *fiber.Ctx) error {
+	module, err := loadOwnedModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	var blocks []models.ContentBlock
+	if err := database.DB.Where("module_id = ?", module.ID).Order("position ASC, id ASC").Find(&blocks).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	out := []fiber.Map{}
+	for _, b := range blocks {
+		out = append(out, blockResponse(b, module.CourseID))
+	}
+	return c.JSON(out)
+}
+
+// CreateContentBlock -> POST /instructor/courses/:course_id/modules/:module_id/blocks
+// JSON or form-data; attachment blocks are sent as form-data with a "file"
+// or the upload_id of a finished resumable upload.
+// Without a position the block is appended to the end.
+func CreateContentBlock(c *fiber.Ctx) error {
+	module, err := loadOwnedModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	var payload blockPayload
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	block := models.ContentBlock{
+		ModuleID: module.ID,
+		Type:     payload.Type,
+		Title:    payload.Title,
+		Body:     payload.Body,
+		URL:      strings.TrimSpace(payload.URL),
+		Position: payload.Position,
+	}
+
+	withFile := hasUpload(c, "file")
+	if block.Type == "attachment" && !withFile {
+		return c.Status(400).JSON(fiber.Map{"error": "file is required for attachment blocks"})
+	}
+	if withFile && block.Type != "attachment" {
+		return c.Status(400).JSON(fiber.Map{"error": "only attachment blocks take a file"})
+	}
+	if err := validateBlock(&block); err != nil {
+		return sendError(c, err)
+	}
+
+	if block.Position == 0 {
+		var last models.ContentBlock
+		if database.DB.Where("module_id = ?", module.ID).Order("position desc").First(&last).Error == nil {
+			block.Position = last.Position + 1
+		} else {
+			block.Position = 1
+		}
+	}
+
+	if err := database.DB.Create(&block).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if withFile {
+		if err := saveBlockAttachment(c, &block); err != nil {
+			database.DB.Unscoped().Delete(&block)
+			return sendError(c, err)
+		}
+		database.DB.Save(&block)
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"message": "content block created successfully",
+		"block":   blockResponse(block, module.CourseID),
+	})
+}
+
+// UpdateContentBlock -> PUT /instructor/courses/:course_id/modules/:module_id/blocks/:block_id
+// Empty fields are left unchanged; an attachment can be replaced with a new "file".
+func UpdateContentBlock(c *fiber.Ctx) error {
+	module, err := loadOwnedModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	var block models.ContentBlock
+	if err := database.DB.Where("id = ? AND module_id = ?", c.Params("block_id"), module.ID).First(&block).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "content block not found for this module"})
+	}
+
+	var payload blockPayload
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if payload.Type != "" && payload.Type != block.Type {
+		return c.Status(400).JSON(fiber.Map{"error": "block type cannot be changed"})
+	}
+	if payload.Title != "" {
+		block.Title = payload.Title
+	}
+	if payload.Body != "" {
+		block.Body = payload.Body
+	}
+	if payload.URL != "" {
+		block.URL = strings.TrimSpace(payload.URL)
+	}
+	if payload.Position != 0 {
+		block.Position = payload.Position
+	}
+
+	if err := validateBlock(&block); err != nil {
+		return sendError(c, err)
+	}
+
+	if hasUpload(c, "file") {
+		if block.Type != "attachment" {
+			return c.Status(400).JSON(fiber.Map{"error": "only attachment blocks take a file"})
+		}
+
+		oldFile := block.FileUrl
+		if err := saveBlockAttachment(c, &block); err != nil {
+			return sendError(c, err)
+		}
+		if oldFile != "" {
+			_ = assets.Release(c.UserContext(), oldFile)
+		}
+	}
+
+	if err := database.DB.Save(&block).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "content block updated successfully",
+		"block":   blockResponse(block, module.CourseID),
+	})
+}
+
+// DeleteContentBlock -> DELETE /instructor/courses/:course_id/modules/:module_id/blocks/:block_id
+func DeleteContentBlock(c *fiber.Ctx) error {
+	module, err := loadOwnedModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	var block models.ContentBlock
+	if err := database.DB.Where("id = ? AND module_id = ?", c.Params("block_id"), module.ID).First(&block).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "content block not found for this module"})
+	}
+
+	if err := database.DB.Delete(&block).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	_ = assets.Release(c.UserContext(), block.FileUrl)
+
+	return c.JSON(fiber.Map{"message": "content block deleted successfully"})
+}
+
+// GetContentBlockFile -> GET /me/courses/:course_id/modules/:module_id/blocks/:block_id/file
+// Also mounted for instructors, who may download from their own courses.
+func GetContentBlockFile(c *fiber.Ctx) error {
+	var module *models.Module
+	var err error
+	if c.Locals("role") == "instructor" {
+		module, err = loadOwnedModule(c)
+	} else {
+		module, err = loadEnrolledModule(c)
+	}
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	var block models.ContentBlock
+	if err := database.DB.Where("id = ? AND module_id = ?", c.Params("block_id"), module.ID).First(&block).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "content block not found for this module"})
+	}
+	if block.FileUrl == "" {
+		return c.Status(404).JSON(fiber.Map{"error": "no file attached to this block"})
+	}
+
+	return sendStoredFile(c, block.FileUrl, block.FileName, "attachment")
+}
+
+func validateBlock(block *models.ContentBlock) error {
+	switch block.Type {
+	case "markdown":
+		if strings.TrimSpace(block.Body) == "" {
+			return fiber.NewError(400, "body is required for markdown blocks")
+		}
+	case "video", "url":
+		u, err := url.Parse(block.URL)
+		if block.URL == "" || err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fiber.NewError(400, "a valid http(s) url is required for "+block.Type+" blocks")
+		}
+	case "attachment":
+		// the file itself is checked by saveBlockAttachment
+	default:
+		return fiber.NewError(400, "type must be one of markdown, video, attachment, url")
+	}
+	return nil
+}
+
+// saveBlockAttachment validates and stores the "file" (or upload_id),
+// keeping its sanitized original name for downloads.
+func saveBlockAttachment(c *fiber.Ctx, block *models.ContentBlock) error {
+	asset, name, err := storeUpload(c, "file", allowedAttachmentTypes...)
+	if err != nil {
+		return err
+	}
+	block.FileUrl = assets.URL(asset)
+	block.FileName = name
+	return nil
+}
+
+// blockResponse renders a block for the API, with Markdown converted to
+// sanitized HTML and attachments pointing at the download route.
+func blockResponse(b models.ContentBlock, courseID uint) fiber.Map {
+	out := fiber.Map{
+		"id":       b.ID,
+		"type":     b.Type,
+		"position": b.Position,
+		"title":    b.Title,
+	}
+	switch b.Type {
+	case "markdown":
+		out["body"] = b.Body
+		out["html"] = utils.RenderMarkdown(b.Body)
+	case "video", "url":
+		out["url"] = b.URL
+	case "attachment":
+		out["file_name"] = b.FileName
+		out["download_url"] = fmt.Sprintf("/api/me/courses/%d/modules/%d/blocks/%d/file", courseID, b.ModuleID, b.ID)
+	}
+	return out
+}
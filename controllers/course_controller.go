@@ -35,6 +35,7 @@ func CreateCourse(c *fiber.Ctx) error {
 	if err := database.DB.Create(&course).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
+	recordCourseRevision(&course, "created", "", course.InstructorID)
 
 	return c.Status(201).JSON(course)
 }
@@ -164,6 +165,7 @@ func GetCourseDetail(c *fiber.Ctx) error {
         ID      uint          `json:"id"`
         Title   string        `json:"title"`
         PDFUrl  string        `json:"pdf_url"`
+        PDFInfo fiber.Map     `json:"pdf_info"`
         Order   int           `json:"order"`
         Quizzes []models.Quiz `json:"quizzes"`
     }
@@ -172,12 +174,13 @@ func GetCourseDetail(c *fiber.Ctx) error {
 
     for _, m := range course.Modules {
         var quizzes []models.Quiz
-        database.DB.Where("module_id = ?", m.ID).Find(&quizzes)
+        database.DB.Where("module_id = ?", m.ID).Order("position ASC, id ASC").Find(&quizzes)
 
         modulesWithQuiz = append(modulesWithQuiz, ModuleResponse{
             ID:      m.ID,
             Title:   m.Title,
             PDFUrl:  m.PDFUrl,
+            PDFInfo: moduleInfo("/api/instructor", m),
             Order:   m.Order,
             Quizzes: quizzes,
         })
@@ -202,10 +205,13 @@ func PublishCourse(c *fiber.Ctx) error {
 	if err := database.DB.First(&course, id).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "course not found"})
 	}
+	adminID, _ := currentUserID(c)
+	ensureCourseBaseline(&course, adminID)
 	course.Published = true
 	if err := database.DB.Save(&course).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
+	recordCourseRevision(&course, "published", "", adminID)
 	return c.JSON(course)
 }
 
@@ -216,10 +222,13 @@ func UnpublishCourse(c *fiber.Ctx) error {
 	if err := database.DB.First(&course, id).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "course not found"})
 	}
+	adminID, _ := currentUserID(c)
+	ensureCourseBaseline(&course, adminID)
 	course.Published = false
 	if err := database.DB.Save(&course).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
+	recordCourseRevision(&course, "unpublished", "", adminID)
 	return c.JSON(course)
 }
 
@@ -227,8 +236,9 @@ func UnpublishCourse(c *fiber.Ctx) error {
 func EditCourse(c *fiber.Ctx) error {
 	id := c.Params("id")
 	var payload struct {
-		Title       string `json:"title"`
-		Description string `json:"description"`
+		Title         string `json:"title"`
+		Description   string `json:"description"`
+		WatermarkPDFs *bool  `json:"watermark_pdfs"` // optional, left as is when omitted
 	}
 	if err := c.BodyParser(&payload); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
@@ -239,13 +249,20 @@ func EditCourse(c *fiber.Ctx) error {
 		return c.Status(404).JSON(fiber.Map{"error": "course not found"})
 	}
 
+	userID, _ := currentUserID(c)
+	ensureCourseBaseline(&course, userID)
+
 	// Update fields
 	course.Title = payload.Title
 	course.Description = payload.Description
+	if payload.WatermarkPDFs != nil {
+		course.WatermarkPDFs = *payload.WatermarkPDFs
+	}
 
 	if err := database.DB.Save(&course).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
+	recordCourseRevision(&course, "updated", "", userID)
 
 	return c.JSON(course)
 }
@@ -259,9 +276,17 @@ func DeleteCourse(c *fiber.Ctx) error {
 		return c.Status(404).JSON(fiber.Map{"error": "course not found"})
 	}
 
+	var modules []models.Module
+	database.DB.Where("course_id = ?", course.ID).Find(&modules)
+
 	if err := database.DB.Delete(&course).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	// release module PDFs and attachments
+	for _, m := range modules {
+		releaseModuleFiles(c.UserContext(), m)
+	}
+
 	return c.Status(204).Send(nil)
 }
@@ -0,0 +1,486 @@
+package controllers
+
+import (
+	"backend-elearning/assets"
+	"backend-elearning/database"
+	"backend-elearning/models"
+	"backend-elearning/storage"
+	"backend-elearning/utils"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type moduleChange struct {
+	Title   string   `json:"title"`
+	Changes []string `json:"changes"`
+}
+
+type courseDiff struct {
+	ComparedCourseID uint           `json:"compared_course_id"`
+	Added            []string       `json:"added"`
+	Removed          []string       `json:"removed"`
+	Changed          []moduleChange `json:"changed"`
+}
+
+type importReport struct {
+	Valid     bool        `json:"valid"`
+	Errors    []string    `json:"errors"`
+	Conflicts []string    `json:"conflicts"`
+	Diff      *courseDiff `json:"diff,omitempty"`
+}
+
+// ExportCourse -> GET /instructor/courses/:id/export (requires instructor)
+// Produces a ZIP with manifest.json and the module PDFs under files/.
+// Fails with 500 naming the module when one of the PDFs cannot be read.
+func ExportCourse(c *fiber.Ctx) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var course models.Course
+	if err := database.DB.
+		Preload("Modules", func(db *gorm.DB) *gorm.DB {
+			return db.Order("`order` ASC")
+		}).
+		Preload("Modules.Quizzes", func(db *gorm.DB) *gorm.DB {
+			return db.Order("position ASC, id ASC")
+		}).
+		First(&course, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "course not found"})
+	}
+	if course.InstructorID != userID {
+		return c.Status(403).JSON(fiber.Map{"error": "not your course"})
+	}
+
+	manifest := utils.CoursePackageManifest{
+		FormatVersion: utils.CoursePackageVersion,
+		ExportedAt:    time.Now(),
+		Course: utils.PackageCourse{
+			Title:       course.Title,
+			Description: course.Description,
+		},
+	}
+
+	// Every opened PDF is closed, also when a later one fails
+	var files []utils.PackageFile
+	var opened []io.Closer
+	defer func() {
+		for _, rc := range opened {
+			rc.Close()
+		}
+	}()
+	for i, m := range course.Modules {
+		pm := utils.PackageModule{
+			Title:   m.Title,
+			Order:   m.Order,
+			Quizzes: []utils.PackageQuiz{},
+		}
+
+		if m.PDFUrl != "" {
+			// A package without a module's PDF would import as if complete
+			rc, err := storage.Files.Get(c.UserContext(), storage.KeyFromURL(m.PDFUrl))
+			if err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": fmt.Sprintf("PDF of module %q could not be read: %v", m.Title, err)})
+			}
+			opened = append(opened, rc)
+			pm.PDFFile = fmt.Sprintf("files/%d%s", i+1, path.Ext(m.PDFUrl))
+			pm.PDFName = m.PDFName
+			files = append(files, utils.PackageFile{Name: pm.PDFFile, Body: rc})
+		}
+
+		for _, q := range m.Quizzes {
+			pq := utils.NewPackageQuiz(q.Type, q.Question, q.Options, q.Answer)
+			if q.Points != 1 {
+				pq.Points = q.Points
+			}
+			pq.Explanation = q.Explanation
+			pm.Quizzes = append(pm.Quizzes, pq)
+		}
+
+		manifest.Modules = append(manifest.Modules, pm)
+	}
+
+	var buf bytes.Buffer
+	if err := utils.WriteCoursePackage(&buf, manifest, files); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	c.Set("Content-Type", "application/zip")
+	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"course-%d.zip\"", course.ID))
+	return c.Send(buf.Bytes())
+}
+
+// ImportCourse -> POST /instructor/courses/import (requires instructor)
+// Form-data: package (ZIP from ExportCourse), dry_run ("true" only validates).
+// The course is always recreated as a new, unpublished course owned by the caller.
+func ImportCourse(c *fiber.Ctx) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	fh, err := c.FormFile("package")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "package file is required"})
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer f.Close()
+
+	pkg, err := utils.OpenCoursePackage(f, fh.Size)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	report := validateCoursePackage(pkg, userID)
+	if !report.Valid {
+		return c.Status(422).JSON(fiber.Map{"error": "invalid course package", "report": report})
+	}
+
+	if c.FormValue("dry_run") == "true" {
+		return c.JSON(fiber.Map{"message": "dry run: nothing imported", "report": report})
+	}
+
+	var modules []importedModule
+	for _, pm := range pkg.Manifest.Modules {
+		im := importedModule{Title: pm.Title, Order: pm.Order, Quizzes: pm.Quizzes}
+		if pm.PDFFile != "" {
+			if im.PDF, err = pkg.ReadFile(pm.PDFFile); err != nil {
+				return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+			}
+			im.PDFName = pm.PDFName
+			if im.PDFName == "" {
+				im.PDFName = path.Base(pm.PDFFile)
+			}
+		}
+		modules = append(modules, im)
+	}
+
+	course, err := createImportedCourse(c.UserContext(), userID, pkg.Manifest.Course.Title, pkg.Manifest.Course.Description, modules)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"message": "course imported successfully",
+		"course":  course,
+		"report":  report,
+	})
+}
+
+// ImportCartridge -> POST /instructor/courses/import/cartridge (requires instructor)
+// Form-data: package (IMS Common Cartridge or SCORM 1.2 ZIP), dry_run.
+// Content that cannot be converted is listed in the warnings.
+func ImportCartridge(c *fiber.Ctx) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	fh, err := c.FormFile("package")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "package file is required"})
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer f.Close()
+
+	cartridge, err := utils.ParseCartridge(f, fh.Size)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// PDF yang tidak lolos pemeriksaan dilewati, modulnya tetap dibuat
+	for i, cm := range cartridge.Modules {
+		if cm.PDF == nil {
+			continue
+		}
+		if err := assets.CheckPDF(cm.PDF); err != nil {
+			cartridge.Warnings = append(cartridge.Warnings, fmt.Sprintf("module %q: %s skipped: %s", cm.Title, cm.PDFName, err.Error()))
+			cartridge.Modules[i].PDF = nil
+			cartridge.Modules[i].PDFName = ""
+		}
+	}
+
+	if c.FormValue("dry_run") == "true" {
+		return c.JSON(fiber.Map{
+			"message":  "dry run: nothing imported",
+			"format":   cartridge.Format,
+			"title":    cartridge.Title,
+			"modules":  cartridge.Modules,
+			"warnings": cartridge.Warnings,
+		})
+	}
+
+	var modules []importedModule
+	for _, cm := range cartridge.Modules {
+		modules = append(modules, importedModule{
+			Title:   cm.Title,
+			Order:   cm.Order,
+			PDFName: cm.PDFName,
+			PDF:     cm.PDF,
+			Quizzes: cm.Quizzes,
+		})
+	}
+
+	course, err := createImportedCourse(c.UserContext(), userID, cartridge.Title, cartridge.Description, modules)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"message":  "course imported successfully",
+		"format":   cartridge.Format,
+		"course":   course,
+		"warnings": cartridge.Warnings,
+	})
+}
+
+// importedModule is a module read from any import format, ready to be created.
+type importedModule struct {
+	Title   string
+	Order   int
+	PDFName string
+	PDF     []byte
+	Quizzes []utils.PackageQuiz
+}
+
+// createImportedCourse creates an unpublished course owned by instructorID
+// with its modules, PDFs and quizzes in one transaction. PDFs already stored
+// are released again if the transaction fails.
+func createImportedCourse(ctx context.Context, instructorID uint, title, description string, modules []importedModule) (models.Course, error) {
+	course := models.Course{
+		Title:        title,
+		Description:  description,
+		InstructorID: instructorID,
+	}
+
+	var stored []string
+	var created []models.Module
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&course).Error; err != nil {
+			return err
+		}
+
+		for _, im := range modules {
+			module := models.Module{
+				Title:    im.Title,
+				Order:    im.Order,
+				CourseID: course.ID,
+			}
+			if err := tx.Create(&module).Error; err != nil {
+				return err
+			}
+
+			if im.PDF != nil {
+				asset, err := assets.Store(ctx, bytes.NewReader(im.PDF), ".pdf", "application/pdf")
+				if err != nil {
+					return err
+				}
+				stored = append(stored, assets.URL(asset))
+
+				module.PDFUrl = assets.URL(asset)
+				module.PDFName = assets.SanitizeFilename(im.PDFName)
+				module.PDFInfoStatus = "pending"
+				if err := tx.Save(&module).Error; err != nil {
+					return err
+				}
+			}
+			created = append(created, module)
+
+			for j, pq := range im.Quizzes {
+				def := pq.Definition()
+				options, answer, err := def.Validate()
+				if err != nil {
+					if !pq.IsSingleChoice() {
+						return fiber.NewError(400, fmt.Sprintf("%s quiz %d: %v", im.Title, j+1, err))
+					}
+					// Reported as a conflict in the preview; imported as is
+					options, answer = string(def.Options), pq.Answer
+				}
+				quiz := models.Quiz{
+					ModuleID:    module.ID,
+					Type:        def.Type,
+					Question:    pq.Question,
+					Options:     options,
+					Answer:      answer,
+					Points:      pq.Points,
+					Explanation: pq.Explanation,
+					Position:    j + 1,
+				}
+				if err := tx.Create(&quiz).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		for _, u := range stored {
+			_ = assets.Release(ctx, u)
+		}
+		return course, err
+	}
+
+	recordCourseRevision(&course, "imported", "", instructorID)
+	for i, m := range created {
+		if m.PDFInfoStatus == "pending" {
+			assets.QueuePDFInfo(m.ID)
+		}
+		recordModuleRevision(ctx, &created[i], "imported", "", instructorID)
+	}
+	return course, nil
+}
+
+// validateCoursePackage checks the manifest for errors that block the import
+// and collects conflicts the instructor should know about. When the
+// instructor already owns a course with the same title, the package is
+// diffed against it.
+func validateCoursePackage(pkg *utils.CoursePackage, userID uint) importReport {
+	report := importReport{Errors: []string{}, Conflicts: []string{}}
+	manifest := pkg.Manifest
+
+	if manifest.Course.Title == "" {
+		report.Errors = append(report.Errors, "course title is required")
+	}
+
+	orders := make(map[int]string)
+	titles := make(map[string]bool)
+	for i, pm := range manifest.Modules {
+		label := fmt.Sprintf("module %d", i+1)
+		if pm.Title == "" {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: title is required", label))
+		} else {
+			label = fmt.Sprintf("module %d (%s)", i+1, pm.Title)
+		}
+
+		if other, ok := orders[pm.Order]; ok {
+			report.Conflicts = append(report.Conflicts, fmt.Sprintf("%s has the same order %d as %s", label, pm.Order, other))
+		} else {
+			orders[pm.Order] = label
+		}
+		if pm.Title != "" && titles[pm.Title] {
+			report.Conflicts = append(report.Conflicts, fmt.Sprintf("%s: duplicate module title", label))
+		}
+		titles[pm.Title] = true
+
+		if pm.PDFFile != "" {
+			if !pkg.HasFile(pm.PDFFile) {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: file %s missing from package", label, pm.PDFFile))
+			} else if data, err := pkg.ReadFile(pm.PDFFile); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: %s", label, err.Error()))
+			} else if err := assets.CheckPDF(data); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: file %s: %s", label, pm.PDFFile, err.Error()))
+			}
+		}
+
+		for j, pq := range pm.Quizzes {
+			qlabel := fmt.Sprintf("%s quiz %d", label, j+1)
+			if pq.Question == "" {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: question is empty", qlabel))
+			}
+			if pq.Points < 0 {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: points must not be negative", qlabel))
+			}
+			if !pq.IsSingleChoice() {
+				if _, _, err := pq.Definition().Validate(); err != nil && pq.Question != "" {
+					report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", qlabel, err))
+				}
+				continue
+			}
+			if len(pq.Options) < 2 {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: must have at least 2 options", qlabel))
+			}
+			if pq.Answer == "" {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: missing answer", qlabel))
+			} else if !containsString(pq.Options, pq.Answer) {
+				report.Conflicts = append(report.Conflicts, fmt.Sprintf("%s: answer is not one of the options", qlabel))
+			}
+		}
+	}
+
+	var existing models.Course
+	if manifest.Course.Title != "" && database.DB.
+		Preload("Modules").
+		Preload("Modules.Quizzes").
+		Where("instructor_id = ? AND title = ?", userID, manifest.Course.Title).
+		Order("created_at desc").
+		First(&existing).Error == nil {
+		report.Conflicts = append(report.Conflicts, fmt.Sprintf("you already have a course titled %q (id %d)", existing.Title, existing.ID))
+		report.Diff = diffCoursePackage(existing, manifest)
+	}
+
+	report.Valid = len(report.Errors) == 0
+	return report
+}
+
+func diffCoursePackage(existing models.Course, manifest utils.CoursePackageManifest) *courseDiff {
+	diff := &courseDiff{
+		ComparedCourseID: existing.ID,
+		Added:            []string{},
+		Removed:          []string{},
+		Changed:          []moduleChange{},
+	}
+
+	current := make(map[string]models.Module)
+	for _, m := range existing.Modules {
+		current[m.Title] = m
+	}
+
+	seen := make(map[string]bool)
+	for _, pm := range manifest.Modules {
+		seen[pm.Title] = true
+		m, ok := current[pm.Title]
+		if !ok {
+			diff.Added = append(diff.Added, pm.Title)
+			continue
+		}
+
+		var changes []string
+		if m.Order != pm.Order {
+			changes = append(changes, fmt.Sprintf("order %d -> %d", m.Order, pm.Order))
+		}
+		if (m.PDFUrl != "") != (pm.PDFFile != "") {
+			if pm.PDFFile != "" {
+				changes = append(changes, "pdf added")
+			} else {
+				changes = append(changes, "pdf removed")
+			}
+		}
+		if len(m.Quizzes) != len(pm.Quizzes) {
+			changes = append(changes, fmt.Sprintf("quizzes %d -> %d", len(m.Quizzes), len(pm.Quizzes)))
+		}
+		if len(changes) > 0 {
+			diff.Changed = append(diff.Changed, moduleChange{Title: pm.Title, Changes: changes})
+		}
+	}
+
+	for _, m := range existing.Modules {
+		if !seen[m.Title] {
+			diff.Removed = append(diff.Removed, m.Title)
+		}
+	}
+
+	return diff
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,612 @@
+package controllers
+
+import (
+	"backend-elearning/database"
+	"backend-elearning/models"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// gradeCategory weighs the items of one category in the final grade.
+// DropLowest leaves out the student's weakest items of the category.
+type gradeCategory struct {
+	Name       string  `json:"name"`
+	Weight     float64 `json:"weight"`
+	DropLowest int     `json:"drop_lowest"`
+}
+
+// letterGrade is awarded from a final percentage of Min upwards.
+type letterGrade struct {
+	Letter string  `json:"letter"`
+	Min    float64 `json:"min"`
+}
+
+// gradingScheme is how a course's final grade is computed. Without
+// categories every item counts by its max points. Missing is what a
+// missing score counts as once the item is due: "zero" or "exclude".
+type gradingScheme struct {
+	Categories []gradeCategory `json:"categories"`
+	Letters    []letterGrade   `json:"letters"`
+	Missing    string          `json:"missing"`
+}
+
+var defaultLetters = []letterGrade{{"A", 85}, {"B", 70}, {"C", 55}, {"D", 40}, {"E", 0}}
+
+// schemeOf returns the course's grading scheme, or the default one.
+func schemeOf(course *models.Course) gradingScheme {
+	var s gradingScheme
+	if course.GradingScheme != "" {
+		_ = json.Unmarshal([]byte(course.GradingScheme), &s)
+	}
+	if len(s.Letters) == 0 {
+		s.Letters = defaultLetters
+	}
+	if s.Missing == "" {
+		s.Missing = "zero"
+	}
+	if s.Categories == nil {
+		s.Categories = []gradeCategory{}
+	}
+	return s
+}
+
+func (s *gradingScheme) validate() error {
+	seen := make(map[string]bool)
+	for i := range s.Categories {
+		cat := &s.Categories[i]
+		cat.Name = strings.TrimSpace(cat.Name)
+		if cat.Name == "" {
+			return fmt.Errorf("category %d has no name", i+1)
+		}
+		if seen[cat.Name] {
+			return fmt.Errorf("category %q is listed twice", cat.Name)
+		}
+		seen[cat.Name] = true
+		if !(cat.Weight > 0) || math.IsInf(cat.Weight, 0) {
+			return fmt.Errorf("category %q: weight must be more than 0", cat.Name)
+		}
+		if cat.DropLowest < 0 {
+			return fmt.Errorf("category %q: drop_lowest must not be negative", cat.Name)
+		}
+	}
+
+	if len(s.Letters) == 0 {
+		s.Letters = defaultLetters
+	}
+	letters := make(map[string]bool)
+	hasZero := false
+	for i := range s.Letters {
+		l := &s.Letters[i]
+		l.Letter = strings.TrimSpace(l.Letter)
+		if l.Letter == "" || len(l.Letter) > 8 {
+			return fmt.Errorf("letter grade %d needs a letter of up to 8 characters", i+1)
+		}
+		if letters[l.Letter] {
+			return fmt.Errorf("letter grade %q is listed twice", l.Letter)
+		}
+		letters[l.Letter] = true
+		if l.Min < 0 || l.Min > 100 || math.IsNaN(l.Min) {
+			return fmt.Errorf("letter grade %q: min must be between 0 and 100", l.Letter)
+		}
+		hasZero = hasZero || l.Min == 0
+	}
+	if !hasZero {
+		return fmt.Errorf("one letter grade must start at 0")
+	}
+	sort.SliceStable(s.Letters, func(i, j int) bool { return s.Letters[i].Min > s.Letters[j].Min })
+
+	switch s.Missing {
+	case "":
+		s.Missing = "zero"
+	case "zero", "exclude":
+	default:
+		return fmt.Errorf(`missing must be "zero" or "exclude"`)
+	}
+	return nil
+}
+
+// gradeItem is one column of the gradebook.
+type gradeItem struct {
+	Key       string     `json:"key"`  // kind and id, e.g. "module:3"
+	Kind      string     `json:"kind"` // module, assignment or assessment
+	ID        uint       `json:"id"`
+	Title     string     `json:"title"`
+	Category  string     `json:"category"`
+	MaxPoints float64    `json:"max_points"`
+	DueAt     *time.Time `json:"due_at,omitempty"`
+}
+
+// gradeEntry is a student's result on one item. It is "graded", "pending"
+// while waiting for grading or "missing".
+type gradeEntry struct {
+	Points   *float64 `json:"points"`
+	Percent  *float64 `json:"percent"`
+	Status   string   `json:"status"`
+	Feedback string   `json:"feedback,omitempty"`
+	Dropped  bool     `json:"dropped,omitempty"` // left out by a drop-lowest rule
+}
+
+// studentGrade is a student's row of the gradebook.
+type studentGrade struct {
+	UserID     uint                  `json:"user_id"`
+	FullName   string                `json:"full_name"`
+	Email      string                `json:"email"`
+	Entries    map[string]gradeEntry `json:"entries"`
+	Categories map[string]*float64   `json:"categories"` // percent per category
+	Final      *float64              `json:"final"`      // percent
+	Letter     string                `json:"letter"`
+}
+
+func graded(points, max float64) gradeEntry {
+	p := round2(points)
+	pct := 0.0
+	if max > 0 {
+		pct = round2(points / max * 100)
+	}
+	return gradeEntry{Points: &p, Percent: &pct, Status: "graded"}
+}
+
+// loadGradebook collects the graded items of the course and each user's
+// entries. Module quizzes count in the "quiz" category out of 100, with
+// the score their scoring policy gives; assignments count in the
+// "assignment" category with the score of the latest submission.
+func loadGradebook(course *models.Course, userIDs []uint) ([]gradeItem, map[uint]map[string]gradeEntry, error) {
+	var assessments []models.Assessment
+	if err := database.DB.Where("course_id = ?", course.ID).Order("position ASC, id ASC").Find(&assessments).Error; err != nil {
+		return nil, nil, err
+	}
+	var modules []models.Module
+	if err := database.DB.Where("course_id = ?", course.ID).Order("`order` ASC, id ASC").Find(&modules).Error; err != nil {
+		return nil, nil, err
+	}
+	moduleByID := make(map[uint]models.Module, len(modules))
+	var moduleIDs []uint
+	for _, m := range modules {
+		moduleByID[m.ID] = m
+		moduleIDs = append(moduleIDs, m.ID)
+	}
+
+	// Modul yang punya kuis; modul ujian dihitung lewat assessment-nya
+	quizModules := make(map[uint]bool)
+	if len(moduleIDs) > 0 {
+		var ids []uint
+		database.DB.Model(&models.Quiz{}).Where("module_id IN ?", moduleIDs).Distinct().Pluck("module_id", &ids)
+		for _, id := range ids {
+			quizModules[id] = true
+		}
+		ids = nil
+		database.DB.Model(&models.QuizRule{}).Where("module_id IN ?", moduleIDs).Distinct().Pluck("module_id", &ids)
+		for _, id := range ids {
+			quizModules[id] = true
+		}
+	}
+	for _, a := range assessments {
+		if a.ModuleID != nil {
+			delete(quizModules, *a.ModuleID)
+		}
+	}
+
+	var assignments []models.Assignment
+	if len(moduleIDs) > 0 {
+		if err := database.DB.Where("module_id IN ?", moduleIDs).Order("position ASC, id ASC").Find(&assignments).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+	assignmentsOf := make(map[uint][]models.Assignment)
+	for _, a := range assignments {
+		assignmentsOf[a.ModuleID] = append(assignmentsOf[a.ModuleID], a)
+	}
+
+	var items []gradeItem
+	for _, m := range modules {
+		if quizModules[m.ID] {
+			items = append(items, gradeItem{Key: fmt.Sprintf("module:%d", m.ID), Kind: "module", ID: m.ID, Title: m.Title, Category: "quiz", MaxPoints: 100, DueAt: m.QuizDeadline})
+		}
+		for _, a := range assignmentsOf[m.ID] {
+			items = append(items, gradeItem{Key: fmt.Sprintf("assignment:%d", a.ID), Kind: "assignment", ID: a.ID, Title: a.Title, Category: "assignment", MaxPoints: a.MaxPoints, DueAt: a.DueAt})
+		}
+	}
+	for _, a := range assessments {
+		items = append(items, gradeItem{Key: fmt.Sprintf("assessment:%d", a.ID), Kind: "assessment", ID: a.ID, Title: a.Title, Category: a.Category, MaxPoints: a.MaxPoints, DueAt: a.DueAt})
+	}
+
+	entries := make(map[uint]map[string]gradeEntry, len(userIDs))
+	for _, id := range userIDs {
+		entries[id] = make(map[string]gradeEntry)
+	}
+	if len(userIDs) == 0 {
+		return items, entries, nil
+	}
+
+	// Standing tiap siswa di setiap modul kuis
+	var results []models.QuizResult
+	if len(moduleIDs) > 0 {
+		if err := database.DB.Where("module_id IN ? AND user_id IN ?", moduleIDs, userIDs).Order("created_at DESC, id DESC").Find(&results).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+	attempts := make(map[[2]uint][]models.QuizResult)
+	for _, r := range results {
+		k := [2]uint{r.UserID, r.ModuleID}
+		attempts[k] = append(attempts[k], r)
+	}
+	standing := func(userID, moduleID uint, max float64) gradeEntry {
+		st := standingOf(moduleByID[moduleID], attempts[[2]uint{userID, moduleID}])
+		switch st.Status {
+		case "Passed", "Failed":
+			return graded(st.Score/100*max, max)
+		case "Pending Review", "In Progress":
+			return gradeEntry{Status: "pending"}
+		}
+		return gradeEntry{Status: "missing"}
+	}
+
+	var scores []models.AssessmentScore
+	if len(assessments) > 0 {
+		var ids []uint
+		for _, a := range assessments {
+			ids = append(ids, a.ID)
+		}
+		if err := database.DB.Where("assessment_id IN ? AND user_id IN ?", ids, userIDs).Find(&scores).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+	scoreOf := make(map[[2]uint]models.AssessmentScore, len(scores))
+	for _, s := range scores {
+		scoreOf[[2]uint{s.UserID, s.AssessmentID}] = s
+	}
+
+	// Hanya submission terakhir tiap siswa yang dinilai
+	var subs []models.AssignmentSubmission
+	if len(assignments) > 0 {
+		var ids []uint
+		for _, a := range assignments {
+			ids = append(ids, a.ID)
+		}
+		if err := database.DB.Where("assignment_id IN ? AND user_id IN ?", ids, userIDs).Order("attempt DESC").Find(&subs).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+	latest := make(map[[2]uint]models.AssignmentSubmission, len(subs))
+	for _, s := range subs {
+		k := [2]uint{s.UserID, s.AssignmentID}
+		if _, ok := latest[k]; !ok {
+			latest[k] = s
+		}
+	}
+
+	for _, userID := range userIDs {
+		for _, m := range modules {
+			if quizModules[m.ID] {
+				entries[userID][fmt.Sprintf("module:%d", m.ID)] = standing(userID, m.ID, 100)
+			}
+			for _, a := range assignmentsOf[m.ID] {
+				key := fmt.Sprintf("assignment:%d", a.ID)
+				s, ok := latest[[2]uint{userID, a.ID}]
+				switch {
+				case !ok:
+					entries[userID][key] = gradeEntry{Status: "missing"}
+				case s.Score == nil:
+					entries[userID][key] = gradeEntry{Status: "pending"}
+				default:
+					e := graded(*s.Score, a.MaxPoints)
+					e.Feedback = s.Feedback
+					entries[userID][key] = e
+				}
+			}
+		}
+		for _, a := range assessments {
+			key := fmt.Sprintf("assessment:%d", a.ID)
+			if a.ModuleID != nil {
+				entries[userID][key] = standing(userID, *a.ModuleID, a.MaxPoints)
+				continue
+			}
+			if s, ok := scoreOf[[2]uint{userID, a.ID}]; ok {
+				e := graded(s.Points, a.MaxPoints)
+				e.Feedback = s.Feedback
+				entries[userID][key] = e
+			} else {
+				entries[userID][key] = gradeEntry{Status: "missing"}
+			}
+		}
+	}
+	return items, entries, nil
+}
+
+// grade computes a student's category scores, final percentage and letter
+// from their entries, marking the entries a drop-lowest rule leaves out.
+func (s gradingScheme) grade(items []gradeItem, entries map[string]gradeEntry, now time.Time) (map[string]*float64, *float64, string) {
+	// percentOf is what an entry counts as, or false if it does not count
+	percentOf := func(item gradeItem) (float64, bool) {
+		e := entries[item.Key]
+		switch {
+		case e.Status == "graded":
+			return *e.Percent, true
+		case e.Status == "missing" && s.Missing == "zero" && (item.DueAt == nil || now.After(*item.DueAt)):
+			return 0, true
+		}
+		return 0, false
+	}
+
+	categories := make(map[string]*float64)
+	var final *float64
+	if len(s.Categories) == 0 {
+		var points, max float64
+		for _, item := range items {
+			if pct, ok := percentOf(item); ok {
+				points += pct / 100 * item.MaxPoints
+				max += item.MaxPoints
+			}
+		}
+		if max > 0 {
+			f := round2(points / max * 100)
+			final = &f
+		}
+	} else {
+		var sum, weights float64
+		for _, cat := range s.Categories {
+			type counted struct {
+				key string
+				pct float64
+			}
+			var list []counted
+			for _, item := range items {
+				if item.Category != cat.Name {
+					continue
+				}
+				if pct, ok := percentOf(item); ok {
+					list = append(list, counted{item.Key, pct})
+				}
+			}
+			categories[cat.Name] = nil
+			if len(list) == 0 {
+				continue
+			}
+			sort.SliceStable(list, func(i, j int) bool { return list[i].pct < list[j].pct })
+			drop := cat.DropLowest
+			if drop > len(list)-1 {
+				drop = len(list) - 1
+			}
+			for _, d := range list[:drop] {
+				e := entries[d.key]
+				e.Dropped = true
+				entries[d.key] = e
+			}
+			total := 0.0
+			for _, k := range list[drop:] {
+				total += k.pct
+			}
+			avg := round2(total / float64(len(list)-drop))
+			categories[cat.Name] = &avg
+			sum += avg * cat.Weight
+			weights += cat.Weight
+		}
+		if weights > 0 {
+			f := round2(sum / weights)
+			final = &f
+		}
+	}
+
+	letter := ""
+	if final != nil {
+		for _, l := range s.Letters {
+			if *final >= l.Min {
+				letter = l.Letter
+				break
+			}
+		}
+	}
+	return categories, final, letter
+}
+
+// uncategorized lists the categories of items the scheme does not weigh.
+func (s gradingScheme) uncategorized(items []gradeItem) []string {
+	out := []string{}
+	if len(s.Categories) == 0 {
+		return out
+	}
+	known := make(map[string]bool)
+	for _, c := range s.Categories {
+		known[c.Name] = true
+	}
+	for _, item := range items {
+		if !known[item.Category] {
+			known[item.Category] = true
+			out = append(out, item.Category)
+		}
+	}
+	return out
+}
+
+// GetGradingScheme -> GET /instructor/courses/:course_id/grading-scheme (requires instructor)
+func GetGradingScheme(c *fiber.Ctx) error {
+	course, err := loadOwnedCourse(c, c.Params("course_id"))
+	if err != nil {
+		return sendError(c, err)
+	}
+	return c.JSON(schemeOf(course))
+}
+
+// UpdateGradingScheme -> PUT /instructor/courses/:course_id/grading-scheme (requires instructor)
+// Body: {"categories": [{"name", "weight", "drop_lowest"}], "letters":
+// [{"letter", "min"}], "missing": "zero" | "exclude"}. Module quizzes are in
+// the "quiz" category, assignments in "assignment" and assessments in
+// their own. Weights are relative;
+// categories without scores are left out of the final grade.
+func UpdateGradingScheme(c *fiber.Ctx) error {
+	course, err := loadOwnedCourse(c, c.Params("course_id"))
+	if err != nil {
+		return sendError(c, err)
+	}
+	var scheme gradingScheme
+	if err := c.BodyParser(&scheme); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := scheme.validate(); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if scheme.Categories == nil {
+		scheme.Categories = []gradeCategory{}
+	}
+
+	b, _ := json.Marshal(scheme)
+	if err := database.DB.Model(course).Update("grading_scheme", string(b)).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{
+		"message": "grading scheme updated successfully",
+		"data":    scheme,
+	})
+}
+
+// GetGradebook -> GET /instructor/courses/:course_id/gradebook (requires instructor)
+// Every enrolled student's result on every graded item, their category
+// scores, final percentage and letter. ?format=csv downloads it.
+func GetGradebook(c *fiber.Ctx) error {
+	course, err := loadOwnedCourse(c, c.Params("course_id"))
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	var enrollments []models.Enrollment
+	if err := database.DB.Preload("User").Where("course_id = ?", course.ID).Find(&enrollments).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	sort.SliceStable(enrollments, func(i, j int) bool {
+		return strings.ToLower(enrollments[i].User.FullName) < strings.ToLower(enrollments[j].User.FullName)
+	})
+	userIDs := make([]uint, 0, len(enrollments))
+	for _, e := range enrollments {
+		userIDs = append(userIDs, e.UserID)
+	}
+
+	items, entries, err := loadGradebook(course, userIDs)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	scheme := schemeOf(course)
+	now := time.Now()
+
+	students := make([]studentGrade, 0, len(enrollments))
+	for _, e := range enrollments {
+		row := studentGrade{UserID: e.UserID, FullName: e.User.FullName, Email: e.User.Email, Entries: entries[e.UserID]}
+		row.Categories, row.Final, row.Letter = scheme.grade(items, row.Entries, now)
+		students = append(students, row)
+	}
+
+	if c.Query("format") == "csv" {
+		return sendGradebookCSV(c, course, scheme, items, students)
+	}
+	return c.JSON(fiber.Map{
+		"scheme":        scheme,
+		"items":         items,
+		"students":      students,
+		"uncategorized": scheme.uncategorized(items),
+	})
+}
+
+// csvText keeps a text cell from being run as a formula by spreadsheet
+// programs: cells starting with =, +, -, @, tab or CR get a leading quote.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func sendGradebookCSV(c *fiber.Ctx, course *models.Course, scheme gradingScheme, items []gradeItem, students []studentGrade) error {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	header := []string{"user_id", "full_name", "email"}
+	for _, item := range items {
+		header = append(header, csvText(fmt.Sprintf("%s [%s] (%g)", item.Title, item.Category, item.MaxPoints)))
+	}
+	for _, cat := range scheme.Categories {
+		header = append(header, csvText(cat.Name+" (%)"))
+	}
+	header = append(header, "final (%)", "letter")
+	w.Write(header)
+
+	number := func(f *float64) string {
+		if f == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*f, 'f', -1, 64)
+	}
+	for _, s := range students {
+		row := []string{strconv.FormatUint(uint64(s.UserID), 10), csvText(s.FullName), csvText(s.Email)}
+		for _, item := range items {
+			e := s.Entries[item.Key]
+			cell := number(e.Points)
+			if e.Status == "pending" {
+				cell = "pending"
+			}
+			row = append(row, cell)
+		}
+		for _, cat := range scheme.Categories {
+			row = append(row, number(s.Categories[cat.Name]))
+		}
+		row = append(row, number(s.Final), csvText(s.Letter))
+		w.Write(row)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	c.Set("Content-Type", "text/csv; charset=utf-8")
+	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"course-%d-gradebook.csv\"", course.ID))
+	return c.Send(buf.Bytes())
+}
+
+// GetMyGrades -> GET /me/courses/:id/grades
+// The student's own row of the gradebook with the grading scheme.
+func GetMyGrades(c *fiber.Ctx) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": err.Error()})
+	}
+	var course models.Course
+	if err := database.DB.First(&course, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "course not found"})
+	}
+	var n int64
+	database.DB.Model(&models.Enrollment{}).Where("user_id = ? AND course_id = ?", userID, course.ID).Count(&n)
+	if n == 0 {
+		return c.Status(403).JSON(fiber.Map{"error": "you are not enrolled in this course"})
+	}
+	expireAttempts(userID)
+
+	items, entries, err := loadGradebook(&course, []uint{userID})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	scheme := schemeOf(&course)
+	mine := entries[userID]
+	categories, final, letter := scheme.grade(items, mine, time.Now())
+
+	grades := make([]fiber.Map, 0, len(items))
+	for _, item := range items {
+		grades = append(grades, fiber.Map{
+			"item":  item,
+			"entry": mine[item.Key],
+		})
+	}
+	return c.JSON(fiber.Map{
+		"scheme":     scheme,
+		"grades":     grades,
+		"categories": categories,
+		"final":      final,
+		"letter":     letter,
+	})
+}
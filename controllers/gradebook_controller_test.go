@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCSVText(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"Budi Santoso", "Budi Santoso"},
+		{"budi@example.com", "budi@example.com"},
+		{`=HYPERLINK("http://evil","x")`, `'=HYPERLINK("http://evil","x")`},
+		{"+62 812", "'+62 812"},
+		{"-1+1", "'-1+1"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\tcmd", "'\tcmd"},
+		{"\rcmd", "'\rcmd"},
+		{"a=b", "a=b"},
+	}
+	for _, tt := range tests {
+		if got := csvText(tt.in); got != tt.want {
+			t.Errorf("csvText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestGradingSchemeGrade(t *testing.T) {
+	pct := func(f float64) *float64 { return &f }
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	items := []gradeItem{
+		{Key: "q1", Category: "quiz", MaxPoints: 100},
+		{Key: "q2", Category: "quiz", MaxPoints: 100},
+		{Key: "q3", Category: "quiz", MaxPoints: 100, DueAt: &past},
+		{Key: "e1", Category: "exam", MaxPoints: 50},
+		{Key: "e2", Category: "exam", MaxPoints: 50, DueAt: &future},
+	}
+	entries := map[string]gradeEntry{
+		"q1": {Percent: pct(80), Status: "graded"},
+		"q2": {Percent: pct(40), Status: "graded"},
+		"q3": {Status: "missing"},
+		"e1": {Percent: pct(90), Status: "graded"},
+		"e2": {Status: "missing"},
+	}
+	scheme := gradingScheme{
+		Categories: []gradeCategory{{Name: "quiz", Weight: 1, DropLowest: 1}, {Name: "exam", Weight: 3}},
+		Letters:    defaultLetters,
+		Missing:    "zero",
+	}
+
+	categories, final, letter := scheme.grade(items, entries, time.Now())
+	// q3 counts as 0 and is dropped; e2 is not due yet
+	if got := *categories["quiz"]; got != 60 {
+		t.Errorf("quiz = %v, want 60", got)
+	}
+	if got := *categories["exam"]; got != 90 {
+		t.Errorf("exam = %v, want 90", got)
+	}
+	if *final != 82.5 || letter != "B" {
+		t.Errorf("final = %v %q, want 82.5 B", *final, letter)
+	}
+	if !entries["q3"].Dropped || entries["q2"].Dropped {
+		t.Errorf("dropped q3=%v q2=%v, want true false", entries["q3"].Dropped, entries["q2"].Dropped)
+	}
+
+	scheme.Missing = "exclude"
+	entries["q3"] = gradeEntry{Status: "missing"}
+	categories, _, _ = scheme.grade(items, entries, time.Now())
+	if got := *categories["quiz"]; got != 80 {
+		t.Errorf("quiz with missing excluded = %v, want 80", got)
+	}
+}
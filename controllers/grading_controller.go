@@ -0,0 +1,473 @@
+package controllers
+
+import (
+	"backend-elearning/database"
+	"backend-elearning/models"
+	"backend-elearning/questions"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func round2(f float64) float64 {
+	return math.Round(f*100) / 100
+}
+
+// scoreAttempt totals the graded answers of an attempt and sets its Score,
+// Points, MaxPoints and Passed. Each question is worth its points; with
+// negative marking a wrong answer costs that share of them instead. The
+// score is the percentage of the attempt's points, never below 0.
+func scoreAttempt(tx *gorm.DB, result *models.QuizResult) error {
+	var module models.Module
+	if err := tx.Unscoped().First(&module, result.ModuleID).Error; err != nil {
+		return err
+	}
+	var answers []models.QuizAnswer
+	if err := tx.Where("quiz_result_id = ?", result.ID).Find(&answers).Error; err != nil {
+		return err
+	}
+
+	ids := attemptQuestionIDs(*result)
+	if len(ids) == 0 {
+		// Submitted before attempts kept their questions
+		for _, a := range answers {
+			ids = append(ids, a.QuizID)
+		}
+	}
+	var quizzes []models.Quiz
+	if len(ids) > 0 {
+		if err := tx.Unscoped().Where("id IN ?", ids).Find(&quizzes).Error; err != nil {
+			return err
+		}
+	}
+	quizByID := make(map[uint]models.Quiz, len(quizzes))
+	total := 0.0
+	for _, q := range quizzes {
+		if q.Points <= 0 {
+			q.Points = 1
+		}
+		quizByID[q.ID] = q
+		total += q.Points
+	}
+
+	earned := 0.0
+	for i := range answers {
+		a := &answers[i]
+		q, ok := quizByID[a.QuizID]
+		if !ok {
+			continue
+		}
+		e := q.Points * a.Credit
+		answered := a.Response != "" && a.Response != "null"
+		if module.QuizNegativeMarking > 0 && a.Credit == 0 && answered && !questions.IsManual(q.Type) {
+			e = -q.Points * module.QuizNegativeMarking
+		}
+		e = round2(e)
+		if e != a.Earned {
+			if err := tx.Model(a).Update("earned", e).Error; err != nil {
+				return err
+			}
+		}
+		earned += e
+	}
+	if earned < 0 {
+		earned = 0
+	}
+
+	result.Points = round2(earned)
+	result.MaxPoints = round2(total)
+	result.Score = 0
+	if total > 0 {
+		result.Score = round2(earned / total * 100)
+	}
+	result.Passed = result.Score >= module.QuizPassThreshold
+	return nil
+}
+
+// finalizeQuizResult recomputes the score of an attempt once none of its
+// answers wait for grading. It reports whether the student should hear
+// about it: the attempt was pending, or a regrade changed the score.
+// Attempts still in progress are left alone; they are scored on submit.
+func finalizeQuizResult(tx *gorm.DB, resultID uint) (models.QuizResult, bool, error) {
+	var result models.QuizResult
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&result, resultID).Error; err != nil {
+		return result, false, err
+	}
+	if result.Status == "in_progress" {
+		return result, false, fiber.NewError(409, "this attempt has not been submitted yet")
+	}
+
+	var pending int64
+	if err := tx.Model(&models.QuizAnswer{}).Where("quiz_result_id = ? AND status = ?", resultID, "pending").Count(&pending).Error; err != nil {
+		return result, false, err
+	}
+	if pending > 0 {
+		return result, false, nil
+	}
+
+	before := result
+	if err := scoreAttempt(tx, &result); err != nil {
+		return result, false, err
+	}
+	changed := before.Status != "graded" || before.Score != result.Score || before.Passed != result.Passed
+
+	result.Status = "graded"
+	err := tx.Model(&result).Updates(map[string]interface{}{
+		"score":      result.Score,
+		"passed":     result.Passed,
+		"points":     result.Points,
+		"max_points": result.MaxPoints,
+		"status":     "graded",
+	}).Error
+	return result, changed, err
+}
+
+// gradingItem is a manually graded answer as shown to course staff.
+type gradingItem struct {
+	ID           uint             `json:"id"`
+	Status       string           `json:"status"`
+	QuizResultID uint             `json:"quiz_result_id"`
+	ModuleID     uint             `json:"module_id"`
+	ModuleTitle  string           `json:"module_title"`
+	QuizID       uint             `json:"quiz_id"`
+	Question     string           `json:"question"`
+	Rubric       questions.Rubric `json:"rubric"`
+	MaxPoints    float64          `json:"max_points"`
+	Response     json.RawMessage  `json:"response"`
+	StudentID    uint             `json:"student_id"`
+	StudentName  string           `json:"student_name"`
+	SubmittedAt  time.Time        `json:"submitted_at"`
+	Points       float64          `json:"points"`
+	RubricScores json.RawMessage  `json:"rubric_scores,omitempty"`
+	Feedback     string           `json:"feedback"`
+	GradedAt     *time.Time       `json:"graded_at"`
+}
+
+// rawJSON returns s as raw JSON, or null when it is empty.
+func rawJSON(s string) json.RawMessage {
+	if s == "" {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(s)
+}
+
+// manualRubric returns the rubric of a manually graded quiz.
+func manualRubric(quiz models.Quiz) (questions.Rubric, bool) {
+	t, err := questions.Lookup(quiz.Type)
+	if err != nil {
+		return nil, false
+	}
+	manual, ok := t.(questions.ManualType)
+	if !ok {
+		return nil, false
+	}
+	return manual.Rubric(quiz.Answer), true
+}
+
+// ListGradingQueue -> GET /instructor/courses/:course_id/grading (requires instructor)
+// Manually graded answers of the course, oldest first. ?status=pending
+// (default), graded or all.
+func ListGradingQueue(c *fiber.Ctx) error {
+	course, err := loadOwnedCourse(c, c.Params("course_id"))
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	query := database.DB.Model(&models.QuizAnswer{}).
+		Select("quiz_answers.*").
+		Joins("JOIN quiz_results ON quiz_results.id = quiz_answers.quiz_result_id AND quiz_results.deleted_at IS NULL").
+		Joins("JOIN modules ON modules.id = quiz_results.module_id").
+		Where("modules.course_id = ?", course.ID)
+	switch c.Query("status", "pending") {
+	case "pending":
+		query = query.Where("quiz_answers.status = ?", "pending")
+	case "graded":
+		query = query.Where("quiz_answers.status = ? AND quiz_answers.grader_id IS NOT NULL", "graded")
+	case "all":
+		query = query.Where("(quiz_answers.status = ? OR quiz_answers.grader_id IS NOT NULL)", "pending")
+	default:
+		return c.Status(400).JSON(fiber.Map{"error": "status must be pending, graded or all"})
+	}
+
+	var answers []models.QuizAnswer
+	if err := query.Order("quiz_answers.created_at ASC, quiz_answers.id ASC").Find(&answers).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	items := []gradingItem{}
+	if len(answers) == 0 {
+		return c.JSON(items)
+	}
+
+	var resultIDs, quizIDs []uint
+	for _, a := range answers {
+		resultIDs = append(resultIDs, a.QuizResultID)
+		quizIDs = append(quizIDs, a.QuizID)
+	}
+	var results []models.QuizResult
+	database.DB.Where("id IN ?", resultIDs).Find(&results)
+	resultByID := make(map[uint]models.QuizResult, len(results))
+	var userIDs, moduleIDs []uint
+	for _, r := range results {
+		resultByID[r.ID] = r
+		userIDs = append(userIDs, r.UserID)
+		moduleIDs = append(moduleIDs, r.ModuleID)
+	}
+	// Edited questions are soft-deleted but still graded as answered
+	var quizzes []models.Quiz
+	database.DB.Unscoped().Where("id IN ?", quizIDs).Find(&quizzes)
+	quizByID := make(map[uint]models.Quiz, len(quizzes))
+	for _, q := range quizzes {
+		quizByID[q.ID] = q
+	}
+	var users []models.User
+	database.DB.Where("id IN ?", userIDs).Find(&users)
+	nameByID := make(map[uint]string, len(users))
+	for _, u := range users {
+		nameByID[u.ID] = u.FullName
+	}
+	var modules []models.Module
+	database.DB.Where("id IN ?", moduleIDs).Find(&modules)
+	titleByID := make(map[uint]string, len(modules))
+	for _, m := range modules {
+		titleByID[m.ID] = m.Title
+	}
+
+	for _, a := range answers {
+		r := resultByID[a.QuizResultID]
+		q := quizByID[a.QuizID]
+		rubric, _ := manualRubric(q)
+		item := gradingItem{
+			ID:           a.ID,
+			Status:       a.Status,
+			QuizResultID: a.QuizResultID,
+			ModuleID:     r.ModuleID,
+			ModuleTitle:  titleByID[r.ModuleID],
+			QuizID:       a.QuizID,
+			Question:     q.Question,
+			Rubric:       rubric,
+			MaxPoints:    rubric.Total(),
+			Response:     rawJSON(a.Response),
+			StudentID:    r.UserID,
+			StudentName:  nameByID[r.UserID],
+			SubmittedAt:  a.CreatedAt,
+			Points:       a.Points,
+			Feedback:     a.Feedback,
+			GradedAt:     a.GradedAt,
+		}
+		if a.RubricScores != "" {
+			item.RubricScores = json.RawMessage(a.RubricScores)
+		}
+		items = append(items, item)
+	}
+	return c.JSON(items)
+}
+
+// GradeAnswer -> PUT /instructor/courses/:course_id/grading/:answer_id (requires instructor)
+// Body: {"scores": [points per rubric criterion], "feedback"} or
+// {"points", "feedback"}. Once an attempt has no ungraded answers left its
+// final score is calculated and the student is notified. Graded answers
+// can be graded again. Answers of attempts not yet submitted fail with 409.
+func GradeAnswer(c *fiber.Ctx) error {
+	course, err := loadOwnedCourse(c, c.Params("course_id"))
+	if err != nil {
+		return sendError(c, err)
+	}
+	graderID, _ := currentUserID(c)
+
+	var payload struct {
+		Scores   []float64 `json:"scores"`
+		Points   *float64  `json:"points"`
+		Feedback string    `json:"feedback"`
+	}
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var answer models.QuizAnswer
+	var result models.QuizResult
+	var notify bool
+	var moduleTitle string
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("quiz_answers.*").
+			Joins("JOIN quiz_results ON quiz_results.id = quiz_answers.quiz_result_id AND quiz_results.deleted_at IS NULL").
+			Joins("JOIN modules ON modules.id = quiz_results.module_id").
+			Where("quiz_answers.id = ? AND modules.course_id = ?", c.Params("answer_id"), course.ID).
+			First(&answer).Error
+		if err != nil {
+			return fiber.NewError(404, "answer not found for this course")
+		}
+		// Jawaban yang masih tersimpan di attempt yang belum dikirim tidak dinilai
+		if answer.Status != "pending" && answer.Status != "graded" {
+			return fiber.NewError(409, "this answer has not been submitted yet")
+		}
+		var attempt models.QuizResult
+		if err := tx.Select("id", "status").First(&attempt, answer.QuizResultID).Error; err != nil {
+			return fiber.NewError(404, "attempt not found")
+		}
+		if attempt.Status == "in_progress" {
+			return fiber.NewError(409, "this attempt has not been submitted yet")
+		}
+
+		var quiz models.Quiz
+		if err := tx.Unscoped().First(&quiz, answer.QuizID).Error; err != nil {
+			return fiber.NewError(404, "question not found")
+		}
+		rubric, ok := manualRubric(quiz)
+		if !ok {
+			return fiber.NewError(400, "this answer is graded automatically")
+		}
+		total := rubric.Total()
+
+		points := 0.0
+		scores := ""
+		switch {
+		case payload.Scores != nil:
+			if len(payload.Scores) != len(rubric) {
+				return fiber.NewError(400, fmt.Sprintf("scores must have one entry per rubric criterion (%d)", len(rubric)))
+			}
+			for i, s := range payload.Scores {
+				if math.IsNaN(s) || s < 0 || s > rubric[i].Points {
+					return fiber.NewError(400, fmt.Sprintf("score for %q must be between 0 and %g", rubric[i].Criterion, rubric[i].Points))
+				}
+				points += s
+			}
+			b, _ := json.Marshal(payload.Scores)
+			scores = string(b)
+		case payload.Points != nil:
+			points = *payload.Points
+			if math.IsNaN(points) || points < 0 || points > total {
+				return fiber.NewError(400, fmt.Sprintf("points must be between 0 and %g", total))
+			}
+		default:
+			return fiber.NewError(400, "scores or points is required")
+		}
+
+		now := time.Now()
+		answer.Status = "graded"
+		answer.Points = points
+		answer.Credit = points / total
+		answer.RubricScores = scores
+		answer.Feedback = payload.Feedback
+		answer.GraderID = &graderID
+		answer.GradedAt = &now
+		if err := tx.Model(&answer).Updates(map[string]interface{}{
+			"status":        answer.Status,
+			"points":        answer.Points,
+			"credit":        answer.Credit,
+			"rubric_scores": answer.RubricScores,
+			"feedback":      answer.Feedback,
+			"grader_id":     graderID,
+			"graded_at":     now,
+		}).Error; err != nil {
+			return err
+		}
+
+		result, notify, err = finalizeQuizResult(tx, answer.QuizResultID)
+		if err != nil || !notify {
+			return err
+		}
+		var module models.Module
+		tx.Select("title").First(&module, result.ModuleID)
+		moduleTitle = module.Title
+		return notifyUser(tx, result.UserID, "quiz_graded",
+			fmt.Sprintf("Your quiz for %q has been graded: %g%%", moduleTitle, result.Score),
+			fiber.Map{"course_id": course.ID, "module_id": result.ModuleID, "quiz_result_id": result.ID})
+	})
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "answer graded successfully",
+		"answer":  answer,
+		"result":  result,
+	})
+}
+
+// GetQuizAttempt -> GET /me/courses/:course_id/modules/:module_id/attempts/:attempt_id
+// One of the student's attempts with the credit, points and feedback of
+// each answer. Correct answers are not included. An attempt in progress
+// also lists its questions and the time left.
+func GetQuizAttempt(c *fiber.Ctx) error {
+	module, err := loadEnrolledModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+	userID, _ := currentUserID(c)
+	expireAttempts(userID)
+
+	var result models.QuizResult
+	if err := database.DB.Preload("Answers").Where("id = ? AND module_id = ? AND user_id = ?", c.Params("attempt_id"), module.ID, userID).First(&result).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "attempt not found"})
+	}
+
+	var quizIDs []uint
+	for _, a := range result.Answers {
+		quizIDs = append(quizIDs, a.QuizID)
+	}
+	var quizzes []models.Quiz
+	if len(quizIDs) > 0 {
+		database.DB.Unscoped().Where("id IN ?", quizIDs).Find(&quizzes)
+	}
+	quizByID := make(map[uint]models.Quiz, len(quizzes))
+	for _, q := range quizzes {
+		quizByID[q.ID] = q
+	}
+
+	answers := []fiber.Map{}
+	for _, a := range result.Answers {
+		q := quizByID[a.QuizID]
+		item := fiber.Map{
+			"quiz_id":  a.QuizID,
+			"type":     q.Type,
+			"question": q.Question,
+			"response": rawJSON(a.Response),
+			"status":   a.Status,
+			"credit":   a.Credit,
+		}
+		if rubric, ok := manualRubric(q); ok {
+			item["rubric"] = rubric
+			item["max_points"] = rubric.Total()
+			item["points"] = a.Points
+			item["feedback"] = a.Feedback
+			item["graded_at"] = a.GradedAt
+		}
+		answers = append(answers, item)
+	}
+
+	out := fiber.Map{
+		"id":               result.ID,
+		"module_id":        result.ModuleID,
+		"status":           result.Status,
+		"score":            result.Score,
+		"passed":           result.Passed,
+		"questions":        result.Questions,
+		"module_revision":  result.ModuleRevision,
+		"started_at":       result.StartedAt,
+		"expires_at":       result.ExpiresAt,
+		"submitted_at":     result.SubmittedAt,
+		"answers":          answers,
+		"review_available": reviewAllowed(*module, result),
+	}
+	if result.SubmittedAt == nil && result.Status != "in_progress" {
+		out["submitted_at"] = result.CreatedAt // submitted before attempts were tracked
+	}
+	if result.Status == "in_progress" {
+		out["quizzes"] = attemptQuestions(result)
+		if result.ExpiresAt != nil {
+			left := time.Until(*result.ExpiresAt)
+			if left < 0 {
+				left = 0
+			}
+			out["remaining_seconds"] = int(left.Seconds())
+		}
+	}
+	return c.JSON(out)
+}
@@ -0,0 +1,286 @@
+package controllers
+
+import (
+	"backend-elearning/assets"
+	"backend-elearning/database"
+	"backend-elearning/models"
+	"backend-elearning/storage"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// currentUserID parses the user_id that AuthMiddleware stores as a string.
+func currentUserID(c *fiber.Ctx) (uint, error) {
+	uidStr, ok := c.Locals("user_id").(string)
+	if !ok {
+		return 0, errors.New("unauthorized")
+	}
+	uid, err := strconv.ParseUint(uidStr, 10, 32)
+	if err != nil {
+		return 0, errors.New("invalid user ID")
+	}
+	return uint(uid), nil
+}
+
+// sendError writes err as the usual {"error": ...} body, using the status of
+// a *fiber.Error, 400 or 413 for rejected uploads and 500 for anything else.
+func sendError(c *fiber.Ctx, err error) error {
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		return c.Status(fe.Code).JSON(fiber.Map{"error": fe.Message})
+	}
+	var re *assets.RejectedError
+	if errors.As(err, &re) {
+		if re.TooLarge {
+			return c.Status(413).JSON(fiber.Map{"error": re.Reason})
+		}
+		return c.Status(400).JSON(fiber.Map{"error": re.Reason})
+	}
+	return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+}
+
+// hasUpload reports whether the request carries a file in field or the id
+// of a finished resumable upload in upload_id.
+func hasUpload(c *fiber.Ctx, field string) bool {
+	if c.FormValue("upload_id") != "" {
+		return true
+	}
+	file, _ := c.FormFile(field)
+	return file != nil
+}
+
+// storeUpload validates and stores the file sent in field, or the finished
+// resumable upload named by upload_id, and returns the asset with the
+// sanitized original file name. Both paths run the same checks.
+func storeUpload(c *fiber.Ctx, field string, allowed ...string) (*models.Asset, string, error) {
+	if id := c.FormValue("upload_id"); id != "" {
+		userID, err := currentUserID(c)
+		if err != nil {
+			return nil, "", fiber.NewError(401, err.Error())
+		}
+		asset, name, err := assets.StoreSession(c.UserContext(), id, userID, allowed...)
+		switch {
+		case errors.Is(err, assets.ErrSessionNotFound):
+			return nil, "", fiber.NewError(404, err.Error())
+		case errors.Is(err, assets.ErrSessionExpired):
+			return nil, "", fiber.NewError(410, err.Error())
+		case errors.Is(err, assets.ErrSessionIncomplete):
+			return nil, "", fiber.NewError(409, err.Error())
+		}
+		return asset, name, err
+	}
+
+	file, err := c.FormFile(field)
+	if err != nil {
+		return nil, "", fiber.NewError(400, field+" file is required")
+	}
+	return assets.StoreUpload(c.UserContext(), file, allowed...)
+}
+
+// loadOwnedCourse loads course id and checks that the calling instructor
+// owns it.
+func loadOwnedCourse(c *fiber.Ctx, id interface{}) (*models.Course, error) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return nil, fiber.NewError(401, err.Error())
+	}
+
+	var course models.Course
+	if err := database.DB.First(&course, id).Error; err != nil {
+		return nil, fiber.NewError(404, "course not found")
+	}
+	if course.InstructorID != userID {
+		return nil, fiber.NewError(403, "not your course")
+	}
+	return &course, nil
+}
+
+// loadOwnedModule loads the module from the :course_id/:module_id params and
+// checks that the calling instructor owns its course.
+func loadOwnedModule(c *fiber.Ctx) (*models.Module, error) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return nil, fiber.NewError(401, err.Error())
+	}
+
+	var module models.Module
+	if err := database.DB.Where("id = ? AND course_id = ?", c.Params("module_id"), c.Params("course_id")).First(&module).Error; err != nil {
+		return nil, fiber.NewError(404, "module not found for this course")
+	}
+
+	var course models.Course
+	if err := database.DB.First(&course, module.CourseID).Error; err != nil {
+		return nil, fiber.NewError(404, "course not found")
+	}
+	if course.InstructorID != userID {
+		return nil, fiber.NewError(403, "not your course")
+	}
+
+	return &module, nil
+}
+
+// loadEnrolledModule loads the module from the :course_id/:module_id params
+// and checks that the calling user is enrolled in its course.
+func loadEnrolledModule(c *fiber.Ctx) (*models.Module, error) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return nil, fiber.NewError(401, err.Error())
+	}
+
+	var module models.Module
+	if err := database.DB.Where("id = ? AND course_id = ?", c.Params("module_id"), c.Params("course_id")).First(&module).Error; err != nil {
+		return nil, fiber.NewError(404, "module not found for this course")
+	}
+
+	var enrollment models.Enrollment
+	if err := database.DB.Where("user_id = ? AND course_id = ?", userID, module.CourseID).First(&enrollment).Error; err != nil {
+		return nil, fiber.NewError(403, "not enrolled in this course")
+	}
+
+	return &module, nil
+}
+
+// canAccessCourse reports whether userID teaches or is enrolled in the course.
+func canAccessCourse(userID, courseID uint) bool {
+	var course models.Course
+	if err := database.DB.First(&course, courseID).Error; err != nil {
+		return false
+	}
+	if course.InstructorID == userID {
+		return true
+	}
+	var n int64
+	database.DB.Model(&models.Enrollment{}).Where("user_id = ? AND course_id = ?", userID, courseID).Count(&n)
+	return n > 0
+}
+
+// sendStoredFile serves a stored file: it redirects to a signed URL when
+// RedirectDownloads is on and the backend supports it, and streams it
+// otherwise. disposition is "inline" or "attachment".
+func sendStoredFile(c *fiber.Ctx, fileURL, filename, disposition string) error {
+	key := storage.KeyFromURL(fileURL)
+	ctx := c.UserContext()
+
+	info, err := storage.Files.Stat(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "file not found on server"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if storage.RedirectDownloads {
+		signed, err := storage.Files.SignedURL(ctx, key, 5*time.Minute)
+		if err == nil {
+			return c.Redirect(signed, fiber.StatusFound)
+		}
+		if !errors.Is(err, storage.ErrSignedURLUnsupported) {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	// Range requests let PDF viewers load large files progressively
+	c.Set("Accept-Ranges", "bytes")
+	start, length, partial, ok := parseRange(c.Get("Range"), info.Size)
+	if !ok {
+		c.Set("Content-Range", fmt.Sprintf("bytes */%d", info.Size))
+		return c.Status(416).JSON(fiber.Map{"error": "requested range not satisfiable"})
+	}
+
+	var rc io.ReadCloser
+	if partial {
+		rc, err = storage.Files.GetRange(ctx, key, start, length)
+	} else {
+		rc, err = storage.Files.Get(ctx, key)
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if partial {
+		c.Status(206)
+		c.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, info.Size))
+	}
+	contentType := info.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(key))
+	}
+	if contentType != "" {
+		c.Set("Content-Type", contentType)
+	}
+	c.Set("Content-Disposition", contentDisposition(disposition, filename))
+	return c.SendStream(rc, int(length))
+}
+
+// parseRange reads a single "bytes=" range. ok is false when the range
+// cannot be satisfied; anything else it does not understand, including
+// multiple ranges, gets the whole file, as RFC 9110 allows.
+func parseRange(header string, size int64) (start, length int64, partial, ok bool) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, size, false, true
+	}
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, size, false, true
+	}
+
+	if first == "" {
+		// "bytes=-500": the last 500 bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return 0, size, false, true
+		}
+		if n <= 0 || size == 0 {
+			return 0, 0, false, false
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, n, true, true
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return 0, size, false, true
+	}
+	if start >= size {
+		return 0, 0, false, false
+	}
+	end := size - 1
+	if last != "" {
+		e, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || e < start {
+			return 0, size, false, true
+		}
+		if e < end {
+			end = e
+		}
+	}
+	return start, end - start + 1, true, true
+}
+
+// contentDisposition builds the header with an ASCII fallback name and the
+// full UTF-8 name in filename* (RFC 6266), so non-Latin names survive.
+func contentDisposition(disposition, filename string) string {
+	filename = assets.SanitizeFilename(filename)
+	ascii := strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, filename)
+	if ascii == filename {
+		return fmt.Sprintf("%s; filename=\"%s\"", disposition, filename)
+	}
+	return fmt.Sprintf("%s; filename=\"%s\"; filename*=UTF-8''%s", disposition, ascii, strings.ReplaceAll(url.QueryEscape(filename), "+", "%20"))
+}
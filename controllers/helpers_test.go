@@ -0,0 +1,61 @@
+package controllers
+
+import "testing"
+
+func TestParseRange(t *testing.T) {
+	const size = 1000
+	tests := []struct {
+		header        string
+		start, length int64
+		partial, ok   bool
+	}{
+		{"", 0, size, false, true},
+		{"bytes=0-499", 0, 500, true, true},
+		{"bytes=500-999", 500, 500, true, true},
+		{"bytes=500-", 500, 500, true, true},
+		{"bytes=999-999", 999, 1, true, true},
+		{"bytes=900-5000", 900, 100, true, true}, // end past the file is clamped
+		{" bytes=0-0", 0, size, false, true},
+		{"bytes= 10-19", 10, 10, true, true},
+
+		// suffix ranges
+		{"bytes=-100", 900, 100, true, true},
+		{"bytes=-1", 999, 1, true, true},
+		{"bytes=-5000", 0, size, true, true},
+		{"bytes=-0", 0, 0, false, false},
+
+		// multiple or overlapping ranges get the whole file
+		{"bytes=0-99,200-299", 0, size, false, true},
+		{"bytes=0-500,400-999", 0, size, false, true},
+		{"bytes=0-1,0-1", 0, size, false, true},
+
+		// unsatisfiable
+		{"bytes=1000-", 0, 0, false, false},
+		{"bytes=1000-1100", 0, 0, false, false},
+		{"bytes=5000-", 0, 0, false, false},
+
+		// invalid ranges are ignored
+		{"bytes=abc-def", 0, size, false, true},
+		{"bytes=10", 0, size, false, true},
+		{"bytes=20-10", 0, size, false, true},
+		{"bytes=-", 0, size, false, true},
+		{"bytes=--5", 0, size, false, true},
+		{"bytes=10-x", 0, size, false, true},
+		{"items=0-10", 0, size, false, true},
+	}
+	for _, tt := range tests {
+		start, length, partial, ok := parseRange(tt.header, size)
+		if start != tt.start || length != tt.length || partial != tt.partial || ok != tt.ok {
+			t.Errorf("parseRange(%q) = %d, %d, %v, %v; want %d, %d, %v, %v",
+				tt.header, start, length, partial, ok, tt.start, tt.length, tt.partial, tt.ok)
+		}
+	}
+
+	// Nothing can be served from an empty file.
+	if _, _, _, ok := parseRange("bytes=-10", 0); ok {
+		t.Error("suffix range on an empty file is satisfiable")
+	}
+	if _, _, _, ok := parseRange("bytes=0-", 0); ok {
+		t.Error("range on an empty file is satisfiable")
+	}
+}
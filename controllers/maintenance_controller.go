@@ -0,0 +1,28 @@
+package controllers
+
+import (
+	"backend-elearning/assets"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ReconcileUploads -> POST /admin/uploads/reconcile (admin only)
+// Lists stored files no row references and rows whose file is missing.
+// Nothing is changed unless dry_run=false; then orphans older than
+// grace_minutes (default 60) are deleted and dangling references cleared.
+func ReconcileUploads(c *fiber.Ctx) error {
+	dryRun := c.Query("dry_run", c.FormValue("dry_run")) != "false"
+
+	grace := time.Hour
+	if m := c.QueryInt("grace_minutes", -1); m >= 0 {
+		grace = time.Duration(m) * time.Minute
+	}
+
+	report, err := assets.Reconcile(c.UserContext(), dryRun, grace)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(report)
+}
@@ -0,0 +1,344 @@
+package controllers
+
+import (
+	"backend-elearning/assets"
+	"backend-elearning/database"
+	"backend-elearning/models"
+	"fmt"
+	"sort"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ReorderModules -> PUT /instructor/courses/:course_id/modules/order (requires instructor)
+// Body: {"module_ids": [3, 1, 2]} listing every module of the course once.
+// The modules get orders 1..n in that sequence; nothing changes on error.
+func ReorderModules(c *fiber.Ctx) error {
+	course, err := loadOwnedCourse(c, c.Params("course_id"))
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	var payload struct {
+		ModuleIDs []uint `json:"module_ids"`
+	}
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var moved []models.Module // modules whose order changed, as they were before
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var modules []models.Module
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("course_id = ?", course.ID).Find(&modules).Error; err != nil {
+			return err
+		}
+
+		// Daftar harus berisi semua module course ini, masing-masing sekali
+		inCourse := make(map[uint]*models.Module, len(modules))
+		for i := range modules {
+			inCourse[modules[i].ID] = &modules[i]
+		}
+		seen := make(map[uint]bool, len(payload.ModuleIDs))
+		for _, id := range payload.ModuleIDs {
+			if inCourse[id] == nil {
+				return fiber.NewError(400, fmt.Sprintf("module %d is not in this course", id))
+			}
+			if seen[id] {
+				return fiber.NewError(400, fmt.Sprintf("module %d is listed twice", id))
+			}
+			seen[id] = true
+		}
+		if len(seen) != len(modules) {
+			return fiber.NewError(400, fmt.Sprintf("module_ids must list all %d modules of the course", len(modules)))
+		}
+
+		for i, id := range payload.ModuleIDs {
+			if inCourse[id].Order == i+1 {
+				continue
+			}
+			moved = append(moved, *inCourse[id])
+			if err := tx.Model(&models.Module{}).Where("id = ?", id).Update("order", i+1).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	userID, _ := currentUserID(c)
+	newOrder := make(map[uint]int, len(payload.ModuleIDs))
+	for i, id := range payload.ModuleIDs {
+		newOrder[id] = i + 1
+	}
+	for _, m := range moved {
+		ensureModuleBaseline(c.UserContext(), &m, userID)
+		m.Order = newOrder[m.ID]
+		recordModuleRevision(c.UserContext(), &m, "reordered", "", userID)
+	}
+
+	var modules []models.Module
+	database.DB.Where("course_id = ?", course.ID).Order("`order` ASC").Find(&modules)
+	return c.JSON(fiber.Map{
+		"message": "modules reordered",
+		"modules": modules,
+	})
+}
+
+type moduleTransferPayload struct {
+	ModuleIDs      []uint `json:"module_ids"`
+	TargetCourseID uint   `json:"target_course_id"`
+}
+
+// MoveModules -> POST /instructor/courses/:course_id/modules/move (requires instructor)
+// Body: {"module_ids": [...], "target_course_id": 7}. Both courses must be
+// the caller's. The modules keep their relative order and are placed after
+// the target's own modules, together with their quizzes, blocks and the
+// quiz results students already have.
+func MoveModules(c *fiber.Ctx) error {
+	target, modules, err := loadModuleTransfer(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+	source := modules[0].CourseID
+	if source == target.ID {
+		return c.Status(400).JSON(fiber.Map{"error": "modules are already in the target course"})
+	}
+
+	userID, _ := currentUserID(c)
+	for i := range modules {
+		ensureModuleBaseline(c.UserContext(), &modules[i], userID)
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		next, err := nextModuleOrder(tx, target.ID)
+		if err != nil {
+			return err
+		}
+		for i := range modules {
+			modules[i].CourseID = target.ID
+			modules[i].Order = next + i
+			err := tx.Model(&modules[i]).Updates(map[string]interface{}{
+				"course_id": modules[i].CourseID,
+				"order":     modules[i].Order,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	for i := range modules {
+		recordModuleRevision(c.UserContext(), &modules[i], "moved", fmt.Sprintf("moved from course %d", source), userID)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": fmt.Sprintf("%d modules moved", len(modules)),
+		"modules": modules,
+	})
+}
+
+// CopyModules -> POST /instructor/courses/:course_id/modules/copy (requires instructor)
+// Same body as MoveModules; the target may be the same course. Copies get
+// the quizzes and content blocks of the originals and share their files.
+// Quiz results stay with the originals.
+func CopyModules(c *fiber.Ctx) error {
+	target, modules, err := loadModuleTransfer(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+	ctx := c.UserContext()
+
+	// Ambil referensi file dulu; dilepas lagi kalau transaksi gagal
+	var acquired []string
+	acquire := func(url string) (string, error) {
+		if url == "" {
+			return "", nil
+		}
+		shared, err := assets.Acquire(ctx, url)
+		if err == nil {
+			acquired = append(acquired, shared)
+		}
+		return shared, err
+	}
+
+	var copies []models.Module
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		next, err := nextModuleOrder(tx, target.ID)
+		if err != nil {
+			return err
+		}
+
+		for i, m := range modules {
+			dup := models.Module{
+				Title:         m.Title,
+				PDFName:       m.PDFName,
+				Order:         next + i,
+				CourseID:      target.ID,
+				PageCount:     m.PageCount,
+				PDFTitle:      m.PDFTitle,
+				PDFInfoStatus: m.PDFInfoStatus,
+
+				QuizTimeLimit:   m.QuizTimeLimit,
+				QuizMaxAttempts: m.QuizMaxAttempts,
+				QuizCooldown:    m.QuizCooldown,
+				QuizScoring:     m.QuizScoring,
+
+				QuizPassThreshold:   m.QuizPassThreshold,
+				QuizNegativeMarking: m.QuizNegativeMarking,
+				QuizDeadline:        m.QuizDeadline,
+				QuizReviewPolicy:    m.QuizReviewPolicy,
+			}
+			if dup.PDFUrl, err = acquire(m.PDFUrl); err != nil {
+				return err
+			}
+			if dup.ThumbnailUrl, err = acquire(m.ThumbnailUrl); err != nil {
+				return err
+			}
+			if err := tx.Create(&dup).Error; err != nil {
+				return err
+			}
+
+			var quizzes []models.Quiz
+			if err := tx.Where("module_id = ?", m.ID).Order("position ASC, id ASC").Find(&quizzes).Error; err != nil {
+				return err
+			}
+			for _, q := range quizzes {
+				quiz := models.Quiz{
+					ModuleID:    dup.ID,
+					Type:        q.Type,
+					Question:    q.Question,
+					Options:     q.Options,
+					Answer:      q.Answer,
+					Points:      q.Points,
+					Explanation: q.Explanation,
+					Position:    q.Position,
+				}
+				if err := tx.Create(&quiz).Error; err != nil {
+					return err
+				}
+			}
+
+			// Banks belong to the instructor, so the rules work in any of their courses
+			var rules []models.QuizRule
+			if err := tx.Where("module_id = ?", m.ID).Find(&rules).Error; err != nil {
+				return err
+			}
+			for _, r := range rules {
+				rule := models.QuizRule{
+					ModuleID:   dup.ID,
+					BankID:     r.BankID,
+					Count:      r.Count,
+					Topic:      r.Topic,
+					Difficulty: r.Difficulty,
+					Position:   r.Position,
+				}
+				if err := tx.Create(&rule).Error; err != nil {
+					return err
+				}
+			}
+
+			var blocks []models.ContentBlock
+			if err := tx.Where("module_id = ?", m.ID).Order("position ASC, id ASC").Find(&blocks).Error; err != nil {
+				return err
+			}
+			for _, b := range blocks {
+				block := models.ContentBlock{
+					ModuleID: dup.ID,
+					Type:     b.Type,
+					Position: b.Position,
+					Title:    b.Title,
+					Body:     b.Body,
+					URL:      b.URL,
+					FileName: b.FileName,
+				}
+				if block.FileUrl, err = acquire(b.FileUrl); err != nil {
+					return err
+				}
+				if err := tx.Create(&block).Error; err != nil {
+					return err
+				}
+			}
+
+			copies = append(copies, dup)
+		}
+		return nil
+	})
+	if err != nil {
+		for _, url := range acquired {
+			_ = assets.Release(ctx, url)
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	userID, _ := currentUserID(c)
+	for i, m := range copies {
+		if m.PDFInfoStatus == "pending" {
+			assets.QueuePDFInfo(m.ID)
+		}
+		recordModuleRevision(ctx, &copies[i], "copied", fmt.Sprintf("copied from module %d", modules[i].ID), userID)
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"message": fmt.Sprintf("%d modules copied", len(copies)),
+		"modules": copies,
+	})
+}
+
+// loadModuleTransfer parses a moduleTransferPayload and checks that the
+// caller owns the source course (:course_id) and the target course, and
+// that every module belongs to the source. The modules are returned in
+// their current order.
+func loadModuleTransfer(c *fiber.Ctx) (*models.Course, []models.Module, error) {
+	var payload moduleTransferPayload
+	if err := c.BodyParser(&payload); err != nil {
+		return nil, nil, fiber.NewError(400, err.Error())
+	}
+	if len(payload.ModuleIDs) == 0 {
+		return nil, nil, fiber.NewError(400, "module_ids is required")
+	}
+	if payload.TargetCourseID == 0 {
+		return nil, nil, fiber.NewError(400, "target_course_id is required")
+	}
+
+	source, err := loadOwnedCourse(c, c.Params("course_id"))
+	if err != nil {
+		return nil, nil, err
+	}
+	target, err := loadOwnedCourse(c, payload.TargetCourseID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ids := make(map[uint]bool, len(payload.ModuleIDs))
+	for _, id := range payload.ModuleIDs {
+		ids[id] = true
+	}
+	var modules []models.Module
+	if err := database.DB.Where("id IN ? AND course_id = ?", payload.ModuleIDs, source.ID).Find(&modules).Error; err != nil {
+		return nil, nil, err
+	}
+	if len(modules) != len(ids) {
+		return nil, nil, fiber.NewError(404, "some modules were not found in this course")
+	}
+	sort.Slice(modules, func(i, j int) bool {
+		if modules[i].Order != modules[j].Order {
+			return modules[i].Order < modules[j].Order
+		}
+		return modules[i].ID < modules[j].ID
+	})
+	return target, modules, nil
+}
+
+// nextModuleOrder is the order that puts a module after the last one of
+// the course.
+func nextModuleOrder(tx *gorm.DB, courseID uint) (int, error) {
+	var last struct{ Max int }
+	err := tx.Model(&models.Module{}).Select("COALESCE(MAX(`order`), 0) AS max").Where("course_id = ?", courseID).Scan(&last).Error
+	return last.Max + 1, err
+}
@@ -1,178 +1,374 @@
 package controllers
 
 import (
-    "backend-elearning/database"
-    "backend-elearning/models"
-    "fmt"
-    "os"
-    "path/filepath"
-    "strconv"
-
-    "github.com/gofiber/fiber/v2"
+	"backend-elearning/assets"
+	"backend-elearning/database"
+	"backend-elearning/models"
+	"backend-elearning/utils"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
 )
 
 // AddModuleToCourse -> POST /instructor/courses/:id/modules (instructor only)
 func AddModuleToCourse(c *fiber.Ctx) error {
-    courseID := c.Params("course_id")
-
-    // Ambil form-data
-    title := c.FormValue("title")
-    orderStr := c.FormValue("order")
-
-    if title == "" {
-        return c.Status(400).JSON(fiber.Map{"error": "title is required"})
-    }
-
-    // Konversi order ke int
-    order, _ := strconv.Atoi(orderStr)
-
-    // Cek course exist
-    var course models.Course
-    if err := database.DB.First(&course, courseID).Error; err != nil {
-        return c.Status(404).JSON(fiber.Map{"error": "course not found"})
-    }
-
-    // Ambil file PDF (opsional)
-    file, _ := c.FormFile("pdf")
-
-    // Buat module dulu
-    module := models.Module{
-        Title:    title,
-        Order:    order,
-        CourseID: course.ID,
-    }
-
-    if err := database.DB.Create(&module).Error; err != nil {
-        return c.Status(500).JSON(fiber.Map{"error": err.Error()})
-    }
-
-    // Jika tidak ada file PDF → return module tanpa PDF
-    if file == nil {
-        return c.Status(201).JSON(fiber.Map{
-            "message": "module created (without PDF)",
-            "module":  module,
-        })
-    }
-
-    // Validasi PDF
-    if file.Header.Get("Content-Type") != "application/pdf" {
-        return c.Status(400).JSON(fiber.Map{"error": "file must be PDF"})
-    }
-
-    // Tentukan lokasi penyimpanan
-    filename := fmt.Sprintf("uploads/modules/%d-%s", module.ID, file.Filename)
-
-    if err := c.SaveFile(file, filename); err != nil {
-        return c.Status(500).JSON(fiber.Map{"error": err.Error()})
-    }
-
-    // Update module dengan PDFUrl
-    module.PDFUrl = "/" + filename
-    database.DB.Save(&module)
-
-    return c.Status(201).JSON(fiber.Map{
-        "message": "module created successfully",
-        "module":  module,
-    })
+	courseID := c.Params("course_id")
+
+	// Ambil form-data
+	title := c.FormValue("title")
+	orderStr := c.FormValue("order")
+
+	if title == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "title is required"})
+	}
+
+	// Konversi order ke int
+	order, _ := strconv.Atoi(orderStr)
+
+	// Cek course exist
+	var course models.Course
+	if err := database.DB.First(&course, courseID).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "course not found"})
+	}
+
+	// Ambil file PDF (opsional): form "pdf" atau upload_id dari upload resumable
+	withPDF := hasUpload(c, "pdf")
+
+	// Buat module dulu
+	module := models.Module{
+		Title:    title,
+		Order:    order,
+		CourseID: course.ID,
+	}
+
+	if err := database.DB.Create(&module).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	userID, _ := currentUserID(c)
+
+	// Jika tidak ada file PDF → return module tanpa PDF
+	if !withPDF {
+		recordModuleRevision(c.UserContext(), &module, "created", "", userID)
+		return c.Status(201).JSON(fiber.Map{
+			"message": "module created (without PDF)",
+			"module":  module,
+		})
+	}
+
+	// Validasi isi PDF lalu simpan dengan nama hasil generate
+	// (file yang sama hanya disimpan sekali)
+	asset, name, err := storeUpload(c, "pdf", ".pdf")
+	if err != nil {
+		database.DB.Unscoped().Delete(&module)
+		return sendError(c, err)
+	}
+
+	// Update module dengan PDFUrl
+	module.PDFUrl = assets.URL(asset)
+	module.PDFName = name
+	module.PDFInfoStatus = "pending"
+	if err := database.DB.Save(&module).Error; err != nil {
+		// Lepas lagi referensi ke PDF yang baru disimpan
+		_ = assets.Release(c.UserContext(), module.PDFUrl)
+		database.DB.Unscoped().Delete(&module)
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Jumlah halaman, judul & thumbnail diisi oleh job di background
+	assets.QueuePDFInfo(module.ID)
+	recordModuleRevision(c.UserContext(), &module, "created", "", userID)
+
+	return c.Status(201).JSON(fiber.Map{
+		"message": "module created successfully",
+		"module":  module,
+	})
 }
 
 // EditModule -> PUT /instructor/courses/:course_id/modules/:id (requires instructor)
 func EditModule(c *fiber.Ctx) error {
-    courseID := c.Params("course_id")
-    moduleID := c.Params("module_id")
-
-    title := c.FormValue("title")
-    orderStr := c.FormValue("order")
-    order, _ := strconv.Atoi(orderStr)
-
-    var module models.Module
-    // Ensure module exists and belongs to the given course
-    if err := database.DB.Where("id = ? AND course_id = ?", moduleID, courseID).First(&module).Error; err != nil {
-        return c.Status(404).JSON(fiber.Map{"error": "module not found for this course"})
-    }
-
-    // Update Title & Order
-    if title != "" {
-        module.Title = title
-    }
-    module.Order = order
-
-    // Cek PDF baru (opsional)
-    pdfFile, _ := c.FormFile("pdf")
-    if pdfFile != nil {
-        if pdfFile.Header.Get("Content-Type") != "application/pdf" {
-            return c.Status(400).JSON(fiber.Map{"error": "file must be a PDF"})
-        }
-
-        // Hapus PDF lama jika ada
-        if module.PDFUrl != "" {
-            _ = os.Remove("." + module.PDFUrl)
-        }
-
-        // Simpan PDF baru
-        filename := fmt.Sprintf("uploads/modules/%d-%s", module.ID, pdfFile.Filename)
-        if err := c.SaveFile(pdfFile, filename); err != nil {
-            return c.Status(500).JSON(fiber.Map{"error": err.Error()})
-        }
-
-        module.PDFUrl = "/" + filename
-    }
-
-    if err := database.DB.Save(&module).Error; err != nil {
-        return c.Status(500).JSON(fiber.Map{"error": err.Error()})
-    }
-
-    return c.JSON(fiber.Map{
-        "message": "module updated successfully",
-        "module":  module,
-    })
+	courseID := c.Params("course_id")
+	moduleID := c.Params("module_id")
+
+	title := c.FormValue("title")
+	orderStr := c.FormValue("order")
+
+	var module models.Module
+	// Ensure module exists and belongs to the given course
+	if err := database.DB.Where("id = ? AND course_id = ?", moduleID, courseID).First(&module).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "module not found for this course"})
+	}
+	userID, _ := currentUserID(c)
+	ctx := c.UserContext()
+	// Tanpa revisi awal, PDF lama akan hilang saat diganti
+	if err := ensureModuleBaseline(ctx, &module, userID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "could not keep the module's current revision: " + err.Error()})
+	}
+
+	// Update Title & Order; field yang tidak dikirim dibiarkan
+	if title != "" {
+		module.Title = title
+	}
+	if orderStr != "" {
+		order, err := strconv.Atoi(orderStr)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "order must be a number"})
+		}
+		module.Order = order
+	}
+
+	// Cek PDF baru (opsional)
+	newPDF := hasUpload(c, "pdf")
+	oldPDF, oldThumbnail := module.PDFUrl, module.ThumbnailUrl
+	if newPDF {
+		// Simpan PDF baru
+		asset, name, err := storeUpload(c, "pdf", ".pdf")
+		if err != nil {
+			return sendError(c, err)
+		}
+
+		module.PDFUrl = assets.URL(asset)
+		module.PDFName = name
+		module.PageCount = 0
+		module.PDFTitle = ""
+		module.ThumbnailUrl = ""
+		module.PDFInfoStatus = "pending"
+	}
+
+	// Perubahan dan revisinya disimpan bersama, atau tidak sama sekali
+	if err := saveModuleWithRevision(ctx, &module, "updated", "", userID); err != nil {
+		if newPDF {
+			_ = assets.Release(ctx, module.PDFUrl)
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Baru sekarang PDF lama dilepas; revisi sebelumnya tetap memegangnya
+	if newPDF {
+		_ = assets.Release(ctx, oldPDF)
+		_ = assets.Release(ctx, oldThumbnail)
+	}
+	if module.PDFInfoStatus == "pending" {
+		assets.QueuePDFInfo(module.ID)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "module updated successfully",
+		"module":  module,
+	})
 }
 
 // DeleteModule -> DELETE /instructor/courses/:course_id/modules/:id (requires instructor)
 func DeleteModule(c *fiber.Ctx) error {
-    courseID := c.Params("course_id")
-    id := c.Params("module_id")
+	courseID := c.Params("course_id")
+	id := c.Params("module_id")
 
-    var module models.Module
-    if err := database.DB.Where("id = ? AND course_id = ?", id, courseID).First(&module).Error; err != nil {
-        return c.Status(404).JSON(fiber.Map{"error": "module not found for this course"})
-    }
+	var module models.Module
+	if err := database.DB.Where("id = ? AND course_id = ?", id, courseID).First(&module).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "module not found for this course"})
+	}
 
 	if err := database.DB.Delete(&module).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	releaseModuleFiles(c.UserContext(), module)
+
 	return c.JSON(fiber.Map{
-        "message": "module deleted successfully",
-    })
+		"message": "module deleted successfully",
+	})
 
 }
 
 // GetModulePDF -> GET /courses/:course_id/modules/:module_id/pdf
-// Returns the PDF file for a module if it exists. Public endpoint.
+// Returns the PDF file for a module if it exists, streamed from storage or
+// redirected to a signed URL when STORAGE_REDIRECT is on.
 func GetModulePDF(c *fiber.Ctx) error {
-    courseID := c.Params("course_id")
-    moduleID := c.Params("module_id")
+	courseID := c.Params("course_id")
+	moduleID := c.Params("module_id")
 
-    var module models.Module
-    if err := database.DB.Where("id = ? AND course_id = ?", moduleID, courseID).First(&module).Error; err != nil {
-        return c.Status(404).JSON(fiber.Map{"error": "module not found for this course"})
-    }
+	var module models.Module
+	if err := database.DB.Where("id = ? AND course_id = ?", moduleID, courseID).First(&module).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "module not found for this course"})
+	}
 
-    if module.PDFUrl == "" {
-        return c.Status(404).JSON(fiber.Map{"error": "no PDF available for this module"})
-    }
+	if module.PDFUrl == "" {
+		return c.Status(404).JSON(fiber.Map{"error": "no PDF available for this module"})
+	}
 
-    // PDFUrl is stored like "/uploads/modules/123-file.pdf"
-    filePath := "." + module.PDFUrl
-    if _, err := os.Stat(filePath); os.IsNotExist(err) {
-        return c.Status(404).JSON(fiber.Map{"error": "PDF file not found on server"})
-    }
+	userID, _ := currentUserID(c)
+	fileURL, err := modulePDFFor(c.UserContext(), &module, userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
 
-    // Set inline Content-Disposition so browser can preview PDF
-    filename := filepath.Base(filePath)
-    c.Set("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", filename))
+	// Inline Content-Disposition so browser can preview PDF
+	name := module.PDFName
+	if name == "" {
+		name = filepath.Base(module.PDFUrl)
+	}
+	return sendStoredFile(c, fileURL, name, "inline")
+}
+
+// signedPDFTTL is how long a signed PDF link stays valid. Viewers keep
+// issuing Range requests while the document is open, so it is not too short.
+const signedPDFTTL = 30 * time.Minute
+
+// GetModulePDFLink -> GET /me/courses/:course_id/modules/:module_id/pdf/link
+// Also mounted for instructors on their own courses. Returns a short-lived
+// URL for the module PDF that works without an Authorization header, e.g.
+// in an <iframe>. The link is bound to the requesting user.
+func GetModulePDFLink(c *fiber.Ctx) error {
+	var module *models.Module
+	var err error
+	if c.Locals("role") == "instructor" {
+		module, err = loadOwnedModule(c)
+	} else {
+		module, err = loadEnrolledModule(c)
+	}
+	if err != nil {
+		return sendError(c, err)
+	}
+	if module.PDFUrl == "" {
+		return c.Status(404).JSON(fiber.Map{"error": "no PDF available for this module"})
+	}
+
+	userID, _ := currentUserID(c)
+	expires := time.Now().Add(signedPDFTTL)
+	link, err := utils.SignURL(fmt.Sprintf("/api/files/modules/%d/pdf", module.ID), modulePDFResource(module.ID), userID, expires)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
 
-    return c.SendFile(filePath)
+	return c.JSON(fiber.Map{
+		"url":        link,
+		"expires_at": expires,
+	})
 }
 
+// StreamModulePDF -> GET /files/modules/:module_id/pdf?uid=&exp=&sig= (public)
+// Serves the PDF for a link from GetModulePDFLink, with Range support. The
+// user the link was issued to must still have access to the course.
+func StreamModulePDF(c *fiber.Ctx) error {
+	moduleID, err := strconv.ParseUint(c.Params("module_id"), 10, 32)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "module not found"})
+	}
+
+	userID, err := utils.VerifySignedURL(modulePDFResource(uint(moduleID)), c.Query("uid"), c.Query("exp"), c.Query("sig"))
+	if errors.Is(err, utils.ErrSignatureInvalid) || errors.Is(err, utils.ErrSignatureExpired) {
+		return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var module models.Module
+	if err := database.DB.First(&module, moduleID).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "module not found"})
+	}
+	if !canAccessCourse(userID, module.CourseID) {
+		return c.Status(403).JSON(fiber.Map{"error": "no access to this course"})
+	}
+	if module.PDFUrl == "" {
+		return c.Status(404).JSON(fiber.Map{"error": "no PDF available for this module"})
+	}
+
+	fileURL, err := modulePDFFor(c.UserContext(), &module, userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	c.Set("Cache-Control", "private, max-age=300")
+	c.Set("Referrer-Policy", "no-referrer")
+	name := module.PDFName
+	if name == "" {
+		name = filepath.Base(module.PDFUrl)
+	}
+	return sendStoredFile(c, fileURL, name, "inline")
+}
+
+// GetModuleThumbnail -> GET /me/courses/:course_id/modules/:module_id/thumbnail
+// Also mounted for instructors on their own courses. Serves the first-page
+// PNG made after the PDF upload.
+func GetModuleThumbnail(c *fiber.Ctx) error {
+	var module *models.Module
+	var err error
+	if c.Locals("role") == "instructor" {
+		module, err = loadOwnedModule(c)
+	} else {
+		module, err = loadEnrolledModule(c)
+	}
+	if err != nil {
+		return sendError(c, err)
+	}
+	if module.ThumbnailUrl == "" {
+		return c.Status(404).JSON(fiber.Map{"error": "no thumbnail available for this module"})
+	}
+
+	c.Set("Cache-Control", "private, max-age=3600")
+	return sendStoredFile(c, module.ThumbnailUrl, fmt.Sprintf("module-%d.png", module.ID), "inline")
+}
+
+// moduleInfo is the PDF metadata included in module listings. prefix is
+// "/api/me" or "/api/instructor", whichever serves the thumbnail to the
+// caller.
+func moduleInfo(prefix string, m models.Module) fiber.Map {
+	thumbnail := ""
+	if m.ThumbnailUrl != "" {
+		thumbnail = fmt.Sprintf("%s/courses/%d/modules/%d/thumbnail", prefix, m.CourseID, m.ID)
+	}
+	return fiber.Map{
+		"status":        m.PDFInfoStatus,
+		"page_count":    m.PageCount,
+		"title":         m.PDFTitle,
+		"thumbnail_url": thumbnail,
+	}
+}
+
+func modulePDFResource(moduleID uint) string {
+	return fmt.Sprintf("module-pdf/%d", moduleID)
+}
+
+// modulePDFFor returns the URL of the module PDF to serve to userID: the
+// original, or a copy stamped with the user's name when the course has
+// watermarking on. The course instructor always gets the original. If the
+// stamp cannot be made the download fails rather than falling back.
+func modulePDFFor(ctx context.Context, module *models.Module, userID uint) (string, error) {
+	var course models.Course
+	if err := database.DB.First(&course, module.CourseID).Error; err != nil {
+		return "", err
+	}
+	if !course.WatermarkPDFs || course.InstructorID == userID {
+		return module.PDFUrl, nil
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		return "", err
+	}
+	return assets.Watermarked(ctx, user, module.PDFUrl)
+}
+
+// releaseModuleFiles drops the references a deleted module held on its PDF,
+// block attachments and assignment submissions, so files nothing else uses
+// are removed. The blocks and assignments go too; soft-deleting the module
+// does not cascade to them.
+func releaseModuleFiles(ctx context.Context, module models.Module) {
+	_ = assets.Release(ctx, module.PDFUrl)
+	_ = assets.Release(ctx, module.ThumbnailUrl)
+
+	var blocks []models.ContentBlock
+	database.DB.Where("module_id = ?", module.ID).Find(&blocks)
+	for _, b := range blocks {
+		_ = assets.Release(ctx, b.FileUrl)
+	}
+	database.DB.Where("module_id = ?", module.ID).Delete(&models.ContentBlock{})
+	releaseAssignments(ctx, module.ID)
+	releaseModuleRevisions(ctx, module.ID)
+}
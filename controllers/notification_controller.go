@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"backend-elearning/database"
+	"backend-elearning/models"
+	"encoding/json"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// notifyUser stores a notification for userID. data holds the ids the
+// client needs to link to what happened.
+func notifyUser(tx *gorm.DB, userID uint, kind, message string, data fiber.Map) error {
+	b, _ := json.Marshal(data)
+	return tx.Create(&models.Notification{
+		UserID:  userID,
+		Kind:    kind,
+		Message: message,
+		Data:    string(b),
+	}).Error
+}
+
+// ListNotifications -> GET /me/notifications
+// Newest first, at most 100. ?unread=true leaves out those already read.
+func ListNotifications(c *fiber.Ctx) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	query := database.DB.Where("user_id = ?", userID)
+	if c.QueryBool("unread") {
+		query = query.Where("read_at IS NULL")
+	}
+	var notifications []models.Notification
+	if err := query.Order("created_at DESC, id DESC").Limit(100).Find(&notifications).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var unread int64
+	database.DB.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", userID).Count(&unread)
+
+	return c.JSON(fiber.Map{
+		"unread":        unread,
+		"notifications": notifications,
+	})
+}
+
+// MarkNotificationRead -> PUT /me/notifications/:id/read
+func MarkNotificationRead(c *fiber.Ctx) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	res := database.DB.Model(&models.Notification{}).
+		Where("id = ? AND user_id = ? AND read_at IS NULL", c.Params("id"), userID).
+		Update("read_at", time.Now())
+	if res.Error != nil {
+		return c.Status(500).JSON(fiber.Map{"error": res.Error.Error()})
+	}
+	if res.RowsAffected == 0 {
+		var n int64
+		database.DB.Model(&models.Notification{}).Where("id = ? AND user_id = ?", c.Params("id"), userID).Count(&n)
+		if n == 0 {
+			return c.Status(404).JSON(fiber.Map{"error": "notification not found"})
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "notification marked as read",
+	})
+}
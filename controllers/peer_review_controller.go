@@ -0,0 +1,590 @@
+package controllers
+
+import (
+	"backend-elearning/database"
+	"backend-elearning/models"
+	"backend-elearning/questions"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"math/rand/v2"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// peerRubric returns the rubric peer reviewers fill in.
+func peerRubric(a models.Assignment) questions.Rubric {
+	rubric := questions.Rubric{}
+	if a.PeerRubric != "" {
+		_ = json.Unmarshal([]byte(a.PeerRubric), &rubric)
+	}
+	return rubric
+}
+
+// submissionsClose is when an assignment stops taking submissions, after
+// which its peer reviews are handed out.
+func submissionsClose(a models.Assignment) *time.Time {
+	if a.LatePolicy != "reject" && a.LateCutoff != nil {
+		return a.LateCutoff
+	}
+	return a.DueAt
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// applyPeerScore makes the peer score the submission's grade unless staff
+// graded it.
+func applyPeerScore(sub *models.AssignmentSubmission) {
+	if sub.GraderID != nil || sub.PeerScore == nil {
+		return
+	}
+	points := *sub.PeerScore
+	score := round2(points * (1 - sub.Penalty/100))
+	now := time.Now()
+	sub.Points, sub.Score, sub.GradedAt = &points, &score, &now
+}
+
+// combinePeerScore recalculates a submission's peer score as the median of
+// its submitted reviews, scaled to the assignment's max_points.
+func combinePeerScore(tx *gorm.DB, a models.Assignment, sub *models.AssignmentSubmission) error {
+	var reviews []models.PeerReview
+	if err := tx.Where("submission_id = ? AND submitted_at IS NOT NULL", sub.ID).Find(&reviews).Error; err != nil {
+		return err
+	}
+	var totals []float64
+	for _, r := range reviews {
+		if r.Total != nil {
+			totals = append(totals, *r.Total)
+		}
+	}
+	if len(totals) == 0 {
+		return nil
+	}
+	peer := round2(median(totals) / 100 * a.MaxPoints)
+	sub.PeerScore = &peer
+	applyPeerScore(sub)
+	return tx.Save(sub).Error
+}
+
+// handOutPeerReviews gives every enrolled student who submitted the latest
+// submissions of peer_reviewers classmates to review, in a random circle
+// so that everyone reviews as many as they get reviews. Students who did
+// not submit review nothing. It returns how many reviews were handed out;
+// 0 when that had already happened.
+func handOutPeerReviews(a *models.Assignment) (int, error) {
+	var enrolled []uint
+	database.DB.Model(&models.Enrollment{}).
+		Joins("JOIN modules ON modules.course_id = enrollments.course_id").
+		Where("modules.id = ?", a.ModuleID).
+		Pluck("enrollments.user_id", &enrolled)
+
+	var module models.Module
+	database.DB.First(&module, a.ModuleID)
+	created := 0
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(a, a.ID).Error; err != nil {
+			return err
+		}
+		if a.PeerAssignedAt != nil {
+			return nil
+		}
+
+		var subs []models.AssignmentSubmission
+		if len(enrolled) > 0 {
+			if err := tx.Where("assignment_id = ? AND user_id IN ?", a.ID, enrolled).Order("attempt DESC").Find(&subs).Error; err != nil {
+				return err
+			}
+		}
+		seen := make(map[uint]bool)
+		var latest []models.AssignmentSubmission
+		for _, s := range subs {
+			if !seen[s.UserID] {
+				seen[s.UserID] = true
+				latest = append(latest, s)
+			}
+		}
+		rand.Shuffle(len(latest), func(i, j int) { latest[i], latest[j] = latest[j], latest[i] })
+
+		// Siswa ke-i mereview siswa i-1 .. i-n, tidak pernah dirinya sendiri
+		n := a.PeerReviewers
+		if n > len(latest)-1 {
+			n = len(latest) - 1
+		}
+		reviewsOf := make(map[uint]int)
+		for i, s := range latest {
+			for j := 1; j <= n; j++ {
+				reviewer := latest[(i+j)%len(latest)].UserID
+				review := models.PeerReview{AssignmentID: a.ID, SubmissionID: s.ID, ReviewerID: reviewer}
+				if err := tx.Create(&review).Error; err != nil {
+					return err
+				}
+				reviewsOf[reviewer]++
+				created++
+			}
+		}
+		for reviewer, count := range reviewsOf {
+			msg := fmt.Sprintf("You have %d submissions of %s to review", count, a.Title)
+			if err := notifyUser(tx, reviewer, "peer_review_assigned", msg, fiber.Map{"course_id": module.CourseID, "module_id": a.ModuleID, "assignment_id": a.ID}); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		a.PeerAssignedAt = &now
+		return tx.Model(a).Update("peer_assigned_at", now).Error
+	})
+	return created, err
+}
+
+// ensurePeerReviews hands out the peer reviews of an assignment whose
+// submissions have closed, if that has not happened yet. The scheduler does
+// this within a minute of the deadline; the review pages call it too so
+// they never show an assignment that is closed but not handed out.
+func ensurePeerReviews(a *models.Assignment) error {
+	closes := submissionsClose(*a)
+	if a.PeerReviewers == 0 || a.PeerAssignedAt != nil || closes == nil || !time.Now().After(*closes) {
+		return nil
+	}
+	_, err := handOutPeerReviews(a)
+	return err
+}
+
+// HandOutDuePeerReviews hands out the peer reviews of every assignment
+// whose submissions have closed, notifying the reviewers. It returns for
+// how many assignments it did.
+func HandOutDuePeerReviews() (int, error) {
+	var due []models.Assignment
+	err := database.DB.Where("peer_reviewers > 0 AND peer_assigned_at IS NULL AND due_at < ?", time.Now()).Find(&due).Error
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for i := range due {
+		if closes := submissionsClose(due[i]); closes == nil || !time.Now().After(*closes) {
+			continue // masih menerima submission terlambat
+		}
+		if _, err := handOutPeerReviews(&due[i]); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// StartPeerReviewScheduler hands out due peer reviews every interval until
+// the process exits.
+func StartPeerReviewScheduler(interval time.Duration) {
+	go func() {
+		for {
+			if n, err := HandOutDuePeerReviews(); err != nil {
+				log.Println("⚠️ Handing out peer reviews failed:", err)
+			} else if n > 0 {
+				log.Printf("📝 Handed out peer reviews for %d assignments", n)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// peerReviewFileName is the name a reviewer downloads a submission under;
+// the author's own file name often carries their name.
+func peerReviewFileName(reviewID uint, fileName string) string {
+	return fmt.Sprintf("submission-%d%s", reviewID, filepath.Ext(fileName))
+}
+
+// reviewerAgreement is how close a reviewer's totals are to the reference
+// score of the submissions they reviewed: the staff grade when there is
+// one, the median of the other reviews otherwise. Differences are in
+// percentage points; a positive mean_difference means a generous reviewer.
+type reviewerAgreement struct {
+	UserID            uint     `json:"user_id"`
+	FullName          string   `json:"full_name"`
+	Assigned          int      `json:"assigned"`
+	Completed         int      `json:"completed"`
+	Compared          int      `json:"compared"` // reviews with a reference score
+	MeanDifference    *float64 `json:"mean_difference"`
+	MeanAbsDifference *float64 `json:"mean_abs_difference"`
+	Agreement         *float64 `json:"agreement"` // 100 minus mean_abs_difference
+
+	totalDiff float64 // sums the means are taken from
+	totalAbs  float64
+}
+
+// AssignPeerReviews -> POST /instructor/courses/:course_id/modules/:module_id/assignments/:assignment_id/peer-reviews/assign (requires instructor)
+// Hands out the peer reviews now instead of when submissions close.
+// Submissions are closed from then on.
+func AssignPeerReviews(c *fiber.Ctx) error {
+	module, err := loadOwnedModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+	a, err := loadAssignment(c, module)
+	if err != nil {
+		return sendError(c, err)
+	}
+	if a.PeerReviewers == 0 {
+		return c.Status(409).JSON(fiber.Map{"error": "peer review is off for this assignment"})
+	}
+	if a.PeerAssignedAt != nil {
+		return c.Status(409).JSON(fiber.Map{"error": "peer reviews are already handed out"})
+	}
+
+	created, err := handOutPeerReviews(a)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{
+		"message": "peer reviews handed out successfully",
+		"reviews": created,
+	})
+}
+
+// ListPeerReviews -> GET /instructor/courses/:course_id/modules/:module_id/assignments/:assignment_id/peer-reviews (requires instructor)
+// Every reviewed submission with its author, reviews and reviewers, the
+// combined peer score and whether staff overrode it, plus each reviewer's
+// agreement statistics.
+func ListPeerReviews(c *fiber.Ctx) error {
+	module, err := loadOwnedModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+	a, err := loadAssignment(c, module)
+	if err != nil {
+		return sendError(c, err)
+	}
+	if err := ensurePeerReviews(a); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var reviews []models.PeerReview
+	if err := database.DB.Where("assignment_id = ?", a.ID).Order("submission_id ASC, id ASC").Find(&reviews).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	var subIDs []uint
+	bySubmission := make(map[uint][]models.PeerReview)
+	for _, r := range reviews {
+		if _, ok := bySubmission[r.SubmissionID]; !ok {
+			subIDs = append(subIDs, r.SubmissionID)
+		}
+		bySubmission[r.SubmissionID] = append(bySubmission[r.SubmissionID], r)
+	}
+	var subs []models.AssignmentSubmission
+	if len(subIDs) > 0 {
+		database.DB.Where("id IN ?", subIDs).Find(&subs)
+	}
+	subByID := make(map[uint]models.AssignmentSubmission, len(subs))
+	for _, s := range subs {
+		subByID[s.ID] = s
+	}
+
+	var users []models.User
+	database.DB.Model(&models.User{}).
+		Joins("JOIN enrollments ON enrollments.user_id = users.id AND enrollments.deleted_at IS NULL").
+		Where("enrollments.course_id = ?", module.CourseID).
+		Find(&users)
+	names := make(map[uint]string, len(users))
+	for _, u := range users {
+		names[u.ID] = u.FullName
+	}
+
+	agreement := make(map[uint]*reviewerAgreement)
+	var reviewerIDs []uint
+	out := make([]fiber.Map, 0, len(subIDs))
+	for _, id := range subIDs {
+		sub := subByID[id]
+		list := bySubmission[id]
+
+		// Skor acuan tiap review: nilai staf, atau median review lainnya
+		var staff *float64
+		if sub.GraderID != nil && sub.Points != nil {
+			pct := *sub.Points / a.MaxPoints * 100
+			staff = &pct
+		}
+		rows := make([]fiber.Map, 0, len(list))
+		for i, r := range list {
+			ra, ok := agreement[r.ReviewerID]
+			if !ok {
+				ra = &reviewerAgreement{UserID: r.ReviewerID, FullName: names[r.ReviewerID]}
+				agreement[r.ReviewerID] = ra
+				reviewerIDs = append(reviewerIDs, r.ReviewerID)
+			}
+			ra.Assigned++
+			rows = append(rows, fiber.Map{
+				"id":            r.ID,
+				"reviewer_id":   r.ReviewerID,
+				"reviewer_name": names[r.ReviewerID],
+				"scores":        rawJSON(r.Scores),
+				"total":         r.Total,
+				"comment":       r.Comment,
+				"submitted_at":  r.SubmittedAt,
+			})
+			if r.Total == nil {
+				continue
+			}
+			ra.Completed++
+
+			reference := staff
+			if reference == nil {
+				var others []float64
+				for j, o := range list {
+					if j != i && o.Total != nil {
+						others = append(others, *o.Total)
+					}
+				}
+				if len(others) > 0 {
+					m := median(others)
+					reference = &m
+				}
+			}
+			if reference != nil {
+				diff := *r.Total - *reference
+				ra.Compared++
+				ra.totalDiff += diff
+				ra.totalAbs += math.Abs(diff)
+			}
+		}
+
+		out = append(out, fiber.Map{
+			"submission_id": id,
+			"user_id":       sub.UserID,
+			"full_name":     names[sub.UserID],
+			"peer_score":    sub.PeerScore,
+			"points":        sub.Points,
+			"score":         sub.Score,
+			"overridden":    sub.GraderID != nil,
+			"reviews":       rows,
+		})
+	}
+
+	reviewers := make([]*reviewerAgreement, 0, len(reviewerIDs))
+	for _, id := range reviewerIDs {
+		ra := agreement[id]
+		if ra.Compared > 0 {
+			mean := round2(ra.totalDiff / float64(ra.Compared))
+			abs := round2(ra.totalAbs / float64(ra.Compared))
+			agree := round2(math.Max(0, 100-abs))
+			ra.MeanDifference, ra.MeanAbsDifference, ra.Agreement = &mean, &abs, &agree
+		}
+		reviewers = append(reviewers, ra)
+	}
+	sort.SliceStable(reviewers, func(i, j int) bool { return reviewers[i].FullName < reviewers[j].FullName })
+
+	return c.JSON(fiber.Map{
+		"assignment":  assignmentResponse(*a, time.Now()),
+		"submissions": out,
+		"reviewers":   reviewers,
+	})
+}
+
+// loadMyPeerReview loads the :review_id review of the assignment that the
+// calling student has to write.
+func loadMyPeerReview(c *fiber.Ctx, a *models.Assignment) (*models.PeerReview, error) {
+	userID, _ := currentUserID(c)
+	var r models.PeerReview
+	if err := database.DB.Where("id = ? AND assignment_id = ? AND reviewer_id = ?", c.Params("review_id"), a.ID, userID).First(&r).Error; err != nil {
+		return nil, fiber.NewError(404, "peer review not found")
+	}
+	return &r, nil
+}
+
+// ListMyPeerReviews -> GET /me/courses/:course_id/modules/:module_id/assignments/:assignment_id/peer-reviews
+// The classmates' submissions the student has to review, without their
+// names, with the rubric and the student's reviews so far.
+func ListMyPeerReviews(c *fiber.Ctx) error {
+	module, err := loadEnrolledModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+	a, err := loadAssignment(c, module)
+	if err != nil {
+		return sendError(c, err)
+	}
+	if err := ensurePeerReviews(a); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	userID, _ := currentUserID(c)
+
+	var reviews []models.PeerReview
+	if err := database.DB.Where("assignment_id = ? AND reviewer_id = ?", a.ID, userID).Order("id ASC").Find(&reviews).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	out := make([]fiber.Map, 0, len(reviews))
+	for _, r := range reviews {
+		var sub models.AssignmentSubmission
+		database.DB.First(&sub, r.SubmissionID)
+		submission := fiber.Map{"text": sub.Text}
+		if sub.FileUrl != "" {
+			submission["file_name"] = peerReviewFileName(r.ID, sub.FileName)
+			submission["download_url"] = fmt.Sprintf("/api/me/courses/%d/modules/%d/assignments/%d/peer-reviews/%d/file", module.CourseID, module.ID, a.ID, r.ID)
+		}
+		out = append(out, fiber.Map{
+			"id":           r.ID,
+			"submission":   submission,
+			"scores":       rawJSON(r.Scores),
+			"total":        r.Total,
+			"comment":      r.Comment,
+			"submitted_at": r.SubmittedAt,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"rubric":  peerRubric(*a),
+		"due_at":  a.PeerReviewDueAt,
+		"reviews": out,
+	})
+}
+
+// SubmitPeerReview -> PUT /me/courses/:course_id/modules/:module_id/assignments/:assignment_id/peer-reviews/:review_id
+// Body: {"scores": [points per rubric criterion], "comment"}. Reviews can
+// be changed until the peer review due date. The submission's combined
+// score is updated right away.
+func SubmitPeerReview(c *fiber.Ctx) error {
+	module, err := loadEnrolledModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+	a, err := loadAssignment(c, module)
+	if err != nil {
+		return sendError(c, err)
+	}
+	review, err := loadMyPeerReview(c, a)
+	if err != nil {
+		return sendError(c, err)
+	}
+	if a.PeerReviewDueAt != nil && time.Now().After(*a.PeerReviewDueAt) {
+		return c.Status(403).JSON(fiber.Map{"error": "the peer review due date has passed"})
+	}
+
+	var payload struct {
+		Scores  []float64 `json:"scores"`
+		Comment string    `json:"comment"`
+	}
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	rubric := peerRubric(*a)
+	if len(payload.Scores) != len(rubric) {
+		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("scores must have one entry per rubric criterion (%d)", len(rubric))})
+	}
+	points := 0.0
+	for i, s := range payload.Scores {
+		if math.IsNaN(s) || s < 0 || s > rubric[i].Points {
+			return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("score for %q must be between 0 and %g", rubric[i].Criterion, rubric[i].Points)})
+		}
+		points += s
+	}
+
+	b, _ := json.Marshal(payload.Scores)
+	total := round2(points / rubric.Total() * 100)
+	now := time.Now()
+	review.Scores = string(b)
+	review.Total = &total
+	review.Comment = payload.Comment
+	review.SubmittedAt = &now
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(review).Error; err != nil {
+			return err
+		}
+		var sub models.AssignmentSubmission
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&sub, review.SubmissionID).Error; err != nil {
+			return err
+		}
+		return combinePeerScore(tx, *a, &sub)
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "peer review saved successfully",
+		"data": fiber.Map{
+			"id":           review.ID,
+			"scores":       rawJSON(review.Scores),
+			"total":        review.Total,
+			"comment":      review.Comment,
+			"submitted_at": review.SubmittedAt,
+		},
+	})
+}
+
+// GetPeerReviewFile -> GET /me/courses/:course_id/modules/:module_id/assignments/:assignment_id/peer-reviews/:review_id/file
+// The file of a submission the student has to review, under a neutral name.
+func GetPeerReviewFile(c *fiber.Ctx) error {
+	module, err := loadEnrolledModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+	a, err := loadAssignment(c, module)
+	if err != nil {
+		return sendError(c, err)
+	}
+	review, err := loadMyPeerReview(c, a)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	var sub models.AssignmentSubmission
+	if err := database.DB.First(&sub, review.SubmissionID).Error; err != nil || sub.FileUrl == "" {
+		return c.Status(404).JSON(fiber.Map{"error": "no file attached to this submission"})
+	}
+	return sendStoredFile(c, sub.FileUrl, peerReviewFileName(review.ID, sub.FileName), "attachment")
+}
+
+// GetMyPeerFeedback -> GET /me/courses/:course_id/modules/:module_id/assignments/:assignment_id/peer-feedback
+// The reviews classmates wrote on the student's submission, without their
+// names, and the combined peer score.
+func GetMyPeerFeedback(c *fiber.Ctx) error {
+	module, err := loadEnrolledModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+	a, err := loadAssignment(c, module)
+	if err != nil {
+		return sendError(c, err)
+	}
+	userID, _ := currentUserID(c)
+
+	var sub models.AssignmentSubmission
+	err = database.DB.
+		Where("assignment_id = ? AND user_id = ? AND id IN (?)", a.ID, userID,
+			database.DB.Model(&models.PeerReview{}).Select("submission_id").Where("assignment_id = ?", a.ID)).
+		Order("attempt DESC").First(&sub).Error
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "your submission has not been peer reviewed"})
+	}
+
+	var reviews []models.PeerReview
+	database.DB.Where("submission_id = ? AND submitted_at IS NOT NULL", sub.ID).Order("id ASC").Find(&reviews)
+	out := make([]fiber.Map, 0, len(reviews))
+	for i, r := range reviews {
+		out = append(out, fiber.Map{
+			"reviewer": fmt.Sprintf("Reviewer %d", i+1),
+			"scores":   rawJSON(r.Scores),
+			"total":    r.Total,
+			"comment":  r.Comment,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"submission_id": sub.ID,
+		"rubric":        peerRubric(*a),
+		"peer_score":    sub.PeerScore,
+		"score":         sub.Score,
+		"reviews":       out,
+	})
+}
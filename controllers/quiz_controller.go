@@ -3,11 +3,17 @@ package controllers
 import (
 	"backend-elearning/database"
 	"backend-elearning/models"
+	"backend-elearning/questions"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // CreateQuiz -> POST /courses/:course_id/modules/:module_id/quizzes
@@ -19,11 +25,7 @@ func CreateQuiz(c *fiber.Ctx) error {
 	}
 
 	// Payload berupa array of quiz
-	var payload []struct {
-		Question string   `json:"question"`
-		Options  []string `json:"options"`
-		Answer   string   `json:"answer"`
-	}
+	var payload []quizInput
 	if err := c.BodyParser(&payload); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -32,28 +34,21 @@ func CreateQuiz(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "no quizzes provided"})
 	}
 
-	var quizzes []models.Quiz
+	// Quiz baru ditaruh setelah quiz terakhir
+	var last struct{ Max int }
+	database.DB.Model(&models.Quiz{}).Select("COALESCE(MAX(position), 0) AS max").Where("module_id = ?", moduleID).Scan(&last)
 
-	for i, q := range payload {
-		// Validasi minimal
-		if q.Question == "" {
-			return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("question %d is empty", i+1)})
-		}
-		if len(q.Options) != 4 {
-			return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("quiz %d must have exactly 4 options", i+1)})
-		}
-		if q.Answer == "" {
-			return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("quiz %d missing answer", i+1)})
-		}
+	var quizzes []models.Quiz
 
-		optionsJSON, _ := json.Marshal(q.Options)
-		quiz := models.Quiz{
-			ModuleID: uint(moduleID),
-			Question: q.Question,
-			Options:  string(optionsJSON),
-			Answer:   q.Answer,
+	for i := range payload {
+		q := &payload[i]
+		// Validasi sesuai tipe soal
+		if err := q.validate(i + 1); err != nil {
+			return sendError(c, err)
 		}
 
+		quiz := q.apply(models.Quiz{ModuleID: uint(moduleID)})
+		quiz.Position = last.Max + i + 1
 		quizzes = append(quizzes, quiz)
 	}
 
@@ -77,16 +72,20 @@ func ListQuizzes(c *fiber.Ctx) error {
 	}
 
 	var quizzes []models.Quiz
-	if err := database.DB.Where("module_id = ?", moduleID).Find(&quizzes).Error; err != nil {
+	if err := database.DB.Where("module_id = ?", moduleID).Order("position ASC, id ASC").Find(&quizzes).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 	for i := range quizzes {
-		quizzes[i].Answer = "" // hide correct answers
+		quizzes[i] = studentQuestion(quizzes[i])
 	}
 	return c.JSON(quizzes)
 }
 
 // SubmitQuiz -> POST /courses/:course_id/modules/:id/submit
+// One-shot attempt: starts, answers and submits in a single request, subject
+// to the module's attempt limit and cooldown. Timed quizzes must go through
+// the attempt endpoints instead, as must quizzes drawn from question banks.
+// The score is out of all the module's questions; unanswered ones earn 0.
 func SubmitQuiz(c *fiber.Ctx) error {
 	// Ambil parameter dari URL
 	courseIDParam := c.Params("course_id")
@@ -117,8 +116,8 @@ func SubmitQuiz(c *fiber.Ctx) error {
 
 	// Payload berisi array JSON
 	var payload []struct {
-		QuizID uint   `json:"quiz_id"`
-		Answer string `json:"answer"`
+		QuizID uint            `json:"quiz_id"`
+		Answer json.RawMessage `json:"answer"` // format depends on the question type
 	}
 	if err := c.BodyParser(&payload); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
@@ -128,14 +127,9 @@ func SubmitQuiz(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "no quiz answers provided"})
 	}
 
-	// Ambil quiz dari database berdasarkan module dan ID
-	quizIDs := make([]uint, len(payload))
-	for i, answer := range payload {
-		quizIDs[i] = answer.QuizID
-	}
-
+	// Semua soal modul dihitung, termasuk yang tidak dijawab
 	var quizzes []models.Quiz
-	if err := database.DB.Where("id IN ? AND module_id = ?", quizIDs, moduleID).Find(&quizzes).Error; err != nil {
+	if err := database.DB.Where("module_id = ?", moduleID).Order("position ASC, id ASC").Find(&quizzes).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
@@ -143,46 +137,70 @@ func SubmitQuiz(c *fiber.Ctx) error {
 		return c.Status(404).JSON(fiber.Map{"error": "no quizzes found for this module"})
 	}
 
-	// Map untuk jawaban benar
-	quizAnswerMap := make(map[uint]string)
-	for _, quiz := range quizzes {
-		quizAnswerMap[quiz.ID] = quiz.Answer
+	// Catat versi module yang dipelajari
+	var module models.Module
+	if err := database.DB.First(&module, moduleID).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "module not found"})
+	}
+	if module.QuizTimeLimit > 0 {
+		return c.Status(409).JSON(fiber.Map{"error": "this quiz has a time limit; start an attempt first"})
+	}
+	if hasQuizRules(module.ID) {
+		return c.Status(409).JSON(fiber.Map{"error": "this quiz draws random questions; start an attempt first"})
 	}
 
-	// Hitung skor
-	totalCorrect := 0
+	// Satu kali submit = satu attempt: dibuka, dijawab dan langsung dinilai
+	shown := make([]uint, len(quizzes))
+	inModule := make(map[uint]bool, len(quizzes))
+	for i, quiz := range quizzes {
+		shown[i] = quiz.ID
+		inModule[quiz.ID] = true
+	}
+	answers := make([]attemptAnswer, 0, len(payload))
 	for _, answer := range payload {
-		if correctAnswer, exists := quizAnswerMap[answer.QuizID]; exists && correctAnswer == answer.Answer {
-			totalCorrect++
+		if inModule[answer.QuizID] {
+			answers = append(answers, attemptAnswer{QuizID: answer.QuizID, Answer: answer.Answer})
 		}
 	}
-
-	// Hitung skor dalam persen
-	totalQuestions := len(quizzes)
-	scorePercent := (float64(totalCorrect) / float64(totalQuestions)) * 100
-	passed := scorePercent >= 60.0 // lulus jika >= 60%
-
-	// Simpan hasil
-	result := models.QuizResult{
-		UserID:   uint(userID),
-		ModuleID: uint(moduleID),
-		Score:    int(scorePercent),
-		Passed:   passed,
+	if len(answers) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "none of the answers are for this module's quizzes"})
 	}
 
-	if err := database.DB.Create(&result).Error; err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	expireAttempts(uint(userID))
+
+	var result models.QuizResult
+	var sum attemptSummary
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if result, err = openAttempt(tx, module, uint(userID), shown, ""); err != nil {
+			return err
+		}
+		if err := saveAttemptAnswers(tx, &result, answers); err != nil {
+			return err
+		}
+		sum, err = submitAttempt(tx, &result)
+		return err
+	})
+	if err != nil {
+		return sendError(c, err)
 	}
+	totalQuestions := result.Questions
 
 	return c.Status(201).JSON(fiber.Map{
-		"message":     "quiz submitted successfully",
-		"course_id":   courseID,
-		"module_id":   moduleID,
-		"score":       result.Score,
-		"passed":      result.Passed,
-		"total_quiz":  totalQuestions,
-		"correct":     totalCorrect,
-		"wrong":       totalQuestions - totalCorrect,
+		"message":         "quiz submitted successfully",
+		"course_id":       courseID,
+		"module_id":       moduleID,
+		"result_id":       result.ID,
+		"status":          result.Status,
+		"score":           result.Score,
+		"passed":          result.Passed,
+		"total_quiz":      totalQuestions,
+		"correct":         sum.Correct,
+		"points":          result.Points,
+		"max_points":      result.MaxPoints,
+		"pending_review":  sum.Pending,
+		"module_revision": result.ModuleRevision,
+		"wrong":           totalQuestions - sum.Correct - sum.Pending,
 	})
 }
 
@@ -237,41 +255,501 @@ func GetCourseStatus(c *fiber.Ctx) error {
 	passedModules := 0
 	var detailedResults []fiber.Map
 
+	expireAttempts(uint(userID))
+
 	for _, m := range modules {
-		var result models.QuizResult
-		err := database.DB.
+		// Attempt yang dihitung tergantung scoring policy module
+		var attempts []models.QuizResult
+		database.DB.
 			Where("user_id = ? AND module_id = ?", userID, m.ID).
-			Order("created_at desc").
-			First(&result).Error
+			Order("created_at desc, id desc").
+			Find(&attempts)
+		standing := standingOf(m, attempts)
 
-		moduleStatus := "Not Attempted"
-		score := 0
-
-		if err == nil {
-			score = result.Score
-			if result.Passed {
-				passedModules++
-				moduleStatus = "Passed"
-			} else {
-				moduleStatus = "Failed"
-			}
+		studied := 0
+		if standing.Counted != nil {
+			studied = standing.Counted.ModuleRevision
+		}
+		if standing.Passed {
+			passedModules++
 		}
 
 		detailedResults = append(detailedResults, fiber.Map{
-			"module_id":    m.ID,
-			"module_title": m.Title,
-			"score":        score,
-			"status":       moduleStatus,
+			"module_id":        m.ID,
+			"module_title":     m.Title,
+			"score":            standing.Score,
+			"status":           standing.Status,
+			"attempts":         standing.Attempts,
+			"scoring_policy":   m.QuizScoring,
+			"pass_threshold":   m.QuizPassThreshold,
+			"module_revision":  studied,
+			"current_revision": latestModuleRevision(m.ID),
 		})
 	}
 
 	completed := passedModules == totalModules
 
 	return c.JSON(fiber.Map{
-		"total_modules":  totalModules,
-		"passed_modules": passedModules,
+		"total_modules":   totalModules,
+		"passed_modules":  passedModules,
 		"completion_rate": fmt.Sprintf("%.2f%%", float64(passedModules)/float64(totalModules)*100),
-		"completed":      completed,
-		"details":        detailedResults,
+		"completed":       completed,
+		"details":         detailedResults,
+	})
+}
+
+// quizInput is one question as sent by the instructor: its type, text,
+// options and answer key in the format the type expects.
+type quizInput struct {
+	ID uint `json:"id"` // ReplaceQuizzes only: the question being kept
+	questions.Definition
+	Points      float64 `json:"points"` // weight in the score, 1 if left out
+	Explanation string  `json:"explanation"`
+
+	// set by validate, as stored on the quiz
+	options, answer string
+}
+
+// validate checks question n (1-based, for the error message).
+func (q *quizInput) validate(n int) error {
+	if err := q.check(); err != nil {
+		return fiber.NewError(400, fmt.Sprintf("quiz %d: %v", n, err))
+	}
+	return nil
+}
+
+// check is validate without the question number in the error.
+func (q *quizInput) check() error {
+	if q.Points < 0 || math.IsNaN(q.Points) || math.IsInf(q.Points, 0) {
+		return errors.New("points must not be negative")
+	}
+	options, answer, err := q.Definition.Validate()
+	if err != nil {
+		return err
+	}
+	q.options, q.answer = options, answer
+	return nil
+}
+
+// apply copies the validated question's content onto quiz.
+func (q quizInput) apply(quiz models.Quiz) models.Quiz {
+	quiz.Type = q.Type
+	if quiz.Type == "" {
+		quiz.Type = questions.SingleChoice
+	}
+	quiz.Question = q.Question
+	quiz.Options = q.options
+	quiz.Answer = q.answer
+	quiz.Points = q.Points
+	if quiz.Points == 0 {
+		quiz.Points = 1
+	}
+	quiz.Explanation = q.Explanation
+	return quiz
+}
+
+// quizResultsSince counts the results of the quiz's module submitted since
+// the question was created, i.e. those that may have been scored on it.
+func quizResultsSince(tx *gorm.DB, quiz models.Quiz) int64 {
+	var n int64
+	if quiz.BankID != nil {
+		// Bank questions have no module; count the attempts that answered it
+		tx.Model(&models.QuizAnswer{}).Where("quiz_id = ?", quiz.ID).Distinct("quiz_result_id").Count(&n)
+		return n
+	}
+	tx.Model(&models.QuizResult{}).Where("module_id = ? AND created_at >= ?", quiz.ModuleID, quiz.CreatedAt).Count(&n)
+	return n
+}
+
+// editQuiz applies in to quiz. A question nobody answered yet, or a change
+// of the explanation alone, is updated in place. Otherwise the old row is
+// soft-deleted and a new version is created, so past results keep pointing
+// at the question they were scored on; the number of such results is
+// returned for the warning.
+func editQuiz(tx *gorm.DB, quiz models.Quiz, in quizInput) (models.Quiz, int64, error) {
+	updated := in.apply(quiz)
+	if updated.Type == quiz.Type && updated.Question == quiz.Question && updated.Options == quiz.Options && updated.Answer == quiz.Answer && updated.Points == quiz.Points {
+		if updated.Explanation == quiz.Explanation {
+			return quiz, 0, nil
+		}
+		return updated, 0, tx.Model(&quiz).Update("explanation", updated.Explanation).Error
+	}
+
+	answered := quizResultsSince(tx, quiz)
+	if answered == 0 {
+		err := tx.Model(&quiz).Updates(map[string]interface{}{
+			"type":        updated.Type,
+			"question":    updated.Question,
+			"options":     updated.Options,
+			"answer":      updated.Answer,
+			"points":      updated.Points,
+			"explanation": updated.Explanation,
+		}).Error
+		return updated, 0, err
+	}
+
+	if err := tx.Delete(&quiz).Error; err != nil {
+		return quiz, 0, err
+	}
+	previous := quiz.ID
+	next := in.apply(models.Quiz{
+		ModuleID:   quiz.ModuleID,
+		Position:   quiz.Position,
+		Version:    quiz.Version + 1,
+		PreviousID: &previous,
+		BankID:     quiz.BankID,
+		Topic:      quiz.Topic,
+		Difficulty: quiz.Difficulty,
+	})
+	if err := tx.Create(&next).Error; err != nil {
+		return quiz, 0, err
+	}
+	return next, answered, nil
+}
+
+func versionWarning(answered int64) string {
+	return fmt.Sprintf("%d past results were scored against the previous version of this question; their scores are unchanged", answered)
+}
+
+// UpdateQuiz -> PUT /instructor/courses/:course_id/modules/:module_id/quizzes/:quiz_id (requires instructor)
+// Body: {"type", "question", "options", "answer"}. If students already answered
+// the question, a new version replaces it (with a new id) and the response
+// carries a warning.
+func UpdateQuiz(c *fiber.Ctx) error {
+	module, err := loadOwnedModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	var payload quizInput
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := payload.validate(1); err != nil {
+		return sendError(c, err)
+	}
+
+	var quiz models.Quiz
+	var answered int64
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ? AND module_id = ?", c.Params("quiz_id"), module.ID).First(&quiz).Error; err != nil {
+			return fiber.NewError(404, "quiz not found for this module")
+		}
+		var err error
+		quiz, answered, err = editQuiz(tx, quiz, payload)
+		return err
+	})
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	out := fiber.Map{
+		"message": "quiz updated successfully",
+		"quiz":    quiz,
+	}
+	if answered > 0 {
+		out["warning"] = versionWarning(answered)
+	}
+	return c.JSON(out)
+}
+
+// DeleteQuiz -> DELETE /instructor/courses/:course_id/modules/:module_id/quizzes/:quiz_id (requires instructor)
+// The question is soft-deleted, so past results are unaffected.
+func DeleteQuiz(c *fiber.Ctx) error {
+	module, err := loadOwnedModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	var quiz models.Quiz
+	if err := database.DB.Where("id = ? AND module_id = ?", c.Params("quiz_id"), module.ID).First(&quiz).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "quiz not found for this module"})
+	}
+	if err := database.DB.Delete(&quiz).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "quiz deleted successfully",
+	})
+}
+
+// ReplaceQuizzes -> PUT /instructor/courses/:course_id/modules/:module_id/quizzes (requires instructor)
+// Body: the module's complete question set in order. Items with an "id"
+// update that question, items without one are added, and questions left
+// out are deleted. Positions follow the array. All or nothing.
+func ReplaceQuizzes(c *fiber.Ctx) error {
+	module, err := loadOwnedModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	var payload []quizInput
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	for i := range payload {
+		if err := payload[i].validate(i + 1); err != nil {
+			return sendError(c, err)
+		}
+	}
+
+	var quizzes []models.Quiz
+	var warnings []string
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var existing []models.Quiz
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("module_id = ?", module.ID).Find(&existing).Error; err != nil {
+			return err
+		}
+		byID := make(map[uint]models.Quiz, len(existing))
+		for _, q := range existing {
+			byID[q.ID] = q
+		}
+
+		kept := make(map[uint]bool)
+		for i, in := range payload {
+			var quiz models.Quiz
+			if in.ID != 0 {
+				old, ok := byID[in.ID]
+				if !ok {
+					return fiber.NewError(400, fmt.Sprintf("quiz %d is not in this module", in.ID))
+				}
+				if kept[in.ID] {
+					return fiber.NewError(400, fmt.Sprintf("quiz %d is listed twice", in.ID))
+				}
+				kept[in.ID] = true
+
+				var answered int64
+				var err error
+				if quiz, answered, err = editQuiz(tx, old, in); err != nil {
+					return err
+				}
+				if answered > 0 {
+					warnings = append(warnings, fmt.Sprintf("question %d: %s", i+1, versionWarning(answered)))
+				}
+			} else {
+				quiz = in.apply(models.Quiz{ModuleID: module.ID})
+				if err := tx.Create(&quiz).Error; err != nil {
+					return err
+				}
+			}
+
+			if quiz.Position != i+1 {
+				quiz.Position = i + 1
+				if err := tx.Model(&quiz).Update("position", quiz.Position).Error; err != nil {
+					return err
+				}
+			}
+			quizzes = append(quizzes, quiz)
+		}
+
+		for _, q := range existing {
+			if !kept[q.ID] {
+				if err := tx.Delete(&q).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	out := fiber.Map{
+		"message": "quizzes replaced successfully",
+		"data":    quizzes,
+	}
+	if len(warnings) > 0 {
+		out["warnings"] = warnings
+	}
+	return c.JSON(out)
+}
+
+// ReorderQuizzes -> PUT /instructor/courses/:course_id/modules/:module_id/quizzes/order (requires instructor)
+// Body: {"quiz_ids": [...]} listing every question of the module once.
+func ReorderQuizzes(c *fiber.Ctx) error {
+	module, err := loadOwnedModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	var payload struct {
+		QuizIDs []uint `json:"quiz_ids"`
+	}
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var ids []uint
+		if err := tx.Model(&models.Quiz{}).Clauses(clause.Locking{Strength: "UPDATE"}).Where("module_id = ?", module.ID).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		inModule := make(map[uint]bool, len(ids))
+		for _, id := range ids {
+			inModule[id] = true
+		}
+		seen := make(map[uint]bool, len(payload.QuizIDs))
+		for _, id := range payload.QuizIDs {
+			if !inModule[id] {
+				return fiber.NewError(400, fmt.Sprintf("quiz %d is not in this module", id))
+			}
+			if seen[id] {
+				return fiber.NewError(400, fmt.Sprintf("quiz %d is listed twice", id))
+			}
+			seen[id] = true
+		}
+		if len(seen) != len(ids) {
+			return fiber.NewError(400, fmt.Sprintf("quiz_ids must list all %d quizzes of the module", len(ids)))
+		}
+
+		for i, id := range payload.QuizIDs {
+			if err := tx.Model(&models.Quiz{}).Where("id = ?", id).Update("position", i+1).Error; err != nil {
+				return err
+			}
+		}
+		return nil
 	})
-}
\ No newline at end of file
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	var quizzes []models.Quiz
+	database.DB.Where("module_id = ?", module.ID).Order("position ASC, id ASC").Find(&quizzes)
+	return c.JSON(fiber.Map{
+		"message": "quizzes reordered",
+		"data":    quizzes,
+	})
+}
+
+// quizSettings are a module's quiz attempt and scoring rules.
+type quizSettings struct {
+	TimeLimit       *int     `json:"time_limit"`   // minutes, 0 for none
+	MaxAttempts     *int     `json:"max_attempts"` // 0 for unlimited
+	Cooldown        *int     `json:"cooldown"`     // minutes between attempts
+	Scoring         *string  `json:"scoring_policy"`
+	PassThreshold   *float64 `json:"pass_threshold"`   // percent
+	NegativeMarking *float64 `json:"negative_marking"` // 0..1 of a question's points
+	ReviewPolicy    *string  `json:"review_policy"`
+	// RFC 3339; an empty string removes the deadline
+	Deadline *string `json:"deadline"`
+}
+
+func quizSettingsOf(m *models.Module) fiber.Map {
+	return fiber.Map{
+		"time_limit":       m.QuizTimeLimit,
+		"max_attempts":     m.QuizMaxAttempts,
+		"cooldown":         m.QuizCooldown,
+		"scoring_policy":   m.QuizScoring,
+		"pass_threshold":   m.QuizPassThreshold,
+		"negative_marking": m.QuizNegativeMarking,
+		"review_policy":    m.QuizReviewPolicy,
+		"deadline":         m.QuizDeadline,
+	}
+}
+
+// GetQuizSettings -> GET /instructor/courses/:course_id/modules/:module_id/quiz-settings (requires instructor)
+func GetQuizSettings(c *fiber.Ctx) error {
+	module, err := loadOwnedModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+	return c.JSON(quizSettingsOf(module))
+}
+
+// UpdateQuizSettings -> PUT /instructor/courses/:course_id/modules/:module_id/quiz-settings (requires instructor)
+// Body: any of {"time_limit", "max_attempts", "cooldown", "scoring_policy",
+// "pass_threshold", "negative_marking", "review_policy", "deadline"}. The
+// review policy is never, after_attempt, after_pass or after_deadline and
+// decides when students see correct answers; "deadline" is an RFC 3339
+// time, or "" to remove it. Attempt rules and negative marking apply to
+// attempts started afterwards; a new pass threshold also applies to the
+// scores students already have.
+func UpdateQuizSettings(c *fiber.Ctx) error {
+	module, err := loadOwnedModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	var payload quizSettings
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	updates := map[string]interface{}{}
+	for _, f := range []struct {
+		value  *int
+		column string
+		name   string
+	}{
+		{payload.TimeLimit, "quiz_time_limit", "time_limit"},
+		{payload.MaxAttempts, "quiz_max_attempts", "max_attempts"},
+		{payload.Cooldown, "quiz_cooldown", "cooldown"},
+	} {
+		if f.value == nil {
+			continue
+		}
+		if *f.value < 0 {
+			return c.Status(400).JSON(fiber.Map{"error": f.name + " must not be negative"})
+		}
+		updates[f.column] = *f.value
+	}
+	if payload.Scoring != nil {
+		if !scoringPolicies[*payload.Scoring] {
+			return c.Status(400).JSON(fiber.Map{"error": "scoring_policy must be highest, latest or average"})
+		}
+		updates["quiz_scoring"] = *payload.Scoring
+	}
+	if p := payload.PassThreshold; p != nil {
+		if math.IsNaN(*p) || *p < 0 || *p > 100 {
+			return c.Status(400).JSON(fiber.Map{"error": "pass_threshold must be between 0 and 100"})
+		}
+		updates["quiz_pass_threshold"] = round2(*p)
+	}
+	if n := payload.NegativeMarking; n != nil {
+		if math.IsNaN(*n) || *n < 0 || *n > 1 {
+			return c.Status(400).JSON(fiber.Map{"error": "negative_marking must be between 0 and 1"})
+		}
+		updates["quiz_negative_marking"] = *n
+	}
+	if p := payload.ReviewPolicy; p != nil {
+		if !reviewPolicies[*p] {
+			return c.Status(400).JSON(fiber.Map{"error": "review_policy must be never, after_attempt, after_pass or after_deadline"})
+		}
+		updates["quiz_review_policy"] = *p
+	}
+	if d := payload.Deadline; d != nil {
+		if *d == "" {
+			updates["quiz_deadline"] = nil
+		} else {
+			deadline, err := time.Parse(time.RFC3339, *d)
+			if err != nil {
+				return c.Status(400).JSON(fiber.Map{"error": "deadline must be an RFC 3339 time"})
+			}
+			updates["quiz_deadline"] = deadline
+		}
+	}
+
+	if len(updates) > 0 {
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(module).Updates(updates).Error; err != nil {
+				return err
+			}
+			if payload.PassThreshold == nil {
+				return nil
+			}
+			return tx.Model(&models.QuizResult{}).
+				Where("module_id = ? AND status = ?", module.ID, "graded").
+				Update("passed", gorm.Expr("score >= ?", updates["quiz_pass_threshold"])).Error
+		})
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"message":  "quiz settings updated successfully",
+		"settings": quizSettingsOf(module),
+	})
+}
@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	"backend-elearning/database"
+	"backend-elearning/models"
+	"backend-elearning/questions"
+	"backend-elearning/utils"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxQuizFileSize caps uploaded quiz files.
+const maxQuizFileSize = 10 << 20
+
+// quizFileRow is how ImportQuizFile reports one question of the file.
+type quizFileRow struct {
+	Line     int    `json:"line"` // item number for QTI
+	Type     string `json:"type,omitempty"`
+	Question string `json:"question"`
+	Valid    bool   `json:"valid"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ImportQuizFile -> POST /instructor/courses/:course_id/modules/:module_id/quizzes/import (requires instructor)
+// Form-data: file (CSV, GIFT, or QTI 2.1 as XML or a content package ZIP),
+// format (csv, gift or qti; taken from the file name when left out),
+// dry_run ("true" only validates). Every question is reported with its
+// line and any error; the valid ones are added after the module's last
+// question and the others skipped.
+func ImportQuizFile(c *fiber.Ctx) error {
+	module, err := loadOwnedModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "file is required"})
+	}
+	if fh.Size > maxQuizFileSize {
+		return c.Status(413).JSON(fiber.Map{"error": fmt.Sprintf("file is larger than %d MB", maxQuizFileSize>>20)})
+	}
+	format, err := utils.QuizFormat(c.FormValue("format"), fh.Filename)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	parsed, err := utils.ParseQuizFile(format, data)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Soal yang valid diberi posisi setelah soal terakhir modul
+	var last struct{ Max int }
+	database.DB.Model(&models.Quiz{}).Select("COALESCE(MAX(position), 0) AS max").Where("module_id = ?", module.ID).Scan(&last)
+
+	rows := make([]quizFileRow, 0, len(parsed))
+	var quizzes []models.Quiz
+	for _, p := range parsed {
+		row := quizFileRow{Line: p.Line, Type: p.Item.Type, Question: p.Item.Question, Error: p.Error}
+		if row.Error == "" {
+			in := quizInput{Definition: p.Item.Definition, Points: p.Item.Points, Explanation: p.Item.Explanation}
+			if err := in.check(); err != nil {
+				row.Error = err.Error()
+			} else {
+				quiz := in.apply(models.Quiz{ModuleID: module.ID})
+				quiz.Position = last.Max + len(quizzes) + 1
+				quizzes = append(quizzes, quiz)
+			}
+		}
+		row.Valid = row.Error == ""
+		rows = append(rows, row)
+	}
+
+	report := fiber.Map{
+		"format":  format,
+		"valid":   len(quizzes),
+		"invalid": len(rows) - len(quizzes),
+		"rows":    rows,
+	}
+	if c.FormValue("dry_run") == "true" {
+		report["message"] = "dry run: nothing imported"
+		return c.JSON(report)
+	}
+	if len(quizzes) == 0 {
+		report["error"] = "no valid questions to import"
+		return c.Status(422).JSON(report)
+	}
+
+	if err := database.DB.Create(&quizzes).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	report["message"] = "quizzes imported successfully"
+	report["data"] = quizzes
+	return c.Status(201).JSON(report)
+}
+
+// ExportQuizFile -> GET /instructor/courses/:course_id/modules/:module_id/quizzes/export (requires instructor)
+// ?format=csv (default), gift or qti. QTI comes as a content package ZIP.
+// GIFT has no ordering questions; they are listed in comments instead.
+func ExportQuizFile(c *fiber.Ctx) error {
+	module, err := loadOwnedModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+	format, err := utils.QuizFormat(c.Query("format", utils.QuizCSV), "")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var quizzes []models.Quiz
+	if err := database.DB.Where("module_id = ?", module.ID).Order("position ASC, id ASC").Find(&quizzes).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	items := make([]utils.QuizItem, 0, len(quizzes))
+	for _, q := range quizzes {
+		items = append(items, utils.QuizItem{
+			Definition: questions.Definition{
+				Type:     q.Type,
+				Question: q.Question,
+				Options:  json.RawMessage(q.Options),
+				Answer:   questions.AnswerJSON(q.Type, q.Answer),
+			},
+			Points:      q.Points,
+			Explanation: q.Explanation,
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := utils.WriteQuizFile(&buf, format, items); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	contentType, ext := utils.QuizFileType(format)
+	c.Set("Content-Type", contentType)
+	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"module-%d-quiz%s\"", module.ID, ext))
+	return c.Send(buf.Bytes())
+}
@@ -0,0 +1,520 @@
+package controllers
+
+import (
+	"backend-elearning/assets"
+	"backend-elearning/database"
+	"backend-elearning/models"
+	"backend-elearning/utils"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Every change to a course or module is kept as a numbered revision, a
+// snapshot of its fields. Module revisions hold their own reference on the
+// PDF, so a replaced file stays available for diffs, downloads and
+// rollback. Rows created before revisions existed get an "initial"
+// snapshot of their old state the first time they change.
+
+// recordCourseRevision snapshots course as its next revision. Failures are
+// logged; the change itself has already been saved.
+func recordCourseRevision(course *models.Course, action, note string, authorID uint) {
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the course so concurrent changes get distinct numbers
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Unscoped().Select("id").First(&models.Course{}, course.ID).Error; err != nil {
+			return err
+		}
+		number, err := nextRevision(tx, &models.CourseRevision{}, "course_id", course.ID)
+		if err != nil {
+			return err
+		}
+		return tx.Create(&models.CourseRevision{
+			CourseID:      course.ID,
+			Number:        number,
+			Action:        action,
+			Note:          note,
+			AuthorID:      authorID,
+			Title:         course.Title,
+			Description:   course.Description,
+			Published:     course.Published,
+			WatermarkPDFs: course.WatermarkPDFs,
+		}).Error
+	})
+	if err != nil {
+		log.Printf("⚠️ Recording revision of course %d failed: %v", course.ID, err)
+	}
+}
+
+// ensureCourseBaseline records course as it is now if it has no history
+// yet, so its first change can be diffed and undone.
+func ensureCourseBaseline(course *models.Course, authorID uint) {
+	var n int64
+	database.DB.Model(&models.CourseRevision{}).Where("course_id = ?", course.ID).Count(&n)
+	if n == 0 {
+		recordCourseRevision(course, "initial", "", authorID)
+	}
+}
+
+// recordModuleRevision snapshots module as its next revision, taking a
+// reference on its PDF. Failures are logged and returned; callers that
+// have already saved the change may ignore them.
+func recordModuleRevision(ctx context.Context, module *models.Module, action, note string, authorID uint) error {
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		_, err := writeModuleRevision(ctx, tx, module, action, note, authorID)
+		return err
+	})
+	if err != nil {
+		log.Printf("⚠️ Recording revision of module %d failed: %v", module.ID, err)
+	}
+	return err
+}
+
+// writeModuleRevision adds module's next revision inside tx and returns the
+// PDF reference the revision took. If tx is rolled back afterwards the
+// caller must release that reference.
+func writeModuleRevision(ctx context.Context, tx *gorm.DB, module *models.Module, action, note string, authorID uint) (string, error) {
+	pdfURL := ""
+	if module.PDFUrl != "" {
+		shared, err := assets.Acquire(ctx, module.PDFUrl)
+		if err != nil {
+			return "", err
+		}
+		pdfURL = shared
+	}
+
+	err := func() error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Unscoped().Select("id").First(&models.Module{}, module.ID).Error; err != nil {
+			return err
+		}
+		number, err := nextRevision(tx, &models.ModuleRevision{}, "module_id", module.ID)
+		if err != nil {
+			return err
+		}
+		return tx.Create(&models.ModuleRevision{
+			ModuleID:  module.ID,
+			Number:    number,
+			Action:    action,
+			Note:      note,
+			AuthorID:  authorID,
+			Title:     module.Title,
+			Order:     module.Order,
+			CourseID:  module.CourseID,
+			PDFUrl:    pdfURL,
+			PDFName:   module.PDFName,
+			PageCount: module.PageCount,
+			PDFTitle:  module.PDFTitle,
+		}).Error
+	}()
+	if err != nil {
+		_ = assets.Release(ctx, pdfURL)
+		return "", err
+	}
+	return pdfURL, nil
+}
+
+// saveModuleWithRevision saves module and records it as its next revision
+// in one transaction, so a change is never kept without its revision. On
+// failure nothing is saved and the revision's PDF reference is dropped.
+func saveModuleWithRevision(ctx context.Context, module *models.Module, action, note string, authorID uint) error {
+	revPDF := ""
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(module).Error; err != nil {
+			return err
+		}
+		var err error
+		revPDF, err = writeModuleRevision(ctx, tx, module, action, note, authorID)
+		return err
+	})
+	if err != nil {
+		_ = assets.Release(ctx, revPDF)
+	}
+	return err
+}
+
+// ensureModuleBaseline records module as it is now if it has no history
+// yet. Call it before changing the module; if it fails, the module's
+// current state could not be kept and the change should not go ahead.
+func ensureModuleBaseline(ctx context.Context, module *models.Module, authorID uint) error {
+	if latestModuleRevision(module.ID) == 0 {
+		return recordModuleRevision(ctx, module, "initial", "", authorID)
+	}
+	return nil
+}
+
+// BackfillModuleRevisions records a baseline for modules that have no
+// history yet, e.g. those created before revisions were kept, so attempts
+// can name the revision they were taken on. The baseline is attributed to
+// the course's instructor. It returns how many modules it recorded.
+func BackfillModuleRevisions(ctx context.Context) (int, error) {
+	var modules []struct {
+		models.Module
+		InstructorID uint
+	}
+	err := database.DB.Model(&models.Module{}).
+		Select("modules.*, courses.instructor_id").
+		Joins("JOIN courses ON courses.id = modules.course_id").
+		Where("NOT EXISTS (SELECT 1 FROM module_revisions r WHERE r.module_id = modules.id)").
+		Find(&modules).Error
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for i := range modules {
+		if err := ensureModuleBaseline(ctx, &modules[i].Module, modules[i].InstructorID); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func nextRevision(tx *gorm.DB, model interface{}, column string, id uint) (int, error) {
+	var last struct{ Max int }
+	err := tx.Model(model).Select("COALESCE(MAX(number), 0) AS max").Where(column+" = ?", id).Scan(&last).Error
+	return last.Max + 1, err
+}
+
+// latestModuleRevision is the number of the module's current revision, or
+// 0 when it has no history.
+func latestModuleRevision(moduleID uint) int {
+	var last struct{ Max int }
+	database.DB.Model(&models.ModuleRevision{}).Select("COALESCE(MAX(number), 0) AS max").Where("module_id = ?", moduleID).Scan(&last)
+	return last.Max
+}
+
+func latestCourseRevision(courseID uint) int {
+	var last struct{ Max int }
+	database.DB.Model(&models.CourseRevision{}).Select("COALESCE(MAX(number), 0) AS max").Where("course_id = ?", courseID).Scan(&last)
+	return last.Max
+}
+
+// releaseModuleRevisions drops the history of a deleted module together
+// with the references it held.
+func releaseModuleRevisions(ctx context.Context, moduleID uint) {
+	var revisions []models.ModuleRevision
+	database.DB.Where("module_id = ?", moduleID).Find(&revisions)
+	for _, r := range revisions {
+		_ = assets.Release(ctx, r.PDFUrl)
+	}
+	database.DB.Where("module_id = ?", moduleID).Delete(&models.ModuleRevision{})
+}
+
+// fieldChange is one entry of a revision diff. Lines is set for long text.
+type fieldChange struct {
+	Field string           `json:"field"`
+	From  interface{}      `json:"from"`
+	To    interface{}      `json:"to"`
+	Lines []utils.DiffLine `json:"lines,omitempty"`
+}
+
+// revisionRange reads the from/to query parameters of a diff. to defaults
+// to the latest revision and from to the one before it.
+func revisionRange(c *fiber.Ctx, latest int) (int, int, error) {
+	if latest == 0 {
+		return 0, 0, fiber.NewError(404, "no revisions yet")
+	}
+	to := c.QueryInt("to", latest)
+	from := c.QueryInt("from", to-1)
+	if from < 1 || to < 1 || from > latest || to > latest {
+		return 0, 0, fiber.NewError(400, fmt.Sprintf("from and to must be between 1 and %d", latest))
+	}
+	return from, to, nil
+}
+
+// ListCourseRevisions -> GET /instructor/courses/:course_id/revisions (requires instructor)
+func ListCourseRevisions(c *fiber.Ctx) error {
+	course, err := loadOwnedCourse(c, c.Params("course_id"))
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	var revisions []models.CourseRevision
+	if err := database.DB.Where("course_id = ?", course.ID).Order("number DESC").Find(&revisions).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(revisions)
+}
+
+// DiffCourseRevisions -> GET /instructor/courses/:course_id/revisions/diff?from=&to= (requires instructor)
+func DiffCourseRevisions(c *fiber.Ctx) error {
+	course, err := loadOwnedCourse(c, c.Params("course_id"))
+	if err != nil {
+		return sendError(c, err)
+	}
+	from, to, err := revisionRange(c, latestCourseRevision(course.ID))
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	var a, b models.CourseRevision
+	if err := database.DB.Where("course_id = ? AND number = ?", course.ID, from).First(&a).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "revision not found"})
+	}
+	if err := database.DB.Where("course_id = ? AND number = ?", course.ID, to).First(&b).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "revision not found"})
+	}
+
+	changes := []fieldChange{}
+	if a.Title != b.Title {
+		changes = append(changes, fieldChange{Field: "title", From: a.Title, To: b.Title})
+	}
+	if a.Description != b.Description {
+		changes = append(changes, fieldChange{Field: "description", From: a.Description, To: b.Description,
+			Lines: utils.LineDiff(a.Description, b.Description)})
+	}
+	if a.Published != b.Published {
+		changes = append(changes, fieldChange{Field: "published", From: a.Published, To: b.Published})
+	}
+	if a.WatermarkPDFs != b.WatermarkPDFs {
+		changes = append(changes, fieldChange{Field: "watermark_pdfs", From: a.WatermarkPDFs, To: b.WatermarkPDFs})
+	}
+
+	return c.JSON(fiber.Map{"from": a, "to": b, "changes": changes})
+}
+
+// RollbackCourse -> POST /instructor/courses/:course_id/revisions/:number/rollback (requires instructor)
+// Restores title, description and the watermark setting. Publishing stays
+// with the admins. The rollback itself becomes a new revision.
+func RollbackCourse(c *fiber.Ctx) error {
+	course, err := loadOwnedCourse(c, c.Params("course_id"))
+	if err != nil {
+		return sendError(c, err)
+	}
+	var rev models.CourseRevision
+	if err := database.DB.Where("course_id = ? AND number = ?", course.ID, c.Params("number")).First(&rev).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "revision not found"})
+	}
+
+	course.Title = rev.Title
+	course.Description = rev.Description
+	course.WatermarkPDFs = rev.WatermarkPDFs
+	if err := database.DB.Save(course).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	userID, _ := currentUserID(c)
+	recordCourseRevision(course, "rolled_back", fmt.Sprintf("rolled back to revision %d", rev.Number), userID)
+
+	return c.JSON(fiber.Map{
+		"message": fmt.Sprintf("course rolled back to revision %d", rev.Number),
+		"course":  course,
+	})
+}
+
+// ListModuleRevisions -> GET /instructor/courses/:course_id/modules/:module_id/revisions (requires instructor)
+func ListModuleRevisions(c *fiber.Ctx) error {
+	module, err := loadOwnedModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	var revisions []models.ModuleRevision
+	if err := database.DB.Where("module_id = ?", module.ID).Order("number DESC").Find(&revisions).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(revisions)
+}
+
+// DiffModuleRevisions -> GET /instructor/courses/:course_id/modules/:module_id/revisions/diff?from=&to= (requires instructor)
+func DiffModuleRevisions(c *fiber.Ctx) error {
+	module, err := loadOwnedModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+	from, to, err := revisionRange(c, latestModuleRevision(module.ID))
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	var a, b models.ModuleRevision
+	if err := database.DB.Where("module_id = ? AND number = ?", module.ID, from).First(&a).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "revision not found"})
+	}
+	if err := database.DB.Where("module_id = ? AND number = ?", module.ID, to).First(&b).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "revision not found"})
+	}
+
+	changes := []fieldChange{}
+	if a.Title != b.Title {
+		changes = append(changes, fieldChange{Field: "title", From: a.Title, To: b.Title})
+	}
+	if a.Order != b.Order {
+		changes = append(changes, fieldChange{Field: "order", From: a.Order, To: b.Order})
+	}
+	if a.CourseID != b.CourseID {
+		changes = append(changes, fieldChange{Field: "course_id", From: a.CourseID, To: b.CourseID})
+	}
+	if a.PDFUrl != b.PDFUrl || a.PDFName != b.PDFName {
+		changes = append(changes, fieldChange{Field: "pdf", From: revisionFile(a), To: revisionFile(b)})
+	}
+
+	return c.JSON(fiber.Map{"from": a, "to": b, "changes": changes})
+}
+
+func revisionFile(r models.ModuleRevision) fiber.Map {
+	if r.PDFUrl == "" {
+		return nil
+	}
+	return fiber.Map{"name": r.PDFName, "page_count": r.PageCount, "title": r.PDFTitle}
+}
+
+// RollbackModule -> POST /instructor/courses/:course_id/modules/:module_id/revisions/:number/rollback (requires instructor)
+// Restores title, order and PDF. The module stays in its current course.
+// The rollback itself becomes a new revision.
+func RollbackModule(c *fiber.Ctx) error {
+	module, err := loadOwnedModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+	var rev models.ModuleRevision
+	if err := database.DB.Where("module_id = ? AND number = ?", module.ID, c.Params("number")).First(&rev).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "revision not found"})
+	}
+	ctx := c.UserContext()
+
+	// The module takes its own reference on the restored PDF
+	pdfURL := ""
+	if rev.PDFUrl != "" {
+		if pdfURL, err = assets.Acquire(ctx, rev.PDFUrl); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+	oldPDF, oldThumbnail := module.PDFUrl, module.ThumbnailUrl
+
+	module.Title = rev.Title
+	module.Order = rev.Order
+	module.PDFName = rev.PDFName
+	if pdfURL != oldPDF {
+		module.PDFUrl = pdfURL
+		module.PageCount = rev.PageCount
+		module.PDFTitle = rev.PDFTitle
+		module.ThumbnailUrl = ""
+		module.PDFInfoStatus = ""
+		if pdfURL != "" {
+			module.PDFInfoStatus = "pending"
+		}
+	}
+	userID, _ := currentUserID(c)
+	if err := saveModuleWithRevision(ctx, module, "rolled_back", fmt.Sprintf("rolled back to revision %d", rev.Number), userID); err != nil {
+		_ = assets.Release(ctx, pdfURL)
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Drop the references the module held before
+	_ = assets.Release(ctx, oldPDF)
+	if pdfURL != oldPDF {
+		_ = assets.Release(ctx, oldThumbnail)
+	}
+	if module.PDFInfoStatus == "pending" {
+		assets.QueuePDFInfo(module.ID)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": fmt.Sprintf("module rolled back to revision %d", rev.Number),
+		"module":  module,
+	})
+}
+
+// GetModuleRevisionPDF -> GET /me/courses/:course_id/modules/:module_id/revisions/:number/pdf
+// Also mounted for instructors on their own courses. Students may only
+// fetch revisions they took the quiz on.
+func GetModuleRevisionPDF(c *fiber.Ctx) error {
+	var module *models.Module
+	var err error
+	if c.Locals("role") == "instructor" {
+		module, err = loadOwnedModule(c)
+	} else {
+		module, err = loadEnrolledModule(c)
+	}
+	if err != nil {
+		return sendError(c, err)
+	}
+	userID, _ := currentUserID(c)
+
+	number, err := strconv.Atoi(c.Params("number"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "revision not found"})
+	}
+	if c.Locals("role") != "instructor" {
+		var n int64
+		database.DB.Model(&models.QuizResult{}).Where("user_id = ? AND module_id = ? AND module_revision = ?", userID, module.ID, number).Count(&n)
+		if n == 0 {
+			return c.Status(403).JSON(fiber.Map{"error": "you did not study this revision"})
+		}
+	}
+
+	var rev models.ModuleRevision
+	if err := database.DB.Where("module_id = ? AND number = ?", module.ID, number).First(&rev).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "revision not found"})
+	}
+	if rev.PDFUrl == "" {
+		return c.Status(404).JSON(fiber.Map{"error": "no PDF in this revision"})
+	}
+
+	old := *module
+	old.PDFUrl = rev.PDFUrl
+	fileURL, err := modulePDFFor(c.UserContext(), &old, userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	name := rev.PDFName
+	if name == "" {
+		name = filepath.Base(rev.PDFUrl)
+	}
+	return sendStoredFile(c, fileURL, name, "inline")
+}
+
+// GetStudiedModuleRevision -> GET /me/courses/:course_id/modules/:module_id/revisions/studied
+// Tells a student which version of the module they passed the quiz on and
+// whether it has changed since.
+func GetStudiedModuleRevision(c *fiber.Ctx) error {
+	module, err := loadEnrolledModule(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+	userID, _ := currentUserID(c)
+
+	var result models.QuizResult
+	err = database.DB.Where("user_id = ? AND module_id = ? AND passed = ?", userID, module.ID, true).
+		Order("created_at desc").First(&result).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "you have not passed this module yet"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	latest := latestModuleRevision(module.ID)
+	out := fiber.Map{
+		"passed_at":        result.CreatedAt,
+		"score":            result.Score,
+		"revision":         nil, // passed before revisions were kept
+		"current_revision": latest,
+		"is_current":       result.ModuleRevision != 0 && result.ModuleRevision == latest,
+	}
+
+	var rev models.ModuleRevision
+	if err := database.DB.Where("module_id = ? AND number = ?", module.ID, result.ModuleRevision).First(&rev).Error; err == nil {
+		revision := fiber.Map{
+			"number":     rev.Number,
+			"created_at": rev.CreatedAt,
+			"title":      rev.Title,
+			"pdf_name":   rev.PDFName,
+			"page_count": rev.PageCount,
+			"pdf_title":  rev.PDFTitle,
+		}
+		if rev.PDFUrl != "" {
+			revision["pdf_url"] = fmt.Sprintf("/api/me/courses/%d/modules/%d/revisions/%d/pdf", module.CourseID, module.ID, rev.Number)
+		}
+		out["revision"] = revision
+	}
+	return c.JSON(out)
+}
@@ -0,0 +1,172 @@
+package controllers
+
+import (
+	"backend-elearning/assets"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Resumable uploads follow the tus 1.0.0 protocol (core, creation,
+// expiration and termination), so stock tus clients work. A finished upload
+// is attached by sending its id as upload_id wherever a file is accepted,
+// e.g. AddModuleToCourse.
+
+const tusVersion = "1.0.0"
+
+// UploadOptions -> OPTIONS /instructor/uploads (requires instructor)
+func UploadOptions(c *fiber.Ctx) error {
+	c.Set("Tus-Resumable", tusVersion)
+	c.Set("Tus-Version", tusVersion)
+	c.Set("Tus-Extension", "creation,expiration,termination")
+	c.Set("Tus-Max-Size", strconv.FormatInt(assets.MaxUploadSize, 10))
+	return c.SendStatus(204)
+}
+
+// CreateUpload -> POST /instructor/uploads (requires instructor)
+// Headers: Upload-Length, Upload-Metadata (must include filename).
+func CreateUpload(c *fiber.Ctx) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !tusVersionOK(c) {
+		return c.Status(412).JSON(fiber.Map{"error": "Tus-Resumable: " + tusVersion + " header is required"})
+	}
+
+	length, err := strconv.ParseInt(c.Get("Upload-Length"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Upload-Length header is required"})
+	}
+	meta := parseUploadMetadata(c.Get("Upload-Metadata"))
+
+	session, err := assets.CreateSession(userID, meta["filename"], length)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	c.Set("Location", "/api/instructor/uploads/"+session.ID)
+	c.Set("Upload-Expires", session.ExpiresAt.UTC().Format(http.TimeFormat))
+	return c.Status(201).JSON(fiber.Map{
+		"message": "upload created",
+		"upload":  session,
+	})
+}
+
+// UploadStatus -> HEAD /instructor/uploads/:upload_id (requires instructor)
+// Reports how many bytes arrived, so the client knows where to resume.
+func UploadStatus(c *fiber.Ctx) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return c.SendStatus(401)
+	}
+	c.Set("Tus-Resumable", tusVersion)
+	c.Set("Cache-Control", "no-store")
+
+	session, err := assets.FindSession(c.Params("upload_id"), userID)
+	if err != nil {
+		return c.SendStatus(uploadErrorStatus(err))
+	}
+
+	c.Set("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+	c.Set("Upload-Length", strconv.FormatInt(session.Length, 10))
+	c.Set("Upload-Expires", session.ExpiresAt.UTC().Format(http.TimeFormat))
+	return c.SendStatus(200)
+}
+
+// PatchUpload -> PATCH /instructor/uploads/:upload_id (requires instructor)
+// Content-Type: application/offset+octet-stream; Upload-Offset must match
+// the current offset.
+func PatchUpload(c *fiber.Ctx) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !tusVersionOK(c) {
+		return c.Status(412).JSON(fiber.Map{"error": "Tus-Resumable: " + tusVersion + " header is required"})
+	}
+	if c.Get("Content-Type") != "application/offset+octet-stream" {
+		return c.Status(415).JSON(fiber.Map{"error": "Content-Type must be application/offset+octet-stream"})
+	}
+	offset, err := strconv.ParseInt(c.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Upload-Offset header is required"})
+	}
+
+	session, err := assets.WriteChunk(c.UserContext(), c.Params("upload_id"), userID, offset, c.Body())
+	if err != nil {
+		if status := uploadErrorStatus(err); status != 500 {
+			return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+		}
+		return sendError(c, err)
+	}
+
+	c.Set("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+	c.Set("Upload-Expires", session.ExpiresAt.UTC().Format(http.TimeFormat))
+	return c.SendStatus(204)
+}
+
+// DeleteUpload -> DELETE /instructor/uploads/:upload_id (requires instructor)
+func DeleteUpload(c *fiber.Ctx) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": err.Error()})
+	}
+	c.Set("Tus-Resumable", tusVersion)
+
+	// Expired uploads can still be deleted by their owner.
+	id := c.Params("upload_id")
+	if _, err := assets.FindSession(id, userID); err != nil && !errors.Is(err, assets.ErrSessionExpired) {
+		return c.Status(uploadErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := assets.DeleteSession(c.UserContext(), id); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.SendStatus(204)
+}
+
+// tusVersionOK sets Tus-Resumable on the response and checks that the
+// client speaks the same protocol version.
+func tusVersionOK(c *fiber.Ctx) bool {
+	c.Set("Tus-Resumable", tusVersion)
+	if c.Get("Tus-Resumable") != tusVersion {
+		c.Set("Tus-Version", tusVersion)
+		return false
+	}
+	return true
+}
+
+func uploadErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, assets.ErrSessionNotFound):
+		return 404
+	case errors.Is(err, assets.ErrSessionExpired):
+		return 410
+	case errors.Is(err, assets.ErrOffsetMismatch):
+		return 409
+	}
+	return 500
+}
+
+// parseUploadMetadata decodes "key base64value,key2 base64value2".
+func parseUploadMetadata(header string) map[string]string {
+	meta := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		parts := strings.Fields(pair)
+		if len(parts) == 0 {
+			continue
+		}
+		value := ""
+		if len(parts) > 1 {
+			if b, err := base64.StdEncoding.DecodeString(parts[1]); err == nil {
+				value = string(b)
+			}
+		}
+		meta[parts[0]] = value
+	}
+	return meta
+}
@@ -191,7 +191,9 @@ func GetEnrolledCourseModules(c *fiber.Ctx) error {
 		ID     uint `json:"id"`
 		Title  string `json:"title"`
 		PDFUrl string `json:"pdf_url"`
+		PDFInfo fiber.Map `json:"pdf_info"`
 		Order  int `json:"order"`
+		Blocks []fiber.Map `json:"blocks"`
 		Quizzes []fiber.Map `json:"quizzes"`
 	}
 
@@ -199,23 +201,34 @@ func GetEnrolledCourseModules(c *fiber.Ctx) error {
 
 	for _, m := range course.Modules {
 		var quizzes []models.Quiz
-		database.DB.Where("module_id = ?", m.ID).Find(&quizzes)
+		database.DB.Where("module_id = ?", m.ID).Order("position ASC, id ASC").Find(&quizzes)
 
 		var quizList []fiber.Map
 		for _, q := range quizzes {
 			quizList = append(quizList, fiber.Map{
 				"id":      q.ID,
+				"type":    q.Type,
 				"question": q.Question,
 				"options": q.Options,
 				// answer hidden for students
 			})
 		}
 
+		var blocks []models.ContentBlock
+		database.DB.Where("module_id = ?", m.ID).Order("position ASC, id ASC").Find(&blocks)
+
+		blockList := []fiber.Map{}
+		for _, b := range blocks {
+			blockList = append(blockList, blockResponse(b, course.ID))
+		}
+
 		modulesWithQuiz = append(modulesWithQuiz, ModuleResponse{
 			ID:      m.ID,
 			Title:   m.Title,
 			PDFUrl:  m.PDFUrl,
+			PDFInfo: moduleInfo("/api/me", m),
 			Order:   m.Order,
+			Blocks:  blockList,
 			Quizzes: quizList,
 		})
 	}
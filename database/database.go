@@ -41,8 +41,23 @@ func ConnectDB(cfg *config.Config) {
 		&models.User{},
 		&models.Course{},
 		&models.Module{},
+		&models.ContentBlock{},
+		&models.Asset{},
+		&models.UploadSession{},
+		&models.WatermarkedFile{},
+		&models.CourseRevision{},
+		&models.ModuleRevision{},
 		&models.Quiz{},
+		&models.QuestionBank{},
+		&models.QuizRule{},
 		&models.QuizResult{},
+		&models.QuizAnswer{},
+		&models.Notification{},
+		&models.Assessment{},
+		&models.AssessmentScore{},
+		&models.Assignment{},
+		&models.AssignmentSubmission{},
+		&models.PeerReview{},
 		&models.Enrollment{},
 		&models.Feedback{},
 	)
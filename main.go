@@ -1,13 +1,18 @@
 package main
 
 import (
+	"backend-elearning/assets"
 	"backend-elearning/config"
+	"backend-elearning/controllers"
+	"context"
 	"fmt"
 	"log"
+	"time"
 
 	"backend-elearning/database"
 
 	"backend-elearning/routes"
+	"backend-elearning/storage"
 
 	loggermw "github.com/gofiber/fiber/v2/middleware/logger"
 
@@ -19,14 +24,30 @@ func main() {
 	cfg := config.LoadConfig()
 
 	database.ConnectDB(cfg)
-
-	app := fiber.New()
+	storage.Init(cfg)
+	assets.MaxUploadSize = int64(cfg.MaxUploadMB) << 20
+	assets.StartUploadJanitor(time.Hour)
+	assets.PDFRenderer = cfg.PDFRenderer
+	assets.StartPDFInfoWorker()
+	controllers.StartPeerReviewScheduler(time.Minute)
+	// Modul lama belum punya revisi awal
+	if n, err := controllers.BackfillModuleRevisions(context.Background()); err != nil {
+		log.Println("⚠️ Recording initial module revisions failed:", err)
+	} else if n > 0 {
+		log.Printf("📚 Recorded initial revisions for %d modules", n)
+	}
+
+	app := fiber.New(fiber.Config{
+		// Ruang tambahan untuk field form selain file
+		BodyLimit: int(assets.MaxUploadSize) + 1<<20,
+	})
 
 	// Middleware: CORS
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     "https://nesyasal.github.io,http://localhost:5500,http://127.0.0.1:5500",
-		AllowMethods:     "GET,POST,PUT,DELETE,OPTIONS",
-		AllowHeaders:     "Origin, Content-Type, Accept, Authorization",
+		AllowMethods:     "GET,POST,PUT,DELETE,OPTIONS,PATCH,HEAD",
+		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, Tus-Resumable, Upload-Length, Upload-Offset, Upload-Metadata",
+		ExposeHeaders:    "Location, Tus-Resumable, Tus-Version, Tus-Extension, Tus-Max-Size, Upload-Offset, Upload-Length, Upload-Expires",
 		AllowCredentials: true,
 	}))
 
@@ -1,6 +1,10 @@
 package models
 
-import "gorm.io/gorm"
+import (
+    "time"
+
+    "gorm.io/gorm"
+)
 
 type User struct {
     gorm.Model
@@ -17,6 +21,8 @@ type Course struct {
     Description  string    `json:"description" gorm:"type:text"` 
     InstructorID uint      `json:"instructor_id"`
     Published    bool      `json:"published" gorm:"default:false"`
+    WatermarkPDFs bool     `json:"watermark_pdfs" gorm:"default:false"` // stamp student downloads with who/when
+    GradingScheme string   `json:"-" gorm:"type:text"` // JSON: category weights, letter grades, drop rules
     Modules      []Module  `json:"modules" gorm:"constraint:OnDelete:CASCADE"`
     Feedbacks    []Feedback `json:"feedbacks" gorm:"constraint:OnDelete:CASCADE"`
 }
@@ -25,25 +31,291 @@ type Module struct {
     gorm.Model
     Title    string `json:"title" gorm:"not null"`
     PDFUrl   string `json:"pdf_url"`
+    PDFName  string `json:"pdf_name"` // original upload name, used for downloads
+    // Filled in by a background job after each PDF upload
+    PageCount     int    `json:"page_count"`
+    PDFTitle      string `json:"pdf_title"`       // title from the PDF metadata
+    ThumbnailUrl  string `json:"thumbnail_url"`   // first page as PNG, stored like PDFUrl
+    PDFInfoStatus string `json:"pdf_info_status"` // "", "pending", "ready" or "failed"
     Order    int    `json:"order"`
     CourseID uint   `json:"course_id"`
+    // Quiz attempt rules; 0 means no limit
+    QuizTimeLimit   int    `json:"quiz_time_limit"`   // minutes per attempt
+    QuizMaxAttempts int    `json:"quiz_max_attempts"`
+    QuizCooldown    int    `json:"quiz_cooldown"`     // minutes between attempts
+    QuizScoring     string `json:"quiz_scoring" gorm:"type:varchar(16);default:latest"` // which attempt counts: highest, latest or average
+    QuizPassThreshold   float64 `json:"quiz_pass_threshold" gorm:"type:decimal(5,2);default:60"` // score (%) needed to pass
+    QuizNegativeMarking float64 `json:"quiz_negative_marking"` // share of a question's points lost for a wrong answer
+    QuizDeadline     *time.Time `json:"quiz_deadline"` // no attempts start after it
+    QuizReviewPolicy string     `json:"quiz_review_policy" gorm:"type:varchar(16);default:never"` // when students see correct answers: never, after_attempt, after_pass or after_deadline
     Quizzes  []Quiz `json:"quizzes" gorm:"constraint:OnDelete:CASCADE"`
+    Blocks   []ContentBlock `json:"blocks" gorm:"constraint:OnDelete:CASCADE"`
+}
+
+// ContentBlock is one ordered piece of module content next to the PDF.
+type ContentBlock struct {
+    gorm.Model
+    ModuleID uint   `json:"module_id"`
+    Type     string `json:"type" gorm:"type:ENUM('markdown','video','attachment','url');not null"`
+    Position int    `json:"position"`
+    Title    string `json:"title"`
+    Body     string `json:"body" gorm:"type:text"` // markdown source
+    URL      string `json:"url"`                   // video or external link
+    FileUrl  string `json:"file_url"`              // attachment, stored like Module.PDFUrl
+    FileName string `json:"file_name"`             // original attachment name
+}
+
+// Asset is an uploaded file stored once per SHA-256 content hash. RefCount
+// counts the rows (module PDFs, block attachments) pointing at its URL; the
+// file is deleted when it drops to zero. No soft delete, so a hash can be
+// stored again after its asset is gone.
+type Asset struct {
+    ID          uint      `json:"id" gorm:"primarykey"`
+    CreatedAt   time.Time `json:"created_at"`
+    UpdatedAt   time.Time `json:"updated_at"`
+    Hash        string    `json:"hash" gorm:"type:char(64);uniqueIndex;not null"`
+    StorageKey  string    `json:"storage_key" gorm:"type:varchar(255);uniqueIndex;not null"`
+    Size        int64     `json:"size"`
+    ContentType string    `json:"content_type"`
+    RefCount    int       `json:"ref_count"`
+}
+
+// UploadSession is a resumable (tus) upload. Chunks are kept in storage
+// under partial/<id>/ until the upload is attached to a module or block,
+// or expires.
+type UploadSession struct {
+    ID        string    `json:"id" gorm:"type:char(32);primarykey"`
+    CreatedAt time.Time `json:"created_at"`
+    UpdatedAt time.Time `json:"updated_at"`
+    UserID    uint      `json:"user_id" gorm:"index"`
+    Filename  string    `json:"filename"`
+    Length    int64     `json:"length"`
+    Offset    int64     `json:"offset"`
+    ExpiresAt time.Time `json:"expires_at" gorm:"index"`
+}
+
+// WatermarkedFile caches a module PDF stamped for one user. SourceUrl is
+// the PDF it was made from; content-addressed URLs change with every new
+// upload, so each version of the file gets its own copy.
+type WatermarkedFile struct {
+    ID        uint      `json:"id" gorm:"primarykey"`
+    CreatedAt time.Time `json:"created_at"`
+    UserID    uint      `json:"user_id" gorm:"uniqueIndex:idx_watermark_user_source"`
+    SourceUrl string    `json:"source_url" gorm:"type:varchar(255);uniqueIndex:idx_watermark_user_source;index"`
+    FileUrl   string    `json:"file_url"`
+    Label     string    `json:"label"` // name and email the copy was stamped with
+}
+
+// CourseRevision is a snapshot of a course's own fields after a change.
+// Number counts up per course.
+type CourseRevision struct {
+    ID            uint      `json:"id" gorm:"primarykey"`
+    CreatedAt     time.Time `json:"created_at"`
+    CourseID      uint      `json:"course_id" gorm:"uniqueIndex:idx_course_revision"`
+    Number        int       `json:"number" gorm:"uniqueIndex:idx_course_revision"`
+    Action        string    `json:"action"` // initial, created, updated, published, ...
+    Note          string    `json:"note"`
+    AuthorID      uint      `json:"author_id"`
+    Title         string    `json:"title"`
+    Description   string    `json:"description" gorm:"type:text"`
+    Published     bool      `json:"published"`
+    WatermarkPDFs bool      `json:"watermark_pdfs"`
+}
+
+// ModuleRevision is a snapshot of a module after a change. Number counts up
+// per module. PDFUrl holds its own asset reference, so a replaced PDF is
+// kept for as long as the revision exists.
+type ModuleRevision struct {
+    ID        uint      `json:"id" gorm:"primarykey"`
+    CreatedAt time.Time `json:"created_at"`
+    ModuleID  uint      `json:"module_id" gorm:"uniqueIndex:idx_module_revision"`
+    Number    int       `json:"number" gorm:"uniqueIndex:idx_module_revision"`
+    Action    string    `json:"action"` // initial, created, updated, moved, reordered, copied, rolled_back
+    Note      string    `json:"note"`
+    AuthorID  uint      `json:"author_id"`
+    Title     string    `json:"title"`
+    Order     int       `json:"order"`
+    CourseID  uint      `json:"course_id"`
+    PDFUrl    string    `json:"pdf_url"`
+    PDFName   string    `json:"pdf_name"`
+    PageCount int       `json:"page_count"`
+    PDFTitle  string    `json:"pdf_title"`
 }
 
 type Quiz struct {
     gorm.Model
     ModuleID uint   `json:"module_id"`
+    // Type names the question type in package questions; the format of
+    // Options and Answer depends on it.
+    Type     string `json:"type" gorm:"type:varchar(32);default:single_choice"`
     Question string `json:"question" gorm:"not null"`
     Options  string `json:"options" gorm:"type:text"`
-    Answer   string `json:"answer" gorm:"not null"`
+    Answer   string `json:"answer" gorm:"type:text;not null"`
+    Points   float64 `json:"points" gorm:"type:decimal(8,2);default:1"` // weight in the score
+    Explanation string `json:"explanation" gorm:"type:text"` // shown with the correct answer on review
+    Position int    `json:"position"`
+    // Editing a question that was already answered creates a new row; the
+    // old one is soft-deleted and kept for the results scored against it.
+    Version    int   `json:"version" gorm:"default:1"`
+    PreviousID *uint `json:"previous_id"`
+    // Questions in a bank have no module; quizzes draw them by rule.
+    BankID     *uint  `json:"bank_id" gorm:"index"`
+    Topic      string `json:"topic" gorm:"type:varchar(100)"`
+    Difficulty string `json:"difficulty" gorm:"type:varchar(16)"` // easy, medium or hard
+}
+
+// QuestionBank is an instructor's pool of questions to draw quizzes from.
+type QuestionBank struct {
+    gorm.Model
+    InstructorID uint   `json:"instructor_id" gorm:"index"`
+    Title        string `json:"title" gorm:"not null"`
+    Description  string `json:"description" gorm:"type:text"`
+    Questions    []Quiz `json:"questions,omitempty" gorm:"foreignKey:BankID"`
+}
+
+// QuizRule draws Count random questions from a bank into every attempt at
+// a module's quiz, optionally only those with the given topic/difficulty.
+type QuizRule struct {
+    gorm.Model
+    ModuleID   uint   `json:"module_id" gorm:"index"`
+    BankID     uint   `json:"bank_id"`
+    Count      int    `json:"count"`
+    Topic      string `json:"topic"`
+    Difficulty string `json:"difficulty"`
+    Position   int    `json:"position"`
 }
 
 type QuizResult struct {
     gorm.Model
     UserID   uint `json:"user_id"`
     ModuleID uint `json:"module_id"`
-    Score    int  `json:"score"`
+    Score    float64 `json:"score" gorm:"type:decimal(5,2)"` // percentage
     Passed   bool `json:"passed"`
+    Points    float64 `json:"points" gorm:"type:decimal(10,2)"`     // weighted points earned
+    MaxPoints float64 `json:"max_points" gorm:"type:decimal(10,2)"` // weighted points available
+    ModuleRevision int `json:"module_revision"` // module version the student studied
+    // An attempt is "in_progress" until submitted, then "pending" while
+    // essay answers wait for manual grading; Score and Passed are final
+    // once it is "graded".
+    Status    string       `json:"status" gorm:"type:varchar(16);default:graded"`
+    Questions int          `json:"questions"` // questions the score is out of
+    QuestionIDs string     `json:"-" gorm:"type:text"` // JSON list of the questions shown
+    Layout      string     `json:"-" gorm:"type:text"` // JSON: quiz id -> options in the order shown
+    StartedAt   *time.Time `json:"started_at"`
+    ExpiresAt   *time.Time `json:"expires_at"` // set when the module has a time limit
+    SubmittedAt *time.Time `json:"submitted_at"`
+    Answers   []QuizAnswer `json:"answers,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+}
+
+// QuizAnswer is one answer of a submitted attempt with the credit it earned.
+type QuizAnswer struct {
+    gorm.Model
+    QuizResultID uint    `json:"quiz_result_id" gorm:"index"`
+    QuizID       uint    `json:"quiz_id" gorm:"index"`
+    Response     string  `json:"response" gorm:"type:text"` // JSON, as submitted
+    Credit       float64 `json:"credit"`                    // 0..1
+    Earned       float64 `json:"earned"`                    // credit times the question's points, less any penalty
+    // Manually graded answers are "pending" until course staff award
+    // Points (out of the rubric total) with optional per-criterion scores
+    // and feedback.
+    Status       string     `json:"status" gorm:"type:varchar(16);default:graded"`
+    Points       float64    `json:"points"`
+    RubricScores string     `json:"rubric_scores" gorm:"type:text"`
+    Feedback     string     `json:"feedback" gorm:"type:text"`
+    GraderID     *uint      `json:"grader_id"`
+    GradedAt     *time.Time `json:"graded_at"`
+}
+
+// Notification is a message for a user, e.g. that their essay was graded.
+type Notification struct {
+    gorm.Model
+    UserID  uint       `json:"user_id" gorm:"index"`
+    Kind    string     `json:"kind" gorm:"type:varchar(32)"`
+    Message string     `json:"message"`
+    Data    string     `json:"data" gorm:"type:text"` // JSON with ids to link to
+    ReadAt  *time.Time `json:"read_at"`
+}
+
+// Assessment is a graded course item besides the module quizzes, such as a
+// final exam. Backed by a module, its score is the student's standing on
+// that module's quiz; otherwise course staff enter the scores.
+type Assessment struct {
+    gorm.Model
+    CourseID  uint       `json:"course_id" gorm:"index"`
+    Title     string     `json:"title" gorm:"not null"`
+    Category  string     `json:"category" gorm:"type:varchar(64)"` // grading scheme category, e.g. "exam"
+    MaxPoints float64    `json:"max_points" gorm:"type:decimal(8,2);default:100"`
+    ModuleID  *uint      `json:"module_id"`
+    DueAt     *time.Time `json:"due_at"`
+    Position  int        `json:"position"`
+    Scores    []AssessmentScore `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+}
+
+// AssessmentScore is the score course staff gave a student on an assessment.
+type AssessmentScore struct {
+    gorm.Model
+    AssessmentID uint       `json:"assessment_id" gorm:"uniqueIndex:idx_assessment_user"`
+    UserID       uint       `json:"user_id" gorm:"uniqueIndex:idx_assessment_user"`
+    Points       float64    `json:"points" gorm:"type:decimal(8,2)"`
+    Feedback     string     `json:"feedback" gorm:"type:text"`
+    GraderID     *uint      `json:"grader_id"`
+    GradedAt     *time.Time `json:"graded_at"`
+}
+
+// Assignment is work students hand in for a module, as files or text.
+type Assignment struct {
+    gorm.Model
+    ModuleID     uint       `json:"module_id" gorm:"index"`
+    Title        string     `json:"title" gorm:"not null"`
+    Instructions string     `json:"instructions" gorm:"type:text"` // markdown
+    DueAt        *time.Time `json:"due_at"`
+    LatePolicy   string     `json:"late_policy" gorm:"type:varchar(16);default:reject"` // reject, accept or penalty
+    LatePenalty  float64    `json:"late_penalty" gorm:"type:decimal(5,2)"`              // % of the points lost per started day late
+    LateCutoff   *time.Time `json:"late_cutoff"`                                        // no late submissions after it
+    AllowedTypes string     `json:"allowed_types"`                                      // comma-separated extensions; empty means no files
+    AllowText    bool       `json:"allow_text" gorm:"default:true"`
+    MaxPoints    float64    `json:"max_points" gorm:"type:decimal(8,2);default:100"`
+    Position     int        `json:"position"`
+    // Peer review; 0 reviewers means staff grade every submission
+    PeerReviewers   int        `json:"peer_reviewers"`                  // classmates reviewing each submission
+    PeerRubric      string     `json:"-" gorm:"type:text"`              // JSON: [{"criterion", "points"}]
+    PeerReviewDueAt *time.Time `json:"peer_review_due_at"`
+    PeerAssignedAt  *time.Time `json:"peer_assigned_at"`                // when the reviews were handed out
+    Submissions  []AssignmentSubmission `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+}
+
+// AssignmentSubmission is one hand-in of a student. Resubmitting adds a new
+// one with the next Attempt; the latest is the one that is graded.
+type AssignmentSubmission struct {
+    gorm.Model
+    AssignmentID uint       `json:"assignment_id" gorm:"index:idx_submission_user"`
+    UserID       uint       `json:"user_id" gorm:"index:idx_submission_user"`
+    Attempt      int        `json:"attempt"`
+    Text         string     `json:"text" gorm:"type:text"`
+    FileUrl      string     `json:"-"`         // stored like Module.PDFUrl
+    FileName     string     `json:"file_name"` // original upload name
+    SubmittedAt  time.Time  `json:"submitted_at"`
+    DaysLate     int        `json:"days_late"` // started days after the due date
+    Points       *float64   `json:"points" gorm:"type:decimal(8,2)"` // as given by the grader
+    Penalty      float64    `json:"penalty" gorm:"type:decimal(5,2)"` // late penalty in % of the points
+    Score        *float64   `json:"score" gorm:"type:decimal(8,2)"`  // points after the penalty
+    PeerScore    *float64   `json:"peer_score" gorm:"type:decimal(8,2)"` // combined from peer reviews, out of MaxPoints
+    Feedback     string     `json:"feedback" gorm:"type:text"`
+    GraderID     *uint      `json:"grader_id"`
+    GradedAt     *time.Time `json:"graded_at"`
+}
+
+// PeerReview is a student's review of a classmate's submission. Neither
+// side is shown who the other is.
+type PeerReview struct {
+    gorm.Model
+    AssignmentID uint       `json:"assignment_id" gorm:"index"`
+    SubmissionID uint       `json:"submission_id" gorm:"uniqueIndex:idx_review_submission_reviewer"`
+    ReviewerID   uint       `json:"reviewer_id" gorm:"uniqueIndex:idx_review_submission_reviewer"`
+    Scores       string     `json:"scores" gorm:"type:text"` // JSON: points per rubric criterion
+    Total        *float64   `json:"total" gorm:"type:decimal(8,2)"` // % of the rubric's points
+    Comment      string     `json:"comment" gorm:"type:text"`
+    SubmittedAt  *time.Time `json:"submitted_at"`
 }
 
 type Enrollment struct {
@@ -0,0 +1,570 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+var (
+	// ErrNotPDF means the data does not start with a PDF header.
+	ErrNotPDF = errors.New("pdf: not a PDF file")
+	// ErrMalformed means no usable cross-reference data or catalog was found,
+	// even after scanning the whole file.
+	ErrMalformed = errors.New("pdf: file is damaged")
+)
+
+type xrefEntry struct {
+	offset int   // kind 1: byte offset of "num gen obj"
+	stream int   // kind 2: object number of the containing object stream
+	index  int   // kind 2: index inside that stream
+	kind   uint8 // 1 = in file, 2 = in object stream
+}
+
+// Document is a parsed PDF held in memory. Objects are parsed lazily.
+type Document struct {
+	Version string
+	Trailer Dict
+
+	data    []byte
+	xref    map[int]xrefEntry
+	cache   map[int]Object
+	objStms map[int]*objectStream
+	changed map[int]Object
+}
+
+type objectStream struct {
+	data    []byte
+	first   int
+	offsets []int
+	nums    []int
+}
+
+// Open parses the cross-reference data of a PDF. When the xref is missing or
+// broken the file is scanned for objects instead, the way viewers recover
+// damaged files.
+func Open(data []byte) (*Document, error) {
+	head := data
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	i := bytes.Index(head, []byte("%PDF-"))
+	if i < 0 {
+		return nil, ErrNotPDF
+	}
+
+	d := &Document{
+		data:    data,
+		xref:    map[int]xrefEntry{},
+		cache:   map[int]Object{},
+		objStms: map[int]*objectStream{},
+		Trailer: Dict{},
+	}
+	l := lexer{data: data, pos: i + 5}
+	d.Version = l.keyword()
+
+	if err := d.loadXrefChain(); err != nil || !d.hasCatalog() {
+		d.xref = map[int]xrefEntry{}
+		d.Trailer = Dict{}
+		d.cache = map[int]Object{}
+		if err := d.reconstruct(); err != nil {
+			return nil, err
+		}
+	}
+	if !d.hasCatalog() {
+		return nil, ErrMalformed
+	}
+	return d, nil
+}
+
+func (d *Document) hasCatalog() bool {
+	_, ok := d.Resolve(d.Trailer["Root"]).(Dict)
+	return ok
+}
+
+func (d *Document) loadXrefChain() error {
+	idx := bytes.LastIndex(d.data, []byte("startxref"))
+	if idx < 0 {
+		return ErrMalformed
+	}
+	l := lexer{data: d.data, pos: idx + len("startxref")}
+	l.skipSpace()
+	off, err := strconv.Atoi(l.keyword())
+	if err != nil {
+		return ErrMalformed
+	}
+
+	seen := map[int]bool{}
+	for off > 0 || (off == 0 && !seen[0]) {
+		if seen[off] || off >= len(d.data) {
+			return ErrMalformed
+		}
+		seen[off] = true
+
+		trailer, err := d.loadXrefSection(off, seen)
+		if err != nil {
+			return err
+		}
+		// Sections are read newest first, so keys already set win.
+		for k, v := range trailer {
+			if _, ok := d.Trailer[k]; !ok {
+				d.Trailer[k] = v
+			}
+		}
+		prev, ok := trailer["Prev"].(int64)
+		if !ok {
+			break
+		}
+		off = int(prev)
+	}
+	return nil
+}
+
+// loadXrefSection reads one xref table or xref stream at off and returns its
+// trailer dictionary. Entries already known (from newer sections) are kept.
+func (d *Document) loadXrefSection(off int, seen map[int]bool) (Dict, error) {
+	l := lexer{data: d.data, pos: off}
+	l.skipSpace()
+	if l.peekKeyword() != "xref" {
+		return d.loadXrefStream(off)
+	}
+	l.keyword()
+
+	var table []struct {
+		num int
+		e   xrefEntry
+	}
+	for {
+		l.skipSpace()
+		if l.peekKeyword() == "trailer" {
+			l.keyword()
+			break
+		}
+		start, err1 := strconv.Atoi(l.keyword())
+		l.skipSpace()
+		count, err2 := strconv.Atoi(l.keyword())
+		if err1 != nil || err2 != nil || count < 0 || count > len(d.data)/18 {
+			return nil, ErrMalformed
+		}
+		for n := 0; n < count; n++ {
+			l.skipSpace()
+			offset, err1 := strconv.Atoi(l.keyword())
+			l.skipSpace()
+			_, err2 := strconv.Atoi(l.keyword())
+			l.skipSpace()
+			typ := l.keyword()
+			if err1 != nil || err2 != nil {
+				return nil, ErrMalformed
+			}
+			if typ == "n" && offset > 0 {
+				table = append(table, struct {
+					num int
+					e   xrefEntry
+				}{start + n, xrefEntry{kind: 1, offset: offset}})
+			}
+		}
+	}
+
+	obj, err := l.object(0)
+	if err != nil {
+		return nil, err
+	}
+	trailer, ok := obj.(Dict)
+	if !ok {
+		return nil, ErrMalformed
+	}
+
+	for _, t := range table {
+		if _, ok := d.xref[t.num]; !ok {
+			d.xref[t.num] = t.e
+		}
+	}
+
+	// Hybrid files list compressed objects in a separate xref stream that
+	// takes precedence over older sections.
+	if stm, ok := trailer["XRefStm"].(int64); ok && !seen[int(stm)] {
+		seen[int(stm)] = true
+		if _, err := d.loadXrefStream(int(stm)); err != nil {
+			return nil, err
+		}
+	}
+	return trailer, nil
+}
+
+func (d *Document) loadXrefStream(off int) (Dict, error) {
+	l := lexer{data: d.data, pos: off}
+	_, obj, err := l.indirect(directLength)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := obj.(*Stream)
+	if !ok || s.Dict.Name("Type") != "XRef" {
+		return nil, ErrMalformed
+	}
+	data, err := d.Decode(s)
+	if err != nil {
+		return nil, err
+	}
+
+	w, ok := s.Dict["W"].(Array)
+	if !ok || len(w) != 3 {
+		return nil, ErrMalformed
+	}
+	var widths [3]int
+	rowLen := 0
+	for i, v := range w {
+		n, ok := v.(int64)
+		if !ok || n < 0 || n > 8 {
+			return nil, ErrMalformed
+		}
+		widths[i] = int(n)
+		rowLen += int(n)
+	}
+	if rowLen == 0 {
+		return nil, ErrMalformed
+	}
+
+	index := Array{int64(0), int64(s.Dict.Int("Size"))}
+	if a, ok := s.Dict["Index"].(Array); ok {
+		index = a
+	}
+
+	pos := 0
+	for i := 0; i+1 < len(index); i += 2 {
+		start, _ := index[i].(int64)
+		count, _ := index[i+1].(int64)
+		for n := int64(0); n < count; n++ {
+			if pos+rowLen > len(data) {
+				return s.Dict, nil
+			}
+			row := data[pos : pos+rowLen]
+			pos += rowLen
+
+			typ := 1 // a zero-width type field defaults to 1
+			if widths[0] > 0 {
+				typ = int(readInt(row[:widths[0]]))
+			}
+			f2 := int(readInt(row[widths[0] : widths[0]+widths[1]]))
+			f3 := int(readInt(row[widths[0]+widths[1]:]))
+
+			num := int(start + n)
+			if _, ok := d.xref[num]; ok {
+				continue
+			}
+			switch typ {
+			case 1:
+				d.xref[num] = xrefEntry{kind: 1, offset: f2}
+			case 2:
+				d.xref[num] = xrefEntry{kind: 2, stream: f2, index: f3}
+			}
+		}
+	}
+	return s.Dict, nil
+}
+
+func readInt(b []byte) int64 {
+	var v int64
+	for _, c := range b {
+		v = v<<8 | int64(c)
+	}
+	return v
+}
+
+// directLength is used while the xref is not loaded yet: only a literal
+// /Length can be trusted, anything else falls back to scanning.
+func directLength(o Object) (int, bool) {
+	n, ok := o.(int64)
+	return int(n), ok
+}
+
+var objHeader = regexp.MustCompile(`(?m)(\d+)[ \t\r\n\f\x00]+(\d+)[ \t\r\n\f\x00]+obj\b`)
+
+// reconstruct rebuilds the xref by scanning for "num gen obj" headers. Later
+// definitions of an object number win, as they would after an update.
+func (d *Document) reconstruct() error {
+	for _, m := range objHeader.FindAllSubmatchIndex(d.data, -1) {
+		num, err := strconv.Atoi(string(d.data[m[2]:m[3]]))
+		if err != nil {
+			continue
+		}
+		d.xref[num] = xrefEntry{kind: 1, offset: m[0]}
+	}
+	if len(d.xref) == 0 {
+		return ErrMalformed
+	}
+
+	// Index the contents of object streams too, without overriding objects
+	// found directly in the file.
+	var nums []int
+	for num := range d.xref {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	for _, num := range nums {
+		s, ok := d.object(num).(*Stream)
+		if !ok || s.Dict.Name("Type") != "ObjStm" {
+			continue
+		}
+		os, err := d.objectStream(num)
+		if err != nil {
+			continue
+		}
+		for i, n := range os.nums {
+			if _, ok := d.xref[n]; !ok {
+				d.xref[n] = xrefEntry{kind: 2, stream: num, index: i}
+			}
+		}
+	}
+
+	for pos := len(d.data); ; {
+		idx := bytes.LastIndex(d.data[:pos], []byte("trailer"))
+		if idx < 0 {
+			break
+		}
+		l := lexer{data: d.data, pos: idx + len("trailer")}
+		if t, err := l.object(0); err == nil {
+			if t, ok := t.(Dict); ok {
+				for k, v := range t {
+					if _, ok := d.Trailer[k]; !ok {
+						d.Trailer[k] = v
+					}
+				}
+			}
+		}
+		pos = idx
+	}
+
+	if !d.hasCatalog() {
+		delete(d.Trailer, "Root")
+		d.Objects(func(ref Ref, o Object) {
+			if dict, ok := o.(Dict); ok && dict.Name("Type") == "Catalog" {
+				d.Trailer["Root"] = ref
+			}
+		})
+	}
+	// Cross-reference streams carry trailer keys in their dictionary.
+	if d.Trailer["Encrypt"] == nil {
+		for _, num := range nums {
+			if s, ok := d.object(num).(*Stream); ok && s.Dict.Name("Type") == "XRef" && s.Dict["Encrypt"] != nil {
+				d.Trailer["Encrypt"] = s.Dict["Encrypt"]
+			}
+		}
+	}
+	return nil
+}
+
+// Resolve follows indirect references until it reaches a direct object.
+// Missing objects resolve to nil, as the spec requires.
+func (d *Document) Resolve(o Object) Object {
+	for i := 0; i < 32; i++ {
+		r, ok := o.(Ref)
+		if !ok {
+			return o
+		}
+		o = d.object(r.Num)
+	}
+	return nil
+}
+
+func (d *Document) object(num int) Object {
+	if o, ok := d.cache[num]; ok {
+		return o
+	}
+	// Guard against objects whose /Length points back at themselves.
+	d.cache[num] = nil
+
+	var obj Object
+	e, ok := d.xref[num]
+	switch {
+	case !ok:
+	case e.kind == 1:
+		if e.offset < len(d.data) {
+			l := lexer{data: d.data, pos: e.offset}
+			if _, o, err := l.indirect(d.length); err == nil {
+				obj = o
+			}
+		}
+	case e.kind == 2:
+		if os, err := d.objectStream(e.stream); err == nil && e.index < len(os.offsets) {
+			l := lexer{data: os.data, pos: os.first + os.offsets[e.index]}
+			if o, err := l.object(0); err == nil {
+				obj = o
+			}
+		}
+	}
+	d.cache[num] = obj
+	return obj
+}
+
+func (d *Document) length(o Object) (int, bool) {
+	n, ok := d.Resolve(o).(int64)
+	return int(n), ok
+}
+
+func (d *Document) objectStream(num int) (*objectStream, error) {
+	if os, ok := d.objStms[num]; ok {
+		if os == nil {
+			return nil, ErrMalformed
+		}
+		return os, nil
+	}
+	d.objStms[num] = nil
+
+	s, ok := d.object(num).(*Stream)
+	if !ok {
+		return nil, ErrMalformed
+	}
+	data, err := d.Decode(s)
+	if err != nil {
+		return nil, err
+	}
+
+	os := &objectStream{data: data, first: s.Dict.Int("First")}
+	n := s.Dict.Int("N")
+	l := lexer{data: data}
+	for i := 0; i < n; i++ {
+		l.skipSpace()
+		objNum, err1 := strconv.Atoi(l.keyword())
+		l.skipSpace()
+		off, err2 := strconv.Atoi(l.keyword())
+		if err1 != nil || err2 != nil || os.first+off >= len(data) {
+			return nil, fmt.Errorf("pdf: bad object stream %d", num)
+		}
+		os.nums = append(os.nums, objNum)
+		os.offsets = append(os.offsets, off)
+	}
+	d.objStms[num] = os
+	return os, nil
+}
+
+// Objects calls fn for every object listed in the cross-reference data.
+func (d *Document) Objects(fn func(Ref, Object)) {
+	var nums []int
+	for num := range d.xref {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	for _, num := range nums {
+		if o := d.object(num); o != nil {
+			fn(Ref{Num: num}, o)
+		}
+	}
+}
+
+// Page is one leaf of the page tree. Dict has the inheritable attributes
+// (Resources, MediaBox, CropBox, Rotate) filled in from its ancestors.
+type Page struct {
+	Ref  Ref
+	Dict Dict
+}
+
+var inheritable = []Name{"Resources", "MediaBox", "CropBox", "Rotate"}
+
+// Pages returns the pages in document order.
+func (d *Document) Pages() ([]Page, error) {
+	root, _ := d.Resolve(d.Trailer["Root"]).(Dict)
+	var pages []Page
+	seen := map[Ref]bool{}
+
+	var walk func(node Object, inherited Dict, depth int) error
+	walk = func(node Object, inherited Dict, depth int) error {
+		ref, _ := node.(Ref)
+		if ref != (Ref{}) {
+			if seen[ref] {
+				return errors.New("pdf: page tree has a cycle")
+			}
+			seen[ref] = true
+		}
+		if depth > maxDepth {
+			return errors.New("pdf: page tree too deep")
+		}
+		dict, ok := d.Resolve(node).(Dict)
+		if !ok {
+			return ErrMalformed
+		}
+
+		attrs := Dict{}
+		for k, v := range inherited {
+			attrs[k] = v
+		}
+		for _, k := range inheritable {
+			if v, ok := dict[k]; ok {
+				attrs[k] = v
+			}
+		}
+
+		kids, isTree := d.Resolve(dict["Kids"]).(Array)
+		if !isTree || dict.Name("Type") == "Page" {
+			page := Dict{}
+			for k, v := range dict {
+				page[k] = v
+			}
+			for k, v := range attrs {
+				page[k] = v
+			}
+			pages = append(pages, Page{Ref: ref, Dict: page})
+			return nil
+		}
+		for _, kid := range kids {
+			if err := walk(kid, attrs, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := walk(root["Pages"], Dict{}, 0); err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
+
+// Encrypted reports whether the file uses the standard (or any) security
+// handler. Such files cannot be inspected or modified without the password.
+func (d *Document) Encrypted() bool {
+	return d.Trailer["Encrypt"] != nil
+}
+
+// HasJavaScript reports whether any object carries a JavaScript action or a
+// document-level JavaScript name tree.
+func (d *Document) HasJavaScript() bool {
+	found := false
+	d.Objects(func(_ Ref, o Object) {
+		if !found {
+			found = hasJavaScript(o, 0)
+		}
+	})
+	return found
+}
+
+func hasJavaScript(o Object, depth int) bool {
+	if depth > maxDepth {
+		return false
+	}
+	switch v := o.(type) {
+	case Dict:
+		for k, val := range v {
+			if k == "JS" || k == "JavaScript" {
+				return true
+			}
+			if k == "S" && val == Name("JavaScript") {
+				return true
+			}
+			if hasJavaScript(val, depth+1) {
+				return true
+			}
+		}
+	case *Stream:
+		return hasJavaScript(v.Dict, depth+1)
+	case Array:
+		for _, val := range v {
+			if hasJavaScript(val, depth+1) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,258 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// buildPDF lays out objects 1..n in order with a correct xref table. Each
+// entry is the body between "n 0 obj" and "endobj".
+func buildPDF(trailer string, objects ...string) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, o := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R %s >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, trailer, xref)
+	return b.Bytes()
+}
+
+func stream(dict, data string) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+func deflate(data string) string {
+	var b bytes.Buffer
+	w := zlib.NewWriter(&b)
+	w.Write([]byte(data))
+	w.Close()
+	return b.String()
+}
+
+// simplePDF has two pages: one with a single content stream and an
+// inherited MediaBox, one with an array of contents and its own CropBox.
+func simplePDF(trailer string, catalogExtra string) []byte {
+	return buildPDF(trailer,
+		"<< /Type /Catalog /Pages 2 0 R "+catalogExtra+" >>",
+		"<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 /MediaBox [0 0 595 842] /Resources << /Font << /F1 5 0 R >> >> >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 6 0 R >>",
+		"<< /Type /Page /Parent 2 0 R /CropBox [10 10 310 410] /Contents [6 0 R 7 0 R] >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Times-Roman >>",
+		stream("", "BT /F1 12 Tf 72 720 Td (Page) Tj ET"),
+		stream("", "0 0 m 100 100 l S"),
+	)
+}
+
+// xrefStreamPDF stores the page objects in a compressed object stream and
+// indexes them with a cross-reference stream, as PDF 1.5 writers do.
+func xrefStreamPDF() []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.5\n")
+	off1 := b.Len()
+	b.WriteString("1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+
+	inner := []string{
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 200 200] >>",
+	}
+	header := fmt.Sprintf("2 0 3 %d ", len(inner[0])+1)
+	body := header + inner[0] + " " + inner[1]
+	off4 := b.Len()
+	fmt.Fprintf(&b, "4 0 obj\n%s\nendobj\n", stream(fmt.Sprintf("/Type /ObjStm /N 2 /First %d /Filter /FlateDecode", len(header)), deflate(body)))
+
+	off5 := b.Len()
+	rows := []byte{
+		0, 0, 0, 0,
+		1, byte(off1 >> 8), byte(off1), 0,
+		2, 0, 4, 0,
+		2, 0, 4, 1,
+		1, byte(off4 >> 8), byte(off4), 0,
+		1, byte(off5 >> 8), byte(off5), 0,
+	}
+	fmt.Fprintf(&b, "5 0 obj\n%s\nendobj\n", stream("/Type /XRef /Size 6 /W [1 2 1] /Root 1 0 R /Filter /FlateDecode", deflate(string(rows))))
+	fmt.Fprintf(&b, "startxref\n%d\n%%%%EOF\n", off5)
+	return b.Bytes()
+}
+
+func TestOpen(t *testing.T) {
+	valid := simplePDF("", "")
+	xrefAt := bytes.LastIndex(valid, []byte("xref\n0"))
+
+	tests := []struct {
+		name       string
+		data       []byte
+		err        error
+		pages      int
+		encrypted  bool
+		javaScript bool
+	}{
+		{name: "valid", data: valid, pages: 2},
+		{name: "xref stream and object stream", data: xrefStreamPDF(), pages: 1},
+		{name: "not a PDF", data: []byte("PK\x03\x04 a zip file"), err: ErrNotPDF},
+		{name: "empty", data: nil, err: ErrNotPDF},
+		{name: "header only", data: []byte("%PDF-1.7\n"), err: ErrMalformed},
+
+		{name: "encrypted", data: simplePDF("/Encrypt 8 0 R", ""), pages: 2, encrypted: true},
+		{name: "encrypted, direct dictionary",
+			data: simplePDF("/Encrypt << /Filter /Standard /V 2 /R 3 >>", ""), pages: 2, encrypted: true},
+
+		{name: "OpenAction JavaScript", pages: 2, javaScript: true,
+			data: simplePDF("", "/OpenAction << /S /JavaScript /JS (app.alert(1)) >>")},
+		{name: "indirect OpenAction", pages: 1, javaScript: true,
+			data: buildPDF("", "<< /Type /Catalog /Pages 2 0 R /OpenAction 4 0 R >>",
+				"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+				"<< /Type /Page /Parent 2 0 R >>",
+				"<< /S /JavaScript /JS 5 0 R >>",
+				stream("", "app.alert(1)"))},
+		{name: "document JavaScript name tree", pages: 2, javaScript: true,
+			data: simplePDF("", "/Names << /JavaScript << /Names [(x) 9 0 R] >> >>")},
+		{name: "OpenAction without JavaScript", pages: 2,
+			data: simplePDF("", "/OpenAction [3 0 R /Fit]")},
+
+		{name: "startxref points past the end", pages: 2,
+			data: bytes.Replace(valid, []byte(fmt.Sprintf("startxref\n%d", xrefAt)), []byte("startxref\n999999"), 1)},
+		{name: "startxref points at garbage", pages: 2,
+			data: bytes.Replace(valid, []byte(fmt.Sprintf("startxref\n%d", xrefAt)), []byte("startxref\n20"), 1)},
+		{name: "no startxref", pages: 2,
+			data: bytes.Replace(valid, []byte("startxref"), []byte("startxre_"), 1)},
+		{name: "xref offsets shifted", pages: 2,
+			data: append([]byte("%PDF-1.4\n% junk inserted by a broken mailer\n"), valid[len("%PDF-1.4\n"):]...)},
+		{name: "xref entry count absurd", pages: 2,
+			data: bytes.Replace(valid, []byte("xref\n0 8\n"), []byte("xref\n0 99999999\n"), 1)},
+		{name: "Prev loop", pages: 2,
+			data: bytes.Replace(valid, []byte("/Size 8"), []byte(fmt.Sprintf("/Size 8 /Prev %d", xrefAt)), 1)},
+		{name: "no catalog anywhere", err: ErrMalformed,
+			data: buildPDF("", "(not a dictionary)", "<< /Type /Pages /Kids [] /Count 0 >>")},
+	}
+	for _, tt := range tests {
+		doc, err := Open(tt.data)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("%s: Open = %v, want %v", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Open: %v", tt.name, err)
+			continue
+		}
+		if pages, err := doc.Pages(); err != nil || len(pages) != tt.pages {
+			t.Errorf("%s: Pages = %d, %v; want %d", tt.name, len(pages), err, tt.pages)
+		}
+		if got := doc.Encrypted(); got != tt.encrypted {
+			t.Errorf("%s: Encrypted = %v, want %v", tt.name, got, tt.encrypted)
+		}
+		if got := doc.HasJavaScript(); got != tt.javaScript {
+			t.Errorf("%s: HasJavaScript = %v, want %v", tt.name, got, tt.javaScript)
+		}
+	}
+}
+
+// TestOpenTruncated cuts a file at every length; Open must either fail
+// cleanly or recover the objects that are still there, never panic.
+func TestOpenTruncated(t *testing.T) {
+	for _, data := range [][]byte{simplePDF("", ""), xrefStreamPDF()} {
+		for n := 0; n < len(data); n++ {
+			doc, err := Open(data[:n])
+			if err != nil {
+				continue
+			}
+			doc.Pages()
+			doc.HasJavaScript()
+			doc.Title()
+		}
+	}
+
+	// Cut inside the last content stream: the pages are still found.
+	data := simplePDF("", "")
+	cut := data[:bytes.Index(data, []byte("100 100 l"))]
+	doc, err := Open(cut)
+	if err != nil {
+		t.Fatalf("Open(truncated): %v", err)
+	}
+	if pages, err := doc.Pages(); err != nil || len(pages) != 2 {
+		t.Errorf("truncated Pages = %d, %v; want 2", len(pages), err)
+	}
+}
+
+func TestPagesInheritance(t *testing.T) {
+	doc, err := Open(simplePDF("", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, err := doc.Pages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pages[0].Ref != (Ref{Num: 3}) || pages[1].Ref != (Ref{Num: 4}) {
+		t.Errorf("page refs = %v %v", pages[0].Ref, pages[1].Ref)
+	}
+	if box, _ := pages[0].Dict["MediaBox"].(Array); len(box) != 4 || box[2] != int64(595) {
+		t.Errorf("inherited MediaBox = %v", pages[0].Dict["MediaBox"])
+	}
+	if _, ok := pages[1].Dict["Resources"].(Dict); !ok {
+		t.Errorf("inherited Resources = %v", pages[1].Dict["Resources"])
+	}
+}
+
+func TestPagesCycle(t *testing.T) {
+	data := buildPDF("",
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Pages /Kids [2 0 R] /Count 1 >>",
+	)
+	doc, err := Open(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := doc.Pages(); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("Pages = %v, want a cycle error", err)
+	}
+}
+
+func TestTitle(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"info dictionary", buildPDF("/Info 4 0 R",
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+			"<< /Type /Page /Parent 2 0 R >>",
+			"<< /Title (  Week 1: Intro  ) >>"), "Week 1: Intro"},
+		{"UTF-16 title", buildPDF("/Info 4 0 R",
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+			"<< /Type /Page /Parent 2 0 R >>",
+			"<< /Title <FEFF004D006F00640075006C> >>"), "Modul"},
+		{"XMP metadata", buildPDF("",
+			"<< /Type /Catalog /Pages 2 0 R /Metadata 4 0 R >>",
+			"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+			"<< /Type /Page /Parent 2 0 R >>",
+			stream("/Type /Metadata /Subtype /XML", `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"><rdf:Description xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:title><rdf:Alt><rdf:li xml:lang="x-default">From XMP</rdf:li></rdf:Alt></dc:title></rdf:Description></rdf:RDF></x:xmpmeta>`)),
+			"From XMP"},
+		{"none", simplePDF("", ""), ""},
+	}
+	for _, tt := range tests {
+		doc, err := Open(tt.data)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := doc.Title(); got != tt.want {
+			t.Errorf("%s: Title = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
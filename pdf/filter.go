@@ -0,0 +1,192 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxDecoded caps the output of a single stream so a small compressed
+// stream cannot expand into gigabytes.
+const maxDecoded = 64 << 20
+
+// ErrUnsupportedFilter is returned by Decode for image codecs and other
+// filters this package does not implement.
+var ErrUnsupportedFilter = errors.New("pdf: unsupported stream filter")
+
+// Decode applies the stream's filters and returns the decoded data.
+func (d *Document) Decode(s *Stream) ([]byte, error) {
+	var filters, params Array
+	switch f := d.Resolve(s.Dict["Filter"]).(type) {
+	case Name:
+		filters = Array{f}
+		params = Array{s.Dict["DecodeParms"]}
+	case Array:
+		filters = f
+		params, _ = d.Resolve(s.Dict["DecodeParms"]).(Array)
+	}
+
+	data := s.Data
+	for i, f := range filters {
+		var parms Dict
+		if i < len(params) {
+			parms, _ = d.Resolve(params[i]).(Dict)
+		}
+
+		var err error
+		switch d.Resolve(f) {
+		case Name("FlateDecode"), Name("Fl"):
+			data, err = inflate(data)
+			if err == nil {
+				data, err = unpredict(data, parms)
+			}
+		case Name("ASCIIHexDecode"), Name("AHx"):
+			data, err = asciiHex(data)
+		case Name("ASCII85Decode"), Name("A85"):
+			data, err = ascii85Decode(data)
+		default:
+			return nil, fmt.Errorf("%w: %v", ErrUnsupportedFilter, f)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+func inflate(data []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	out, err := io.ReadAll(io.LimitReader(zr, maxDecoded+1))
+	if len(out) > maxDecoded {
+		return nil, errors.New("pdf: stream too large")
+	}
+	// Truncated streams and bad checksums are common; keep what decoded.
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+	return out, nil
+}
+
+func asciiHex(data []byte) ([]byte, error) {
+	var digits []byte
+	for _, c := range data {
+		if c == '>' {
+			break
+		}
+		if !isWhite(c) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	return hex.DecodeString(string(digits))
+}
+
+func ascii85Decode(data []byte) ([]byte, error) {
+	data = bytes.TrimSpace(data)
+	data = bytes.TrimPrefix(data, []byte("<~"))
+	if i := bytes.Index(data, []byte("~>")); i >= 0 {
+		data = data[:i]
+	}
+	out := make([]byte, 4*len(data)/5+4)
+	n, _, err := ascii85.Decode(out, data, true)
+	if err != nil {
+		return nil, err
+	}
+	return out[:n], nil
+}
+
+// unpredict reverses the TIFF and PNG predictors of Flate-encoded streams.
+func unpredict(data []byte, parms Dict) ([]byte, error) {
+	predictor := parms.Int("Predictor")
+	if predictor <= 1 {
+		return data, nil
+	}
+
+	colors, bpc, columns := 1, 8, 1
+	if parms["Colors"] != nil {
+		colors = parms.Int("Colors")
+	}
+	if parms["BitsPerComponent"] != nil {
+		bpc = parms.Int("BitsPerComponent")
+	}
+	if parms["Columns"] != nil {
+		columns = parms.Int("Columns")
+	}
+	if colors < 1 || bpc < 1 || columns < 1 || colors*bpc*columns > 1<<24 {
+		return nil, errors.New("pdf: bad predictor parameters")
+	}
+	bpp := (colors*bpc + 7) / 8
+	rowLen := (colors*bpc*columns + 7) / 8
+
+	if predictor == 2 {
+		if bpc != 8 {
+			return nil, fmt.Errorf("%w: TIFF predictor with %d bits", ErrUnsupportedFilter, bpc)
+		}
+		out := append([]byte(nil), data...)
+		for row := 0; row+rowLen <= len(out); row += rowLen {
+			for i := bpp; i < rowLen; i++ {
+				out[row+i] += out[row+i-bpp]
+			}
+		}
+		return out, nil
+	}
+
+	// PNG predictors: every row starts with its own filter type byte.
+	var out []byte
+	prev := make([]byte, rowLen)
+	for pos := 0; pos+1+rowLen <= len(data); pos += 1 + rowLen {
+		typ := data[pos]
+		cur := append([]byte(nil), data[pos+1:pos+1+rowLen]...)
+		for i := range cur {
+			var left, upLeft byte
+			if i >= bpp {
+				left = cur[i-bpp]
+				upLeft = prev[i-bpp]
+			}
+			up := prev[i]
+			switch typ {
+			case 1:
+				cur[i] += left
+			case 2:
+				cur[i] += up
+			case 3:
+				cur[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				cur[i] += paeth(left, up, upLeft)
+			}
+		}
+		out = append(out, cur...)
+		prev = cur
+	}
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,124 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Info returns an entry of the document information dictionary, such as
+// "Title" or "Author", as plain text. Missing entries are "".
+func (d *Document) Info(key Name) string {
+	info, ok := d.Resolve(d.Trailer["Info"]).(Dict)
+	if !ok {
+		return ""
+	}
+	s, ok := d.Resolve(info[key]).(String)
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(TextString(s))
+}
+
+// Title returns the document title from the information dictionary, or
+// from the XMP metadata (dc:title) when the dictionary has none.
+func (d *Document) Title() string {
+	if t := d.Info("Title"); t != "" {
+		return t
+	}
+	root, ok := d.Resolve(d.Trailer["Root"]).(Dict)
+	if !ok {
+		return ""
+	}
+	meta, ok := d.Resolve(root["Metadata"]).(*Stream)
+	if !ok {
+		return ""
+	}
+	data, err := d.Decode(meta)
+	if err != nil {
+		return ""
+	}
+	return xmpTitle(data)
+}
+
+// xmpTitle returns the first dc:title entry of an XMP packet.
+func xmpTitle(data []byte) string {
+	const dc = "http://purl.org/dc/elements/1.1/"
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+	inTitle := false
+	var text strings.Builder
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return ""
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Space == dc && t.Name.Local == "title" {
+				inTitle = true
+			}
+		case xml.CharData:
+			if inTitle {
+				text.Write(t)
+			}
+		case xml.EndElement:
+			if inTitle && (t.Name.Local == "li" || t.Name.Local == "title") {
+				if s := strings.TrimSpace(text.String()); s != "" {
+					return clean(s)
+				}
+			}
+			if t.Name.Space == dc && t.Name.Local == "title" {
+				return ""
+			}
+		}
+	}
+}
+
+// TextString decodes a PDF text string: UTF-16BE or UTF-8 when it starts
+// with a byte order mark, PDFDocEncoding otherwise.
+func TextString(s String) string {
+	b := []byte(s)
+	switch {
+	case len(b) >= 2 && b[0] == 0xfe && b[1] == 0xff:
+		b = b[2:]
+		units := make([]uint16, 0, len(b)/2)
+		for i := 0; i+1 < len(b); i += 2 {
+			units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+		}
+		return clean(string(utf16.Decode(units)))
+	case len(b) >= 3 && b[0] == 0xef && b[1] == 0xbb && b[2] == 0xbf:
+		return clean(strings.ToValidUTF8(string(b[3:]), "�"))
+	}
+
+	var sb strings.Builder
+	for _, c := range b {
+		if r, ok := pdfDocEncoding[c]; ok {
+			sb.WriteRune(r)
+		} else {
+			sb.WriteRune(rune(c)) // Latin-1 for the rest
+		}
+	}
+	return clean(sb.String())
+}
+
+// clean drops control characters (e.g. language escape sequences).
+func clean(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\t' && r != '\n' || r == 0x7f || r == utf8.RuneError {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// pdfDocEncoding lists where PDFDocEncoding differs from Latin-1.
+var pdfDocEncoding = map[byte]rune{
+	0x18: '˘', 0x19: 'ˇ', 0x1a: 'ˆ', 0x1b: '˙', 0x1c: '˝', 0x1d: '˛', 0x1e: '˚', 0x1f: '˜',
+	0x80: '•', 0x81: '†', 0x82: '‡', 0x83: '…', 0x84: '—', 0x85: '–', 0x86: 'ƒ', 0x87: '⁄',
+	0x88: '‹', 0x89: '›', 0x8a: '−', 0x8b: '‰', 0x8c: '„', 0x8d: '“', 0x8e: '”', 0x8f: '‘',
+	0x90: '’', 0x91: '‚', 0x92: '™', 0x93: 'ﬁ', 0x94: 'ﬂ', 0x95: 'Ł', 0x96: 'Œ', 0x97: 'Š',
+	0x98: 'Ÿ', 0x99: 'Ž', 0x9a: 'ı', 0x9b: 'ł', 0x9c: 'œ', 0x9d: 'š', 0x9e: 'ž', 0xa0: '€',
+}
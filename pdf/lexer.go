@@ -0,0 +1,323 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// maxDepth bounds nesting of arrays and dictionaries so crafted files cannot
+// exhaust the stack.
+const maxDepth = 256
+
+var errSyntax = errors.New("pdf: syntax error")
+
+type lexer struct {
+	data []byte
+	pos  int
+}
+
+func isWhite(c byte) bool {
+	return c == 0 || c == '\t' || c == '\n' || c == '\f' || c == '\r' || c == ' '
+}
+
+func isDelim(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if isWhite(c) {
+			l.pos++
+			continue
+		}
+		if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		return
+	}
+}
+
+// keyword reads a run of regular characters (numbers, true, obj, R, ...).
+func (l *lexer) keyword() string {
+	start := l.pos
+	for l.pos < len(l.data) && !isWhite(l.data[l.pos]) && !isDelim(l.data[l.pos]) {
+		l.pos++
+	}
+	return string(l.data[start:l.pos])
+}
+
+func (l *lexer) peekKeyword() string {
+	save := l.pos
+	l.skipSpace()
+	kw := l.keyword()
+	l.pos = save
+	return kw
+}
+
+// object parses one direct object. Indirect references are returned as Ref.
+func (l *lexer) object(depth int) (Object, error) {
+	if depth > maxDepth {
+		return nil, errors.New("pdf: nesting too deep")
+	}
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, errSyntax
+	}
+
+	switch c := l.data[l.pos]; c {
+	case '/':
+		l.pos++
+		return l.name(), nil
+	case '(':
+		l.pos++
+		return l.literalString()
+	case '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			return l.dict(depth)
+		}
+		l.pos++
+		return l.hexString()
+	case '[':
+		l.pos++
+		var arr Array
+		for {
+			l.skipSpace()
+			if l.pos >= len(l.data) {
+				return nil, errSyntax
+			}
+			if l.data[l.pos] == ']' {
+				l.pos++
+				return arr, nil
+			}
+			v, err := l.object(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+	}
+
+	kw := l.keyword()
+	switch kw {
+	case "":
+		return nil, fmt.Errorf("pdf: unexpected %q at %d", l.data[l.pos], l.pos)
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+
+	if i, err := strconv.ParseInt(kw, 10, 64); err == nil {
+		// "num gen R" is a reference; anything else is a plain integer.
+		save := l.pos
+		l.skipSpace()
+		if gen, err := strconv.Atoi(l.keyword()); err == nil {
+			l.skipSpace()
+			if l.keyword() == "R" {
+				return Ref{Num: int(i), Gen: gen}, nil
+			}
+		}
+		l.pos = save
+		return i, nil
+	}
+	if f, err := strconv.ParseFloat(kw, 64); err == nil {
+		return f, nil
+	}
+	return nil, fmt.Errorf("pdf: unexpected keyword %q at %d", kw, l.pos)
+}
+
+func (l *lexer) name() Name {
+	var buf []byte
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if isWhite(c) || isDelim(c) {
+			break
+		}
+		if c == '#' && l.pos+2 < len(l.data) {
+			if b, err := hex.DecodeString(string(l.data[l.pos+1 : l.pos+3])); err == nil {
+				buf = append(buf, b[0])
+				l.pos += 3
+				continue
+			}
+		}
+		buf = append(buf, c)
+		l.pos++
+	}
+	return Name(buf)
+}
+
+func (l *lexer) literalString() (String, error) {
+	var buf []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return String(buf), nil
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return nil, errSyntax
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for k := 0; k < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; k++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		buf = append(buf, c)
+	}
+	return nil, errSyntax
+}
+
+func (l *lexer) hexString() (String, error) {
+	var digits []byte
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		if c == '>' {
+			if len(digits)%2 == 1 {
+				digits = append(digits, '0')
+			}
+			b, err := hex.DecodeString(string(digits))
+			if err != nil {
+				return nil, errSyntax
+			}
+			return String(b), nil
+		}
+		if !isWhite(c) {
+			digits = append(digits, c)
+		}
+	}
+	return nil, errSyntax
+}
+
+func (l *lexer) dict(depth int) (Dict, error) {
+	d := Dict{}
+	for {
+		l.skipSpace()
+		if l.pos+1 >= len(l.data) {
+			return nil, errSyntax
+		}
+		if l.data[l.pos] == '>' && l.data[l.pos+1] == '>' {
+			l.pos += 2
+			return d, nil
+		}
+		if l.data[l.pos] != '/' {
+			return nil, fmt.Errorf("pdf: expected name key at %d", l.pos)
+		}
+		l.pos++
+		key := l.name()
+		v, err := l.object(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		d[key] = v
+	}
+}
+
+// indirect parses "num gen obj ... endobj" at the lexer position. When the
+// object is a stream, length resolves an indirect /Length.
+func (l *lexer) indirect(length func(Object) (int, bool)) (Ref, Object, error) {
+	l.skipSpace()
+	num, err1 := strconv.Atoi(l.keyword())
+	l.skipSpace()
+	gen, err2 := strconv.Atoi(l.keyword())
+	l.skipSpace()
+	if err1 != nil || err2 != nil || l.keyword() != "obj" {
+		return Ref{}, nil, fmt.Errorf("pdf: no object header at %d", l.pos)
+	}
+	ref := Ref{Num: num, Gen: gen}
+
+	obj, err := l.object(0)
+	if err != nil {
+		return ref, nil, err
+	}
+
+	d, ok := obj.(Dict)
+	if !ok || l.peekKeyword() != "stream" {
+		return ref, obj, nil
+	}
+
+	l.skipSpace()
+	l.keyword() // "stream"
+	// The keyword is followed by CRLF or LF (some writers emit a bare CR).
+	if l.pos < len(l.data) && l.data[l.pos] == '\r' {
+		l.pos++
+	}
+	if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+		l.pos++
+	}
+	start := l.pos
+
+	end := -1
+	if n, ok := length(d["Length"]); ok && n >= 0 && start+n <= len(l.data) {
+		rest := l.data[start+n:]
+		trimmed := bytes.TrimLeft(rest, "\r\n \t")
+		if bytes.HasPrefix(trimmed, []byte("endstream")) {
+			end = start + n
+		}
+	}
+	if end < 0 {
+		// Wrong or missing /Length: fall back to the endstream keyword.
+		idx := bytes.Index(l.data[start:], []byte("endstream"))
+		if idx < 0 {
+			return ref, nil, errors.New("pdf: unterminated stream")
+		}
+		end = start + idx
+		for end > start && (l.data[end-1] == '\n' || l.data[end-1] == '\r') {
+			end--
+		}
+	}
+
+	l.pos = end
+	l.skipSpace()
+	l.keyword() // "endstream"
+	return ref, &Stream{Dict: d, Data: l.data[start:end]}, nil
+}
@@ -0,0 +1,117 @@
+package pdf
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLexerObject(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Object
+	}{
+		{"42", int64(42)},
+		{"-7", int64(-7)},
+		{"3.25", 3.25},
+		{".5", 0.5},
+		{"true", true},
+		{"false", false},
+		{"null", nil},
+		{"/Type", Name("Type")},
+		{"/A#20B", Name("A B")},
+		{"/A#zz", Name("A#zz")},
+		{"(hello)", String("hello")},
+		{`(a \(b\) c)`, String("a (b) c")},
+		{"(nested (parens) ok)", String("nested (parens) ok")},
+		{`(\101\102C)`, String("ABC")},
+		{`(line\nbreak\t)`, String("line\nbreak\t")},
+		{"(split \\\r\nline)", String("split line")},
+		{"<48656C6C6F>", String("Hello")},
+		{"<48 65 6c\n6c 6f>", String("Hello")},
+		{"<4>", String("\x40")},
+		{"<>", String("")},
+		{"12 0 R", Ref{Num: 12}},
+		{"12 0 obj", int64(12)},
+		{"[1 2 0 R 3.5 /N (s) null]", Array{int64(1), Ref{Num: 2}, 3.5, Name("N"), String("s"), nil}},
+		{"[]", Array(nil)},
+		{"<< /A 1 /B [/C] /D << /E (f) >> >>", Dict{"A": int64(1), "B": Array{Name("C")}, "D": Dict{"E": String("f")}}},
+		{"<<>>", Dict{}},
+		{"% comment\n/After", Name("After")},
+	}
+	for _, tt := range tests {
+		l := lexer{data: []byte(tt.in)}
+		got, err := l.object(0)
+		if err != nil {
+			t.Errorf("object(%q): %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("object(%q) = %#v, want %#v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLexerObjectErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"   % only a comment",
+		"(unterminated",
+		`(ends in escape\`,
+		"<48656C",
+		"<zz>",
+		"[1 2",
+		"<< /A 1",
+		"<< /A >>",
+		"<< 1 2 >>",
+		"]",
+		"endobj",
+		strings.Repeat("[", maxDepth+2) + strings.Repeat("]", maxDepth+2),
+		strings.Repeat("<</A ", maxDepth+2),
+	}
+	for _, in := range tests {
+		l := lexer{data: []byte(in)}
+		if got, err := l.object(0); err == nil {
+			t.Errorf("object(%q) = %#v, want an error", in, got)
+		}
+	}
+}
+
+func TestLexerIndirect(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    Object
+		wantErr bool
+	}{
+		{name: "plain", in: "7 0 obj (seven) endobj", want: String("seven")},
+		{name: "stream", in: "7 0 obj << /Length 5 >>\nstream\nhello\nendstream endobj",
+			want: &Stream{Dict: Dict{"Length": int64(5)}, Data: []byte("hello")}},
+		{name: "crlf stream", in: "7 0 obj << /Length 5 >>\r\nstream\r\nhello\r\nendstream endobj",
+			want: &Stream{Dict: Dict{"Length": int64(5)}, Data: []byte("hello")}},
+		{name: "wrong length", in: "7 0 obj << /Length 99 >>\nstream\nhello\nendstream endobj",
+			want: &Stream{Dict: Dict{"Length": int64(99)}, Data: []byte("hello")}},
+		{name: "indirect length", in: "7 0 obj << /Length 8 0 R >>\nstream\nhello\nendstream endobj",
+			want: &Stream{Dict: Dict{"Length": Ref{Num: 8}}, Data: []byte("hello")}},
+		{name: "unterminated stream", in: "7 0 obj << /Length 99 >>\nstream\nhello", wantErr: true},
+		{name: "no header", in: "7 obj (seven) endobj", wantErr: true},
+		{name: "truncated body", in: "7 0 obj << /A (b", wantErr: true},
+	}
+	for _, tt := range tests {
+		l := lexer{data: []byte(tt.in)}
+		ref, got, err := l.indirect(directLength)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: indirect = %#v, want an error", tt.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if ref != (Ref{Num: 7}) || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: indirect = %v %#v, want %#v", tt.name, ref, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+// Package pdf reads just enough of the PDF file format for the checks and
+// metadata the upload pipeline needs: cross-reference tables and streams,
+// object streams and the page tree. It does not render anything.
+package pdf
+
+import "fmt"
+
+// Object is any PDF value: nil (null), bool, int64, float64, String, Name,
+// Array, Dict, Stream or Ref.
+type Object interface{}
+
+type Name string
+
+type String []byte
+
+type Array []Object
+
+type Dict map[Name]Object
+
+// Ref is an indirect reference ("12 0 R").
+type Ref struct {
+	Num int
+	Gen int
+}
+
+func (r Ref) String() string {
+	return fmt.Sprintf("%d %d R", r.Num, r.Gen)
+}
+
+// Stream keeps its data exactly as stored in the file, still encoded with
+// the filters named in its dictionary.
+type Stream struct {
+	Dict Dict
+	Data []byte
+}
+
+// Name returns d[key] if it is a name, or "".
+func (d Dict) Name(key Name) Name {
+	n, _ := d[key].(Name)
+	return n
+}
+
+// Int returns d[key] as an integer, or 0.
+func (d Dict) Int(key Name) int {
+	switch v := d[key].(type) {
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	return 0
+}
@@ -0,0 +1,201 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Stamp is text drawn over every page, e.g. to watermark a download.
+type Stamp struct {
+	Diagonal []string // large lines across the middle of the page
+	Footer   string   // one small line along the bottom edge
+	Opacity  float64  // 0..1; 0 means the default of 0.18
+}
+
+// Resource names used for the stamp. They are added next to the page's own
+// resources, so they must not clash with names producers commonly use.
+const (
+	stampFont  = Name("WMStampFont")
+	stampState = Name("WMStampGS")
+)
+
+// ApplyStamp adds s to every page. The page's own content is wrapped in q/Q
+// so whatever graphics state it leaves behind does not affect the stamp.
+func (d *Document) ApplyStamp(s Stamp) error {
+	pages, err := d.Pages()
+	if err != nil {
+		return err
+	}
+	if len(pages) == 0 {
+		return errors.New("pdf: document has no pages")
+	}
+
+	opacity := s.Opacity
+	if opacity <= 0 || opacity > 1 {
+		opacity = 0.18
+	}
+	font := d.Add(Dict{
+		"Type":     Name("Font"),
+		"Subtype":  Name("Type1"),
+		"BaseFont": Name("Helvetica"),
+		"Encoding": Name("WinAnsiEncoding"),
+	})
+	state := d.Add(Dict{"Type": Name("ExtGState"), "ca": opacity, "CA": opacity})
+	save := d.Add(&Stream{Dict: Dict{}, Data: []byte("q\n")})
+
+	for _, page := range pages {
+		if page.Ref == (Ref{}) {
+			continue // pages must be indirect objects; skip malformed ones
+		}
+
+		resources := Dict{}
+		if r, ok := d.Resolve(page.Dict["Resources"]).(Dict); ok {
+			for k, v := range r {
+				resources[k] = v
+			}
+		}
+		resources["Font"] = withEntry(d.Resolve(resources["Font"]), stampFont, font)
+		resources["ExtGState"] = withEntry(d.Resolve(resources["ExtGState"]), stampState, state)
+
+		contents := Array{save}
+		switch c := d.Resolve(page.Dict["Contents"]).(type) {
+		case Array:
+			contents = append(contents, c...)
+		case *Stream:
+			contents = append(contents, page.Dict["Contents"])
+		}
+		contents = append(contents, d.Add(&Stream{Dict: Dict{}, Data: stampContent(s, pageBox(d, page.Dict))}))
+
+		dict := Dict{}
+		for k, v := range page.Dict {
+			dict[k] = v
+		}
+		dict["Resources"] = resources
+		dict["Contents"] = contents
+		d.Set(page.Ref.Num, dict)
+	}
+	return nil
+}
+
+func withEntry(o Object, key Name, value Object) Dict {
+	out := Dict{}
+	if dict, ok := o.(Dict); ok {
+		for k, v := range dict {
+			out[k] = v
+		}
+	}
+	out[key] = value
+	return out
+}
+
+// pageBox returns the visible area: the CropBox, else the MediaBox, else
+// US Letter.
+func pageBox(d *Document, page Dict) [4]float64 {
+	for _, key := range []Name{"CropBox", "MediaBox"} {
+		arr, ok := d.Resolve(page[key]).(Array)
+		if !ok || len(arr) != 4 {
+			continue
+		}
+		var box [4]float64
+		valid := true
+		for i, v := range arr {
+			switch n := d.Resolve(v).(type) {
+			case int64:
+				box[i] = float64(n)
+			case float64:
+				box[i] = n
+			default:
+				valid = false
+			}
+		}
+		if valid && box[2] != box[0] && box[3] != box[1] {
+			return [4]float64{
+				math.Min(box[0], box[2]), math.Min(box[1], box[3]),
+				math.Max(box[0], box[2]), math.Max(box[1], box[3]),
+			}
+		}
+	}
+	return [4]float64{0, 0, 612, 792}
+}
+
+func stampContent(s Stamp, box [4]float64) []byte {
+	var b bytes.Buffer
+	w, h := box[2]-box[0], box[3]-box[1]
+	cx, cy := box[0]+w/2, box[1]+h/2
+
+	b.WriteString("Q\nq\n")
+	fmt.Fprintf(&b, "/%s gs\n0.45 g\n", stampState)
+
+	// Size the diagonal lines so the longest spans about 70% of the diagonal.
+	angle := math.Atan2(h, w)
+	cos, sin := math.Cos(angle), math.Sin(angle)
+	longest := 0.0
+	for _, line := range s.Diagonal {
+		longest = math.Max(longest, textWidth(line))
+	}
+	if longest > 0 {
+		size := math.Min(0.7*math.Hypot(w, h)/longest, 48)
+		lineHeight := size * 1.25
+		top := lineHeight * float64(len(s.Diagonal)-1) / 2
+		for i, line := range s.Diagonal {
+			// Offset each line perpendicular to the baseline, then centre it.
+			off := top - float64(i)*lineHeight - size*0.35
+			half := textWidth(line) * size / 2
+			x := cx - half*cos - off*sin
+			y := cy - half*sin + off*cos
+			fmt.Fprintf(&b, "BT /%s %.2f Tf %.4f %.4f %.4f %.4f %.2f %.2f Tm %s Tj ET\n",
+				stampFont, size, cos, sin, -sin, cos, x, y, encodeString(winAnsi(line)))
+		}
+	}
+
+	if s.Footer != "" {
+		size := math.Min(8, 0.9*w/math.Max(textWidth(s.Footer), 1))
+		fmt.Fprintf(&b, "/%s gs 0.3 g\n", stampState)
+		fmt.Fprintf(&b, "BT /%s %.2f Tf 1 0 0 1 %.2f %.2f Tm %s Tj ET\n",
+			stampFont, size, box[0]+w*0.05, box[1]+12, encodeString(winAnsi(s.Footer)))
+	}
+
+	b.WriteString("Q\n")
+	return b.Bytes()
+}
+
+// winAnsi converts text for the WinAnsiEncoding of the standard fonts.
+// Latin-1 maps directly; anything else becomes "?".
+func winAnsi(s string) String {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r >= 0x20 && r < 0x7f, r >= 0xa0 && r <= 0xff:
+			out = append(out, byte(r))
+		default:
+			out = append(out, '?')
+		}
+	}
+	return String(out)
+}
+
+// helveticaWidths are the glyph widths of Helvetica for ASCII 32..126, in
+// thousandths of the font size.
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// textWidth is the width of s in Helvetica at size 1.
+func textWidth(s string) float64 {
+	total := 0
+	for _, c := range winAnsi(s) {
+		if c >= 32 && c < 127 {
+			total += helveticaWidths[c-32]
+		} else {
+			total += 556
+		}
+	}
+	return float64(total) / 1000
+}
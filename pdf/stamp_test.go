@@ -0,0 +1,132 @@
+package pdf
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestApplyStampRoundTrip stamps a file, writes it and checks the result
+// the way the download watermark does.
+func TestApplyStampRoundTrip(t *testing.T) {
+	doc, err := Open(simplePDF("", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = doc.ApplyStamp(Stamp{
+		Diagonal: []string{"Budi (Santoso)", "budi@example.com"},
+		Footer:   "Downloaded by Budi on 2026-01-02 03:04 UTC",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := doc.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	stamped, err := Open(out.Bytes())
+	if err != nil {
+		t.Fatalf("reopening stamped file: %v", err)
+	}
+	if stamped.Encrypted() || stamped.HasJavaScript() {
+		t.Error("stamped file looks encrypted or scripted")
+	}
+	pages, err := stamped.Pages()
+	if err != nil || len(pages) != 2 {
+		t.Fatalf("stamped Pages = %d, %v", len(pages), err)
+	}
+
+	wantContents := []int{3, 4} // q, original streams, stamp
+	for i, page := range pages {
+		contents, ok := stamped.Resolve(page.Dict["Contents"]).(Array)
+		if !ok || len(contents) != wantContents[i] {
+			t.Errorf("page %d: Contents = %v", i+1, page.Dict["Contents"])
+			continue
+		}
+		first, _ := stamped.Resolve(contents[0]).(*Stream)
+		last, _ := stamped.Resolve(contents[len(contents)-1]).(*Stream)
+		if first == nil || string(first.Data) != "q\n" {
+			t.Errorf("page %d: first content stream = %#v, want q", i+1, first)
+		}
+		if last == nil {
+			t.Errorf("page %d: no stamp stream", i+1)
+			continue
+		}
+		text := string(last.Data)
+		for _, want := range []string{"Q\nq\n", "/WMStampGS gs", "/WMStampFont", `(Budi \(Santoso\))`, "(budi@example.com)", "(Downloaded by Budi"} {
+			if !strings.Contains(text, want) {
+				t.Errorf("page %d: stamp missing %q in %q", i+1, want, text)
+			}
+		}
+		if !strings.HasSuffix(text, "Q\n") {
+			t.Errorf("page %d: stamp does not restore the graphics state", i+1)
+		}
+
+		resources, _ := stamped.Resolve(page.Dict["Resources"]).(Dict)
+		fonts, _ := stamped.Resolve(resources["Font"]).(Dict)
+		states, _ := stamped.Resolve(resources["ExtGState"]).(Dict)
+		if fonts["F1"] == nil || fonts[stampFont] == nil {
+			t.Errorf("page %d: fonts = %v, want the page's F1 and the stamp font", i+1, fonts)
+		}
+		state, _ := stamped.Resolve(states[stampState]).(Dict)
+		if state["ca"] != 0.18 {
+			t.Errorf("page %d: stamp opacity = %v, want default 0.18", i+1, state["ca"])
+		}
+	}
+}
+
+func TestApplyStampNoPages(t *testing.T) {
+	doc, err := Open(buildPDF("",
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [] /Count 0 >>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.ApplyStamp(Stamp{Footer: "x"}); err == nil {
+		t.Error("ApplyStamp on a document without pages succeeded")
+	}
+}
+
+func TestPageBox(t *testing.T) {
+	doc, err := Open(simplePDF("", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		page Dict
+		want [4]float64
+	}{
+		{"media box", Dict{"MediaBox": Array{int64(0), int64(0), int64(595), int64(842)}}, [4]float64{0, 0, 595, 842}},
+		{"crop box wins", Dict{"MediaBox": Array{int64(0), int64(0), int64(595), int64(842)}, "CropBox": Array{10.5, int64(20), int64(300), int64(400)}}, [4]float64{10.5, 20, 300, 400}},
+		{"reversed corners", Dict{"MediaBox": Array{int64(612), int64(792), int64(0), int64(0)}}, [4]float64{0, 0, 612, 792}},
+		{"empty box falls back", Dict{"MediaBox": Array{int64(0), int64(0), int64(0), int64(0)}}, [4]float64{0, 0, 612, 792}},
+		{"bad box falls back", Dict{"MediaBox": Array{Name("A"), int64(0), int64(1), int64(1)}}, [4]float64{0, 0, 612, 792}},
+		{"no box", Dict{}, [4]float64{0, 0, 612, 792}},
+	}
+	for _, tt := range tests {
+		if got := pageBox(doc, tt.page); got != tt.want {
+			t.Errorf("%s: pageBox = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWinAnsi(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"plain ASCII", "plain ASCII"},
+		{"Zoë Müller", "Zo\xeb M\xfcller"},
+		{"tab\there", "tab?here"},
+		{"check ✓ 日本", "check ? ??"},
+	}
+	for _, tt := range tests {
+		if got := string(winAnsi(tt.in)); got != tt.want {
+			t.Errorf("winAnsi(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	if textWidth("ii") >= textWidth("WW") {
+		t.Error("textWidth does not follow the Helvetica metrics")
+	}
+}
@@ -0,0 +1,226 @@
+package pdf
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// Set replaces object num in the output of Write.
+func (d *Document) Set(num int, obj Object) {
+	if d.changed == nil {
+		d.changed = map[int]Object{}
+	}
+	d.changed[num] = obj
+	d.cache[num] = obj
+}
+
+// Add adds a new object to the output of Write and returns its reference.
+func (d *Document) Add(obj Object) Ref {
+	num := 1
+	for n := range d.xref {
+		if n >= num {
+			num = n + 1
+		}
+	}
+	for n := range d.changed {
+		if n >= num {
+			num = n + 1
+		}
+	}
+	d.Set(num, obj)
+	return Ref{Num: num}
+}
+
+// Write saves the document as a new file containing every object, with the
+// changes made through Set and Add. Unlike an incremental update, the old
+// versions of changed objects are not kept. Object and cross-reference
+// streams are not copied; their contents are written as plain objects.
+func (d *Document) Write(w io.Writer) error {
+	if d.Encrypted() {
+		return errors.New("pdf: cannot rewrite an encrypted file")
+	}
+
+	nums := map[int]bool{}
+	for n := range d.xref {
+		nums[n] = true
+	}
+	for n := range d.changed {
+		nums[n] = true
+	}
+	var order []int
+	for n := range nums {
+		if n > 0 {
+			order = append(order, n)
+		}
+	}
+	sort.Ints(order)
+
+	bw := bufio.NewWriter(w)
+	cw := &countingWriter{w: bw}
+	version := d.Version
+	if version < "1.4" {
+		version = "1.4" // transparency, which stamps rely on
+	}
+	fmt.Fprintf(cw, "%%PDF-%s\n%%\xe2\xe3\xcf\xd3\n", version)
+
+	offsets := map[int]int64{}
+	size := 1
+	for _, num := range order {
+		obj := d.object(num)
+		if obj == nil {
+			continue
+		}
+		if s, ok := obj.(*Stream); ok {
+			if t := s.Dict.Name("Type"); t == "XRef" || t == "ObjStm" {
+				continue
+			}
+		}
+		offsets[num] = cw.n
+		fmt.Fprintf(cw, "%d 0 obj\n", num)
+		writeObject(cw, obj, true)
+		cw.WriteString("\nendobj\n")
+		if num+1 > size {
+			size = num + 1
+		}
+	}
+
+	xrefAt := cw.n
+	fmt.Fprintf(cw, "xref\n0 %d\n0000000000 65535 f \n", size)
+	for num := 1; num < size; num++ {
+		if off, ok := offsets[num]; ok {
+			fmt.Fprintf(cw, "%010d 00000 n \n", off)
+		} else {
+			cw.WriteString("0000000000 00000 f \n")
+		}
+	}
+
+	trailer := Dict{"Size": int64(size), "Root": d.Trailer["Root"]}
+	for _, k := range []Name{"Info", "ID"} {
+		if v, ok := d.Trailer[k]; ok {
+			trailer[k] = v
+		}
+	}
+	cw.WriteString("trailer\n")
+	writeObject(cw, trailer, false)
+	fmt.Fprintf(cw, "\nstartxref\n%d\n%%%%EOF\n", xrefAt)
+
+	if cw.err != nil {
+		return cw.err
+	}
+	return bw.Flush()
+}
+
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
+
+func (c *countingWriter) WriteString(s string) {
+	c.Write([]byte(s))
+}
+
+// writeObject serializes o. Streams are only allowed at the top level of an
+// indirect object; their /Length is rewritten to match the data.
+func writeObject(w *countingWriter, o Object, top bool) {
+	switch v := o.(type) {
+	case nil:
+		w.WriteString("null")
+	case bool:
+		w.WriteString(strconv.FormatBool(v))
+	case int64:
+		w.WriteString(strconv.FormatInt(v, 10))
+	case int:
+		w.WriteString(strconv.Itoa(v))
+	case float64:
+		w.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+	case Name:
+		w.WriteString(encodeName(v))
+	case String:
+		w.WriteString(encodeString(v))
+	case Ref:
+		fmt.Fprintf(w, "%d 0 R", v.Num)
+	case Array:
+		w.WriteString("[")
+		for i, e := range v {
+			if i > 0 {
+				w.WriteString(" ")
+			}
+			writeObject(w, e, false)
+		}
+		w.WriteString("]")
+	case Dict:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, string(k))
+		}
+		sort.Strings(keys)
+		w.WriteString("<<")
+		for _, k := range keys {
+			w.WriteString(encodeName(Name(k)))
+			w.WriteString(" ")
+			writeObject(w, v[Name(k)], false)
+		}
+		w.WriteString(">>")
+	case *Stream:
+		if !top {
+			w.WriteString("null")
+			return
+		}
+		dict := Dict{}
+		for k, val := range v.Dict {
+			dict[k] = val
+		}
+		dict["Length"] = int64(len(v.Data))
+		writeObject(w, dict, false)
+		w.WriteString("\nstream\n")
+		w.Write(v.Data)
+		w.WriteString("\nendstream")
+	default:
+		w.WriteString("null")
+	}
+}
+
+func encodeName(n Name) string {
+	buf := []byte{'/'}
+	for i := 0; i < len(n); i++ {
+		c := n[i]
+		if c < '!' || c > '~' || c == '#' || isDelim(c) {
+			buf = append(buf, fmt.Sprintf("#%02X", c)...)
+		} else {
+			buf = append(buf, c)
+		}
+	}
+	return string(buf)
+}
+
+func encodeString(s String) string {
+	buf := []byte{'('}
+	for _, c := range s {
+		switch c {
+		case '(', ')', '\\':
+			buf = append(buf, '\\', c)
+		case '\r':
+			buf = append(buf, '\\', 'r')
+		case '\n':
+			buf = append(buf, '\\', 'n')
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return string(append(buf, ')'))
+}
@@ -0,0 +1,115 @@
+package pdf
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestWriteObjectRoundTrip(t *testing.T) {
+	tests := []Object{
+		nil,
+		true,
+		int64(-12),
+		2.5,
+		Name("Type"),
+		Name("With Space#(x)"),
+		String("plain"),
+		String("paren ( ) \\ and\r\nnewlines"),
+		String("\x00\xff binary"),
+		Ref{Num: 9},
+		Array{int64(1), Name("A"), Array{String("x")}, nil},
+		Dict{"A": int64(1), "B": Dict{"C": Array{Ref{Num: 2}}}},
+	}
+	for _, want := range tests {
+		var b bytes.Buffer
+		w := &countingWriter{w: bufio.NewWriter(&b)}
+		writeObject(w, want, false)
+		w.w.Flush()
+
+		l := lexer{data: b.Bytes()}
+		got, err := l.object(0)
+		if err != nil {
+			t.Errorf("reading back %q: %v", b.String(), err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("round trip of %#v via %q = %#v", want, b.String(), got)
+		}
+		if w.n != int64(b.Len()) {
+			t.Errorf("countingWriter.n = %d, wrote %d", w.n, b.Len())
+		}
+	}
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"xref table":  simplePDF("/Info 8 0 R", ""),
+		"xref stream": xrefStreamPDF(),
+	} {
+		doc, err := Open(data)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		note := doc.Add(Dict{"Note": String("added (by test)")})
+		root := doc.Resolve(doc.Trailer["Root"]).(Dict)
+		root["Extra"] = note
+		doc.Set(1, root)
+
+		var out bytes.Buffer
+		if err := doc.Write(&out); err != nil {
+			t.Fatalf("%s: Write: %v", name, err)
+		}
+		if !bytes.HasPrefix(out.Bytes(), []byte("%PDF-1.")) || bytes.Contains(out.Bytes(), []byte("/ObjStm")) {
+			t.Errorf("%s: unexpected output header or object stream", name)
+		}
+
+		again, err := Open(out.Bytes())
+		if err != nil {
+			t.Fatalf("%s: reopening: %v", name, err)
+		}
+		// The rewritten file must parse from its own xref, not by recovery.
+		if err := again.loadXrefChain(); err != nil {
+			t.Errorf("%s: rewritten xref: %v", name, err)
+		}
+		pagesBefore, _ := doc.Pages()
+		pagesAfter, err := again.Pages()
+		if err != nil || len(pagesAfter) != len(pagesBefore) {
+			t.Errorf("%s: pages after Write = %d, %v; want %d", name, len(pagesAfter), err, len(pagesBefore))
+		}
+		extra, _ := again.Resolve(again.Resolve(again.Trailer["Root"]).(Dict)["Extra"]).(Dict)
+		if got, _ := extra["Note"].(String); string(got) != "added (by test)" {
+			t.Errorf("%s: added object = %#v", name, extra)
+		}
+	}
+}
+
+func TestWriteKeepsStreamData(t *testing.T) {
+	doc, err := Open(simplePDF("", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := doc.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+	again, err := Open(out.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, ok := again.Resolve(Ref{Num: 6}).(*Stream)
+	if !ok || string(s.Data) != "BT /F1 12 Tf 72 720 Td (Page) Tj ET" || s.Dict.Int("Length") != len(s.Data) {
+		t.Errorf("content stream after Write = %#v", s)
+	}
+}
+
+func TestWriteRefusesEncrypted(t *testing.T) {
+	doc, err := Open(simplePDF("/Encrypt 8 0 R", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.Write(&bytes.Buffer{}); err == nil {
+		t.Error("Write of an encrypted document succeeded")
+	}
+}
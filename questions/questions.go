@@ -0,0 +1,188 @@
+// Package questions defines the kinds of quiz questions. Each type checks
+// the options and answer key an instructor sends and grades a student's
+// response against them.
+package questions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+)
+
+const (
+	SingleChoice   = "single_choice"
+	MultipleSelect = "multiple_select"
+	TrueFalse      = "true_false"
+	Numeric        = "numeric"
+	ShortText      = "short_text"
+	Ordering       = "ordering"
+	Matching       = "matching"
+	Essay          = "essay"
+)
+
+// Type is one kind of question. Options and answers are stored on the quiz
+// as text (JSON, apart from the plain answer of SingleChoice); students see
+// the options, never the answer.
+type Type interface {
+	// Validate checks options and answer as sent by the instructor and
+	// returns them in the form stored on the quiz.
+	Validate(options, answer json.RawMessage) (storedOptions, storedAnswer string, err error)
+	// Grade scores a response against a stored question: 1 is fully
+	// correct, 0 is wrong and anything in between is partial credit.
+	Grade(options, answer string, response json.RawMessage) float64
+}
+
+var types = map[string]Type{
+	SingleChoice:   singleChoice{},
+	MultipleSelect: multipleSelect{},
+	TrueFalse:      trueFalse{},
+	Numeric:        numeric{},
+	ShortText:      shortText{},
+	Ordering:       ordering{},
+	Matching:       matching{},
+	Essay:          essay{},
+}
+
+// ManualType is a type that course staff grade by hand against a rubric.
+// Its Grade is never called; answers wait in the grading queue instead.
+type ManualType interface {
+	Type
+	// Rubric returns the rubric stored as the question's answer.
+	Rubric(answer string) Rubric
+}
+
+// Criterion is one line of a rubric, worth up to Points.
+type Criterion struct {
+	Criterion string  `json:"criterion"`
+	Points    float64 `json:"points"`
+}
+
+// Rubric is what a manually graded answer is marked against.
+type Rubric []Criterion
+
+// Total is the most points the rubric awards.
+func (r Rubric) Total() float64 {
+	total := 0.0
+	for _, c := range r {
+		total += c.Points
+	}
+	return total
+}
+
+// IsManual reports whether questions of type typ are graded by hand.
+func IsManual(typ string) bool {
+	t, err := Lookup(typ)
+	if err != nil {
+		return false
+	}
+	_, ok := t.(ManualType)
+	return ok
+}
+
+// Lookup returns the type called name. "" is SingleChoice, the type of
+// quizzes created before there were others.
+func Lookup(name string) (Type, error) {
+	if name == "" {
+		name = SingleChoice
+	}
+	t, ok := types[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown question type %q (use one of %v)", name, Names())
+	}
+	return t, nil
+}
+
+// Names lists the question types.
+func Names() []string {
+	names := make([]string, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Grade scores response with the question's type. Unknown types score 0.
+func Grade(typ, options, answer string, response json.RawMessage) float64 {
+	t, err := Lookup(typ)
+	if err != nil {
+		return 0
+	}
+	credit := t.Grade(options, answer, response)
+	switch {
+	case credit < 0:
+		return 0
+	case credit > 1:
+		return 1
+	}
+	return credit
+}
+
+// AnswerJSON turns a stored answer back into the form Validate accepts,
+// e.g. to export a question.
+func AnswerJSON(typ, stored string) json.RawMessage {
+	if typ == "" || typ == SingleChoice {
+		b, _ := json.Marshal(stored)
+		return b
+	}
+	return json.RawMessage(stored)
+}
+
+// Definition is a question as exchanged with instructors and in course
+// packages: the type, the text and the raw options and answer key.
+type Definition struct {
+	Type     string          `json:"type,omitempty"`
+	Question string          `json:"question"`
+	Options  json.RawMessage `json:"options,omitempty"`
+	Answer   json.RawMessage `json:"answer"`
+}
+
+// Validate checks d and returns its stored options and answer.
+func (d Definition) Validate() (storedOptions, storedAnswer string, err error) {
+	if d.Question == "" {
+		return "", "", errors.New("question is empty")
+	}
+	t, err := Lookup(d.Type)
+	if err != nil {
+		return "", "", err
+	}
+	if len(d.Answer) == 0 || string(d.Answer) == "null" {
+		return "", "", errors.New("missing answer")
+	}
+	return t.Validate(d.Options, d.Answer)
+}
+
+func marshal(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// ShuffleOptions returns stored options in a random order for display.
+// Grading compares option text, so the order does not affect the answer.
+// Types whose options have no order to hide are returned as they are.
+func ShuffleOptions(typ, options string) string {
+	switch typ {
+	case "", SingleChoice, MultipleSelect, Ordering:
+		var list []string
+		if json.Unmarshal([]byte(options), &list) != nil {
+			return options
+		}
+		shuffle(list)
+		return marshal(list)
+	case Matching:
+		var o matchingOptions
+		if json.Unmarshal([]byte(options), &o) != nil {
+			return options
+		}
+		shuffle(o.Prompts)
+		shuffle(o.Choices)
+		return marshal(o)
+	}
+	return options
+}
+
+func shuffle(list []string) {
+	rand.Shuffle(len(list), func(i, j int) { list[i], list[j] = list[j], list[i] })
+}
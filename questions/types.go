@@ -0,0 +1,386 @@
+package questions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// singleChoice: options is a list of strings, the answer is one of them.
+type singleChoice struct{}
+
+func (singleChoice) Validate(options, answer json.RawMessage) (string, string, error) {
+	opts, err := optionList(options)
+	if err != nil {
+		return "", "", err
+	}
+	var a string
+	if err := json.Unmarshal(answer, &a); err != nil || a == "" {
+		return "", "", errors.New("answer must be one of the options")
+	}
+	if !contains(opts, a) {
+		return "", "", fmt.Errorf("answer %q is not one of the options", a)
+	}
+	return marshal(opts), a, nil
+}
+
+func (singleChoice) Grade(options, answer string, response json.RawMessage) float64 {
+	var r string
+	if json.Unmarshal(response, &r) == nil && r == answer {
+		return 1
+	}
+	return 0
+}
+
+// multipleSelect: options is a list of strings, the answer the non-empty
+// subset that must be selected. Each correct choice earns its share of the
+// credit and each wrong one takes a share away.
+type multipleSelect struct{}
+
+func (multipleSelect) Validate(options, answer json.RawMessage) (string, string, error) {
+	opts, err := optionList(options)
+	if err != nil {
+		return "", "", err
+	}
+	var a []string
+	if err := json.Unmarshal(answer, &a); err != nil || len(a) == 0 {
+		return "", "", errors.New("answer must list the correct options")
+	}
+	seen := map[string]bool{}
+	for _, s := range a {
+		if !contains(opts, s) {
+			return "", "", fmt.Errorf("answer %q is not one of the options", s)
+		}
+		if seen[s] {
+			return "", "", fmt.Errorf("answer %q is listed twice", s)
+		}
+		seen[s] = true
+	}
+	return marshal(opts), marshal(a), nil
+}
+
+func (multipleSelect) Grade(options, answer string, response json.RawMessage) float64 {
+	var correct, selected []string
+	if json.Unmarshal([]byte(answer), &correct) != nil || len(correct) == 0 {
+		return 0
+	}
+	if json.Unmarshal(response, &selected) != nil {
+		return 0
+	}
+
+	hits, misses := 0, 0
+	seen := map[string]bool{}
+	for _, s := range selected {
+		if seen[s] {
+			continue
+		}
+		seen[s] = true
+		if contains(correct, s) {
+			hits++
+		} else {
+			misses++
+		}
+	}
+	return float64(hits-misses) / float64(len(correct))
+}
+
+// trueFalse: the answer is true or false.
+type trueFalse struct{}
+
+func (trueFalse) Validate(_, answer json.RawMessage) (string, string, error) {
+	b, ok := parseBool(answer)
+	if !ok {
+		return "", "", errors.New("answer must be true or false")
+	}
+	return `["true","false"]`, strconv.FormatBool(b), nil
+}
+
+func (trueFalse) Grade(_, answer string, response json.RawMessage) float64 {
+	b, ok := parseBool(response)
+	if ok && strconv.FormatBool(b) == answer {
+		return 1
+	}
+	return 0
+}
+
+// numeric: the answer is {"value": 9.81, "tolerance": 0.05} or just a
+// number; responses within the tolerance are correct.
+type numeric struct{}
+
+type numericAnswer struct {
+	Value     float64 `json:"value"`
+	Tolerance float64 `json:"tolerance"`
+}
+
+func (numeric) Validate(_, answer json.RawMessage) (string, string, error) {
+	var a numericAnswer
+	if v, ok := parseNumber(answer); ok {
+		a.Value = v
+	} else if err := json.Unmarshal(answer, &a); err != nil {
+		return "", "", errors.New(`answer must be a number or {"value": ..., "tolerance": ...}`)
+	}
+	if a.Tolerance < 0 || math.IsNaN(a.Value) || math.IsInf(a.Value, 0) {
+		return "", "", errors.New("answer needs a finite value and a tolerance of at least 0")
+	}
+	return "[]", marshal(a), nil
+}
+
+func (numeric) Grade(_, answer string, response json.RawMessage) float64 {
+	var a numericAnswer
+	if json.Unmarshal([]byte(answer), &a) != nil {
+		return 0
+	}
+	r, ok := parseNumber(response)
+	// Allow for the rounding of decimal fractions in binary
+	if ok && math.Abs(r-a.Value) <= a.Tolerance+1e-9*math.Max(1, math.Abs(a.Value)) {
+		return 1
+	}
+	return 0
+}
+
+// shortText: the answer is the accepted spelling or a list of them.
+// Comparison ignores case and extra whitespace.
+type shortText struct{}
+
+func (shortText) Validate(_, answer json.RawMessage) (string, string, error) {
+	var variants []string
+	var one string
+	if json.Unmarshal(answer, &one) == nil {
+		variants = []string{one}
+	} else if json.Unmarshal(answer, &variants) != nil {
+		return "", "", errors.New("answer must be a string or a list of accepted strings")
+	}
+	var out []string
+	for _, v := range variants {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	if len(out) == 0 {
+		return "", "", errors.New("answer needs at least one accepted string")
+	}
+	return "[]", marshal(out), nil
+}
+
+func (shortText) Grade(_, answer string, response json.RawMessage) float64 {
+	var variants []string
+	var r string
+	if json.Unmarshal([]byte(answer), &variants) != nil || json.Unmarshal(response, &r) != nil {
+		return 0
+	}
+	r = normalizeText(r)
+	for _, v := range variants {
+		if normalizeText(v) == r {
+			return 1
+		}
+	}
+	return 0
+}
+
+// ordering: options are the items as shown, the answer lists the same
+// items in the correct order. Each item in its right place earns its share.
+type ordering struct{}
+
+func (ordering) Validate(options, answer json.RawMessage) (string, string, error) {
+	opts, err := optionList(options)
+	if err != nil {
+		return "", "", err
+	}
+	var a []string
+	if err := json.Unmarshal(answer, &a); err != nil {
+		return "", "", errors.New("answer must list the options in the correct order")
+	}
+	if len(a) != len(opts) {
+		return "", "", errors.New("answer must list every option exactly once")
+	}
+	seen := map[string]bool{}
+	for _, s := range a {
+		if !contains(opts, s) || seen[s] {
+			return "", "", errors.New("answer must list every option exactly once")
+		}
+		seen[s] = true
+	}
+	return marshal(opts), marshal(a), nil
+}
+
+func (ordering) Grade(_, answer string, response json.RawMessage) float64 {
+	var correct, r []string
+	if json.Unmarshal([]byte(answer), &correct) != nil || len(correct) == 0 || json.Unmarshal(response, &r) != nil {
+		return 0
+	}
+	right := 0
+	for i := range correct {
+		if i < len(r) && r[i] == correct[i] {
+			right++
+		}
+	}
+	return float64(right) / float64(len(correct))
+}
+
+// matching: options are {"prompts": [...], "choices": [...]} and the answer
+// maps every prompt to its choice. Choices may include distractors. Each
+// correct pair earns its share.
+type matching struct{}
+
+type matchingOptions struct {
+	Prompts []string `json:"prompts"`
+	Choices []string `json:"choices"`
+}
+
+func (matching) Validate(options, answer json.RawMessage) (string, string, error) {
+	var o matchingOptions
+	if err := json.Unmarshal(options, &o); err != nil {
+		return "", "", errors.New(`options must be {"prompts": [...], "choices": [...]}`)
+	}
+	if err := checkList(o.Prompts, 1, "prompts"); err != nil {
+		return "", "", err
+	}
+	if err := checkList(o.Choices, 1, "choices"); err != nil {
+		return "", "", err
+	}
+
+	var a map[string]string
+	if err := json.Unmarshal(answer, &a); err != nil {
+		return "", "", errors.New("answer must map each prompt to its choice")
+	}
+	for _, p := range o.Prompts {
+		choice, ok := a[p]
+		if !ok {
+			return "", "", fmt.Errorf("answer has no choice for prompt %q", p)
+		}
+		if !contains(o.Choices, choice) {
+			return "", "", fmt.Errorf("answer for prompt %q is not one of the choices", p)
+		}
+	}
+	if len(a) != len(o.Prompts) {
+		return "", "", errors.New("answer has entries for unknown prompts")
+	}
+	return marshal(o), marshal(a), nil
+}
+
+func (matching) Grade(_, answer string, response json.RawMessage) float64 {
+	var correct, r map[string]string
+	if json.Unmarshal([]byte(answer), &correct) != nil || len(correct) == 0 || json.Unmarshal(response, &r) != nil {
+		return 0
+	}
+	right := 0
+	for prompt, choice := range correct {
+		if r[prompt] == choice {
+			right++
+		}
+	}
+	return float64(right) / float64(len(correct))
+}
+
+// essay: an open answer graded by course staff. The answer is the rubric,
+// a list of {"criterion", "points"}, or just the points for one overall
+// criterion.
+type essay struct{}
+
+func (essay) Validate(_, answer json.RawMessage) (string, string, error) {
+	var rubric Rubric
+	if points, ok := parseNumber(answer); ok {
+		rubric = Rubric{{Criterion: "Overall", Points: points}}
+	} else if err := json.Unmarshal(answer, &rubric); err != nil {
+		return "", "", errors.New(`answer must be the rubric, [{"criterion": ..., "points": ...}], or the points`)
+	}
+	if len(rubric) == 0 {
+		return "", "", errors.New("rubric needs at least one criterion")
+	}
+	for i, c := range rubric {
+		if strings.TrimSpace(c.Criterion) == "" {
+			return "", "", fmt.Errorf("rubric criterion %d has no description", i+1)
+		}
+		if !(c.Points > 0) || math.IsInf(c.Points, 0) {
+			return "", "", fmt.Errorf("rubric criterion %d must be worth more than 0 points", i+1)
+		}
+	}
+	return "[]", marshal(rubric), nil
+}
+
+func (essay) Grade(string, string, json.RawMessage) float64 {
+	return 0
+}
+
+func (essay) Rubric(answer string) Rubric {
+	var rubric Rubric
+	_ = json.Unmarshal([]byte(answer), &rubric)
+	return rubric
+}
+
+// optionList parses a list of at least two distinct, non-empty options.
+func optionList(options json.RawMessage) ([]string, error) {
+	var opts []string
+	if err := json.Unmarshal(options, &opts); err != nil {
+		return nil, errors.New("options must be a list of strings")
+	}
+	return opts, checkList(opts, 2, "options")
+}
+
+func checkList(list []string, min int, what string) error {
+	if len(list) < min {
+		return fmt.Errorf("needs at least %d %s", min, what)
+	}
+	seen := map[string]bool{}
+	for _, s := range list {
+		if strings.TrimSpace(s) == "" {
+			return fmt.Errorf("%s must not be empty", what)
+		}
+		if seen[s] {
+			return fmt.Errorf("%s must be distinct; %q appears twice", what, s)
+		}
+		seen[s] = true
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// parseBool accepts true/false as JSON booleans or strings.
+func parseBool(raw json.RawMessage) (bool, bool) {
+	var b bool
+	if json.Unmarshal(raw, &b) == nil {
+		return b, true
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		switch strings.ToLower(strings.TrimSpace(s)) {
+		case "true":
+			return true, true
+		case "false":
+			return false, true
+		}
+	}
+	return false, false
+}
+
+// parseNumber accepts a JSON number or a string such as "3.5" or "3,5".
+func parseNumber(raw json.RawMessage) (float64, bool) {
+	var f float64
+	if json.Unmarshal(raw, &f) == nil {
+		return f, true
+	}
+	var s string
+	if json.Unmarshal(raw, &s) != nil {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(s), ",", "."), 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, false
+	}
+	return f, true
+}
+
+func normalizeText(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
@@ -0,0 +1,269 @@
+package questions
+
+import (
+	"encoding/json"
+	"sort"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		typ             string
+		options, answer string
+		wantOptions     string
+		wantAnswer      string
+		wantErr         bool
+	}{
+		// single_choice, also the type of quizzes without one
+		{typ: SingleChoice, options: `["A","B","C"]`, answer: `"B"`, wantOptions: `["A","B","C"]`, wantAnswer: "B"},
+		{typ: "", options: `["A","B"]`, answer: `"A"`, wantOptions: `["A","B"]`, wantAnswer: "A"},
+		{typ: SingleChoice, options: `["A","B"]`, answer: `"D"`, wantErr: true},
+		{typ: SingleChoice, options: `["A","B"]`, answer: `""`, wantErr: true},
+		{typ: SingleChoice, options: `["A","B"]`, answer: `1`, wantErr: true},
+		{typ: SingleChoice, options: `["A"]`, answer: `"A"`, wantErr: true},
+		{typ: SingleChoice, options: `["A","A"]`, answer: `"A"`, wantErr: true},
+		{typ: SingleChoice, options: `["A"," "]`, answer: `"A"`, wantErr: true},
+		{typ: SingleChoice, options: `"A,B"`, answer: `"A"`, wantErr: true},
+		{typ: SingleChoice, options: ``, answer: `"A"`, wantErr: true},
+
+		// multiple_select
+		{typ: MultipleSelect, options: `["A","B","C"]`, answer: `["A","C"]`, wantOptions: `["A","B","C"]`, wantAnswer: `["A","C"]`},
+		{typ: MultipleSelect, options: `["A","B","C"]`, answer: `[]`, wantErr: true},
+		{typ: MultipleSelect, options: `["A","B","C"]`, answer: `["A","A"]`, wantErr: true},
+		{typ: MultipleSelect, options: `["A","B","C"]`, answer: `["D"]`, wantErr: true},
+		{typ: MultipleSelect, options: `["A","B","C"]`, answer: `"A"`, wantErr: true},
+
+		// true_false
+		{typ: TrueFalse, answer: `true`, wantOptions: `["true","false"]`, wantAnswer: "true"},
+		{typ: TrueFalse, answer: `" False "`, wantOptions: `["true","false"]`, wantAnswer: "false"},
+		{typ: TrueFalse, answer: `"yes"`, wantErr: true},
+		{typ: TrueFalse, answer: `1`, wantErr: true},
+
+		// numeric
+		{typ: Numeric, answer: `9.81`, wantOptions: `[]`, wantAnswer: `{"value":9.81,"tolerance":0}`},
+		{typ: Numeric, answer: `"3,5"`, wantOptions: `[]`, wantAnswer: `{"value":3.5,"tolerance":0}`},
+		{typ: Numeric, answer: `{"value": 100, "tolerance": 2.5}`, wantOptions: `[]`, wantAnswer: `{"value":100,"tolerance":2.5}`},
+		{typ: Numeric, answer: `{"value": 1, "tolerance": -1}`, wantErr: true},
+		{typ: Numeric, answer: `"NaN"`, wantErr: true},
+		{typ: Numeric, answer: `"Inf"`, wantErr: true},
+		{typ: Numeric, answer: `"ten"`, wantErr: true},
+		{typ: Numeric, answer: `[1]`, wantErr: true},
+
+		// short_text
+		{typ: ShortText, answer: `"  Jakarta "`, wantOptions: `[]`, wantAnswer: `["Jakarta"]`},
+		{typ: ShortText, answer: `["colour", "", "color"]`, wantOptions: `[]`, wantAnswer: `["colour","color"]`},
+		{typ: ShortText, answer: `"   "`, wantErr: true},
+		{typ: ShortText, answer: `[]`, wantErr: true},
+		{typ: ShortText, answer: `42`, wantErr: true},
+
+		// ordering
+		{typ: Ordering, options: `["b","c","a"]`, answer: `["a","b","c"]`, wantOptions: `["b","c","a"]`, wantAnswer: `["a","b","c"]`},
+		{typ: Ordering, options: `["b","c","a"]`, answer: `["a","b"]`, wantErr: true},
+		{typ: Ordering, options: `["b","c","a"]`, answer: `["a","a","b"]`, wantErr: true},
+		{typ: Ordering, options: `["b","c","a"]`, answer: `["a","b","d"]`, wantErr: true},
+		{typ: Ordering, options: `["b","c","a"]`, answer: `{"a":1}`, wantErr: true},
+
+		// matching
+		{typ: Matching, options: `{"prompts":["cat","dog"],"choices":["meow","woof","moo"]}`, answer: `{"cat":"meow","dog":"woof"}`,
+			wantOptions: `{"prompts":["cat","dog"],"choices":["meow","woof","moo"]}`, wantAnswer: `{"cat":"meow","dog":"woof"}`},
+		{typ: Matching, options: `{"prompts":["cat","dog"],"choices":["meow","woof"]}`, answer: `{"cat":"meow"}`, wantErr: true},
+		{typ: Matching, options: `{"prompts":["cat","dog"],"choices":["meow","woof"]}`, answer: `{"cat":"meow","dog":"moo"}`, wantErr: true},
+		{typ: Matching, options: `{"prompts":["cat"],"choices":["meow"]}`, answer: `{"cat":"meow","cow":"meow"}`, wantErr: true},
+		{typ: Matching, options: `{"prompts":[],"choices":["meow"]}`, answer: `{}`, wantErr: true},
+		{typ: Matching, options: `{"prompts":["cat","cat"],"choices":["meow"]}`, answer: `{"cat":"meow"}`, wantErr: true},
+		{typ: Matching, options: `["cat","dog"]`, answer: `{"cat":"meow"}`, wantErr: true},
+		{typ: Matching, options: `{"prompts":["cat"],"choices":["meow"]}`, answer: `["meow"]`, wantErr: true},
+
+		// essay
+		{typ: Essay, answer: `10`, wantOptions: `[]`, wantAnswer: `[{"criterion":"Overall","points":10}]`},
+		{typ: Essay, answer: `[{"criterion":"Argument","points":6},{"criterion":"Style","points":4}]`,
+			wantOptions: `[]`, wantAnswer: `[{"criterion":"Argument","points":6},{"criterion":"Style","points":4}]`},
+		{typ: Essay, answer: `0`, wantErr: true},
+		{typ: Essay, answer: `[]`, wantErr: true},
+		{typ: Essay, answer: `[{"criterion":" ","points":5}]`, wantErr: true},
+		{typ: Essay, answer: `[{"criterion":"Argument","points":-1}]`, wantErr: true},
+		{typ: Essay, answer: `"lots"`, wantErr: true},
+	}
+	for _, tt := range tests {
+		typ, err := Lookup(tt.typ)
+		if err != nil {
+			t.Fatal(err)
+		}
+		options, answer, err := typ.Validate(json.RawMessage(tt.options), json.RawMessage(tt.answer))
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: Validate(%s, %s) = %s, %s; want an error", tt.typ, tt.options, tt.answer, options, answer)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Validate(%s, %s): %v", tt.typ, tt.options, tt.answer, err)
+			continue
+		}
+		if options != tt.wantOptions || answer != tt.wantAnswer {
+			t.Errorf("%s: Validate(%s, %s) = %s, %s; want %s, %s", tt.typ, tt.options, tt.answer, options, answer, tt.wantOptions, tt.wantAnswer)
+		}
+
+		// The stored answer turned back into JSON validates to itself, as
+		// exports rely on.
+		_, again, err := typ.Validate(json.RawMessage(tt.options), AnswerJSON(tt.typ, answer))
+		if err != nil || again != answer {
+			t.Errorf("%s: re-validating stored answer %s = %s, %v", tt.typ, answer, again, err)
+		}
+	}
+}
+
+func TestGrade(t *testing.T) {
+	tests := []struct {
+		typ             string
+		options, answer string
+		response        string
+		want            float64
+	}{
+		{SingleChoice, `["A","B"]`, "B", `"B"`, 1},
+		{SingleChoice, `["A","B"]`, "B", `"A"`, 0},
+		{"", `["A","B"]`, "B", `"B"`, 1},
+		{SingleChoice, `["A","B"]`, "B", `["B"]`, 0},
+		{SingleChoice, `["A","B"]`, "B", `not json`, 0},
+
+		// one share per correct choice, minus one per wrong choice
+		{MultipleSelect, `["A","B","C","D"]`, `["A","C"]`, `["A","C"]`, 1},
+		{MultipleSelect, `["A","B","C","D"]`, `["A","C"]`, `["C","A"]`, 1},
+		{MultipleSelect, `["A","B","C","D"]`, `["A","C"]`, `["A"]`, 0.5},
+		{MultipleSelect, `["A","B","C","D"]`, `["A","C"]`, `["A","A"]`, 0.5},
+		{MultipleSelect, `["A","B","C","D"]`, `["A","C"]`, `["A","B","C"]`, 0.5},
+		{MultipleSelect, `["A","B","C","D"]`, `["A","C"]`, `["A","B"]`, 0},
+		{MultipleSelect, `["A","B","C","D"]`, `["A","C"]`, `["B","D"]`, 0}, // never below 0
+		{MultipleSelect, `["A","B","C","D"]`, `["A","C"]`, `[]`, 0},
+		{MultipleSelect, `["A","B","C","D"]`, `["A","C"]`, `"A"`, 0},
+		{MultipleSelect, `["A","B"]`, `[]`, `["A"]`, 0},
+
+		{TrueFalse, "", "true", `true`, 1},
+		{TrueFalse, "", "true", `"TRUE"`, 1},
+		{TrueFalse, "", "true", `false`, 0},
+		{TrueFalse, "", "false", `"no"`, 0},
+
+		// value 9.81 give or take 0.05
+		{Numeric, "", `{"value":9.81,"tolerance":0.05}`, `9.81`, 1},
+		{Numeric, "", `{"value":9.81,"tolerance":0.05}`, `9.86`, 1},
+		{Numeric, "", `{"value":9.81,"tolerance":0.05}`, `9.76`, 1},
+		{Numeric, "", `{"value":9.81,"tolerance":0.05}`, `9.87`, 0},
+		{Numeric, "", `{"value":9.81,"tolerance":0.05}`, `"9,8"`, 1},
+		{Numeric, "", `{"value":0.3,"tolerance":0}`, `0.30000000000000004`, 1},
+		{Numeric, "", `{"value":0.3,"tolerance":0}`, `0.31`, 0},
+		{Numeric, "", `{"value":1e6,"tolerance":0}`, `1000000.0001`, 1},
+		{Numeric, "", `{"value":1e6,"tolerance":0}`, `1000001`, 0},
+		{Numeric, "", `{"value":5,"tolerance":0}`, `"five"`, 0},
+		{Numeric, "", `{"value":5,"tolerance":0}`, `"NaN"`, 0},
+		{Numeric, "", `broken`, `5`, 0},
+
+		{ShortText, "", `["Jakarta"]`, `"  jakarta "`, 1},
+		{ShortText, "", `["New York"]`, `"new   york"`, 1},
+		{ShortText, "", `["colour","color"]`, `"Color"`, 1},
+		{ShortText, "", `["Jakarta"]`, `"Bandung"`, 0},
+		{ShortText, "", `["Jakarta"]`, `["Jakarta"]`, 0},
+
+		// one share per item in its right place
+		{Ordering, `["c","a","b"]`, `["a","b","c"]`, `["a","b","c"]`, 1},
+		{Ordering, `["c","a","b"]`, `["a","b","c"]`, `["a","c","b"]`, 1.0 / 3},
+		{Ordering, `["c","a","b"]`, `["a","b","c"]`, `["c","a","b"]`, 0},
+		{Ordering, `["c","a","b"]`, `["a","b","c"]`, `["a","b"]`, 2.0 / 3},
+		{Ordering, `["c","a","b"]`, `["a","b","c"]`, `["a","b","c","d"]`, 1},
+		{Ordering, `["c","a","b"]`, `["a","b","c"]`, `"abc"`, 0},
+
+		// one share per correct pair
+		{Matching, "", `{"cat":"meow","dog":"woof"}`, `{"cat":"meow","dog":"woof"}`, 1},
+		{Matching, "", `{"cat":"meow","dog":"woof"}`, `{"cat":"meow","dog":"moo"}`, 0.5},
+		{Matching, "", `{"cat":"meow","dog":"woof"}`, `{"cat":"meow"}`, 0.5},
+		{Matching, "", `{"cat":"meow","dog":"woof"}`, `{"cat":"woof","dog":"meow"}`, 0},
+		{Matching, "", `{"cat":"meow","dog":"woof"}`, `["meow","woof"]`, 0},
+
+		// graded by hand
+		{Essay, "", `[{"criterion":"Overall","points":10}]`, `"A long answer"`, 0},
+
+		{"crossword", "", "x", `"x"`, 0},
+	}
+	for _, tt := range tests {
+		got := Grade(tt.typ, tt.options, tt.answer, json.RawMessage(tt.response))
+		if diff := got - tt.want; diff > 1e-9 || diff < -1e-9 {
+			t.Errorf("Grade(%s, %s, %s) = %v, want %v", tt.typ, tt.answer, tt.response, got, tt.want)
+		}
+	}
+}
+
+func TestDefinitionValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		def     Definition
+		wantErr bool
+	}{
+		{"valid", Definition{Question: "2+2?", Options: json.RawMessage(`["3","4"]`), Answer: json.RawMessage(`"4"`)}, false},
+		{"no question", Definition{Options: json.RawMessage(`["3","4"]`), Answer: json.RawMessage(`"4"`)}, true},
+		{"unknown type", Definition{Type: "crossword", Question: "?", Answer: json.RawMessage(`"x"`)}, true},
+		{"no answer", Definition{Type: TrueFalse, Question: "?"}, true},
+		{"null answer", Definition{Type: TrueFalse, Question: "?", Answer: json.RawMessage(`null`)}, true},
+	}
+	for _, tt := range tests {
+		_, _, err := tt.def.Validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestManualTypes(t *testing.T) {
+	for _, name := range Names() {
+		if got := IsManual(name); got != (name == Essay) {
+			t.Errorf("IsManual(%s) = %v", name, got)
+		}
+	}
+	if IsManual("crossword") {
+		t.Error("IsManual of an unknown type")
+	}
+
+	typ, _ := Lookup(Essay)
+	rubric := typ.(ManualType).Rubric(`[{"criterion":"Argument","points":6},{"criterion":"Style","points":4}]`)
+	if len(rubric) != 2 || rubric.Total() != 10 {
+		t.Errorf("Rubric = %v, total %v", rubric, rubric.Total())
+	}
+	if got := typ.(ManualType).Rubric("broken"); len(got) != 0 {
+		t.Errorf("Rubric of a broken answer = %v", got)
+	}
+}
+
+func TestShuffleOptions(t *testing.T) {
+	sorted := func(list []string) []string {
+		out := append([]string(nil), list...)
+		sort.Strings(out)
+		return out
+	}
+	same := func(a, b []string) bool {
+		return marshal(sorted(a)) == marshal(sorted(b))
+	}
+
+	list := []string{"a", "b", "c", "d", "e"}
+	for _, typ := range []string{"", SingleChoice, MultipleSelect, Ordering} {
+		var got []string
+		if err := json.Unmarshal([]byte(ShuffleOptions(typ, marshal(list))), &got); err != nil || !same(got, list) {
+			t.Errorf("ShuffleOptions(%s) = %v, %v", typ, got, err)
+		}
+	}
+
+	o := matchingOptions{Prompts: []string{"cat", "dog", "cow"}, Choices: []string{"meow", "woof", "moo", "oink"}}
+	var got matchingOptions
+	if err := json.Unmarshal([]byte(ShuffleOptions(Matching, marshal(o))), &got); err != nil ||
+		!same(got.Prompts, o.Prompts) || !same(got.Choices, o.Choices) {
+		t.Errorf("ShuffleOptions(matching) = %+v, %v", got, err)
+	}
+
+	for _, tt := range []struct{ typ, options string }{
+		{TrueFalse, `["true","false"]`},
+		{Numeric, `[]`},
+		{SingleChoice, `not json`},
+		{Matching, `["cat"]`},
+	} {
+		if got := ShuffleOptions(tt.typ, tt.options); got != tt.options {
+			t.Errorf("ShuffleOptions(%s, %s) = %s, want it unchanged", tt.typ, tt.options, got)
+		}
+	}
+}
@@ -20,6 +20,8 @@ func SetupRoutes(app *fiber.App) {
 
 	// public course listing
 	api.Get("/courses", controllers.ListPublishedCourses)
+	// signed module PDF links (no Authorization header; see GetModulePDFLink)
+	api.Get("/files/modules/:module_id/pdf", controllers.StreamModulePDF)
 
 
 
@@ -32,19 +34,88 @@ func SetupRoutes(app *fiber.App) {
 	instr.Get("/courses/:id", controllers.GetCourseDetail)
 	instr.Post("/courses", controllers.CreateCourse)
 	instr.Put("/courses/:id", controllers.EditCourse)
+	instr.Get("/courses/:id/export", controllers.ExportCourse)
+	instr.Post("/courses/import", controllers.ImportCourse)
+	instr.Post("/courses/import/cartridge", controllers.ImportCartridge)
+	// course & module history
+	instr.Get("/courses/:course_id/revisions", controllers.ListCourseRevisions)
+	instr.Get("/courses/:course_id/revisions/diff", controllers.DiffCourseRevisions)
+	instr.Post("/courses/:course_id/revisions/:number/rollback", controllers.RollbackCourse)
+	instr.Get("/courses/:course_id/modules/:module_id/revisions", controllers.ListModuleRevisions)
+	instr.Get("/courses/:course_id/modules/:module_id/revisions/diff", controllers.DiffModuleRevisions)
+	instr.Get("/courses/:course_id/modules/:module_id/revisions/:number/pdf", controllers.GetModuleRevisionPDF)
+	instr.Post("/courses/:course_id/modules/:module_id/revisions/:number/rollback", controllers.RollbackModule)
 	//modules
 	instr.Post("/courses/:course_id/modules", controllers.AddModuleToCourse)
 	instr.Delete("/courses/:id", controllers.DeleteCourse)
+	instr.Put("/courses/:course_id/modules/order", controllers.ReorderModules) // before :module_id
+	instr.Post("/courses/:course_id/modules/move", controllers.MoveModules)
+	instr.Post("/courses/:course_id/modules/copy", controllers.CopyModules)
 	instr.Put("/courses/:course_id/modules/:module_id", controllers.EditModule)
 	instr.Delete("/courses/:course_id/modules/:module_id", controllers.DeleteModule)
+	// module content blocks
+	instr.Get("/courses/:course_id/modules/:module_id/blocks", controllers.ListContentBlocks)
+	instr.Post("/courses/:course_id/modules/:module_id/blocks", controllers.CreateContentBlock)
+	instr.Put("/courses/:course_id/modules/:module_id/blocks/:block_id", controllers.UpdateContentBlock)
+	instr.Delete("/courses/:course_id/modules/:module_id/blocks/:block_id", controllers.DeleteContentBlock)
+	instr.Get("/courses/:course_id/modules/:module_id/blocks/:block_id/file", controllers.GetContentBlockFile)
+	// resumable uploads (tus); attach with upload_id instead of a file
+	instr.Options("/uploads", controllers.UploadOptions)
+	instr.Post("/uploads", controllers.CreateUpload)
+	instr.Head("/uploads/:upload_id", controllers.UploadStatus)
+	instr.Patch("/uploads/:upload_id", controllers.PatchUpload)
+	instr.Delete("/uploads/:upload_id", controllers.DeleteUpload)
 	// quiz routes
 	quiz := instr.Group("/courses/:course_id/modules/:module_id")
 	quiz.Post("/quizzes", controllers.CreateQuiz)
 	quiz.Get("/quizzes", controllers.ListQuizzes)
+	quiz.Put("/quizzes", controllers.ReplaceQuizzes)
+	quiz.Put("/quizzes/order", controllers.ReorderQuizzes) // before :quiz_id
+	quiz.Post("/quizzes/import", controllers.ImportQuizFile)
+	quiz.Get("/quizzes/export", controllers.ExportQuizFile)
+	quiz.Put("/quizzes/:quiz_id", controllers.UpdateQuiz)
+	quiz.Delete("/quizzes/:quiz_id", controllers.DeleteQuiz)
 	quiz.Post("/submit", controllers.SubmitQuiz)
+	quiz.Get("/quiz-settings", controllers.GetQuizSettings)
+	quiz.Put("/quiz-settings", controllers.UpdateQuizSettings)
+	quiz.Get("/quiz-rules", controllers.GetQuizRules)
+	quiz.Put("/quiz-rules", controllers.ReplaceQuizRules)
+	quiz.Get("/item-analysis", controllers.GetItemAnalysis)
+	quiz.Get("/assignments", controllers.ListAssignments)
+	quiz.Post("/assignments", controllers.CreateAssignment)
+	quiz.Put("/assignments/:assignment_id", controllers.UpdateAssignment)
+	quiz.Delete("/assignments/:assignment_id", controllers.DeleteAssignment)
+	quiz.Get("/assignments/:assignment_id/submissions", controllers.ListSubmissions)
+	quiz.Put("/assignments/:assignment_id/submissions/:submission_id/grade", controllers.GradeSubmission)
+	quiz.Get("/assignments/:assignment_id/submissions/:submission_id/file", controllers.GetSubmissionFile)
+	quiz.Get("/assignments/:assignment_id/peer-reviews", controllers.ListPeerReviews)
+	quiz.Post("/assignments/:assignment_id/peer-reviews/assign", controllers.AssignPeerReviews)
+	// question banks
+	instr.Get("/banks", controllers.ListQuestionBanks)
+	instr.Post("/banks", controllers.CreateQuestionBank)
+	instr.Get("/banks/:bank_id", controllers.GetQuestionBank)
+	instr.Put("/banks/:bank_id", controllers.UpdateQuestionBank)
+	instr.Delete("/banks/:bank_id", controllers.DeleteQuestionBank)
+	instr.Post("/banks/:bank_id/questions", controllers.AddBankQuestions)
+	instr.Put("/banks/:bank_id/questions/:quiz_id", controllers.UpdateBankQuestion)
+	instr.Delete("/banks/:bank_id/questions/:quiz_id", controllers.DeleteBankQuestion)
+	// manual grading (essays)
+	instr.Get("/courses/:course_id/grading", controllers.ListGradingQueue)
+	instr.Put("/courses/:course_id/grading/:answer_id", controllers.GradeAnswer)
+
+	instr.Get("/courses/:course_id/assessments", controllers.ListAssessments)
+	instr.Post("/courses/:course_id/assessments", controllers.CreateAssessment)
+	instr.Put("/courses/:course_id/assessments/:assessment_id", controllers.UpdateAssessment)
+	instr.Delete("/courses/:course_id/assessments/:assessment_id", controllers.DeleteAssessment)
+	instr.Put("/courses/:course_id/assessments/:assessment_id/scores", controllers.SetAssessmentScores)
+	instr.Get("/courses/:course_id/grading-scheme", controllers.GetGradingScheme)
+	instr.Put("/courses/:course_id/grading-scheme", controllers.UpdateGradingScheme)
+	instr.Get("/courses/:course_id/gradebook", controllers.GetGradebook)
 
 	// instructor: get module PDF (protected)
 	instr.Get("/courses/:course_id/modules/:module_id/pdf", controllers.GetModulePDF)
+	instr.Get("/courses/:course_id/modules/:module_id/pdf/link", controllers.GetModulePDFLink)
+	instr.Get("/courses/:course_id/modules/:module_id/thumbnail", controllers.GetModuleThumbnail)
 
 	instr.Get("/courses", controllers.InstructorCourses)
 	instr.Get("/earnings", controllers.InstructorEarnings)
@@ -60,6 +131,7 @@ func SetupRoutes(app *fiber.App) {
 	admin.Get("/overview", controllers.AdminOverview)
 	admin.Get("/courses/:course_id/feedback", controllers.GetFeedbackByCourse)
 	admin.Get("/feedback", controllers.GetAllFeedback)
+	admin.Post("/uploads/reconcile", controllers.ReconcileUploads)
 
 	admin.Get("/users", controllers.GetAllUsers)
 	admin.Get("/users/:id", controllers.GetUserByID)
@@ -76,12 +148,34 @@ func SetupRoutes(app *fiber.App) {
 	me.Delete("/profile", controllers.DeleteAccount)
 	me.Get("/courses/:id/modules/quiz-results", controllers.GetQuizResults)
 	me.Get("/courses/:id/status", controllers.GetCourseStatus)
+	me.Get("/courses/:id/grades", controllers.GetMyGrades)
 	me.Get("/courses/:id/modules", controllers.GetEnrolledCourseModules)
 	me.Get("/courses", controllers.GetMyCourses)
 	me.Get("/enrollments", controllers.GetMyEnrollments)
 	me.Post("/courses/:id/enroll", controllers.EnrollCourse)
 	me.Get("/courses/:course_id/modules/:module_id/pdf", controllers.GetModulePDF)
+	me.Get("/courses/:course_id/modules/:module_id/pdf/link", controllers.GetModulePDFLink)
+	me.Get("/courses/:course_id/modules/:module_id/thumbnail", controllers.GetModuleThumbnail)
+	me.Get("/courses/:course_id/modules/:module_id/revisions/studied", controllers.GetStudiedModuleRevision)
+	me.Get("/courses/:course_id/modules/:module_id/revisions/:number/pdf", controllers.GetModuleRevisionPDF)
+	me.Get("/courses/:course_id/modules/:module_id/blocks/:block_id/file", controllers.GetContentBlockFile)
 	me.Post("/courses/:course_id/modules/:module_id/submit", controllers.SubmitQuiz)
+	me.Get("/courses/:course_id/modules/:module_id/assignments", controllers.ListMyAssignments)
+	me.Get("/courses/:course_id/modules/:module_id/assignments/:assignment_id/submissions", controllers.ListMySubmissions)
+	me.Post("/courses/:course_id/modules/:module_id/assignments/:assignment_id/submissions", controllers.SubmitAssignment)
+	me.Get("/courses/:course_id/modules/:module_id/assignments/:assignment_id/submissions/:submission_id/file", controllers.GetSubmissionFile)
+	me.Get("/courses/:course_id/modules/:module_id/assignments/:assignment_id/peer-reviews", controllers.ListMyPeerReviews)
+	me.Put("/courses/:course_id/modules/:module_id/assignments/:assignment_id/peer-reviews/:review_id", controllers.SubmitPeerReview)
+	me.Get("/courses/:course_id/modules/:module_id/assignments/:assignment_id/peer-reviews/:review_id/file", controllers.GetPeerReviewFile)
+	me.Get("/courses/:course_id/modules/:module_id/assignments/:assignment_id/peer-feedback", controllers.GetMyPeerFeedback)
+	me.Get("/courses/:course_id/modules/:module_id/attempts", controllers.ListQuizAttempts)
+	me.Post("/courses/:course_id/modules/:module_id/attempts", controllers.StartQuizAttempt)
+	me.Get("/courses/:course_id/modules/:module_id/attempts/:attempt_id", controllers.GetQuizAttempt)
+	me.Get("/courses/:course_id/modules/:module_id/attempts/:attempt_id/review", controllers.ReviewQuizAttempt)
+	me.Put("/courses/:course_id/modules/:module_id/attempts/:attempt_id/answers", controllers.SaveQuizAttemptAnswers)
+	me.Post("/courses/:course_id/modules/:module_id/attempts/:attempt_id/submit", controllers.SubmitQuizAttempt)
+	me.Get("/notifications", controllers.ListNotifications)
+	me.Put("/notifications/:id/read", controllers.MarkNotificationRead)
 		// public: list quizzes for a module (answers hidden)
 	me.Get("/courses/:course_id/modules/:module_id/quizzes", controllers.ListQuizzes)
 }
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalRoundTrip(t *testing.T) {
+	root := t.TempDir()
+	l := NewLocal(root)
+	ctx := context.Background()
+
+	body := "%PDF-1.4 hello world"
+	if err := l.Put(ctx, "modules/1-intro.pdf", strings.NewReader(body), int64(len(body)), "application/pdf"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Put(ctx, "thumbnails/1-intro.png", strings.NewReader("png"), 3, "image/png"); err != nil {
+		t.Fatal(err)
+	}
+
+	rc, err := l.Get(ctx, "modules/1-intro.pdf")
+	if got := readAll(t, rc, err); got != body {
+		t.Errorf("Get = %q", got)
+	}
+	rc, err = l.GetRange(ctx, "modules/1-intro.pdf", 9, 5)
+	if got := readAll(t, rc, err); got != "hello" {
+		t.Errorf("GetRange = %q, want %q", got, "hello")
+	}
+
+	info, err := l.Stat(ctx, "modules/1-intro.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != int64(len(body)) || info.ContentType != "application/pdf" || info.LastModified.IsZero() {
+		t.Errorf("Stat = %+v", info)
+	}
+
+	// A leftover temp file from an interrupted Put is not an object.
+	if err := os.WriteFile(filepath.Join(root, "modules", ".upload-123"), []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	list, err := l.List(ctx, "modules/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Key != "modules/1-intro.pdf" {
+		t.Errorf("List(modules/) = %+v", list)
+	}
+	if all, err := l.List(ctx, ""); err != nil || len(all) != 2 {
+		t.Errorf("List(\"\") = %+v, %v", all, err)
+	}
+
+	if err := l.Delete(ctx, "modules/1-intro.pdf"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Get(ctx, "modules/1-intro.pdf"); err != ErrNotFound {
+		t.Errorf("Get after Delete = %v, want ErrNotFound", err)
+	}
+	if _, err := l.Stat(ctx, "modules/1-intro.pdf"); err != ErrNotFound {
+		t.Errorf("Stat after Delete = %v, want ErrNotFound", err)
+	}
+	if err := l.Delete(ctx, "modules/1-intro.pdf"); err != nil {
+		t.Errorf("Delete of a missing key = %v, want nil", err)
+	}
+
+	if _, err := l.SignedURL(ctx, "thumbnails/1-intro.png", time.Minute); err != ErrSignedURLUnsupported {
+		t.Errorf("SignedURL = %v, want ErrSignedURLUnsupported", err)
+	}
+}
+
+func TestLocalRejectsEscapingKeys(t *testing.T) {
+	root := t.TempDir()
+	l := NewLocal(filepath.Join(root, "uploads"))
+	ctx := context.Background()
+
+	for _, key := range []string{"", ".", "..", "/etc/passwd", "../secret", "a/../../secret", `a\b`} {
+		if err := l.Put(ctx, key, strings.NewReader("x"), 1, ""); err != ErrInvalidKey {
+			t.Errorf("Put(%q) = %v, want ErrInvalidKey", key, err)
+		}
+		if _, err := l.Get(ctx, key); err != ErrInvalidKey {
+			t.Errorf("Get(%q) = %v, want ErrInvalidKey", key, err)
+		}
+		if err := l.Delete(ctx, key); err != ErrInvalidKey {
+			t.Errorf("Delete(%q) = %v, want ErrInvalidKey", key, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "secret")); !os.IsNotExist(err) {
+		t.Errorf("a file was written outside the root")
+	}
+}
+
+func TestLocalListMissingRoot(t *testing.T) {
+	l := NewLocal(filepath.Join(t.TempDir(), "missing"))
+	list, err := l.List(context.Background(), "")
+	if err != nil || len(list) != 0 {
+		t.Errorf("List on a missing root = %v, %v; want empty", list, err)
+	}
+}
+
+func TestKeyFromURL(t *testing.T) {
+	for _, key := range []string{"modules/1-a.pdf", "thumbnails/x.png"} {
+		if got := KeyFromURL(URLFromKey(key)); got != key {
+			t.Errorf("KeyFromURL(URLFromKey(%q)) = %q", key, got)
+		}
+	}
+	if got := KeyFromURL("uploads/modules/1-a.pdf"); got != "modules/1-a.pdf" {
+		t.Errorf("KeyFromURL without leading slash = %q", got)
+	}
+}
@@ -0,0 +1,337 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// CartridgeImport is the result of converting an IMS Common Cartridge or
+// SCORM 1.2 package into our course structure.
+type CartridgeImport struct {
+	Format      string            `json:"format"` // "imscc", "scorm12" or "imscp"
+	Title       string            `json:"title"`
+	Description string            `json:"description"`
+	Modules     []CartridgeModule `json:"modules"`
+	Warnings    []string          `json:"warnings"`
+}
+
+type CartridgeModule struct {
+	Title   string        `json:"title"`
+	Order   int           `json:"order"`
+	PDFName string        `json:"pdf_name,omitempty"`
+	PDF     []byte        `json:"-"`
+	Quizzes []PackageQuiz `json:"quizzes"`
+}
+
+// imsmanifest.xml, reduced to what we map. Element names are matched on
+// their local name so both IMS CP and CC namespaces decode.
+type cpManifest struct {
+	Identifier    string          `xml:"identifier,attr"`
+	Metadata      cpMetadata      `xml:"metadata"`
+	Organizations cpOrganizations `xml:"organizations"`
+	Resources     cpResources     `xml:"resources"`
+}
+
+type cpMetadata struct {
+	Schema        string `xml:"schema"`
+	SchemaVersion string `xml:"schemaversion"`
+	Title         string `xml:"lom>general>title>string"`
+	Description   string `xml:"lom>general>description>string"`
+}
+
+type cpOrganizations struct {
+	Default       string           `xml:"default,attr"`
+	Organizations []cpOrganization `xml:"organization"`
+}
+
+type cpOrganization struct {
+	Identifier string   `xml:"identifier,attr"`
+	Title      string   `xml:"title"`
+	Items      []cpItem `xml:"item"`
+}
+
+type cpItem struct {
+	Identifier    string   `xml:"identifier,attr"`
+	IdentifierRef string   `xml:"identifierref,attr"`
+	Title         string   `xml:"title"`
+	Items         []cpItem `xml:"item"`
+}
+
+type cpResources struct {
+	Base      string       `xml:"base,attr"`
+	Resources []cpResource `xml:"resource"`
+}
+
+type cpResource struct {
+	Identifier string   `xml:"identifier,attr"`
+	Type       string   `xml:"type,attr"`
+	Href       string   `xml:"href,attr"`
+	Base       string   `xml:"base,attr"`
+	ScormType  string   `xml:"scormtype,attr"`
+	Files      []cpFile `xml:"file"`
+	Deps       []cpDep  `xml:"dependency"`
+}
+
+type cpFile struct {
+	Href string `xml:"href,attr"`
+}
+
+type cpDep struct {
+	IdentifierRef string `xml:"identifierref,attr"`
+}
+
+type cartridgeReader struct {
+	files     map[string]*zip.File
+	base      string
+	resources map[string]cpResource
+	out       *CartridgeImport
+}
+
+// ParseCartridge reads an IMS Common Cartridge (.imscc) or SCORM 1.2 ZIP.
+// Top-level organization items become modules; the first PDF found under an
+// item becomes its PDF, and QTI multiple-choice items become quizzes.
+// Anything else is reported in Warnings instead of failing the import.
+func ParseCartridge(r io.ReaderAt, size int64) (*CartridgeImport, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid zip: %w", err)
+	}
+
+	cr := &cartridgeReader{
+		files:     make(map[string]*zip.File),
+		resources: make(map[string]cpResource),
+		out:       &CartridgeImport{Modules: []CartridgeModule{}, Warnings: []string{}},
+	}
+	for _, f := range zr.File {
+		cr.files[path.Clean(f.Name)] = f
+	}
+
+	mf, ok := cr.files["imsmanifest.xml"]
+	if !ok {
+		return nil, errors.New("imsmanifest.xml not found in package")
+	}
+	data, err := readZipEntry(mf)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest cpManifest
+	if err := xml.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid imsmanifest.xml: %w", err)
+	}
+
+	cr.out.Format = detectCartridgeFormat(manifest, data)
+	if cr.out.Format == "imscp" {
+		cr.out.Warnings = append(cr.out.Warnings, "package is neither Common Cartridge nor SCORM 1.2; imported as a plain IMS content package")
+	}
+
+	cr.base = manifest.Resources.Base
+	for _, res := range manifest.Resources.Resources {
+		cr.resources[res.Identifier] = res
+	}
+
+	org := pickOrganization(manifest.Organizations)
+	if org == nil {
+		return nil, errors.New("manifest has no organization")
+	}
+
+	cr.out.Title = firstNonEmpty(strings.TrimSpace(manifest.Metadata.Title), strings.TrimSpace(org.Title), manifest.Identifier, "Imported course")
+	cr.out.Description = strings.TrimSpace(manifest.Metadata.Description)
+
+	items := org.Items
+	// Common Cartridge wraps everything in a single untitled root item.
+	if len(items) == 1 && items[0].IdentifierRef == "" && len(items[0].Items) > 0 {
+		items = items[0].Items
+	}
+
+	for i, item := range items {
+		module := CartridgeModule{
+			Title:   firstNonEmpty(strings.TrimSpace(item.Title), fmt.Sprintf("Module %d", i+1)),
+			Order:   i + 1,
+			Quizzes: []PackageQuiz{},
+		}
+		cr.collectItem(&module, item)
+		cr.out.Modules = append(cr.out.Modules, module)
+	}
+
+	if len(cr.out.Modules) == 0 {
+		cr.out.Warnings = append(cr.out.Warnings, "organization contains no items")
+	}
+
+	return cr.out, nil
+}
+
+func detectCartridgeFormat(m cpManifest, raw []byte) string {
+	schema := strings.ToLower(m.Metadata.Schema)
+	switch {
+	case strings.Contains(schema, "common cartridge") || bytes.Contains(raw, []byte("imsglobal.org/xsd/imsccv1")):
+		return "imscc"
+	case strings.Contains(schema, "scorm") || bytes.Contains(raw, []byte("adlnet.org/xsd/adlcp_rootv1p2")):
+		return "scorm12"
+	}
+	return "imscp"
+}
+
+func pickOrganization(orgs cpOrganizations) *cpOrganization {
+	for i := range orgs.Organizations {
+		if orgs.Organizations[i].Identifier == orgs.Default {
+			return &orgs.Organizations[i]
+		}
+	}
+	if len(orgs.Organizations) > 0 {
+		return &orgs.Organizations[0]
+	}
+	return nil
+}
+
+// collectItem maps the resource behind item and all nested items onto module.
+func (cr *cartridgeReader) collectItem(module *CartridgeModule, item cpItem) {
+	if item.IdentifierRef != "" {
+		res, ok := cr.resources[item.IdentifierRef]
+		if !ok {
+			cr.warn(module, "item %q references missing resource %s", item.Title, item.IdentifierRef)
+		} else {
+			cr.collectResource(module, item, res)
+		}
+	}
+	for _, child := range item.Items {
+		cr.collectItem(module, child)
+	}
+}
+
+func (cr *cartridgeReader) collectResource(module *CartridgeModule, item cpItem, res cpResource) {
+	typ := strings.ToLower(res.Type)
+
+	if strings.Contains(typ, "imsqti") {
+		cr.collectQTI(module, res)
+		return
+	}
+
+	// PDFs may sit on the resource itself or on a webcontent resource it
+	// depends on.
+	var pdfs []string
+	files := cr.resourceFiles(res)
+	for _, dep := range res.Deps {
+		if d, ok := cr.resources[dep.IdentifierRef]; ok {
+			files = append(files, cr.resourceFiles(d)...)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, href := range files {
+		if strings.HasSuffix(strings.ToLower(href), ".pdf") && !seen[href] {
+			seen[href] = true
+			pdfs = append(pdfs, href)
+		}
+	}
+
+	if len(pdfs) == 0 {
+		switch {
+		case strings.Contains(typ, "imswl"):
+			cr.warn(module, "web link %q cannot be converted", item.Title)
+		case strings.Contains(typ, "imsdt"):
+			cr.warn(module, "discussion topic %q cannot be converted", item.Title)
+		case strings.EqualFold(res.ScormType, "sco"):
+			cr.warn(module, "SCORM SCO %q is interactive content and cannot be converted", item.Title)
+		default:
+			cr.warn(module, "resource %q (%s) has no PDF and was skipped", item.Title, res.Type)
+		}
+		return
+	}
+
+	for _, href := range pdfs {
+		if module.PDF != nil {
+			cr.warn(module, "additional PDF %s skipped; a module holds one PDF", href)
+			continue
+		}
+		data, err := cr.read(href)
+		if err != nil {
+			cr.warn(module, "PDF %s: %s", href, err.Error())
+			continue
+		}
+		if !bytes.HasPrefix(data, []byte("%PDF-")) {
+			cr.warn(module, "file %s is not a valid PDF", href)
+			continue
+		}
+		module.PDF = data
+		module.PDFName = path.Base(href)
+	}
+}
+
+func (cr *cartridgeReader) collectQTI(module *CartridgeModule, res cpResource) {
+	for _, href := range cr.resourceFiles(res) {
+		if !strings.HasSuffix(strings.ToLower(href), ".xml") {
+			continue
+		}
+		data, err := cr.read(href)
+		if err != nil {
+			cr.warn(module, "QTI file %s: %s", href, err.Error())
+			continue
+		}
+		quizzes, warnings, err := ParseQTI12(data)
+		if err != nil {
+			cr.warn(module, "QTI file %s: %s", href, err.Error())
+			continue
+		}
+		module.Quizzes = append(module.Quizzes, quizzes...)
+		for _, w := range warnings {
+			cr.warn(module, "%s", w)
+		}
+	}
+}
+
+// resourceFiles lists the package paths of a resource's href and files,
+// resolved against xml:base and with duplicates removed.
+func (cr *cartridgeReader) resourceFiles(res cpResource) []string {
+	var out []string
+	seen := make(map[string]bool)
+	add := func(href string) {
+		if href == "" {
+			return
+		}
+		if unescaped, err := url.PathUnescape(href); err == nil {
+			href = unescaped
+		}
+		p := path.Clean(path.Join(cr.base, res.Base, href))
+		if !seen[p] {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	add(res.Href)
+	for _, f := range res.Files {
+		add(f.Href)
+	}
+	return out
+}
+
+func (cr *cartridgeReader) read(name string) ([]byte, error) {
+	f, ok := cr.files[name]
+	if !ok {
+		return nil, errors.New("missing from package")
+	}
+	return readZipEntry(f)
+}
+
+func (cr *cartridgeReader) warn(module *CartridgeModule, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if module != nil {
+		msg = module.Title + ": " + msg
+	}
+	cr.out.Warnings = append(cr.out.Warnings, msg)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
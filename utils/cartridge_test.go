@@ -0,0 +1,217 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// zipOf builds an in-memory ZIP from name/content pairs, in order.
+func zipOf(t *testing.T, entries ...string) *bytes.Reader {
+	t.Helper()
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	for i := 0; i+1 < len(entries); i += 2 {
+		w, err := zw.Create(entries[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(entries[i+1]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(b.Bytes())
+}
+
+const ccManifest = `<?xml version="1.0" encoding="UTF-8"?>
+<manifest identifier="cc1" xmlns="http://www.imsglobal.org/xsd/imsccv1p1/imscp_v1p1">
+  <metadata>
+    <schema>IMS Common Cartridge</schema>
+    <schemaversion>1.1.0</schemaversion>
+    <lomimscc:lom xmlns:lomimscc="http://ltsc.ieee.org/xsd/imsccv1p1/LOM/manifest">
+      <lomimscc:general>
+        <lomimscc:title><lomimscc:string>Intro to Go</lomimscc:string></lomimscc:title>
+        <lomimscc:description><lomimscc:string> Learn Go. </lomimscc:string></lomimscc:description>
+      </lomimscc:general>
+    </lomimscc:lom>
+  </metadata>
+  <organizations>
+    <organization identifier="org1" structure="rooted-hierarchy">
+      <item identifier="root">
+        <item identifier="i1"><title>Week 1</title>
+          <item identifier="i1a" identifierref="r_pdf1"><title>Slides</title></item>
+          <item identifier="i1b" identifierref="r_quiz"><title>Quiz</title></item>
+          <item identifier="i1c" identifierref="r_link"><title>Go website</title></item>
+        </item>
+        <item identifier="i2" identifierref="r_wrapper"><title>Week 2</title></item>
+        <item identifier="i3"><title> </title>
+          <item identifier="i3a" identifierref="r_missing"><title>Gone</title></item>
+          <item identifier="i3b" identifierref="r_fake"><title>Fake</title></item>
+          <item identifier="i3c" identifierref="r_two"><title>Two PDFs</title></item>
+        </item>
+      </item>
+    </organization>
+  </organizations>
+  <resources base="content/">
+    <resource identifier="r_pdf1" type="webcontent" href="week%201/slides.pdf"><file href="week%201/slides.pdf"/></resource>
+    <resource identifier="r_quiz" type="imsqti_xmlv1p2/imscc_xmlv1p1/assessment"><file href="quiz.xml"/></resource>
+    <resource identifier="r_link" type="imswl_xmlv1p1"><file href="link.xml"/></resource>
+    <resource identifier="r_wrapper" type="associatedcontent/imscc_xmlv1p1/learning-application-resource">
+      <dependency identifierref="r_pdf2"/>
+    </resource>
+    <resource identifier="r_pdf2" type="webcontent" base="week2/"><file href="notes.pdf"/></resource>
+    <resource identifier="r_fake" type="webcontent"><file href="fake.pdf"/></resource>
+    <resource identifier="r_two" type="webcontent"><file href="a.pdf"/><file href="b.pdf"/></resource>
+  </resources>
+</manifest>`
+
+func TestParseCartridgeCommonCartridge(t *testing.T) {
+	quiz := string(qti12Doc(
+		qti12Item("Capital", "", qti12Choices, qti12Correct("b")),
+		qti12Item("Essay", qti12Field("cc_profile", "cc.essay.v0p1"), `<material><mattext>Discuss.</mattext></material>`, ""),
+	))
+	r := zipOf(t,
+		"imsmanifest.xml", ccManifest,
+		"content/week 1/slides.pdf", "%PDF-1.4 week one",
+		"content/quiz.xml", quiz,
+		"content/link.xml", "<webLink/>",
+		"content/week2/notes.pdf", "%PDF-1.4 week two",
+		"content/fake.pdf", "<html>not a pdf</html>",
+		"content/a.pdf", "%PDF-1.4 a",
+		"content/b.pdf", "%PDF-1.4 b",
+	)
+
+	got, err := ParseCartridge(r, r.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Format != "imscc" || got.Title != "Intro to Go" || got.Description != "Learn Go." {
+		t.Errorf("format/title/description = %q %q %q", got.Format, got.Title, got.Description)
+	}
+	if len(got.Modules) != 3 {
+		t.Fatalf("modules = %d, want 3 (the root item is unwrapped)", len(got.Modules))
+	}
+
+	week1, week2, week3 := got.Modules[0], got.Modules[1], got.Modules[2]
+	if week1.Title != "Week 1" || week1.Order != 1 || week1.PDFName != "slides.pdf" || string(week1.PDF) != "%PDF-1.4 week one" {
+		t.Errorf("week 1 = %q #%d %q %q", week1.Title, week1.Order, week1.PDFName, week1.PDF)
+	}
+	if len(week1.Quizzes) != 1 || week1.Quizzes[0].Answer != "Jakarta & surroundings" {
+		t.Errorf("week 1 quizzes = %+v", week1.Quizzes)
+	}
+	if week2.PDFName != "notes.pdf" || string(week2.PDF) != "%PDF-1.4 week two" {
+		t.Errorf("week 2 PDF from a dependency = %q %q", week2.PDFName, week2.PDF)
+	}
+	if week3.Title != "Module 3" || string(week3.PDF) != "%PDF-1.4 a" {
+		t.Errorf("week 3 = %q %q", week3.Title, week3.PDF)
+	}
+
+	for _, want := range []string{
+		`Week 1: question "Essay": question type cc.essay.v0p1 is not supported`,
+		`Week 1: web link "Go website" cannot be converted`,
+		`Module 3: item "Gone" references missing resource r_missing`,
+		`Module 3: file content/fake.pdf is not a valid PDF`,
+		`Module 3: additional PDF content/b.pdf skipped; a module holds one PDF`,
+	} {
+		if !containsString(got.Warnings, want) {
+			t.Errorf("missing warning %q in %q", want, got.Warnings)
+		}
+	}
+}
+
+func TestParseCartridgeFormats(t *testing.T) {
+	scorm := `<manifest identifier="scorm1" xmlns:adlcp="http://www.adlnet.org/xsd/adlcp_rootv1p2">
+  <metadata><schema>ADL SCORM</schema><schemaversion>1.2</schemaversion></metadata>
+  <organizations default="org2">
+    <organization identifier="org1"><title>Wrong</title><item identifier="x"><title>X</title></item></organization>
+    <organization identifier="org2"><title>SCORM Course</title>
+      <item identifier="i1" identifierref="sco1"><title>Lesson</title></item>
+      <item identifier="i2" identifierref="asset1"><title>Handout</title></item>
+    </organization>
+  </organizations>
+  <resources>
+    <resource identifier="sco1" type="webcontent" adlcp:scormtype="sco" href="index.html"><file href="index.html"/></resource>
+    <resource identifier="asset1" type="webcontent" adlcp:scormtype="asset" href="handout.PDF"/>
+  </resources>
+</manifest>`
+	r := zipOf(t, "imsmanifest.xml", scorm, "index.html", "<html/>", "handout.PDF", "%PDF-1.3")
+	got, err := ParseCartridge(r, r.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Format != "scorm12" || got.Title != "SCORM Course" || len(got.Modules) != 2 {
+		t.Fatalf("SCORM = %q %q %d modules", got.Format, got.Title, len(got.Modules))
+	}
+	if got.Modules[1].PDFName != "handout.PDF" {
+		t.Errorf("handout PDF = %q", got.Modules[1].PDFName)
+	}
+	if !containsString(got.Warnings, `Lesson: SCORM SCO "Lesson" is interactive content and cannot be converted`) {
+		t.Errorf("warnings = %q", got.Warnings)
+	}
+
+	plain := `<manifest identifier="plain-pkg"><organizations><organization identifier="o"/></organizations><resources/></manifest>`
+	r = zipOf(t, "imsmanifest.xml", plain)
+	got, err = ParseCartridge(r, r.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Format != "imscp" || got.Title != "plain-pkg" || len(got.Modules) != 0 {
+		t.Errorf("plain package = %q %q %d modules", got.Format, got.Title, len(got.Modules))
+	}
+	if len(got.Warnings) != 2 || !strings.Contains(got.Warnings[0], "plain IMS content package") || got.Warnings[1] != "organization contains no items" {
+		t.Errorf("warnings = %q", got.Warnings)
+	}
+}
+
+func TestParseCartridgeMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data *bytes.Reader
+		want string
+	}{
+		{"not a zip", bytes.NewReader([]byte("%PDF-1.4 this is not a zip")), "invalid zip"},
+		{"truncated zip", func() *bytes.Reader {
+			full := zipOf(t, "imsmanifest.xml", ccManifest)
+			data := make([]byte, full.Size()/2)
+			full.Read(data)
+			return bytes.NewReader(data)
+		}(), "invalid zip"},
+		{"no manifest", zipOf(t, "course/imsmanifest.xml", ccManifest), "imsmanifest.xml not found"},
+		{"invalid XML", zipOf(t, "imsmanifest.xml", "<manifest><organizations>"), "invalid imsmanifest.xml"},
+		{"no organization", zipOf(t, "imsmanifest.xml", `<manifest identifier="m"><resources/></manifest>`), "manifest has no organization"},
+	}
+	for _, tt := range tests {
+		got, err := ParseCartridge(tt.data, tt.data.Size())
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: ParseCartridge = %+v, %v; want an error containing %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+// TestParseCartridgeStaysInPackage checks that hrefs climbing out of the
+// package resolve to nothing rather than to other entries.
+func TestParseCartridgeStaysInPackage(t *testing.T) {
+	manifest := `<manifest identifier="m"><organizations><organization identifier="o">
+  <item identifier="i" identifierref="r"><title>Escape</title></item>
+</organization></organizations>
+<resources><resource identifier="r" type="webcontent" href="../../etc/secret.pdf"/></resources></manifest>`
+	r := zipOf(t, "imsmanifest.xml", manifest, "secret.pdf", "%PDF-1.4 not for you")
+	got, err := ParseCartridge(r, r.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Modules[0].PDF != nil {
+		t.Errorf("PDF read through ../ href: %q", got.Modules[0].PDF)
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
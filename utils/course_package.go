@@ -0,0 +1,200 @@
+package utils
+
+import (
+	"archive/zip"
+	"backend-elearning/questions"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"time"
+)
+
+// CoursePackageVersion is bumped whenever the manifest layout changes in a
+// way older importers cannot read.
+const CoursePackageVersion = 1
+
+// ManifestName is the manifest entry inside an exported course ZIP.
+const ManifestName = "manifest.json"
+
+// maxPackageEntrySize caps how much of a single ZIP entry we are willing to
+// decompress, so a crafted package cannot exhaust memory.
+const maxPackageEntrySize = 100 << 20
+
+type CoursePackageManifest struct {
+	FormatVersion int             `json:"format_version"`
+	ExportedAt    time.Time       `json:"exported_at"`
+	Course        PackageCourse   `json:"course"`
+	Modules       []PackageModule `json:"modules"`
+}
+
+type PackageCourse struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+type PackageModule struct {
+	Title   string        `json:"title"`
+	Order   int           `json:"order"`
+	PDFFile string        `json:"pdf_file,omitempty"` // path inside the ZIP
+	PDFName string        `json:"pdf_name,omitempty"` // original upload name
+	Quizzes []PackageQuiz `json:"quizzes"`
+}
+
+// PackageQuiz is one question. Single-choice questions keep their options
+// and answer in Options and Answer; other types carry them in Data as
+// {"options": ..., "answer": ...}, the JSON the quiz API takes.
+type PackageQuiz struct {
+	Type        string          `json:"type,omitempty"` // empty for single choice
+	Question    string          `json:"question"`
+	Options     []string        `json:"options"`
+	Answer      string          `json:"answer"`
+	Data        json.RawMessage `json:"data,omitempty"`
+	Points      float64         `json:"points,omitempty"` // weight; 0 means 1
+	Explanation string          `json:"explanation,omitempty"`
+}
+
+// NewPackageQuiz packs a stored question.
+func NewPackageQuiz(typ, question, options, answer string) PackageQuiz {
+	quiz := PackageQuiz{Question: question}
+	if typ == "" || typ == questions.SingleChoice {
+		_ = json.Unmarshal([]byte(options), &quiz.Options)
+		quiz.Answer = answer
+		return quiz
+	}
+	quiz.Type = typ
+	quiz.Data, _ = json.Marshal(map[string]json.RawMessage{
+		"options": json.RawMessage(options),
+		"answer":  questions.AnswerJSON(typ, answer),
+	})
+	return quiz
+}
+
+// IsSingleChoice reports whether the question uses Options and Answer.
+func (q PackageQuiz) IsSingleChoice() bool {
+	return q.Type == "" || q.Type == questions.SingleChoice
+}
+
+// Definition returns the question in the form the quiz API takes.
+func (q PackageQuiz) Definition() questions.Definition {
+	def := questions.Definition{Type: q.Type, Question: q.Question}
+	if q.IsSingleChoice() {
+		def.Type = questions.SingleChoice
+		def.Options, _ = json.Marshal(q.Options)
+		def.Answer, _ = json.Marshal(q.Answer)
+		return def
+	}
+	var data struct {
+		Options json.RawMessage `json:"options"`
+		Answer  json.RawMessage `json:"answer"`
+	}
+	_ = json.Unmarshal(q.Data, &data)
+	def.Options, def.Answer = data.Options, data.Answer
+	return def
+}
+
+// PackageFile is a file written alongside the manifest.
+type PackageFile struct {
+	Name string
+	Body io.Reader
+}
+
+// CoursePackage is an opened package: the manifest plus access to the files
+// it references.
+type CoursePackage struct {
+	Manifest CoursePackageManifest
+	files    map[string]*zip.File
+}
+
+// WriteCoursePackage writes manifest.json followed by files to w.
+func WriteCoursePackage(w io.Writer, manifest CoursePackageManifest, files []PackageFile) error {
+	zw := zip.NewWriter(w)
+
+	mw, err := zw.Create(ManifestName)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(mw)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(manifest); err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		fw, err := zw.Create(f.Name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(fw, f.Body); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// OpenCoursePackage reads and decodes the manifest of a course package.
+func OpenCoursePackage(r io.ReaderAt, size int64) (*CoursePackage, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid zip: %w", err)
+	}
+
+	pkg := &CoursePackage{files: make(map[string]*zip.File)}
+	for _, f := range zr.File {
+		pkg.files[path.Clean(f.Name)] = f
+	}
+
+	mf, ok := pkg.files[ManifestName]
+	if !ok {
+		return nil, errors.New("manifest.json not found in package")
+	}
+	data, err := readZipEntry(mf)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &pkg.Manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if pkg.Manifest.FormatVersion < 1 || pkg.Manifest.FormatVersion > CoursePackageVersion {
+		return nil, fmt.Errorf("unsupported package format version %d", pkg.Manifest.FormatVersion)
+	}
+
+	return pkg, nil
+}
+
+// HasFile reports whether the package contains the given entry.
+func (p *CoursePackage) HasFile(name string) bool {
+	_, ok := p.files[path.Clean(name)]
+	return ok
+}
+
+// ReadFile returns the content of a package entry.
+func (p *CoursePackage) ReadFile(name string) ([]byte, error) {
+	f, ok := p.files[path.Clean(name)]
+	if !ok {
+		return nil, fmt.Errorf("%s not found in package", name)
+	}
+	return readZipEntry(f)
+}
+
+func readZipEntry(f *zip.File) ([]byte, error) {
+	if f.UncompressedSize64 > maxPackageEntrySize {
+		return nil, fmt.Errorf("%s is too large", f.Name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, maxPackageEntrySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxPackageEntrySize {
+		return nil, fmt.Errorf("%s is too large", f.Name)
+	}
+	return data, nil
+}
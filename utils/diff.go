@@ -0,0 +1,78 @@
+package utils
+
+import "strings"
+
+// DiffLine is one line of a line diff: Op is " " (unchanged), "-" (only in
+// the old text) or "+" (only in the new text).
+type DiffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// maxDiffCells bounds the LCS table; longer texts are diffed as a whole
+// replacement.
+const maxDiffCells = 1 << 20
+
+// LineDiff returns the line-by-line changes from a to b, based on the
+// longest common subsequence of lines.
+func LineDiff(a, b string) []DiffLine {
+	x, y := splitLines(a), splitLines(b)
+	out := []DiffLine{}
+
+	if len(x)*len(y) > maxDiffCells {
+		for _, l := range x {
+			out = append(out, DiffLine{"-", l})
+		}
+		for _, l := range y {
+			out = append(out, DiffLine{"+", l})
+		}
+		return out
+	}
+
+	// lcs[i][j] is the LCS length of x[i:] and y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			out = append(out, DiffLine{" ", x[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, DiffLine{"-", x[i]})
+			i++
+		default:
+			out = append(out, DiffLine{"+", y[j]})
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		out = append(out, DiffLine{"-", x[i]})
+	}
+	for ; j < len(y); j++ {
+		out = append(out, DiffLine{"+", y[j]})
+	}
+	return out
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+}
@@ -0,0 +1,434 @@
+package utils
+
+import (
+	"backend-elearning/questions"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// Moodle GIFT: one question per paragraph, the answers in braces.
+//
+//	Ibu kota Indonesia? {=Jakarta ~Bandung ~Surabaya ####Sejak 1961.}
+//
+// Single and multiple choice, true/false, numeric, short answer, matching
+// and essay questions are read. GIFT has no weights or rubrics, so they go
+// in comments before the question ("// points: 2", "// rubric:
+// Clarity=4|Argument=6") that other tools ignore. Ordering questions
+// cannot be written in GIFT.
+
+// ParseGIFT reads a GIFT file.
+func ParseGIFT(data []byte) []QuizFileRow {
+	var rows []QuizFileRow
+	var block []string
+	start := 0
+	meta := map[string]string{}
+
+	flush := func() {
+		if len(block) > 0 {
+			row := QuizFileRow{Line: start}
+			item, err := parseGIFTQuestion(strings.Join(block, "\n"), meta)
+			row.Item = item
+			if err != nil {
+				row.Error = err.Error()
+			}
+			rows = append(rows, row)
+		}
+		block = nil
+		meta = map[string]string{}
+	}
+
+	sc := bufio.NewScanner(strings.NewReader(strings.TrimPrefix(string(data), "\ufeff")))
+	sc.Buffer(make([]byte, 64<<10), 4<<20)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimRight(sc.Text(), "\r")
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			flush()
+		case strings.HasPrefix(trimmed, "//"):
+			if kv := strings.SplitN(strings.TrimSpace(trimmed[2:]), ":", 2); len(kv) == 2 {
+				key := strings.ToLower(strings.TrimSpace(kv[0]))
+				if key == "points" || key == "rubric" {
+					meta[key] = strings.TrimSpace(kv[1])
+				}
+			}
+		case strings.HasPrefix(trimmed, "$CATEGORY:"):
+			flush()
+		default:
+			if len(block) == 0 {
+				start = n
+			}
+			block = append(block, line)
+		}
+	}
+	flush()
+	return rows
+}
+
+type giftAnswer struct {
+	Mark   rune // '=' or '~'
+	Weight float64
+	Text   string
+}
+
+func parseGIFTQuestion(text string, meta map[string]string) (QuizItem, error) {
+	var item QuizItem
+	if s, ok := meta["points"]; ok {
+		points, err := parseDecimal(s)
+		if err != nil {
+			return item, fmt.Errorf("points: %v", err)
+		}
+		item.Points = points
+	}
+
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "::") {
+		if end := indexUnescaped(text[2:], "::"); end >= 0 {
+			text = strings.TrimSpace(text[end+4:])
+		}
+	}
+
+	from := indexUnescaped(text, "{")
+	if from < 0 {
+		return item, errors.New("no answers in braces")
+	}
+	to := indexUnescaped(text[from:], "}")
+	if to < 0 {
+		return item, errors.New("the answers are missing their closing brace")
+	}
+	to += from
+	stem, body, after := text[:from], text[from+1:to], strings.TrimSpace(text[to+1:])
+	if after != "" {
+		stem = strings.TrimSpace(stem) + " _____ " + after
+	}
+	item.Question = giftText(stem)
+	if item.Question == "" {
+		return item, errors.New("question text is empty")
+	}
+
+	if i := indexUnescaped(body, "####"); i >= 0 {
+		item.Explanation = giftText(body[i+4:])
+		body = body[:i]
+	}
+	body = strings.TrimSpace(body)
+
+	var p quizParts
+	var typ string
+	switch {
+	case body == "":
+		typ = questions.Essay
+		p.Rubric = questions.Rubric{{Criterion: "Overall", Points: 1}}
+		if s, ok := meta["rubric"]; ok {
+			rubric, err := parseRubric(s)
+			if err != nil {
+				return item, err
+			}
+			p.Rubric = rubric
+		}
+
+	case strings.HasPrefix(body, "#"):
+		typ = questions.Numeric
+		value := body[1:]
+		if indexUnescaped(value, "=") >= 0 {
+			value = ""
+			for _, a := range giftAnswers(body[1:]) {
+				if a.Mark == '=' && a.Weight == 100 {
+					value = a.Text
+					break
+				}
+			}
+		} else if i := indexUnescaped(value, "#"); i >= 0 {
+			value = value[:i]
+		}
+		var err error
+		if p.Value, p.Tolerance, err = giftNumber(strings.TrimSpace(value)); err != nil {
+			return item, err
+		}
+
+	default:
+		head := body
+		if i := indexUnescaped(head, "#"); i >= 0 {
+			head = head[:i]
+		}
+		switch strings.ToUpper(strings.TrimSpace(head)) {
+		case "T", "TRUE":
+			typ, p.Correct = questions.TrueFalse, []string{"true"}
+		case "F", "FALSE":
+			typ, p.Correct = questions.TrueFalse, []string{"false"}
+		}
+		if typ != "" {
+			break
+		}
+
+		answers := giftAnswers(body)
+		if len(answers) == 0 {
+			return item, errors.New("no answers found")
+		}
+		var rights, wrongs, weighted int
+		matching := false
+		for _, a := range answers {
+			if a.Mark == '=' {
+				rights++
+				matching = matching || strings.Contains(a.Text, "\x00")
+			} else {
+				wrongs++
+				if a.Weight > 0 {
+					weighted++
+				}
+			}
+		}
+
+		switch {
+		case matching:
+			typ = questions.Matching
+			for _, a := range answers {
+				pair := strings.SplitN(a.Text, "\x00", 2)
+				if a.Mark != '=' || len(pair) != 2 {
+					return item, errors.New("every answer of a matching question must be =prompt -> choice")
+				}
+				prompt, choice := strings.TrimSpace(pair[0]), strings.TrimSpace(pair[1])
+				if prompt != "" {
+					p.Prompts = append(p.Prompts, prompt)
+					p.Correct = append(p.Correct, choice)
+				}
+				if !containsText(p.Options, choice) {
+					p.Options = append(p.Options, choice)
+				}
+			}
+		case wrongs == 0:
+			typ = questions.ShortText
+			for _, a := range answers {
+				p.Correct = append(p.Correct, a.Text)
+			}
+		case rights == 1 && weighted == 0:
+			typ = questions.SingleChoice
+			for _, a := range answers {
+				p.Options = append(p.Options, a.Text)
+				if a.Mark == '=' {
+					p.Correct = []string{a.Text}
+				}
+			}
+		default:
+			typ = questions.MultipleSelect
+			for _, a := range answers {
+				p.Options = append(p.Options, a.Text)
+				if a.Mark == '=' || a.Weight > 0 {
+					p.Correct = append(p.Correct, a.Text)
+				}
+			}
+		}
+	}
+
+	item.Definition = joinQuiz(typ, item.Question, p)
+	return item, nil
+}
+
+// giftAnswers splits an answer block into its =right and ~wrong answers,
+// dropping their feedback. The arrow of a matching pair becomes "\x00".
+func giftAnswers(body string) []giftAnswer {
+	var answers []giftAnswer
+	var marks []int
+	escaped := false
+	for i, r := range body {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '=' || r == '~':
+			marks = append(marks, i)
+		}
+	}
+	for k, at := range marks {
+		end := len(body)
+		if k+1 < len(marks) {
+			end = marks[k+1]
+		}
+		a := giftAnswer{Mark: rune(body[at]), Text: body[at+1 : end]}
+		if a.Mark == '=' {
+			a.Weight = 100
+		}
+		if t := strings.TrimSpace(a.Text); strings.HasPrefix(t, "%") {
+			if i := strings.Index(t[1:], "%"); i >= 0 {
+				if w, err := parseDecimal(t[1 : i+1]); err == nil {
+					a.Weight = w
+				}
+				a.Text = t[i+2:]
+			}
+		}
+		if i := indexUnescaped(a.Text, "#"); i >= 0 {
+			a.Text = a.Text[:i]
+		}
+		if i := indexUnescaped(a.Text, "->"); i >= 0 {
+			a.Text = giftText(a.Text[:i]) + "\x00" + giftText(a.Text[i+2:])
+		} else {
+			a.Text = giftText(a.Text)
+		}
+		answers = append(answers, a)
+	}
+	return answers
+}
+
+// giftNumber reads 9.81, 9.81:0.05 or the range 9.7..9.9.
+func giftNumber(s string) (float64, float64, error) {
+	if parts := strings.SplitN(s, "..", 2); len(parts) == 2 {
+		lo, err1 := parseDecimal(parts[0])
+		hi, err2 := parseDecimal(parts[1])
+		if err1 != nil || err2 != nil || hi < lo {
+			return 0, 0, fmt.Errorf("numeric answer %q is not a valid range", s)
+		}
+		return (lo + hi) / 2, (hi - lo) / 2, nil
+	}
+	parts := strings.SplitN(s, ":", 2)
+	value, err := parseDecimal(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("numeric answer: %v", err)
+	}
+	tolerance := 0.0
+	if len(parts) == 2 {
+		if tolerance, err = parseDecimal(parts[1]); err != nil {
+			return 0, 0, fmt.Errorf("numeric tolerance: %v", err)
+		}
+	}
+	return value, tolerance, nil
+}
+
+// giftText resolves the escapes of a GIFT text and drops a [format]
+// prefix, turning [html] into plain text.
+func giftText(s string) string {
+	s = strings.TrimSpace(s)
+	html := false
+	for _, f := range []string{"[html]", "[moodle]", "[plain]", "[markdown]"} {
+		if strings.HasPrefix(strings.ToLower(s), f) {
+			html = f == "[html]"
+			s = s[len(f):]
+			break
+		}
+	}
+
+	var b strings.Builder
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			if r == 'n' {
+				r = '\n'
+			}
+			b.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		default:
+			b.WriteRune(r)
+		}
+	}
+	s = strings.TrimSpace(b.String())
+	if html {
+		s = PlainText(s)
+	}
+	return s
+}
+
+// indexUnescaped is strings.Index ignoring matches preceded by a backslash.
+func indexUnescaped(s, sub string) int {
+	escaped := false
+	for i, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case strings.HasPrefix(s[i:], sub):
+			return i
+		}
+	}
+	return -1
+}
+
+// WriteGIFT writes items as a GIFT file. Ordering questions are left out
+// with a comment saying so.
+func WriteGIFT(w io.Writer, items []QuizItem) error {
+	bw := bufio.NewWriter(w)
+	for n, item := range items {
+		p, err := splitQuiz(item.Definition)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			bw.WriteString("\n")
+		}
+		if item.Type == questions.Ordering {
+			fmt.Fprintf(bw, "// question %d left out: GIFT has no ordering questions\n// %s\n", n+1, strings.ReplaceAll(item.Question, "\n", " "))
+			continue
+		}
+		if item.Points != 0 && item.Points != 1 {
+			fmt.Fprintf(bw, "// points: %s\n", formatDecimal(item.Points))
+		}
+		if item.Type == questions.Essay {
+			fmt.Fprintf(bw, "// rubric: %s\n", formatRubric(p.Rubric))
+		}
+
+		var answers []string
+		switch item.Type {
+		case "", questions.SingleChoice:
+			for _, o := range p.Options {
+				mark := "~"
+				if o == p.Correct[0] {
+					mark = "="
+				}
+				answers = append(answers, mark+giftEscape(o))
+			}
+		case questions.MultipleSelect:
+			share := formatDecimal(math.Round(100/float64(len(p.Correct))*1e5) / 1e5)
+			for _, o := range p.Options {
+				weight := "-" + share
+				if containsText(p.Correct, o) {
+					weight = share
+				}
+				answers = append(answers, "~%"+weight+"%"+giftEscape(o))
+			}
+		case questions.TrueFalse:
+			answers = append(answers, strings.ToUpper(p.Correct[0]))
+		case questions.Numeric:
+			answer := "#" + formatDecimal(p.Value)
+			if p.Tolerance > 0 {
+				answer += ":" + formatDecimal(p.Tolerance)
+			}
+			answers = append(answers, answer)
+		case questions.ShortText:
+			for _, v := range p.Correct {
+				answers = append(answers, "="+giftEscape(v))
+			}
+		case questions.Matching:
+			for i, prompt := range p.Prompts {
+				answers = append(answers, "="+giftEscape(prompt)+" -> "+giftEscape(p.Correct[i]))
+			}
+			for _, choice := range p.Options {
+				if !containsText(p.Correct, choice) {
+					answers = append(answers, "= -> "+giftEscape(choice))
+				}
+			}
+		}
+		if item.Explanation != "" {
+			answers = append(answers, "####"+giftEscape(item.Explanation))
+		}
+
+		bw.WriteString(giftEscape(item.Question) + " {")
+		for _, a := range answers {
+			bw.WriteString("\n\t" + a)
+		}
+		if len(answers) > 0 {
+			bw.WriteString("\n")
+		}
+		bw.WriteString("}\n")
+	}
+	return bw.Flush()
+}
+
+func giftEscape(s string) string {
+	return strings.ReplaceAll(escapeChars(s, "~=#{}:"), "\n", `\n`)
+}
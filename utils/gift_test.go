@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseGIFT(t *testing.T) {
+	data := "\ufeff// A Moodle export\n" +
+		"$CATEGORY: $course$/Week 1\n" +
+		"\n" +
+		"::Q1:: Ibu kota Indonesia? {=Jakarta ~Bandung ~Surabaya ####Sejak 1961.}\n" +
+		"\n" +
+		"// points: 2\n" +
+		"Which are prime? {\n" +
+		"\t~%50%2 #right\n" +
+		"\t~%50%3\n" +
+		"\t~%-100%4\n" +
+		"}\n" +
+		"\n" +
+		"The sky is green.{F}\n" +
+		"\n" +
+		"::g:: Gravity? {#9.81:0.05}\n" +
+		"\n" +
+		"Between? {#9.5..10.5}\n" +
+		"\n" +
+		"Legs? {#\n\t=%100%4\n\t=%50%3\n}\n" +
+		"\n" +
+		"Capital of France? {=Paris =paris}\n" +
+		"\n" +
+		"Match {\n\t=cat -> meow\n\t=dog -> woof\n\t= -> moo\n}\n" +
+		"\n" +
+		"// rubric: Clarity=4|Argument=6\n" +
+		"[html]<p>Discuss <b>freedom</b>.</p> {}\n" +
+		"\n" +
+		"Two plus {=two ~three} is four.\n" +
+		"\n" +
+		"Escaped \\{braces\\} and \\= sign {=a\\~b ~c}\n"
+
+	rows := ParseGIFT([]byte(data))
+	want := []struct {
+		line            int
+		typ, question   string
+		options, answer string
+	}{
+		{4, "single_choice", "Ibu kota Indonesia?", `["Jakarta","Bandung","Surabaya"]`, `Jakarta`},
+		{7, "multiple_select", "Which are prime?", `["2","3","4"]`, `["2","3"]`},
+		{13, "true_false", "The sky is green.", `["true","false"]`, `false`},
+		{15, "numeric", "Gravity?", `[]`, `{"value":9.81,"tolerance":0.05}`},
+		{17, "numeric", "Between?", `[]`, `{"value":10,"tolerance":0.5}`},
+		{19, "numeric", "Legs?", `[]`, `{"value":4,"tolerance":0}`},
+		{24, "short_text", "Capital of France?", `[]`, `["Paris","paris"]`},
+		{26, "matching", "Match", `{"prompts":["cat","dog"],"choices":["meow","woof","moo"]}`, `{"cat":"meow","dog":"woof"}`},
+		{33, "essay", "Discuss freedom .", `[]`, `[{"criterion":"Clarity","points":4},{"criterion":"Argument","points":6}]`},
+		{35, "single_choice", "Two plus _____ is four.", `["two","three"]`, `two`},
+		{37, "single_choice", "Escaped {braces} and = sign", `["a~b","c"]`, `a~b`},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("rows = %d, want %d: %+v", len(rows), len(want), rows)
+	}
+	for i, w := range want {
+		row := rows[i]
+		if row.Error != "" {
+			t.Errorf("line %d: %s", row.Line, row.Error)
+			continue
+		}
+		options, answer, err := row.Item.Definition.Validate()
+		if row.Line != w.line || row.Item.Type != w.typ || row.Item.Question != w.question || options != w.options || answer != w.answer || err != nil {
+			t.Errorf("row %d = line %d %s %q %s %s %v\n want line %d %s %q %s %s", i, row.Line, row.Item.Type, row.Item.Question, options, answer, err,
+				w.line, w.typ, w.question, w.options, w.answer)
+		}
+	}
+	if rows[0].Item.Explanation != "Sejak 1961." || rows[1].Item.Points != 2 {
+		t.Errorf("explanation %q, points %v", rows[0].Item.Explanation, rows[1].Item.Points)
+	}
+}
+
+func TestParseGIFTErrors(t *testing.T) {
+	tests := []struct {
+		question, want string
+	}{
+		{"No answers here.", "no answers in braces"},
+		{"Unclosed {=a ~b", "missing their closing brace"},
+		{"{=a ~b}", "question text is empty"},
+		{"::Title:: {=a}", "question text is empty"},
+		{"Q {#ten}", "numeric answer:"},
+		{"Q {#5:wide}", "numeric tolerance:"},
+		{"Q {#9..1}", "not a valid range"},
+		{"Q {abc}", "no answers found"},
+		{"Q {=cat -> meow ~dog}", "every answer of a matching question"},
+		{"// points: lots\nQ {T}", "points:"},
+		{"// rubric: Clarity\nQ {}", `rubric criterion "Clarity" needs its points`},
+	}
+	for _, tt := range tests {
+		rows := ParseGIFT([]byte(tt.question))
+		if len(rows) != 1 || !strings.Contains(rows[0].Error, tt.want) {
+			t.Errorf("%q: rows = %+v, want an error containing %q", tt.question, rows, tt.want)
+		}
+	}
+
+	if rows := ParseGIFT(nil); len(rows) != 0 {
+		t.Errorf("empty file = %+v", rows)
+	}
+	if rows := ParseGIFT([]byte("// only comments\n$CATEGORY: x\n")); len(rows) != 0 {
+		t.Errorf("comments only = %+v", rows)
+	}
+}
+
+func TestWriteGIFTOrdering(t *testing.T) {
+	items := sampleQuizItems()
+	var b strings.Builder
+	if err := WriteGIFT(&b, items[6:7]); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "// question 1 left out: GIFT has no ordering questions") {
+		t.Errorf("WriteGIFT(ordering) = %q", b.String())
+	}
+	if rows := ParseGIFT([]byte(b.String())); len(rows) != 0 {
+		t.Errorf("the note reads back as %+v", rows)
+	}
+}
@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RenderMarkdown converts the small Markdown subset instructors use in
+// content blocks (headings, paragraphs, lists, quotes, code, emphasis and
+// links) to HTML. Raw HTML in the source is always escaped and links are
+// limited to http, https, mailto and site-relative URLs, so the output is
+// safe to inject into the page.
+func RenderMarkdown(src string) string {
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+
+	var out strings.Builder
+	var para []string
+	listTag := ""
+
+	flushPara := func() {
+		if len(para) > 0 {
+			out.WriteString("<p>" + renderInline(strings.Join(para, " ")) + "</p>\n")
+			para = nil
+		}
+	}
+	closeList := func() {
+		if listTag != "" {
+			out.WriteString("</" + listTag + ">\n")
+			listTag = ""
+		}
+	}
+	openList := func(tag string) {
+		if listTag != tag {
+			closeList()
+			out.WriteString("<" + tag + ">\n")
+			listTag = tag
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(trimmed, "```"):
+			flushPara()
+			closeList()
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			out.WriteString("<pre><code>" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>\n")
+
+		case trimmed == "":
+			flushPara()
+			closeList()
+
+		case headingPattern.MatchString(trimmed):
+			flushPara()
+			closeList()
+			m := headingPattern.FindStringSubmatch(trimmed)
+			level := string(rune('0' + len(m[1])))
+			out.WriteString("<h" + level + ">" + renderInline(m[2]) + "</h" + level + ">\n")
+
+		case strings.HasPrefix(trimmed, ">"):
+			flushPara()
+			closeList()
+			out.WriteString("<blockquote>" + renderInline(strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))) + "</blockquote>\n")
+
+		case bulletPattern.MatchString(trimmed):
+			flushPara()
+			openList("ul")
+			out.WriteString("<li>" + renderInline(bulletPattern.ReplaceAllString(trimmed, "")) + "</li>\n")
+
+		case orderedPattern.MatchString(trimmed):
+			flushPara()
+			openList("ol")
+			out.WriteString("<li>" + renderInline(orderedPattern.ReplaceAllString(trimmed, "")) + "</li>\n")
+
+		default:
+			closeList()
+			para = append(para, trimmed)
+		}
+	}
+	flushPara()
+	closeList()
+
+	return out.String()
+}
+
+var (
+	headingPattern = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	bulletPattern  = regexp.MustCompile(`^[-*+]\s+`)
+	orderedPattern = regexp.MustCompile(`^\d+[.)]\s+`)
+
+	codeSpanPattern = regexp.MustCompile("`([^`]+)`")
+	linkPattern     = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	boldPattern     = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	italicPattern   = regexp.MustCompile(`\*([^*]+)\*`)
+)
+
+// renderInline escapes text first and only then adds markup, so nothing
+// from the source can open its own tags.
+func renderInline(text string) string {
+	// Pull code spans out so their content is not formatted. NUL bytes mark
+	// their placeholders, so strip any from the source first.
+	text = strings.ReplaceAll(text, "\x00", "")
+	var spans []string
+	text = codeSpanPattern.ReplaceAllStringFunc(text, func(s string) string {
+		spans = append(spans, s[1:len(s)-1])
+		return "\x00" + strconv.Itoa(len(spans)-1) + "\x00"
+	})
+
+	text = html.EscapeString(text)
+
+	text = linkPattern.ReplaceAllStringFunc(text, func(s string) string {
+		m := linkPattern.FindStringSubmatch(s)
+		href := html.UnescapeString(m[2])
+		if !SafeLinkURL(href) {
+			return m[1]
+		}
+		return `<a href="` + html.EscapeString(href) + `" rel="noopener noreferrer" target="_blank">` + m[1] + `</a>`
+	})
+	text = boldPattern.ReplaceAllString(text, "<strong>$1</strong>")
+	text = italicPattern.ReplaceAllString(text, "<em>$1</em>")
+
+	for i, code := range spans {
+		text = strings.Replace(text, "\x00"+strconv.Itoa(i)+"\x00", "<code>"+html.EscapeString(code)+"</code>", 1)
+	}
+	return text
+}
+
+// SafeLinkURL reports whether a URL may be rendered as a link.
+func SafeLinkURL(u string) bool {
+	lower := strings.ToLower(strings.TrimSpace(u))
+	return strings.HasPrefix(lower, "http://") ||
+		strings.HasPrefix(lower, "https://") ||
+		strings.HasPrefix(lower, "mailto:") ||
+		(strings.HasPrefix(lower, "/") && !strings.HasPrefix(lower, "//"))
+}
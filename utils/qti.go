@@ -0,0 +1,211 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// QTI 1.2 as used by Common Cartridge assessments and question banks.
+
+type qtiItem struct {
+	Ident        string             `xml:"ident,attr"`
+	Title        string             `xml:"title,attr"`
+	Metadata     []qtiMetaField     `xml:"itemmetadata>qtimetadata>qtimetadatafield"`
+	Presentation qtiPresentation    `xml:"presentation"`
+	Conditions   []qtiRespCondition `xml:"resprocessing>respcondition"`
+}
+
+type qtiMetaField struct {
+	Label string `xml:"fieldlabel"`
+	Entry string `xml:"fieldentry"`
+}
+
+type qtiPresentation struct {
+	Materials   []qtiMaterial     `xml:"material"`
+	ResponseLid []qtiResponseLid  `xml:"response_lid"`
+	ResponseStr []struct{}        `xml:"response_str"`
+	ResponseNum []struct{}        `xml:"response_num"`
+	Flows       []qtiPresentation `xml:"flow"`
+}
+
+type qtiMaterial struct {
+	Texts []string `xml:"mattext"`
+}
+
+type qtiResponseLid struct {
+	Ident        string             `xml:"ident,attr"`
+	Rcardinality string             `xml:"rcardinality,attr"`
+	Labels       []qtiResponseLabel `xml:"render_choice>response_label"`
+	FlowLabels   []qtiResponseLabel `xml:"render_choice>flow_label>response_label"`
+}
+
+type qtiResponseLabel struct {
+	Ident     string        `xml:"ident,attr"`
+	Materials []qtiMaterial `xml:"material"`
+}
+
+type qtiRespCondition struct {
+	VarEqual []qtiVarEqual `xml:"conditionvar>varequal"`
+	SetVar   []qtiSetVar   `xml:"setvar"`
+}
+
+type qtiVarEqual struct {
+	RespIdent string `xml:"respident,attr"`
+	Value     string `xml:",chardata"`
+}
+
+type qtiSetVar struct {
+	Action string `xml:"action,attr"`
+	Value  string `xml:",chardata"`
+}
+
+// ParseQTI12 extracts single-answer multiple-choice items from a QTI 1.2
+// document (questestinterop). Items it cannot convert are described in the
+// returned warnings.
+func ParseQTI12(data []byte) ([]PackageQuiz, []string, error) {
+	var quizzes []PackageQuiz
+	var warnings []string
+
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid QTI document: %w", err)
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "item" {
+			continue
+		}
+
+		var item qtiItem
+		if err := dec.DecodeElement(&item, &start); err != nil {
+			return nil, nil, fmt.Errorf("invalid QTI item: %w", err)
+		}
+
+		quiz, reason := convertQTI12Item(item)
+		if reason != "" {
+			warnings = append(warnings, fmt.Sprintf("question %q: %s", qtiItemLabel(item), reason))
+			continue
+		}
+		quizzes = append(quizzes, quiz)
+	}
+
+	return quizzes, warnings, nil
+}
+
+func convertQTI12Item(item qtiItem) (PackageQuiz, string) {
+	var quiz PackageQuiz
+
+	for _, f := range item.Metadata {
+		label := strings.ToLower(f.Label)
+		if label != "cc_profile" && label != "question_type" && label != "qmd_itemtype" {
+			continue
+		}
+		entry := strings.ToLower(f.Entry)
+		if !strings.Contains(entry, "multiple_choice") && !strings.Contains(entry, "true_false") && !strings.Contains(entry, "multiple choice") {
+			return quiz, fmt.Sprintf("question type %s is not supported", f.Entry)
+		}
+	}
+
+	texts, lids := flattenQTIPresentation(item.Presentation)
+	if len(lids) != 1 {
+		return quiz, "not a single-response multiple-choice item"
+	}
+	lid := lids[0]
+	if strings.EqualFold(lid.Rcardinality, "Multiple") {
+		return quiz, "multiple-response items are not supported"
+	}
+
+	quiz.Question = strings.TrimSpace(strings.Join(texts, "\n"))
+	if quiz.Question == "" {
+		return quiz, "question text is empty"
+	}
+
+	labels := append(lid.Labels, lid.FlowLabels...)
+	optionByIdent := make(map[string]string)
+	for _, l := range labels {
+		var parts []string
+		for _, m := range l.Materials {
+			for _, t := range m.Texts {
+				parts = append(parts, PlainText(t))
+			}
+		}
+		option := strings.TrimSpace(strings.Join(parts, " "))
+		optionByIdent[l.Ident] = option
+		quiz.Options = append(quiz.Options, option)
+	}
+	if len(quiz.Options) < 2 {
+		return quiz, fmt.Sprintf("has %d options; quizzes need at least 2", len(quiz.Options))
+	}
+
+	for _, cond := range item.Conditions {
+		if len(cond.VarEqual) != 1 || !qtiAwardsPoints(cond.SetVar) {
+			continue
+		}
+		ve := cond.VarEqual[0]
+		if ve.RespIdent != "" && ve.RespIdent != lid.Ident {
+			continue
+		}
+		if option, ok := optionByIdent[strings.TrimSpace(ve.Value)]; ok {
+			quiz.Answer = option
+			break
+		}
+	}
+	if quiz.Answer == "" {
+		return quiz, "no correct answer found"
+	}
+
+	return quiz, ""
+}
+
+func flattenQTIPresentation(p qtiPresentation) ([]string, []qtiResponseLid) {
+	var texts []string
+	for _, m := range p.Materials {
+		for _, t := range m.Texts {
+			texts = append(texts, PlainText(t))
+		}
+	}
+	lids := p.ResponseLid
+	for _, f := range p.Flows {
+		t, l := flattenQTIPresentation(f)
+		texts = append(texts, t...)
+		lids = append(lids, l...)
+	}
+	return texts, lids
+}
+
+func qtiAwardsPoints(vars []qtiSetVar) bool {
+	for _, v := range vars {
+		if strings.EqualFold(v.Action, "Subtract") {
+			continue
+		}
+		if n, err := strconv.ParseFloat(strings.TrimSpace(v.Value), 64); err == nil && n > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func qtiItemLabel(item qtiItem) string {
+	return firstNonEmpty(item.Title, item.Ident)
+}
+
+var htmlTagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// PlainText strips HTML tags and entities from rich text exported by other
+// LMSs, collapsing whitespace.
+func PlainText(s string) string {
+	s = htmlTagPattern.ReplaceAllString(s, " ")
+	s = html.UnescapeString(s)
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,546 @@
+package utils
+
+import (
+	"archive/zip"
+	"backend-elearning/questions"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// QTI 2.1 items: a ZIP content package with one assessmentItem file per
+// question, or a bare XML document of items. Choice, order, match, text
+// entry and extended text interactions are read. The weight of a question
+// is its MAXSCORE; an essay rubric is listed in a rubricBlock for scorers.
+
+const qti21Namespace = "http://www.imsglobal.org/xsd/imsqti_v2p1"
+
+type qti21Item struct {
+	Identifier string          `xml:"identifier,attr"`
+	Title      string          `xml:"title,attr"`
+	Responses  []qti21Response `xml:"responseDeclaration"`
+	Outcomes   []qti21Outcome  `xml:"outcomeDeclaration"`
+	Body       qti21Inner      `xml:"itemBody"`
+	Processing qti21Inner      `xml:"responseProcessing"`
+	Feedback   []qti21Inner    `xml:"modalFeedback"`
+}
+
+type qti21Inner struct {
+	XML string `xml:",innerxml"`
+}
+
+type qti21Response struct {
+	Identifier string   `xml:"identifier,attr"`
+	BaseType   string   `xml:"baseType,attr"`
+	Correct    []string `xml:"correctResponse>value"`
+	Mapping    []struct {
+		Key string `xml:"mapKey,attr"`
+	} `xml:"mapping>mapEntry"`
+}
+
+type qti21Outcome struct {
+	Identifier string   `xml:"identifier,attr"`
+	Default    []string `xml:"defaultValue>value"`
+}
+
+type qti21Interaction struct {
+	XMLName    xml.Name
+	Response   string        `xml:"responseIdentifier,attr"`
+	MaxChoices *int          `xml:"maxChoices,attr"`
+	Prompt     qti21Inner    `xml:"prompt"`
+	Choices    []qti21Choice `xml:"simpleChoice"`
+	MatchSets  []struct {
+		Choices []qti21Choice `xml:"simpleAssociableChoice"`
+	} `xml:"simpleMatchSet"`
+}
+
+type qti21Choice struct {
+	Identifier string `xml:"identifier,attr"`
+	Inner      string `xml:",innerxml"`
+}
+
+var qti21Interactions = map[string]bool{
+	"choiceInteraction":       true,
+	"orderInteraction":        true,
+	"matchInteraction":        true,
+	"textEntryInteraction":    true,
+	"extendedTextInteraction": true,
+}
+
+var (
+	qti21Tolerance = regexp.MustCompile(`tolerance="\s*([^"\s]+)`)
+	qti21Criterion = regexp.MustCompile(`^(.*)\(([0-9.,]+)\)$`)
+)
+
+// ParseQTI21 reads QTI 2.1 items from a content package ZIP or an XML
+// document.
+func ParseQTI21(data []byte) ([]QuizFileRow, error) {
+	var docs [][]byte
+	if bytes.HasPrefix(data, []byte("PK")) {
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid ZIP: %w", err)
+		}
+		if docs, err = qti21PackageItems(zr); err != nil {
+			return nil, err
+		}
+	} else {
+		docs = [][]byte{data}
+	}
+
+	var rows []QuizFileRow
+	for _, doc := range docs {
+		dec := xml.NewDecoder(bytes.NewReader(doc))
+		for {
+			tok, err := dec.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid QTI document: %w", err)
+			}
+			start, ok := tok.(xml.StartElement)
+			if !ok || start.Name.Local != "assessmentItem" {
+				continue
+			}
+			var item qti21Item
+			if err := dec.DecodeElement(&item, &start); err != nil {
+				return nil, fmt.Errorf("invalid QTI item: %w", err)
+			}
+
+			row := QuizFileRow{Line: len(rows) + 1}
+			row.Item, err = convertQTI21Item(item)
+			if err != nil {
+				row.Error = fmt.Sprintf("item %q: %v", firstNonEmpty(item.Title, item.Identifier), err)
+			}
+			rows = append(rows, row)
+		}
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("no QTI 2.1 assessment items found")
+	}
+	return rows, nil
+}
+
+// qti21PackageItems returns the item files of a content package in the
+// order of its manifest, or every XML file when it has none.
+func qti21PackageItems(zr *zip.Reader) ([][]byte, error) {
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	var names []string
+	if mf, ok := files["imsmanifest.xml"]; ok {
+		raw, err := readZipEntry(mf)
+		if err != nil {
+			return nil, err
+		}
+		var manifest struct {
+			Resources []struct {
+				Type string `xml:"type,attr"`
+				Href string `xml:"href,attr"`
+			} `xml:"resources>resource"`
+		}
+		if err := xml.Unmarshal(raw, &manifest); err != nil {
+			return nil, fmt.Errorf("invalid imsmanifest.xml: %w", err)
+		}
+		for _, r := range manifest.Resources {
+			if strings.HasPrefix(r.Type, "imsqti_item_xmlv2p") && r.Href != "" {
+				names = append(names, r.Href)
+			}
+		}
+	} else {
+		for _, f := range zr.File {
+			if strings.HasSuffix(strings.ToLower(f.Name), ".xml") {
+				names = append(names, f.Name)
+			}
+		}
+	}
+
+	var docs [][]byte
+	for _, name := range names {
+		f, ok := files[name]
+		if !ok {
+			return nil, fmt.Errorf("file %s missing from package", name)
+		}
+		raw, err := readZipEntry(f)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, raw)
+	}
+	return docs, nil
+}
+
+func convertQTI21Item(item qti21Item) (QuizItem, error) {
+	var out QuizItem
+	for _, o := range item.Outcomes {
+		if o.Identifier == "MAXSCORE" && len(o.Default) > 0 {
+			points, err := parseDecimal(o.Default[0])
+			if err != nil {
+				return out, fmt.Errorf("MAXSCORE: %v", err)
+			}
+			out.Points = points
+		}
+	}
+	if len(item.Feedback) > 0 {
+		out.Explanation = PlainText(item.Feedback[0].XML)
+	}
+
+	// Teks soal adalah isi itemBody di luar interaksinya
+	var text []string
+	var interactions []qti21Interaction
+	var rubric questions.Rubric
+	dec := xml.NewDecoder(strings.NewReader(item.Body.XML))
+	dec.Strict = false
+	dec.Entity = xml.HTMLEntity
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return out, fmt.Errorf("invalid itemBody: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.CharData:
+			text = append(text, string(t))
+		case xml.StartElement:
+			if qti21Interactions[t.Name.Local] {
+				var in qti21Interaction
+				if err := dec.DecodeElement(&in, &t); err != nil {
+					return out, fmt.Errorf("invalid %s: %w", t.Name.Local, err)
+				}
+				if prompt := PlainText(in.Prompt.XML); prompt != "" {
+					text = append(text, "\n"+prompt)
+				}
+				interactions = append(interactions, in)
+			} else if t.Name.Local == "rubricBlock" {
+				var block struct {
+					Items []string `xml:"ul>li"`
+				}
+				if err := dec.DecodeElement(&block, &t); err != nil {
+					return out, fmt.Errorf("invalid rubricBlock: %w", err)
+				}
+				for _, li := range block.Items {
+					m := qti21Criterion.FindStringSubmatch(strings.TrimSpace(li))
+					if m == nil {
+						continue
+					}
+					points, err := parseDecimal(m[2])
+					if err != nil {
+						continue
+					}
+					rubric = append(rubric, questions.Criterion{Criterion: strings.TrimSpace(m[1]), Points: points})
+				}
+			} else {
+				text = append(text, " ")
+			}
+		case xml.EndElement:
+			if t.Name.Local == "p" || t.Name.Local == "div" || t.Name.Local == "br" {
+				text = append(text, "\n")
+			} else {
+				text = append(text, " ")
+			}
+		}
+	}
+	var lines []string
+	for _, line := range strings.Split(strings.Join(text, ""), "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	question := strings.Join(lines, "\n")
+	if question == "" {
+		return out, errors.New("question text is empty")
+	}
+	if len(interactions) != 1 {
+		return out, fmt.Errorf("has %d interactions; only items with one are supported", len(interactions))
+	}
+	in := interactions[0]
+
+	var resp qti21Response
+	for _, r := range item.Responses {
+		if r.Identifier == in.Response {
+			resp = r
+		}
+	}
+	var p quizParts
+	var typ string
+	choiceText := func(choices []qti21Choice) map[string]string {
+		m := make(map[string]string, len(choices))
+		for _, c := range choices {
+			m[c.Identifier] = PlainText(c.Inner)
+		}
+		return m
+	}
+
+	switch in.XMLName.Local {
+	case "choiceInteraction":
+		byID := choiceText(in.Choices)
+		for _, c := range in.Choices {
+			p.Options = append(p.Options, byID[c.Identifier])
+		}
+		for _, id := range resp.Correct {
+			if text, ok := byID[strings.TrimSpace(id)]; ok {
+				p.Correct = append(p.Correct, text)
+			}
+		}
+		_, hasTrue := byID["true"]
+		_, hasFalse := byID["false"]
+		single := in.MaxChoices != nil && *in.MaxChoices == 1
+		switch {
+		case single && len(in.Choices) == 2 && hasTrue && hasFalse:
+			typ = questions.TrueFalse
+			p.Correct = []string{}
+			if len(resp.Correct) == 1 {
+				p.Correct = []string{strings.TrimSpace(resp.Correct[0])}
+			}
+		case single:
+			typ = questions.SingleChoice
+			if len(p.Correct) != 1 {
+				return out, errors.New("needs exactly one correct choice")
+			}
+		default:
+			typ = questions.MultipleSelect
+		}
+
+	case "orderInteraction":
+		typ = questions.Ordering
+		byID := choiceText(in.Choices)
+		for _, c := range in.Choices {
+			p.Options = append(p.Options, byID[c.Identifier])
+		}
+		for _, id := range resp.Correct {
+			p.Correct = append(p.Correct, byID[strings.TrimSpace(id)])
+		}
+
+	case "matchInteraction":
+		typ = questions.Matching
+		if len(in.MatchSets) != 2 {
+			return out, errors.New("a match interaction needs two sets of choices")
+		}
+		prompts, choices := choiceText(in.MatchSets[0].Choices), choiceText(in.MatchSets[1].Choices)
+		for _, c := range in.MatchSets[1].Choices {
+			p.Options = append(p.Options, choices[c.Identifier])
+		}
+		correct := make(map[string]string)
+		for _, v := range resp.Correct {
+			pair := strings.Fields(v)
+			if len(pair) == 2 {
+				correct[pair[0]] = choices[pair[1]]
+			}
+		}
+		for _, c := range in.MatchSets[0].Choices {
+			p.Prompts = append(p.Prompts, prompts[c.Identifier])
+			p.Correct = append(p.Correct, correct[c.Identifier])
+		}
+
+	case "textEntryInteraction":
+		if resp.BaseType == "float" || resp.BaseType == "integer" {
+			typ = questions.Numeric
+			if len(resp.Correct) == 0 {
+				return out, errors.New("no correct answer found")
+			}
+			var err error
+			if p.Value, err = parseDecimal(resp.Correct[0]); err != nil {
+				return out, fmt.Errorf("correct answer: %v", err)
+			}
+			if m := qti21Tolerance.FindStringSubmatch(item.Processing.XML); m != nil {
+				if p.Tolerance, err = parseDecimal(m[1]); err != nil {
+					return out, fmt.Errorf("tolerance: %v", err)
+				}
+			}
+			break
+		}
+		typ = questions.ShortText
+		for _, v := range resp.Correct {
+			if v = strings.TrimSpace(v); !containsText(p.Correct, v) {
+				p.Correct = append(p.Correct, v)
+			}
+		}
+		for _, e := range resp.Mapping {
+			if v := strings.TrimSpace(e.Key); !containsText(p.Correct, v) {
+				p.Correct = append(p.Correct, v)
+			}
+		}
+
+	case "extendedTextInteraction":
+		typ = questions.Essay
+		p.Rubric = rubric
+		if len(p.Rubric) == 0 {
+			p.Rubric = questions.Rubric{{Criterion: "Overall", Points: 1}}
+		}
+	}
+
+	out.Definition = joinQuiz(typ, question, p)
+	return out, nil
+}
+
+// WriteQTI21 writes items as a QTI 2.1 content package ZIP.
+func WriteQTI21(w io.Writer, items []QuizItem) error {
+	zw := zip.NewWriter(w)
+	var manifest strings.Builder
+	manifest.WriteString(xml.Header)
+	manifest.WriteString(`<manifest xmlns="http://www.imsglobal.org/xsd/imscp_v1p1" identifier="quiz">` + "\n")
+	manifest.WriteString("  <organizations/>\n  <resources>\n")
+
+	for n, item := range items {
+		id := fmt.Sprintf("item-%d", n+1)
+		href := "items/" + id + ".xml"
+		body, err := qti21ItemXML(id, n+1, item)
+		if err != nil {
+			return err
+		}
+		f, err := zw.Create(href)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(body); err != nil {
+			return err
+		}
+		fmt.Fprintf(&manifest, "    <resource identifier=%q type=\"imsqti_item_xmlv2p1\" href=%q>\n      <file href=%q/>\n    </resource>\n", id, href, href)
+	}
+	manifest.WriteString("  </resources>\n</manifest>\n")
+
+	f, err := zw.Create("imsmanifest.xml")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(f, manifest.String()); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func qti21ItemXML(id string, n int, item QuizItem) ([]byte, error) {
+	p, err := splitQuiz(item.Definition)
+	if err != nil {
+		return nil, err
+	}
+	points := item.Points
+	if points == 0 {
+		points = 1
+	}
+
+	var decl, body, processing strings.Builder
+	values := func(vs ...string) string {
+		var b strings.Builder
+		for _, v := range vs {
+			b.WriteString("<value>" + xmlText(v) + "</value>")
+		}
+		return b.String()
+	}
+	choices := func(tag, prefix string, options []string, extra string) (map[string]string, string) {
+		ids := make(map[string]string, len(options))
+		var b strings.Builder
+		for i, o := range options {
+			cid := fmt.Sprintf("%s%d", prefix, i+1)
+			ids[o] = cid
+			fmt.Fprintf(&b, "      <%s identifier=%q%s>%s</%s>\n", tag, cid, extra, xmlText(o), tag)
+		}
+		return ids, b.String()
+	}
+	matchCorrect := `<responseProcessing template="http://www.imsglobal.org/question/qti_v2p1/rptemplates/match_correct"/>`
+
+	switch item.Type {
+	case "", questions.SingleChoice, questions.MultipleSelect:
+		ids, list := choices("simpleChoice", "C", p.Options, "")
+		var correct []string
+		for _, c := range p.Correct {
+			correct = append(correct, ids[c])
+		}
+		cardinality, maxChoices := "multiple", 0
+		if item.Type != questions.MultipleSelect {
+			cardinality, maxChoices = "single", 1
+		}
+		fmt.Fprintf(&decl, `<responseDeclaration identifier="RESPONSE" cardinality="%s" baseType="identifier"><correctResponse>%s</correctResponse></responseDeclaration>`, cardinality, values(correct...))
+		fmt.Fprintf(&body, "    <choiceInteraction responseIdentifier=\"RESPONSE\" shuffle=\"false\" maxChoices=\"%d\">\n%s    </choiceInteraction>\n", maxChoices, list)
+		processing.WriteString(matchCorrect)
+
+	case questions.TrueFalse:
+		fmt.Fprintf(&decl, `<responseDeclaration identifier="RESPONSE" cardinality="single" baseType="identifier"><correctResponse>%s</correctResponse></responseDeclaration>`, values(p.Correct[0]))
+		body.WriteString("    <choiceInteraction responseIdentifier=\"RESPONSE\" shuffle=\"false\" maxChoices=\"1\">\n      <simpleChoice identifier=\"true\">True</simpleChoice>\n      <simpleChoice identifier=\"false\">False</simpleChoice>\n    </choiceInteraction>\n")
+		processing.WriteString(matchCorrect)
+
+	case questions.Ordering:
+		ids, list := choices("simpleChoice", "C", p.Options, "")
+		var correct []string
+		for _, c := range p.Correct {
+			correct = append(correct, ids[c])
+		}
+		fmt.Fprintf(&decl, `<responseDeclaration identifier="RESPONSE" cardinality="ordered" baseType="identifier"><correctResponse>%s</correctResponse></responseDeclaration>`, values(correct...))
+		fmt.Fprintf(&body, "    <orderInteraction responseIdentifier=\"RESPONSE\" shuffle=\"false\">\n%s    </orderInteraction>\n", list)
+		processing.WriteString(matchCorrect)
+
+	case questions.Matching:
+		promptIDs, prompts := choices("simpleAssociableChoice", "P", p.Prompts, ` matchMax="1"`)
+		choiceIDs, list := choices("simpleAssociableChoice", "M", p.Options, fmt.Sprintf(` matchMax="%d"`, len(p.Prompts)))
+		var pairs []string
+		for i, prompt := range p.Prompts {
+			pairs = append(pairs, promptIDs[prompt]+" "+choiceIDs[p.Correct[i]])
+		}
+		fmt.Fprintf(&decl, `<responseDeclaration identifier="RESPONSE" cardinality="multiple" baseType="directedPair"><correctResponse>%s</correctResponse></responseDeclaration>`, values(pairs...))
+		fmt.Fprintf(&body, "    <matchInteraction responseIdentifier=\"RESPONSE\" shuffle=\"false\" maxAssociations=\"%d\">\n      <simpleMatchSet>\n%s      </simpleMatchSet>\n      <simpleMatchSet>\n%s      </simpleMatchSet>\n    </matchInteraction>\n", len(p.Prompts), prompts, list)
+		processing.WriteString(matchCorrect)
+
+	case questions.Numeric:
+		fmt.Fprintf(&decl, `<responseDeclaration identifier="RESPONSE" cardinality="single" baseType="float"><correctResponse>%s</correctResponse></responseDeclaration>`, values(formatDecimal(p.Value)))
+		body.WriteString("    <p><textEntryInteraction responseIdentifier=\"RESPONSE\"/></p>\n")
+		t := formatDecimal(p.Tolerance)
+		fmt.Fprintf(&processing, `<responseProcessing><responseCondition><responseIf><equal toleranceMode="absolute" tolerance="%s %s"><variable identifier="RESPONSE"/><correct identifier="RESPONSE"/></equal><setOutcomeValue identifier="SCORE"><baseValue baseType="float">1</baseValue></setOutcomeValue></responseIf></responseCondition></responseProcessing>`, t, t)
+
+	case questions.ShortText:
+		var entries strings.Builder
+		for _, v := range p.Correct {
+			fmt.Fprintf(&entries, `<mapEntry mapKey="%s" mappedValue="1" caseSensitive="false"/>`, xmlText(v))
+		}
+		fmt.Fprintf(&decl, `<responseDeclaration identifier="RESPONSE" cardinality="single" baseType="string"><correctResponse>%s</correctResponse><mapping defaultValue="0">%s</mapping></responseDeclaration>`, values(p.Correct[0]), entries.String())
+		body.WriteString("    <p><textEntryInteraction responseIdentifier=\"RESPONSE\"/></p>\n")
+		processing.WriteString(`<responseProcessing template="http://www.imsglobal.org/question/qti_v2p1/rptemplates/map_response"/>`)
+
+	case questions.Essay:
+		decl.WriteString(`<responseDeclaration identifier="RESPONSE" cardinality="single" baseType="string"/>`)
+		body.WriteString("    <rubricBlock view=\"scorer\">\n      <ul>\n")
+		for _, c := range p.Rubric {
+			fmt.Fprintf(&body, "        <li>%s (%s)</li>\n", xmlText(c.Criterion), formatDecimal(c.Points))
+		}
+		body.WriteString("      </ul>\n    </rubricBlock>\n")
+		body.WriteString("    <extendedTextInteraction responseIdentifier=\"RESPONSE\"/>\n")
+
+	default:
+		return nil, fmt.Errorf("unknown question type %q", item.Type)
+	}
+
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	fmt.Fprintf(&b, "<assessmentItem xmlns=%q identifier=%q title=\"Question %d\" adaptive=\"false\" timeDependent=\"false\">\n", qti21Namespace, id, n)
+	b.WriteString("  " + decl.String() + "\n")
+	b.WriteString(`  <outcomeDeclaration identifier="SCORE" cardinality="single" baseType="float"/>` + "\n")
+	fmt.Fprintf(&b, "  <outcomeDeclaration identifier=\"MAXSCORE\" cardinality=\"single\" baseType=\"float\"><defaultValue><value>%s</value></defaultValue></outcomeDeclaration>\n", formatDecimal(points))
+	b.WriteString("  <itemBody>\n")
+	for _, para := range strings.Split(item.Question, "\n") {
+		b.WriteString("    <p>" + xmlText(para) + "</p>\n")
+	}
+	b.WriteString(body.String())
+	b.WriteString("  </itemBody>\n")
+	if processing.Len() > 0 {
+		b.WriteString("  " + processing.String() + "\n")
+	}
+	if item.Explanation != "" {
+		fmt.Fprintf(&b, "  <modalFeedback outcomeIdentifier=\"FEEDBACK\" identifier=\"EXPLANATION\" showHide=\"show\">%s</modalFeedback>\n", xmlText(item.Explanation))
+	}
+	b.WriteString("</assessmentItem>\n")
+	return b.Bytes(), nil
+}
+
+func xmlText(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
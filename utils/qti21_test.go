@@ -0,0 +1,197 @@
+package utils
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func qti21Doc(items ...string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?><items>` + strings.Join(items, "\n") + `</items>`
+}
+
+func qti21ItemOf(id, decl, body, extra string) string {
+	return `<assessmentItem xmlns="http://www.imsglobal.org/xsd/imsqti_v2p1" identifier="` + id + `" title="` + id + `">` +
+		decl + `<itemBody>` + body + `</itemBody>` + extra + `</assessmentItem>`
+}
+
+func TestParseQTI21(t *testing.T) {
+	doc := qti21Doc(
+		qti21ItemOf("choice",
+			`<responseDeclaration identifier="R" cardinality="single" baseType="identifier"><correctResponse><value>B</value></correctResponse></responseDeclaration>
+<outcomeDeclaration identifier="MAXSCORE"><defaultValue><value>2,5</value></defaultValue></outcomeDeclaration>`,
+			`<p>Ibu kota&#160;<b>Indonesia</b>?</p><choiceInteraction responseIdentifier="R" maxChoices="1"><prompt>Pick one.</prompt>
+<simpleChoice identifier="A">Bandung</simpleChoice><simpleChoice identifier="B"><span>Jakarta</span></simpleChoice></choiceInteraction>`,
+			`<modalFeedback identifier="F"><p>Sejak 1961.</p></modalFeedback>`),
+		qti21ItemOf("multi",
+			`<responseDeclaration identifier="R" cardinality="multiple" baseType="identifier"><correctResponse><value>A</value><value>C</value></correctResponse></responseDeclaration>`,
+			`<p>Primes?</p><choiceInteraction responseIdentifier="R" maxChoices="0"><simpleChoice identifier="A">2</simpleChoice><simpleChoice identifier="B">4</simpleChoice><simpleChoice identifier="C">3</simpleChoice></choiceInteraction>`, ""),
+		qti21ItemOf("tf",
+			`<responseDeclaration identifier="R" cardinality="single" baseType="identifier"><correctResponse><value>false</value></correctResponse></responseDeclaration>`,
+			`<p>The sky is green.</p><choiceInteraction responseIdentifier="R" maxChoices="1"><simpleChoice identifier="true">True</simpleChoice><simpleChoice identifier="false">False</simpleChoice></choiceInteraction>`, ""),
+		qti21ItemOf("order",
+			`<responseDeclaration identifier="R" cardinality="ordered" baseType="identifier"><correctResponse><value>B</value><value>C</value><value>A</value></correctResponse></responseDeclaration>`,
+			`<p>Sort</p><orderInteraction responseIdentifier="R"><simpleChoice identifier="A">3</simpleChoice><simpleChoice identifier="B">1</simpleChoice><simpleChoice identifier="C">2</simpleChoice></orderInteraction>`, ""),
+		qti21ItemOf("match",
+			`<responseDeclaration identifier="R" cardinality="multiple" baseType="directedPair"><correctResponse><value>P1 M2</value><value>P2 M1</value></correctResponse></responseDeclaration>`,
+			`<p>Match</p><matchInteraction responseIdentifier="R"><simpleMatchSet><simpleAssociableChoice identifier="P1">cat</simpleAssociableChoice><simpleAssociableChoice identifier="P2">dog</simpleAssociableChoice></simpleMatchSet>
+<simpleMatchSet><simpleAssociableChoice identifier="M1">woof</simpleAssociableChoice><simpleAssociableChoice identifier="M2">meow</simpleAssociableChoice><simpleAssociableChoice identifier="M3">moo</simpleAssociableChoice></simpleMatchSet></matchInteraction>`, ""),
+		qti21ItemOf("numeric",
+			`<responseDeclaration identifier="R" cardinality="single" baseType="float"><correctResponse><value>9.81</value></correctResponse></responseDeclaration>`,
+			`<p>g = <textEntryInteraction responseIdentifier="R"/> m/s²</p>`,
+			`<responseProcessing><responseCondition><responseIf><equal toleranceMode="absolute" tolerance="0.05 0.05"><variable identifier="R"/><correct identifier="R"/></equal></responseIf></responseCondition></responseProcessing>`),
+		qti21ItemOf("text",
+			`<responseDeclaration identifier="R" cardinality="single" baseType="string"><correctResponse><value>Paris</value></correctResponse><mapping><mapEntry mapKey="Paris" mappedValue="1"/><mapEntry mapKey="Lutetia" mappedValue="1"/></mapping></responseDeclaration>`,
+			`<p>Capital of France? <textEntryInteraction responseIdentifier="R"/></p>`, ""),
+		qti21ItemOf("essay",
+			`<responseDeclaration identifier="R" cardinality="single" baseType="string"/>`,
+			`<p>Discuss.</p><rubricBlock view="scorer"><ul><li>Clarity (4)</li><li>Argument (6)</li><li>not a criterion</li></ul></rubricBlock><extendedTextInteraction responseIdentifier="R"/>`, ""),
+		qti21ItemOf("essay-plain",
+			`<responseDeclaration identifier="R" cardinality="single" baseType="string"/>`,
+			`<div>Describe your weekend.</div><extendedTextInteraction responseIdentifier="R"/>`, ""),
+	)
+
+	rows, err := ParseQTI21([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		typ, question   string
+		options, answer string
+	}{
+		{"single_choice", "Ibu kota Indonesia ?\nPick one.", `["Bandung","Jakarta"]`, `Jakarta`},
+		{"multiple_select", "Primes?", `["2","4","3"]`, `["2","3"]`},
+		{"true_false", "The sky is green.", `["true","false"]`, `false`},
+		{"ordering", "Sort", `["3","1","2"]`, `["1","2","3"]`},
+		{"matching", "Match", `{"prompts":["cat","dog"],"choices":["woof","meow","moo"]}`, `{"cat":"meow","dog":"woof"}`},
+		{"numeric", "g = m/s²", `[]`, `{"value":9.81,"tolerance":0.05}`},
+		{"short_text", "Capital of France?", `[]`, `["Paris","Lutetia"]`},
+		{"essay", "Discuss.", `[]`, `[{"criterion":"Clarity","points":4},{"criterion":"Argument","points":6}]`},
+		{"essay", "Describe your weekend.", `[]`, `[{"criterion":"Overall","points":1}]`},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("rows = %d, want %d: %+v", len(rows), len(want), rows)
+	}
+	for i, w := range want {
+		row := rows[i]
+		if row.Error != "" {
+			t.Errorf("item %d: %s", row.Line, row.Error)
+			continue
+		}
+		options, answer, err := row.Item.Definition.Validate()
+		if row.Line != i+1 || row.Item.Type != w.typ || row.Item.Question != w.question || options != w.options || answer != w.answer || err != nil {
+			t.Errorf("item %d = %d %s %q %s %s %v\n want %s %q %s %s", i+1, row.Line, row.Item.Type, row.Item.Question, options, answer, err,
+				w.typ, w.question, w.options, w.answer)
+		}
+	}
+	if rows[0].Item.Points != 2.5 || rows[0].Item.Explanation != "Sejak 1961." {
+		t.Errorf("points %v, explanation %q", rows[0].Item.Points, rows[0].Item.Explanation)
+	}
+}
+
+func TestParseQTI21ItemErrors(t *testing.T) {
+	choice := `<choiceInteraction responseIdentifier="R" maxChoices="1"><simpleChoice identifier="A">a</simpleChoice><simpleChoice identifier="B">b</simpleChoice></choiceInteraction>`
+	tests := []struct {
+		name, item, want string
+	}{
+		{"no text", qti21ItemOf("x", "", choice, ""), "question text is empty"},
+		{"two interactions", qti21ItemOf("x", "", "<p>Q</p>"+choice+choice, ""), "has 2 interactions"},
+		{"no interaction", qti21ItemOf("x", "", "<p>Q</p>", ""), "has 0 interactions"},
+		{"single without answer", qti21ItemOf("x", "", "<p>Q</p>"+choice, ""), "needs exactly one correct choice"},
+		{"one match set", qti21ItemOf("x", "", `<p>Q</p><matchInteraction responseIdentifier="R"><simpleMatchSet/></matchInteraction>`, ""),
+			"needs two sets of choices"},
+		{"numeric without answer", qti21ItemOf("x", `<responseDeclaration identifier="R" baseType="float"/>`,
+			`<p>Q <textEntryInteraction responseIdentifier="R"/></p>`, ""), "no correct answer found"},
+		{"numeric not a number", qti21ItemOf("x", `<responseDeclaration identifier="R" baseType="integer"><correctResponse><value>four</value></correctResponse></responseDeclaration>`,
+			`<p>Q <textEntryInteraction responseIdentifier="R"/></p>`, ""), "correct answer:"},
+		{"bad MAXSCORE", qti21ItemOf("x", `<outcomeDeclaration identifier="MAXSCORE"><defaultValue><value>lots</value></defaultValue></outcomeDeclaration>`,
+			"<p>Q</p>"+choice, ""), "MAXSCORE:"},
+	}
+	for _, tt := range tests {
+		rows, err := ParseQTI21([]byte(qti21Doc(tt.item)))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(rows) != 1 || !strings.HasPrefix(rows[0].Error, `item "x": `) || !strings.Contains(rows[0].Error, tt.want) {
+			t.Errorf("%s: rows = %+v, want an error containing %q", tt.name, rows, tt.want)
+		}
+	}
+}
+
+func TestParseQTI21Package(t *testing.T) {
+	item := func(id, text string) string {
+		return qti21ItemOf(id, `<responseDeclaration identifier="R"><correctResponse><value>A</value></correctResponse></responseDeclaration>`,
+			`<p>`+text+`</p><choiceInteraction responseIdentifier="R" maxChoices="1"><simpleChoice identifier="A">a</simpleChoice><simpleChoice identifier="B">b</simpleChoice></choiceInteraction>`, "")
+	}
+	manifest := `<manifest><resources>
+<resource identifier="r2" type="imsqti_item_xmlv2p1" href="items/second.xml"/>
+<resource identifier="r1" type="imsqti_item_xmlv2p1" href="items/first.xml"/>
+<resource identifier="t" type="imsqti_test_xmlv2p1" href="test.xml"/>
+</resources></manifest>`
+
+	// The manifest decides the order; the test file is not an item.
+	r := zipOf(t, "imsmanifest.xml", manifest, "items/first.xml", item("1", "First"), "items/second.xml", item("2", "Second"), "test.xml", "<assessmentTest/>")
+	data := make([]byte, r.Size())
+	r.Read(data)
+	rows, err := ParseQTI21(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].Item.Question != "Second" || rows[1].Item.Question != "First" {
+		t.Errorf("rows = %+v", rows)
+	}
+
+	// Without a manifest every XML file is read.
+	r = zipOf(t, "a.xml", item("1", "A"), "readme.txt", "hello", "b.xml", item("2", "B"))
+	data = make([]byte, r.Size())
+	r.Read(data)
+	if rows, err := ParseQTI21(data); err != nil || len(rows) != 2 {
+		t.Errorf("package without manifest = %+v, %v", rows, err)
+	}
+}
+
+func TestParseQTI21Malformed(t *testing.T) {
+	pkg := func(entries ...string) []byte {
+		r := zipOf(t, entries...)
+		data := make([]byte, r.Size())
+		r.Read(data)
+		return data
+	}
+	full := pkg("a.xml", qti21Doc())
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"empty", nil, "no QTI 2.1 assessment items found"},
+		{"no items", []byte(qti21Doc()), "no QTI 2.1 assessment items found"},
+		{"QTI 1.2", []byte(`<questestinterop><item ident="a"/></questestinterop>`), "no QTI 2.1 assessment items found"},
+		{"not XML", []byte("question,answer\nQ,A\n"), "no QTI 2.1 assessment items found"},
+		{"broken XML", []byte(`<items><assessmentItem identifier="x"><itemBody>`), "invalid QTI"},
+		{"broken itemBody", []byte(qti21Doc(`<assessmentItem identifier="x"><itemBody><p>Q</b></itemBody></assessmentItem>`)), "invalid QTI"},
+		{"not a zip", []byte("PK but not a zip"), "invalid ZIP"},
+		{"truncated zip", full[:len(full)/2], "invalid ZIP"},
+		{"bad manifest", pkg("imsmanifest.xml", "<manifest><resources>"), "invalid imsmanifest.xml"},
+		{"missing item file", pkg("imsmanifest.xml", `<manifest><resources><resource type="imsqti_item_xmlv2p1" href="gone.xml"/></resources></manifest>`),
+			"file gone.xml missing from package"},
+	}
+	for _, tt := range tests {
+		rows, err := ParseQTI21(tt.data)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: ParseQTI21 = %+v, %v; want an error containing %q", tt.name, rows, err, tt.want)
+		}
+	}
+}
+
+func TestWriteQTI21Package(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteQTI21(&b, sampleQuizItems()[:2]); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"imsmanifest.xml", "items/item-1.xml", "items/item-2.xml"} {
+		if !bytes.Contains(b.Bytes(), []byte(name)) {
+			t.Errorf("package has no %s", name)
+		}
+	}
+}
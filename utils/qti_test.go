@@ -0,0 +1,158 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// qti12Item wraps presentation and resprocessing markup in an <item>.
+func qti12Item(title, metadata, presentation, resprocessing string) string {
+	return `<item ident="` + strings.ToLower(strings.ReplaceAll(title, " ", "_")) + `" title="` + title + `">` +
+		`<itemmetadata><qtimetadata>` + metadata + `</qtimetadata></itemmetadata>` +
+		`<presentation>` + presentation + `</presentation>` +
+		`<resprocessing>` + resprocessing + `</resprocessing></item>`
+}
+
+func qti12Doc(items ...string) []byte {
+	return []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<questestinterop xmlns="http://www.imsglobal.org/xsd/ims_qtiasiv1p2"><assessment ident="a1" title="Quiz"><section ident="root">` +
+		strings.Join(items, "\n") + `</section></assessment></questestinterop>`)
+}
+
+func qti12Field(label, entry string) string {
+	return `<qtimetadatafield><fieldlabel>` + label + `</fieldlabel><fieldentry>` + entry + `</fieldentry></qtimetadatafield>`
+}
+
+const qti12Choices = `<material><mattext texttype="text/html">&lt;p&gt;Capital of &lt;b&gt;Indonesia&lt;/b&gt;?&lt;/p&gt;</mattext></material>
+<response_lid ident="response1" rcardinality="Single"><render_choice>
+<response_label ident="a"><material><mattext>Bandung</mattext></material></response_label>
+<response_label ident="b"><material><mattext texttype="text/html">&lt;p&gt;Jakarta &amp;amp; surroundings&lt;/p&gt;</mattext></material></response_label>
+<response_label ident="c"><material><mattext>Surabaya</mattext></material></response_label>
+</render_choice></response_lid>`
+
+func qti12Correct(ident string) string {
+	return `<respcondition continue="No"><conditionvar><varequal respident="response1">` + ident + `</varequal></conditionvar><setvar action="Set" varname="SCORE">100</setvar></respcondition>`
+}
+
+func TestParseQTI12(t *testing.T) {
+	data := qti12Doc(
+		qti12Item("Capital", qti12Field("cc_profile", "cc.multiple_choice.v0p1"), qti12Choices,
+			`<outcomes><decvar varname="SCORE"/></outcomes>`+qti12Correct("b")),
+		qti12Item("Sky", qti12Field("question_type", "true_false_question"),
+			`<material><mattext>The sky is green.</mattext></material>
+<response_lid ident="response1"><render_choice>
+<response_label ident="t"><material><mattext>True</mattext></material></response_label>
+<response_label ident="f"><material><mattext>False</mattext></material></response_label>
+</render_choice></response_lid>`,
+			// a wrong-answer branch that subtracts comes first
+			`<respcondition><conditionvar><varequal respident="response1">t</varequal></conditionvar><setvar action="Subtract">1</setvar></respcondition>`+
+				`<respcondition><conditionvar><varequal respident="response1">f</varequal></conditionvar><setvar action="Set">1</setvar></respcondition>`),
+		qti12Item("Flow", "",
+			`<flow><material><mattext>In a flow</mattext></material><flow><response_lid ident="r"><render_choice><flow_label>
+<response_label ident="x"><material><mattext>X</mattext></material></response_label>
+<response_label ident="y"><material><mattext>Y</mattext></material></response_label>
+</flow_label></render_choice></response_lid></flow></flow>`,
+			`<respcondition><conditionvar><varequal>y</varequal></conditionvar><setvar>1</setvar></respcondition>`),
+	)
+
+	quizzes, warnings, err := ParseQTI12(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("warnings = %v", warnings)
+	}
+	want := []PackageQuiz{
+		{Question: "Capital of Indonesia ?", Options: []string{"Bandung", "Jakarta & surroundings", "Surabaya"}, Answer: "Jakarta & surroundings"},
+		{Question: "The sky is green.", Options: []string{"True", "False"}, Answer: "False"},
+		{Question: "In a flow", Options: []string{"X", "Y"}, Answer: "Y"},
+	}
+	if !reflect.DeepEqual(quizzes, want) {
+		t.Errorf("ParseQTI12 =\n%+v\nwant\n%+v", quizzes, want)
+	}
+
+	// The converted questions are valid single-choice quizzes.
+	for _, q := range quizzes {
+		if _, _, err := q.Definition().Validate(); err != nil {
+			t.Errorf("%q does not validate: %v", q.Question, err)
+		}
+	}
+}
+
+func TestParseQTI12Skips(t *testing.T) {
+	tests := []struct {
+		name string
+		item string
+		want string
+	}{
+		{"essay", qti12Item("Essay", qti12Field("cc_profile", "cc.essay.v0p1"),
+			`<material><mattext>Discuss.</mattext></material><response_str ident="r"/>`, ""),
+			"question type cc.essay.v0p1 is not supported"},
+		{"multiple response", qti12Item("Multi", "",
+			strings.Replace(qti12Choices, `rcardinality="Single"`, `rcardinality="Multiple"`, 1), qti12Correct("a")),
+			"multiple-response items are not supported"},
+		{"no response", qti12Item("Fill", "", `<material><mattext>2+2=</mattext></material><response_num ident="r"/>`, ""),
+			"not a single-response multiple-choice item"},
+		{"two responses", qti12Item("Two", "", qti12Choices+strings.Replace(qti12Choices, "<material><mattext texttype", "<material><mattext x", 1), qti12Correct("a")),
+			"not a single-response multiple-choice item"},
+		{"no text", qti12Item("Blank", "", strings.Replace(qti12Choices, "&lt;p&gt;Capital of &lt;b&gt;Indonesia&lt;/b&gt;?&lt;/p&gt;", " ", 1), qti12Correct("a")),
+			"question text is empty"},
+		{"one option", qti12Item("One", "", `<material><mattext>Q</mattext></material><response_lid ident="response1"><render_choice>
+<response_label ident="a"><material><mattext>Only</mattext></material></response_label></render_choice></response_lid>`, qti12Correct("a")),
+			"has 1 options; quizzes need at least 2"},
+		{"no correct answer", qti12Item("None", "", qti12Choices, ""),
+			"no correct answer found"},
+		{"answer for another response", qti12Item("Other", "", qti12Choices,
+			`<respcondition><conditionvar><varequal respident="elsewhere">a</varequal></conditionvar><setvar>1</setvar></respcondition>`),
+			"no correct answer found"},
+		{"answer worth nothing", qti12Item("Zero", "", qti12Choices,
+			`<respcondition><conditionvar><varequal respident="response1">a</varequal></conditionvar><setvar>0</setvar></respcondition>`),
+			"no correct answer found"},
+		{"unknown answer ident", qti12Item("Unknown", "", qti12Choices, qti12Correct("z")),
+			"no correct answer found"},
+	}
+	for _, tt := range tests {
+		quizzes, warnings, err := ParseQTI12(qti12Doc(tt.item))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(quizzes) != 0 || len(warnings) != 1 || !strings.HasSuffix(warnings[0], ": "+tt.want) {
+			t.Errorf("%s: ParseQTI12 = %v, %q; want one warning ending in %q", tt.name, quizzes, warnings, tt.want)
+		}
+	}
+}
+
+func TestParseQTI12Malformed(t *testing.T) {
+	for name, data := range map[string]string{
+		"unclosed element": `<questestinterop><item ident="a"><presentation>`,
+		"bad entity":       `<questestinterop><item ident="a" title="&nope;"></item></questestinterop>`,
+		"mismatched tags":  `<questestinterop><item></section></questestinterop>`,
+	} {
+		if quizzes, _, err := ParseQTI12([]byte(data)); err == nil {
+			t.Errorf("%s: ParseQTI12 = %v, want an error", name, quizzes)
+		}
+	}
+
+	// A document without items is not an error, just empty.
+	quizzes, warnings, err := ParseQTI12([]byte(`<questestinterop/>`))
+	if err != nil || len(quizzes) != 0 || len(warnings) != 0 {
+		t.Errorf("empty document = %v, %v, %v", quizzes, warnings, err)
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"plain", "plain"},
+		{"<p>Hello <b>world</b></p>", "Hello world"},
+		{"a &amp; b &lt;c&gt;", "a & b <c>"},
+		{"  spaced\n\tout  ", "spaced out"},
+		{"x<br/>y", "x y"},
+	}
+	for _, tt := range tests {
+		if got := PlainText(tt.in); got != tt.want {
+			t.Errorf("PlainText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
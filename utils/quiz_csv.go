@@ -0,0 +1,219 @@
+package utils
+
+import (
+	"backend-elearning/questions"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Quiz CSV has a header row naming its columns: type, question, options,
+// answer, points and explanation; only question and answer are required.
+// Lists are separated by "|" and pairs written as key=value; a backslash
+// escapes either character. Per type:
+//
+//	single_choice    options A|B|C, answer B (the type when left empty)
+//	multiple_select  options A|B|C, answer A|C
+//	true_false       answer true or false
+//	numeric          answer 9.81, or 9.81:0.05 with a tolerance
+//	short_text       answer Jakarta|DKI Jakarta
+//	ordering         options as shown, answer in the correct order
+//	matching         answer prompt=choice|prompt=choice, options all choices
+//	                 including distractors (the answer's when left empty)
+//	essay            answer 10, or the rubric Clarity=4|Argument=6
+
+var quizCSVColumns = []string{"type", "question", "options", "answer", "points", "explanation"}
+
+// ParseQuizCSV reads a quiz CSV file.
+func ParseQuizCSV(data []byte) ([]QuizFileRow, error) {
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	r.FieldsPerRecord = -1
+
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, errors.New("the file is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	col := make(map[string]int)
+	for i, name := range header {
+		col[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"question", "answer"} {
+		if _, ok := col[name]; !ok {
+			return nil, fmt.Errorf("the header has no %q column (columns: %s)", name, strings.Join(quizCSVColumns, ", "))
+		}
+	}
+
+	var rows []QuizFileRow
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		line, _ := r.FieldPos(0)
+		field := func(name string) string {
+			if i, ok := col[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue // baris kosong
+		}
+
+		row := QuizFileRow{Line: line}
+		row.Item, err = quizFromCSV(field)
+		if err != nil {
+			row.Error = err.Error()
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func quizFromCSV(field func(string) string) (QuizItem, error) {
+	item := QuizItem{Explanation: field("explanation")}
+	if s := field("points"); s != "" {
+		points, err := parseDecimal(s)
+		if err != nil {
+			return item, fmt.Errorf("points: %v", err)
+		}
+		item.Points = points
+	}
+
+	typ := strings.ToLower(field("type"))
+	if typ == "" {
+		typ = questions.SingleChoice
+	}
+	if _, err := questions.Lookup(typ); err != nil {
+		return item, err
+	}
+	options, answer := field("options"), field("answer")
+
+	var p quizParts
+	if options != "" {
+		p.Options = splitEscaped(options, '|')
+	}
+	switch typ {
+	case questions.SingleChoice, questions.TrueFalse:
+		p.Correct = []string{unescape(answer)}
+		if typ == questions.TrueFalse {
+			p.Correct[0] = strings.ToLower(p.Correct[0])
+			if p.Correct[0] != "true" && p.Correct[0] != "false" {
+				return item, errors.New("answer must be true or false")
+			}
+		}
+	case questions.MultipleSelect, questions.Ordering, questions.ShortText:
+		if answer != "" {
+			p.Correct = splitEscaped(answer, '|')
+		}
+	case questions.Numeric:
+		var err error
+		parts := splitEscapedOnce(answer, ':')
+		if p.Value, err = parseDecimal(parts[0]); err != nil {
+			return item, fmt.Errorf("answer: %v", err)
+		}
+		if len(parts) == 2 {
+			if p.Tolerance, err = parseDecimal(parts[1]); err != nil {
+				return item, fmt.Errorf("answer tolerance: %v", err)
+			}
+		}
+	case questions.Matching:
+		var choices []string
+		for _, pair := range splitRaw(answer, '|') {
+			kv := splitEscapedOnce(pair, '=')
+			if len(kv) != 2 {
+				return item, fmt.Errorf("answer pair %q must be written prompt=choice", strings.TrimSpace(unescape(pair)))
+			}
+			p.Prompts = append(p.Prompts, kv[0])
+			p.Correct = append(p.Correct, kv[1])
+			if !containsText(choices, kv[1]) {
+				choices = append(choices, kv[1])
+			}
+		}
+		if len(p.Options) == 0 {
+			p.Options = choices
+		}
+	case questions.Essay:
+		var err error
+		if p.Rubric, err = parseRubric(answer); err != nil {
+			return item, err
+		}
+	}
+	item.Definition = joinQuiz(typ, field("question"), p)
+	return item, nil
+}
+
+// WriteQuizCSV writes items as a quiz CSV file.
+func WriteQuizCSV(w io.Writer, items []QuizItem) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(quizCSVColumns); err != nil {
+		return err
+	}
+	for _, item := range items {
+		p, err := splitQuiz(item.Definition)
+		if err != nil {
+			return err
+		}
+		typ := item.Type
+		if typ == "" {
+			typ = questions.SingleChoice
+		}
+
+		list := func(values []string) string {
+			escaped := make([]string, len(values))
+			for i, v := range values {
+				escaped[i] = escapeChars(v, "|=")
+			}
+			return strings.Join(escaped, "|")
+		}
+		var options, answer string
+		switch typ {
+		case questions.SingleChoice, questions.TrueFalse:
+			options = list(p.Options)
+			answer = escapeChars(p.Correct[0], "|=")
+		case questions.MultipleSelect, questions.Ordering, questions.ShortText:
+			options, answer = list(p.Options), list(p.Correct)
+		case questions.Numeric:
+			answer = formatDecimal(p.Value)
+			if p.Tolerance > 0 {
+				answer += ":" + formatDecimal(p.Tolerance)
+			}
+		case questions.Matching:
+			pairs := make([]string, len(p.Prompts))
+			for i, prompt := range p.Prompts {
+				pairs[i] = escapeChars(prompt, "|=") + "=" + escapeChars(p.Correct[i], "|=")
+			}
+			options, answer = list(p.Options), strings.Join(pairs, "|")
+		case questions.Essay:
+			answer = formatRubric(p.Rubric)
+		}
+
+		points := ""
+		if item.Points != 0 && item.Points != 1 {
+			points = formatDecimal(item.Points)
+		}
+		if err := cw.Write([]string{typ, item.Question, options, answer, points, item.Explanation}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func containsText(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
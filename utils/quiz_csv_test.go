@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseQuizCSV(t *testing.T) {
+	data := "\xef\xbb\xbfQuestion,Answer,Options,Type,Points,Explanation\n" +
+		"2+2?,4,3|4|5,,,\n" +
+		"\n" +
+		",,,,,\n" +
+		"Primes?,2|3,2|3|4,multiple_select,1.5,\n" +
+		"Sky is green?,FALSE,,true_false,,\n" +
+		"g?,\"9,81:0,05\",,numeric,,\n" +
+		"France?,Paris|paris,,short_text,,\n" +
+		"Sort,a|b|c,c|a|b,ordering,,\n" +
+		"Sounds,cat=meow|dog=woof,,matching,,\n" +
+		"Essay,Clarity=4|Argument=6,,essay,,\"Multi-line,\nexplanation\"\n" +
+		"Short essay,10,,essay,,\n" +
+		"Escaped,a\\|b,a\\|b|c,,,\n"
+
+	rows, err := ParseQuizCSV([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		line            int
+		typ             string
+		options, answer string
+	}{
+		{2, "single_choice", `["3","4","5"]`, `4`},
+		{5, "multiple_select", `["2","3","4"]`, `["2","3"]`},
+		{6, "true_false", `["true","false"]`, `false`},
+		{7, "numeric", `[]`, `{"value":9.81,"tolerance":0.05}`},
+		{8, "short_text", `[]`, `["Paris","paris"]`},
+		{9, "ordering", `["c","a","b"]`, `["a","b","c"]`},
+		{10, "matching", `{"prompts":["cat","dog"],"choices":["meow","woof"]}`, `{"cat":"meow","dog":"woof"}`},
+		{11, "essay", `[]`, `[{"criterion":"Clarity","points":4},{"criterion":"Argument","points":6}]`},
+		{13, "essay", `[]`, `[{"criterion":"Overall","points":10}]`},
+		{14, "single_choice", `["a|b","c"]`, `a|b`},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("rows = %d, want %d: %+v", len(rows), len(want), rows)
+	}
+	for i, w := range want {
+		row := rows[i]
+		if row.Error != "" {
+			t.Errorf("line %d: %s", row.Line, row.Error)
+			continue
+		}
+		options, answer, err := row.Item.Definition.Validate()
+		if row.Line != w.line || row.Item.Type != w.typ || options != w.options || answer != w.answer || err != nil {
+			t.Errorf("row %d = line %d %s %s %s %v; want line %d %s %s %s", i, row.Line, row.Item.Type, options, answer, err, w.line, w.typ, w.options, w.answer)
+		}
+	}
+	if rows[1].Item.Points != 1.5 {
+		t.Errorf("points = %v, want 1.5", rows[1].Item.Points)
+	}
+	if rows[7].Item.Explanation != "Multi-line,\nexplanation" {
+		t.Errorf("explanation = %q", rows[7].Item.Explanation)
+	}
+}
+
+func TestParseQuizCSVRowErrors(t *testing.T) {
+	tests := []struct {
+		row  string
+		want string
+	}{
+		{"Q,x,a|b,crossword,", `unknown question type "crossword"`},
+		{"Q,maybe,,true_false,", "answer must be true or false"},
+		{"Q,ten,,numeric,", "answer:"},
+		{"Q,10:wide,,numeric,", "answer tolerance:"},
+		{"Q,cat|dog=woof,,matching,", `answer pair "cat" must be written prompt=choice`},
+		{"Q,Clarity|Argument=6,,essay,", `rubric criterion "Clarity" needs its points`},
+		{"Q,Clarity=lots,,essay,", `rubric criterion "Clarity"`},
+		{"Q,a,a|b,,many", "points:"},
+	}
+	for _, tt := range tests {
+		rows, err := ParseQuizCSV([]byte("question,answer,options,type,points\n" + tt.row + "\n"))
+		if err != nil {
+			t.Errorf("%s: %v", tt.row, err)
+			continue
+		}
+		if len(rows) != 1 || !strings.Contains(rows[0].Error, tt.want) {
+			t.Errorf("%s: rows = %+v, want an error containing %q", tt.row, rows, tt.want)
+		}
+	}
+}
+
+func TestParseQuizCSVMalformed(t *testing.T) {
+	tests := []struct {
+		name, data, want string
+	}{
+		{"empty", "", "the file is empty"},
+		{"no answer column", "question,options\nQ,a|b\n", `the header has no "answer" column`},
+		{"no question column", "type,answer\n,a\n", `the header has no "question" column`},
+		{"bad quote in header", "question,\"answer\nQ,a\n", "invalid CSV"},
+		{"bad quote in row", "question,answer\nQ,a\"b\n", "invalid CSV"},
+	}
+	for _, tt := range tests {
+		rows, err := ParseQuizCSV([]byte(tt.data))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: ParseQuizCSV = %+v, %v; want an error containing %q", tt.name, rows, err, tt.want)
+		}
+	}
+}
+
+func TestWriteQuizCSVColumns(t *testing.T) {
+	var b strings.Builder
+	if err := WriteQuizCSV(&b, sampleQuizItems()[:1]); err != nil {
+		t.Fatal(err)
+	}
+	want := "type,question,options,answer,points,explanation\nsingle_choice,Ibu kota Indonesia?,Jakarta|Bandung|Surabaya,Jakarta,2,Sejak 1961.\n"
+	if b.String() != want {
+		t.Errorf("WriteQuizCSV =\n%s\nwant\n%s", b.String(), want)
+	}
+}
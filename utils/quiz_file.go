@@ -0,0 +1,309 @@
+package utils
+
+import (
+	"backend-elearning/questions"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Quiz files hold a module's questions outside the app: CSV for
+// spreadsheets, Moodle GIFT and QTI 2.1.
+const (
+	QuizCSV  = "csv"
+	QuizGIFT = "gift"
+	QuizQTI  = "qti"
+)
+
+// QuizItem is one question of a quiz file.
+type QuizItem struct {
+	questions.Definition
+	Points      float64 `json:"points,omitempty"` // weight; 0 means 1
+	Explanation string  `json:"explanation,omitempty"`
+}
+
+// QuizFileRow is a question read from a quiz file. Line is where it
+// starts: the line for CSV and GIFT, the item number for QTI. Error says
+// why the question could not be read.
+type QuizFileRow struct {
+	Line  int
+	Item  QuizItem
+	Error string
+}
+
+// QuizFormat returns the format called name or, when name is empty, the
+// one the file name suggests.
+func QuizFormat(name, filename string) (string, error) {
+	switch name = strings.ToLower(strings.TrimSpace(name)); name {
+	case QuizCSV, QuizGIFT, QuizQTI:
+		return name, nil
+	case "":
+	default:
+		return "", fmt.Errorf("unknown quiz format %q (use csv, gift or qti)", name)
+	}
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".csv":
+		return QuizCSV, nil
+	case ".gift", ".txt":
+		return QuizGIFT, nil
+	case ".xml", ".zip":
+		return QuizQTI, nil
+	}
+	return "", errors.New("cannot tell the format from the file name; send format csv, gift or qti")
+}
+
+// QuizFileType returns the content type and file extension of format.
+func QuizFileType(format string) (string, string) {
+	switch format {
+	case QuizCSV:
+		return "text/csv; charset=utf-8", ".csv"
+	case QuizGIFT:
+		return "text/plain; charset=utf-8", ".gift"
+	}
+	return "application/zip", ".zip"
+}
+
+// ParseQuizFile reads the questions of a quiz file. Questions it cannot
+// read are returned with their Error set; the error is only for files that
+// cannot be read at all.
+func ParseQuizFile(format string, data []byte) ([]QuizFileRow, error) {
+	switch format {
+	case QuizCSV:
+		return ParseQuizCSV(data)
+	case QuizGIFT:
+		return ParseGIFT(data), nil
+	case QuizQTI:
+		return ParseQTI21(data)
+	}
+	return nil, fmt.Errorf("unknown quiz format %q", format)
+}
+
+// WriteQuizFile writes items to w in format.
+func WriteQuizFile(w io.Writer, format string, items []QuizItem) error {
+	switch format {
+	case QuizCSV:
+		return WriteQuizCSV(w, items)
+	case QuizGIFT:
+		return WriteGIFT(w, items)
+	case QuizQTI:
+		return WriteQTI21(w, items)
+	}
+	return fmt.Errorf("unknown quiz format %q", format)
+}
+
+// quizParts is a question taken apart into what the file formats write.
+// Correct holds the correct options, the accepted texts, the items in
+// their right order, "true" or "false", or for matching the choice of
+// each prompt.
+type quizParts struct {
+	Options   []string // choices; the items of an ordering question
+	Correct   []string
+	Prompts   []string // matching
+	Value     float64  // numeric
+	Tolerance float64
+	Rubric    questions.Rubric // essay
+}
+
+// splitQuiz takes a stored question apart. def must be valid.
+func splitQuiz(def questions.Definition) (quizParts, error) {
+	var p quizParts
+	var err error
+	switch def.Type {
+	case "", questions.SingleChoice:
+		var answer string
+		if err = json.Unmarshal(def.Options, &p.Options); err == nil {
+			err = json.Unmarshal(def.Answer, &answer)
+		}
+		p.Correct = []string{answer}
+	case questions.MultipleSelect, questions.Ordering:
+		if err = json.Unmarshal(def.Options, &p.Options); err == nil {
+			err = json.Unmarshal(def.Answer, &p.Correct)
+		}
+	case questions.TrueFalse:
+		var b bool
+		err = json.Unmarshal(def.Answer, &b)
+		p.Correct = []string{strconv.FormatBool(b)}
+	case questions.Numeric:
+		var a struct {
+			Value     float64 `json:"value"`
+			Tolerance float64 `json:"tolerance"`
+		}
+		err = json.Unmarshal(def.Answer, &a)
+		p.Value, p.Tolerance = a.Value, a.Tolerance
+	case questions.ShortText:
+		err = json.Unmarshal(def.Answer, &p.Correct)
+	case questions.Matching:
+		var o struct {
+			Prompts []string `json:"prompts"`
+			Choices []string `json:"choices"`
+		}
+		var a map[string]string
+		if err = json.Unmarshal(def.Options, &o); err == nil {
+			err = json.Unmarshal(def.Answer, &a)
+		}
+		p.Prompts, p.Options = o.Prompts, o.Choices
+		for _, prompt := range o.Prompts {
+			p.Correct = append(p.Correct, a[prompt])
+		}
+	case questions.Essay:
+		err = json.Unmarshal(def.Answer, &p.Rubric)
+	default:
+		err = fmt.Errorf("unknown question type %q", def.Type)
+	}
+	return p, err
+}
+
+// joinQuiz puts a question back together in the form the quiz API takes.
+func joinQuiz(typ, question string, p quizParts) questions.Definition {
+	def := questions.Definition{Type: typ, Question: question}
+	var options, answer interface{}
+	switch typ {
+	case questions.SingleChoice:
+		options = p.Options
+		if len(p.Correct) > 0 {
+			answer = p.Correct[0]
+		}
+	case questions.MultipleSelect, questions.Ordering:
+		options, answer = p.Options, p.Correct
+	case questions.TrueFalse:
+		answer = len(p.Correct) > 0 && p.Correct[0] == "true"
+	case questions.Numeric:
+		answer = map[string]float64{"value": p.Value, "tolerance": p.Tolerance}
+	case questions.ShortText:
+		answer = p.Correct
+	case questions.Matching:
+		options = map[string][]string{"prompts": p.Prompts, "choices": p.Options}
+		pairs := make(map[string]string, len(p.Prompts))
+		for i, prompt := range p.Prompts {
+			if i < len(p.Correct) {
+				pairs[prompt] = p.Correct[i]
+			}
+		}
+		answer = pairs
+	case questions.Essay:
+		answer = p.Rubric
+	}
+	if options != nil {
+		def.Options, _ = json.Marshal(options)
+	}
+	def.Answer, _ = json.Marshal(answer)
+	return def
+}
+
+// parseDecimal reads a number written as 3.5 or 3,5.
+func parseDecimal(s string) (float64, error) {
+	f, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(s), ",", "."), 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("%q is not a number", s)
+	}
+	return f, nil
+}
+
+func formatDecimal(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// splitRaw splits s at each sep not preceded by a backslash, keeping the
+// escapes.
+func splitRaw(s string, sep rune) []string {
+	var parts []string
+	escaped, from := false, 0
+	for i, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == sep:
+			parts = append(parts, s[from:i])
+			from = i + len(string(r))
+		}
+	}
+	return append(parts, s[from:])
+}
+
+// splitEscaped splits s at each unescaped sep and resolves the escapes.
+// Parts are trimmed.
+func splitEscaped(s string, sep rune) []string {
+	parts := splitRaw(s, sep)
+	for i := range parts {
+		parts[i] = strings.TrimSpace(unescape(parts[i]))
+	}
+	return parts
+}
+
+// unescape drops the backslash before escaped characters.
+func unescape(s string) string {
+	var b strings.Builder
+	escaped := false
+	for _, r := range s {
+		if r == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// escapeChars puts a backslash before every character of chars in s.
+func escapeChars(s, chars string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r == '\\' || strings.ContainsRune(chars, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// parseRubric reads "Clarity=4|Argument=6", or just the points of one
+// overall criterion.
+func parseRubric(s string) (questions.Rubric, error) {
+	if points, err := parseDecimal(s); err == nil {
+		return questions.Rubric{{Criterion: "Overall", Points: points}}, nil
+	}
+	var rubric questions.Rubric
+	for _, part := range splitRaw(s, '|') {
+		kv := splitEscapedOnce(part, '=')
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("rubric criterion %q needs its points, as criterion=points", part)
+		}
+		points, err := parseDecimal(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("rubric criterion %q: %v", kv[0], err)
+		}
+		rubric = append(rubric, questions.Criterion{Criterion: kv[0], Points: points})
+	}
+	return rubric, nil
+}
+
+func formatRubric(rubric questions.Rubric) string {
+	if len(rubric) == 1 && rubric[0].Criterion == "Overall" {
+		return formatDecimal(rubric[0].Points)
+	}
+	parts := make([]string, len(rubric))
+	for i, c := range rubric {
+		parts[i] = escapeChars(c.Criterion, "|=") + "=" + formatDecimal(c.Points)
+	}
+	return strings.Join(parts, "|")
+}
+
+// splitEscapedOnce splits s at the first unescaped sep.
+func splitEscapedOnce(s string, sep rune) []string {
+	parts := splitRaw(s, sep)
+	if len(parts) > 2 {
+		parts = []string{parts[0], strings.Join(parts[1:], string(sep))}
+	}
+	for i := range parts {
+		parts[i] = strings.TrimSpace(unescape(parts[i]))
+	}
+	return parts
+}
@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"backend-elearning/questions"
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func quizItem(typ, question, options, answer string) QuizItem {
+	def := questions.Definition{Type: typ, Question: question, Answer: json.RawMessage(answer)}
+	if options != "" {
+		def.Options = json.RawMessage(options)
+	}
+	return QuizItem{Definition: def}
+}
+
+// sampleQuizItems has one question of every type, with the characters each
+// format has to escape.
+func sampleQuizItems() []QuizItem {
+	items := []QuizItem{
+		quizItem(questions.SingleChoice, "Ibu kota Indonesia?", `["Jakarta","Bandung","Surabaya"]`, `"Jakarta"`),
+		quizItem(questions.MultipleSelect, "Which are {prime}?", `["2","3","4","9 = 3^2"]`, `["2","3"]`),
+		quizItem(questions.TrueFalse, "The sky is green.", "", `false`),
+		quizItem(questions.Numeric, "g in m/s²?", "", `{"value":9.81,"tolerance":0.05}`),
+		quizItem(questions.Numeric, "How many legs?", "", `{"value":4,"tolerance":0}`),
+		quizItem(questions.ShortText, "Capital of France?", "", `["Paris","paris, France"]`),
+		quizItem(questions.Ordering, "Sort ascending", `["3","1","2"]`, `["1","2","3"]`),
+		quizItem(questions.Matching, "Match the sounds", `{"prompts":["cat","dog"],"choices":["meow","woof","moo"]}`, `{"cat":"meow","dog":"woof"}`),
+		quizItem(questions.Essay, "Discuss: a|b = c?\nUse two paragraphs.", "", `[{"criterion":"Clarity","points":4},{"criterion":"Argument","points":6}]`),
+		quizItem(questions.Essay, "Describe your weekend.", "", `[{"criterion":"Overall","points":5}]`),
+		quizItem("", "Pick one ~ or # <&>", `["a ~ b","c # d","e <&> f"]`, `"c # d"`),
+	}
+	items[0].Points = 2
+	items[0].Explanation = "Sejak 1961."
+	items[3].Points = 0.5
+	items[7].Explanation = "Animals make sounds: <loud> & clear."
+	return items
+}
+
+// storedForm validates def the way the quiz API does, so questions that
+// differ only in how they were written compare equal.
+func storedForm(t *testing.T, item QuizItem) [5]string {
+	t.Helper()
+	options, answer, err := item.Definition.Validate()
+	if err != nil {
+		t.Fatalf("%q does not validate: %v", item.Question, err)
+	}
+	typ := item.Type
+	if typ == "" {
+		typ = questions.SingleChoice
+	}
+	points := item.Points
+	if points == 0 {
+		points = 1
+	}
+	return [5]string{typ + ": " + item.Question, options, answer, formatDecimal(points), item.Explanation}
+}
+
+func TestQuizFileRoundTrip(t *testing.T) {
+	for _, format := range []string{QuizCSV, QuizGIFT, QuizQTI} {
+		items := sampleQuizItems()
+		var buf bytes.Buffer
+		if err := WriteQuizFile(&buf, format, items); err != nil {
+			t.Fatalf("%s: WriteQuizFile: %v", format, err)
+		}
+		rows, err := ParseQuizFile(format, buf.Bytes())
+		if err != nil {
+			t.Fatalf("%s: ParseQuizFile: %v", format, err)
+		}
+
+		var want []QuizItem
+		for _, item := range items {
+			if format == QuizGIFT && item.Type == questions.Ordering {
+				continue // GIFT has no ordering questions
+			}
+			want = append(want, item)
+		}
+		if len(rows) != len(want) {
+			t.Fatalf("%s: read %d questions, wrote %d\n%s", format, len(rows), len(want), buf.String())
+		}
+		for i, row := range rows {
+			if row.Error != "" {
+				t.Errorf("%s: question %d: %s", format, i+1, row.Error)
+				continue
+			}
+			if got, exp := storedForm(t, row.Item), storedForm(t, want[i]); got != exp {
+				t.Errorf("%s: question %d\n got %q\nwant %q", format, i+1, got, exp)
+			}
+		}
+	}
+}
+
+func TestQuizFileUnknownFormat(t *testing.T) {
+	if err := WriteQuizFile(&bytes.Buffer{}, "docx", sampleQuizItems()); err == nil {
+		t.Error("WriteQuizFile accepted an unknown format")
+	}
+	if _, err := ParseQuizFile("docx", []byte("x")); err == nil {
+		t.Error("ParseQuizFile accepted an unknown format")
+	}
+}
+
+func TestQuizFormat(t *testing.T) {
+	tests := []struct {
+		name, filename string
+		want           string
+		wantErr        bool
+	}{
+		{"csv", "anything.xml", QuizCSV, false},
+		{" GIFT ", "", QuizGIFT, false},
+		{"", "week1.CSV", QuizCSV, false},
+		{"", "bank.gift", QuizGIFT, false},
+		{"", "bank.txt", QuizGIFT, false},
+		{"", "export.zip", QuizQTI, false},
+		{"", "item.xml", QuizQTI, false},
+		{"", "quiz.docx", "", true},
+		{"", "", "", true},
+		{"xlsx", "quiz.csv", "", true},
+	}
+	for _, tt := range tests {
+		got, err := QuizFormat(tt.name, tt.filename)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("QuizFormat(%q, %q) = %q, %v", tt.name, tt.filename, got, err)
+		}
+	}
+}
+
+func TestSplitEscaped(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"a|b|c", []string{"a", "b", "c"}},
+		{` a | b `, []string{"a", "b"}},
+		{`a\|b|c`, []string{"a|b", "c"}},
+		{`a\\|b`, []string{`a\`, "b"}},
+		{"", []string{""}},
+	}
+	for _, tt := range tests {
+		got := splitEscaped(tt.in, '|')
+		if len(got) != len(tt.want) {
+			t.Errorf("splitEscaped(%q) = %q, want %q", tt.in, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("splitEscaped(%q) = %q, want %q", tt.in, got, tt.want)
+				break
+			}
+		}
+	}
+	if got := unescape(escapeChars(`x|y=z\w`, "|=")); got != `x|y=z\w` {
+		t.Errorf("unescape(escapeChars) = %q", got)
+	}
+}
@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSigningKey = "0123456789abcdef0123456789abcdef"
+
+func signedParams(t *testing.T, resource string, userID uint, expires time.Time) url.Values {
+	t.Helper()
+	link, err := SignURL("/api/files/"+resource, resource, userID, expires)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, query, _ := strings.Cut(link, "?")
+	if path != "/api/files/"+resource {
+		t.Fatalf("SignURL path = %q", path)
+	}
+	q, err := url.ParseQuery(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+func TestSignedURL(t *testing.T) {
+	t.Setenv("URL_SIGNING_KEY", testSigningKey)
+	q := signedParams(t, "module-pdf/12", 7, time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name               string
+		resource, uid, exp string
+		sig                string
+		want               error
+	}{
+		{"valid", "module-pdf/12", q.Get("uid"), q.Get("exp"), q.Get("sig"), nil},
+		{"other resource", "module-pdf/13", q.Get("uid"), q.Get("exp"), q.Get("sig"), ErrSignatureInvalid},
+		{"other user", "module-pdf/12", "8", q.Get("exp"), q.Get("sig"), ErrSignatureInvalid},
+		{"extended expiry", "module-pdf/12", q.Get("uid"), "99999999999", q.Get("sig"), ErrSignatureInvalid},
+		{"tampered signature", "module-pdf/12", q.Get("uid"), q.Get("exp"), q.Get("sig")[1:], ErrSignatureInvalid},
+		{"missing signature", "module-pdf/12", q.Get("uid"), q.Get("exp"), "", ErrSignatureInvalid},
+		{"bad uid", "module-pdf/12", "seven", q.Get("exp"), q.Get("sig"), ErrSignatureInvalid},
+		{"bad exp", "module-pdf/12", q.Get("uid"), "soon", q.Get("sig"), ErrSignatureInvalid},
+	}
+	for _, tt := range tests {
+		uid, err := VerifySignedURL(tt.resource, tt.uid, tt.exp, tt.sig)
+		if err != tt.want {
+			t.Errorf("%s: VerifySignedURL = %v, want %v", tt.name, err, tt.want)
+			continue
+		}
+		if err == nil && uid != 7 {
+			t.Errorf("%s: uid = %d, want 7", tt.name, uid)
+		}
+	}
+}
+
+func TestSignedURLExpiry(t *testing.T) {
+	t.Setenv("URL_SIGNING_KEY", testSigningKey)
+
+	expired := signedParams(t, "module-pdf/12", 7, time.Now().Add(-time.Second))
+	if _, err := VerifySignedURL("module-pdf/12", expired.Get("uid"), expired.Get("exp"), expired.Get("sig")); err != ErrSignatureExpired {
+		t.Errorf("expired link: %v, want ErrSignatureExpired", err)
+	}
+
+	// A link is still good during the second it expires.
+	now := signedParams(t, "module-pdf/12", 7, time.Now().Add(2*time.Second))
+	if _, err := VerifySignedURL("module-pdf/12", now.Get("uid"), now.Get("exp"), now.Get("sig")); err != nil {
+		t.Errorf("link expiring shortly: %v", err)
+	}
+
+	// A forged signature on an expired link is reported as invalid, not
+	// expired, so the error does not reveal which links were once valid.
+	if _, err := VerifySignedURL("module-pdf/12", expired.Get("uid"), expired.Get("exp"), "forged"); err != ErrSignatureInvalid {
+		t.Errorf("forged expired link: %v, want ErrSignatureInvalid", err)
+	}
+}
+
+func TestSignedURLKey(t *testing.T) {
+	t.Setenv("URL_SIGNING_KEY", "")
+	t.Setenv("PASETO_SECRET_KEY", "")
+	if _, err := SignURL("/x", "x", 1, time.Now().Add(time.Hour)); err == nil {
+		t.Error("SignURL without a key succeeded")
+	}
+
+	t.Setenv("URL_SIGNING_KEY", "too-short")
+	if _, err := SignURL("/x", "x", 1, time.Now().Add(time.Hour)); err == nil {
+		t.Error("SignURL with a short URL_SIGNING_KEY succeeded")
+	}
+
+	// Links signed with the key derived from PASETO_SECRET_KEY stop working
+	// once a different URL_SIGNING_KEY is configured.
+	t.Setenv("URL_SIGNING_KEY", "")
+	t.Setenv("PASETO_SECRET_KEY", testSigningKey)
+	q := signedParams(t, "x", 1, time.Now().Add(time.Hour))
+	if _, err := VerifySignedURL("x", q.Get("uid"), q.Get("exp"), q.Get("sig")); err != nil {
+		t.Errorf("derived key: %v", err)
+	}
+	t.Setenv("URL_SIGNING_KEY", strings.Repeat("k", 32))
+	if _, err := VerifySignedURL("x", q.Get("uid"), q.Get("exp"), q.Get("sig")); err != ErrSignatureInvalid {
+		t.Errorf("after key change: %v, want ErrSignatureInvalid", err)
+	}
+}